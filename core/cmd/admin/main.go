@@ -11,11 +11,12 @@ import (
 	"github.com/luketaylor45/atlas/core/internal/config"
 	"github.com/luketaylor45/atlas/core/internal/database"
 	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
-	cmd := flag.String("action", "create", "Actions: create, reset-password")
+	cmd := flag.String("action", "create", "Actions: create, reset-password, reset-2fa")
 	flag.Parse()
 
 	config.LoadConfig()
@@ -64,9 +65,28 @@ func main() {
 		user.Password = string(hashedPassword)
 
 		database.DB.Save(&user)
+		utils.RevokeUserSessions(user.ID)
 		fmt.Printf("Successfully reset password for %s\n", username)
 
+	case "reset-2fa":
+		fmt.Print("Enter Username to Reset 2FA: ")
+		username, _ := reader.ReadString('\n')
+		username = strings.TrimSpace(username)
+
+		var user models.User
+		if err := database.DB.Where("LOWER(username) = LOWER(?)", username).First(&user).Error; err != nil {
+			log.Fatalf("User not found: %s", username)
+		}
+
+		database.DB.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+			"recovery_codes": "",
+		})
+		fmt.Printf("Successfully disabled two-factor authentication for %s\n", username)
+
 	default:
-		fmt.Println("Invalid action. Use -action=create or -action=reset-password")
+		fmt.Println("Invalid action. Use -action=create, -action=reset-password or -action=reset-2fa")
 	}
 }
@@ -17,6 +17,9 @@ func main() {
 	// 1. Drop Tables in Order
 	log.Println("Deleting Database Tables...")
 	tables := []interface{}{
+		&models.SSHKey{},
+		&models.Session{},
+		&models.APIKey{},
 		&models.Service{},
 		&models.EggVariable{},
 		&models.Egg{},
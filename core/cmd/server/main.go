@@ -17,7 +17,10 @@ func main() {
 	database.Connect()
 
 	// Auto Migrate
-	database.DB.AutoMigrate(&models.User{}, &models.Node{}, &models.Nest{}, &models.Egg{}, &models.EggVariable{}, &models.Service{}, &models.ServiceUser{}, &models.ActivityLog{}, &models.News{})
+	database.DB.AutoMigrate(&models.User{}, &models.Location{}, &models.Node{}, &models.Nest{}, &models.Egg{}, &models.EggVariable{}, &models.Service{}, &models.ServiceUser{}, &models.ActivityLog{}, &models.News{}, &models.APIKey{}, &models.Session{}, &models.SSHKey{}, &models.DatabaseHost{}, &models.ServiceDatabase{}, &models.UserQuota{})
+	database.MigrateNodeTokens()
+	database.MigrateNodeLocations()
+	database.MigrateDatabasePasswords()
 
 	// Seed basic data (Nests/Categories)
 	//database.SeedDefaults()
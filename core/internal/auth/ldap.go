@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LDAPConfig holds the directory settings, see the LDAP_* options in config
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	UsernameAttribute  string
+	EmailAttribute     string
+	GroupAttribute     string
+	GroupBaseDN        string
+	GroupFilter        string
+	AdminGroups        []string
+	AutoProvision      bool
+	Timeout            time.Duration
+}
+
+// LDAPConfigFromApp reads the LDAP settings from the app config
+func LDAPConfigFromApp() LDAPConfig {
+	cfg := config.AppConfig
+	var adminGroups []string
+	for _, group := range strings.Split(cfg.LDAPAdminGroups, ";") {
+		if group = strings.TrimSpace(group); group != "" {
+			adminGroups = append(adminGroups, group)
+		}
+	}
+
+	return LDAPConfig{
+		URL:                cfg.LDAPURL,
+		StartTLS:           cfg.LDAPStartTLS,
+		InsecureSkipVerify: cfg.LDAPInsecureSkipVerify,
+		BindDN:             cfg.LDAPBindDN,
+		BindPassword:       cfg.LDAPBindPassword,
+		BaseDN:             cfg.LDAPBaseDN,
+		UserFilter:         cfg.LDAPUserFilter,
+		UsernameAttribute:  cfg.LDAPUsernameAttribute,
+		EmailAttribute:     cfg.LDAPEmailAttribute,
+		GroupAttribute:     cfg.LDAPGroupAttribute,
+		GroupBaseDN:        cfg.LDAPGroupBaseDN,
+		GroupFilter:        cfg.LDAPGroupFilter,
+		AdminGroups:        adminGroups,
+		AutoProvision:      cfg.LDAPAutoProvision,
+		Timeout:            cfg.LDAPTimeout,
+	}
+}
+
+// LDAPConn is the part of *ldap.Conn the provider uses, so a stub directory can stand in for it
+type LDAPConn interface {
+	StartTLS(config *tls.Config) error
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// DirectoryUser is what the directory told us about a user whose password checked out
+type DirectoryUser struct {
+	DN       string
+	Username string
+	Email    string
+	Groups   []string
+	IsAdmin  *bool // nil when no admin groups are configured
+}
+
+// LDAPProvider checks passwords against an LDAP or Active Directory server
+type LDAPProvider struct {
+	cfg  LDAPConfig
+	dial func() (LDAPConn, error)
+}
+
+// NewLDAPProvider returns a provider that connects to cfg.URL for every login
+func NewLDAPProvider(cfg LDAPConfig) *LDAPProvider {
+	p := &LDAPProvider{cfg: cfg}
+	p.dial = func() (LDAPConn, error) {
+		conn, err := ldap.DialURL(cfg.URL,
+			ldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout}),
+			ldap.DialWithTLSConfig(p.tlsConfig()))
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Timeout > 0 {
+			conn.SetTimeout(cfg.Timeout)
+		}
+		return conn, nil
+	}
+	return p
+}
+
+// NewLDAPProviderWithDialer is NewLDAPProvider with a custom connection, e.g. an in-process stub
+func NewLDAPProviderWithDialer(cfg LDAPConfig, dial func() (LDAPConn, error)) *LDAPProvider {
+	return &LDAPProvider{cfg: cfg, dial: dial}
+}
+
+func (p *LDAPProvider) Name() string { return models.AuthSourceLDAP }
+
+// Authenticate checks the password with the directory and returns the matching Atlas user,
+// creating it on first login and keeping email and admin rights in sync
+func (p *LDAPProvider) Authenticate(username, password string) (*models.User, error) {
+	entry, err := p.Lookup(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return p.syncUser(entry)
+}
+
+// Lookup finds the user in the directory and binds as them to check the password
+func (p *LDAPProvider) Lookup(username, password string) (*DirectoryUser, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close()
+
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig()); err != nil {
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+	if err := p.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	attributes := []string{p.cfg.UsernameAttribute, p.cfg.EmailAttribute}
+	if p.cfg.GroupAttribute != "" {
+		attributes = append(attributes, p.cfg.GroupAttribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(p.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(p.cfg.UserFilter, "%s", ldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("search user: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, ErrUnknownUser
+	}
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("filter matched more than one entry for %q", username)
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("bind user: %w", err)
+	}
+
+	user := &DirectoryUser{
+		DN:       entry.DN,
+		Username: entry.GetAttributeValue(p.cfg.UsernameAttribute),
+		Email:    entry.GetAttributeValue(p.cfg.EmailAttribute),
+	}
+	if user.Username == "" {
+		user.Username = username
+	}
+	if p.cfg.GroupAttribute != "" {
+		user.Groups = entry.GetAttributeValues(p.cfg.GroupAttribute)
+	}
+
+	// Directories without memberOf are searched for groups listing the user instead
+	if p.cfg.GroupFilter != "" {
+		groups, err := p.searchGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		user.Groups = append(user.Groups, groups...)
+	}
+
+	if len(p.cfg.AdminGroups) > 0 {
+		isAdmin := p.inAdminGroup(user.Groups)
+		user.IsAdmin = &isAdmin
+	}
+	return user, nil
+}
+
+func (p *LDAPProvider) bindService(conn LDAPConn) error {
+	if p.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+		return fmt.Errorf("bind service account: %w", err)
+	}
+	return nil
+}
+
+func (p *LDAPProvider) searchGroups(conn LDAPConn, userDN string) ([]string, error) {
+	// The user's own bind may not be allowed to search, so go back to the service account
+	if err := p.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	baseDN := p.cfg.GroupBaseDN
+	if baseDN == "" {
+		baseDN = p.cfg.BaseDN
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(p.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(p.cfg.GroupFilter, "%s", ldap.EscapeFilter(userDN)),
+		[]string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("search groups: %w", err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+func (p *LDAPProvider) inAdminGroup(groups []string) bool {
+	for _, group := range groups {
+		for _, admin := range p.cfg.AdminGroups {
+			if sameDN(group, admin) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameDN compares DNs ignoring case and spacing around separators
+func sameDN(a, b string) bool {
+	parsedA, errA := ldap.ParseDN(a)
+	parsedB, errB := ldap.ParseDN(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(a, b)
+	}
+	return parsedA.EqualFold(parsedB)
+}
+
+func (p *LDAPProvider) tlsConfig() *tls.Config {
+	serverName := ""
+	if u, err := url.Parse(p.cfg.URL); err == nil {
+		serverName = u.Hostname()
+	}
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: p.cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+}
+
+// syncUser finds or provisions the Atlas user for a directory login
+func (p *LDAPProvider) syncUser(entry *DirectoryUser) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("LOWER(username) = LOWER(?)", entry.Username).First(&user).Error; err != nil {
+		if !p.cfg.AutoProvision {
+			return nil, ErrInvalidCredentials
+		}
+
+		// The local password is never checked for LDAP users
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(utils.RandomString(32)), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		user = models.User{
+			Username:   entry.Username,
+			Password:   string(hashedPassword),
+			Email:      entry.Email,
+			AuthSource: models.AuthSourceLDAP,
+			IsAdmin:    entry.IsAdmin != nil && *entry.IsAdmin,
+		}
+		if err := database.DB.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		utils.LogActivityDirect(0, user.ID, "ldap_provision", "ldap", "Created account from LDAP directory", "")
+		return &user, nil
+	}
+
+	// A local or SSO account with the same name is not taken over by the directory
+	if user.AuthSource != models.AuthSourceLDAP {
+		return nil, ErrInvalidCredentials
+	}
+
+	if entry.Email != "" && entry.Email != user.Email {
+		user.Email = entry.Email
+		database.DB.Model(&user).Update("email", user.Email)
+	}
+	if entry.IsAdmin != nil && *entry.IsAdmin != user.IsAdmin {
+		user.IsAdmin = *entry.IsAdmin
+		if err := database.DB.Model(&user).Update("is_admin", user.IsAdmin).Error; err != nil {
+			return nil, err
+		}
+		utils.RevokeUserSessions(user.ID)
+		utils.LogActivityDirect(0, user.ID, "ldap_admin_sync", "ldap", fmt.Sprintf("Admin rights set to %t from LDAP groups", user.IsAdmin), "")
+	}
+	return &user, nil
+}
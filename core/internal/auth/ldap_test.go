@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+// stubDirectory is an in-process directory. Searches match entries under the base DN that have
+// an attribute equal to a value the filter asks for, which covers the simple filters used here.
+type stubDirectory struct {
+	entries   []*ldap.Entry
+	passwords map[string]string // Keyed by DN
+	dialErr   error
+
+	startTLS bool
+	binds    []string
+	searches []*ldap.SearchRequest
+}
+
+func (d *stubDirectory) dial() (LDAPConn, error) {
+	if d.dialErr != nil {
+		return nil, d.dialErr
+	}
+	return d, nil
+}
+
+func (d *stubDirectory) StartTLS(*tls.Config) error {
+	d.startTLS = true
+	return nil
+}
+
+func (d *stubDirectory) Bind(username, password string) error {
+	d.binds = append(d.binds, username)
+	if want, ok := d.passwords[username]; !ok || want != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	return nil
+}
+
+func (d *stubDirectory) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.searches = append(d.searches, request)
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.DN), strings.ToLower(request.BaseDN)) {
+			continue
+		}
+		if matchesFilter(entry, request.Filter) {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (d *stubDirectory) Close() error { return nil }
+
+func matchesFilter(entry *ldap.Entry, filter string) bool {
+	for _, attribute := range entry.Attributes {
+		for _, value := range attribute.Values {
+			if strings.Contains(filter, "("+attribute.Name+"="+ldap.EscapeFilter(value)+")") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const (
+	serviceDN = "cn=atlas,ou=services,dc=example,dc=com"
+	aliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+	bobDN     = "uid=bob,ou=people,dc=example,dc=com"
+	adminsDN  = "cn=Atlas Admins,ou=groups,dc=example,dc=com"
+)
+
+func newStubDirectory() *stubDirectory {
+	return &stubDirectory{
+		entries: []*ldap.Entry{
+			ldap.NewEntry(aliceDN, map[string][]string{
+				"uid": {"alice"}, "mail": {"alice@example.com"}, "memberOf": {"CN=Atlas Admins, OU=Groups, DC=example, DC=com"},
+			}),
+			ldap.NewEntry(bobDN, map[string][]string{"uid": {"bob"}, "mail": {"bob@example.com"}}),
+			ldap.NewEntry(adminsDN, map[string][]string{"cn": {"Atlas Admins"}, "member": {bobDN}}),
+		},
+		passwords: map[string]string{
+			serviceDN: "service-secret",
+			aliceDN:   "alice-password",
+			bobDN:     "bob-password",
+		},
+	}
+}
+
+func testLDAPConfig() LDAPConfig {
+	return LDAPConfig{
+		URL:               "ldap://directory.example.com",
+		BindDN:            serviceDN,
+		BindPassword:      "service-secret",
+		BaseDN:            "ou=people,dc=example,dc=com",
+		UserFilter:        "(uid=%s)",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+		GroupAttribute:    "memberOf",
+		AdminGroups:       []string{adminsDN},
+	}
+}
+
+func TestLDAPLookup(t *testing.T) {
+	dir := newStubDirectory()
+	p := NewLDAPProviderWithDialer(testLDAPConfig(), dir.dial)
+
+	user, err := p.Lookup("alice", "alice-password")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if user.DN != aliceDN || user.Username != "alice" || user.Email != "alice@example.com" {
+		t.Errorf("user = %+v", user)
+	}
+	if user.IsAdmin == nil || !*user.IsAdmin {
+		t.Error("member of the admin group was not mapped to admin")
+	}
+
+	// The service account searches, then the user's own bind checks the password
+	if len(dir.binds) != 2 || dir.binds[0] != serviceDN || dir.binds[1] != aliceDN {
+		t.Errorf("binds = %v", dir.binds)
+	}
+	if len(dir.searches) != 1 || dir.searches[0].Filter != "(uid=alice)" {
+		t.Errorf("searches = %+v", dir.searches)
+	}
+}
+
+func TestLDAPLookupErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      func(*LDAPConfig)
+		dir      func(*stubDirectory)
+		username string
+		password string
+		want     error  // Checked with errors.Is
+		wantErr  string // Otherwise the error must contain this
+	}{
+		{name: "wrong password", username: "alice", password: "wrong", want: ErrInvalidCredentials},
+		{name: "empty password", username: "alice", password: "", want: ErrInvalidCredentials},
+		{name: "missing user", username: "carol", password: "anything", want: ErrUnknownUser},
+		{name: "filter injection", username: "*)(uid=*", password: "alice-password", want: ErrUnknownUser},
+		{
+			name:     "service bind fails",
+			cfg:      func(cfg *LDAPConfig) { cfg.BindPassword = "rotated" },
+			username: "alice", password: "alice-password",
+			wantErr: "bind service account",
+		},
+		{
+			name:     "directory unreachable",
+			dir:      func(d *stubDirectory) { d.dialErr = errors.New("connection refused") },
+			username: "alice", password: "alice-password",
+			wantErr: "connect",
+		},
+		{
+			name: "ambiguous filter",
+			dir: func(d *stubDirectory) {
+				d.entries = append(d.entries, ldap.NewEntry("uid=alice,ou=contractors,ou=people,dc=example,dc=com", map[string][]string{"uid": {"alice"}}))
+			},
+			username: "alice", password: "alice-password",
+			wantErr: "more than one entry",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testLDAPConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			dir := newStubDirectory()
+			if tt.dir != nil {
+				tt.dir(dir)
+			}
+
+			_, err := NewLDAPProviderWithDialer(cfg, dir.dial).Lookup(tt.username, tt.password)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrUnknownUser) {
+				t.Fatalf("directory failure reported as %v", err)
+			}
+		})
+	}
+}
+
+func TestLDAPAdminMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      func(*LDAPConfig)
+		username string
+		password string
+		want     *bool
+	}{
+		{name: "memberOf names an admin group", username: "alice", password: "alice-password", want: boolPtr(true)},
+		{name: "no admin group", username: "bob", password: "bob-password", want: boolPtr(false)},
+		{
+			name:     "no admin groups configured",
+			cfg:      func(cfg *LDAPConfig) { cfg.AdminGroups = nil },
+			username: "alice", password: "alice-password",
+			want: nil,
+		},
+		{
+			name: "group search instead of memberOf",
+			cfg: func(cfg *LDAPConfig) {
+				cfg.GroupAttribute = ""
+				cfg.GroupBaseDN = "ou=groups,dc=example,dc=com"
+				cfg.GroupFilter = "(member=%s)"
+			},
+			username: "bob", password: "bob-password",
+			want: boolPtr(true),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testLDAPConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			user, err := NewLDAPProviderWithDialer(cfg, newStubDirectory().dial).Lookup(tt.username, tt.password)
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			switch {
+			case tt.want == nil && user.IsAdmin != nil:
+				t.Errorf("IsAdmin = %v, want unset", *user.IsAdmin)
+			case tt.want != nil && (user.IsAdmin == nil || *user.IsAdmin != *tt.want):
+				t.Errorf("IsAdmin = %v, want %v", user.IsAdmin, *tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAPGroupSearchRebindsServiceAccount(t *testing.T) {
+	cfg := testLDAPConfig()
+	cfg.GroupFilter = "(member=%s)"
+	dir := newStubDirectory()
+	if _, err := NewLDAPProviderWithDialer(cfg, dir.dial).Lookup("bob", "bob-password"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{serviceDN, bobDN, serviceDN}; strings.Join(dir.binds, "|") != strings.Join(want, "|") {
+		t.Errorf("binds = %v, want %v", dir.binds, want)
+	}
+}
+
+func TestLDAPStartTLS(t *testing.T) {
+	cfg := testLDAPConfig()
+	cfg.StartTLS = true
+	dir := newStubDirectory()
+	if _, err := NewLDAPProviderWithDialer(cfg, dir.dial).Lookup("alice", "alice-password"); err != nil {
+		t.Fatal(err)
+	}
+	if !dir.startTLS {
+		t.Error("StartTLS was not negotiated")
+	}
+}
+
+// fixedProvider stands in for local accounts in the provider chain
+type fixedProvider struct {
+	user *models.User
+	err  error
+}
+
+func (f fixedProvider) Name() string { return models.AuthSourceLocal }
+
+func (f fixedProvider) Authenticate(username, password string) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.user, nil
+}
+
+func TestAuthenticateChain(t *testing.T) {
+	t.Cleanup(func() { SetProviders() })
+	local := &models.User{ID: 1, Username: "carol", AuthSource: models.AuthSourceLocal}
+
+	tests := []struct {
+		name     string
+		dir      func(*stubDirectory)
+		next     error // What the provider after LDAP answers
+		username string
+		password string
+		want     error
+	}{
+		// A user the directory doesn't know is left to the next provider
+		{name: "unknown to the directory", username: "carol", password: "anything"},
+		{name: "wrong directory password", username: "alice", password: "wrong", want: ErrInvalidCredentials},
+		{
+			name:     "directory down",
+			dir:      func(d *stubDirectory) { d.dialErr = errors.New("connection refused") },
+			next:     ErrUnknownUser,
+			username: "carol", password: "anything",
+			want: ErrUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newStubDirectory()
+			if tt.dir != nil {
+				tt.dir(dir)
+			}
+			SetProviders(NewLDAPProviderWithDialer(testLDAPConfig(), dir.dial), fixedProvider{user: local, err: tt.next})
+
+			user, err := Authenticate(tt.username, tt.password)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil || user != local {
+				t.Fatalf("Authenticate = %+v, %v, want the local user", user, err)
+			}
+		})
+	}
+}
+
+func TestSameDN(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{adminsDN, "CN=Atlas Admins, OU=Groups, DC=example, DC=com", true},
+		{adminsDN, "cn=Atlas Users,ou=groups,dc=example,dc=com", false},
+		{"not a dn", "NOT A DN", true},
+	}
+	for _, tt := range tests {
+		if got := sameDN(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameDN(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials means the provider knows the user but the password is wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnknownUser means the provider does not manage this user, so the next one is asked
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrUnavailable is returned when a provider that could have known the user failed to answer
+	ErrUnavailable = errors.New("authentication provider unavailable")
+)
+
+// Provider checks a username and password and returns the Atlas user they belong to.
+// It returns ErrUnknownUser for users it does not manage and ErrInvalidCredentials for a wrong password.
+type Provider interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   []Provider
+)
+
+// SetProviders replaces the provider chain, e.g. with a stub
+func SetProviders(chain ...Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers = chain
+}
+
+// Providers returns the provider chain, building it from the config on first use.
+// Local accounts are checked first so existing users keep working when LDAP is enabled.
+func Providers() []Provider {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if providers == nil {
+		providers = []Provider{LocalProvider{}}
+		if config.AppConfig.LDAPEnabled {
+			providers = append(providers, NewLDAPProvider(LDAPConfigFromApp()))
+		}
+	}
+	return providers
+}
+
+// Authenticate asks each provider in turn until one recognises the user
+func Authenticate(username, password string) (*models.User, error) {
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	unavailable := false
+	for _, provider := range Providers() {
+		user, err := provider.Authenticate(username, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ErrUnknownUser):
+			continue
+		case errors.Is(err, ErrInvalidCredentials):
+			return nil, ErrInvalidCredentials
+		default:
+			log.Printf("[AUTH] %s provider failed: %v", provider.Name(), err)
+			unavailable = true
+		}
+	}
+
+	if unavailable {
+		return nil, ErrUnavailable
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// CheckPassword confirms password belongs to user, for re-authentication on sensitive account changes
+func CheckPassword(user *models.User, password string) bool {
+	authenticated, err := Authenticate(user.Username, password)
+	return err == nil && authenticated.ID == user.ID
+}
+
+// LocalProvider checks bcrypt password hashes stored in the database
+type LocalProvider struct{}
+
+func (LocalProvider) Name() string { return models.AuthSourceLocal }
+
+func (LocalProvider) Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("LOWER(username) = LOWER(?)", username).First(&user).Error; err != nil {
+		return nil, ErrUnknownUser
+	}
+	if user.AuthSource != "" && !strings.EqualFold(user.AuthSource, models.AuthSourceLocal) {
+		return nil, ErrUnknownUser
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,6 +12,73 @@ type Config struct {
 	DatabaseURL string `mapstructure:"DATABASE_URL"`
 	JWTSecret   string `mapstructure:"JWT_SECRET"`
 	Environment string `mapstructure:"ENVIRONMENT"`
+
+	// Key for secrets Core stores encrypted, such as node signing keys and database host passwords.
+	// Falls back to JWT_SECRET; changing it makes those secrets unreadable.
+	EncryptionKey string `mapstructure:"ENCRYPTION_KEY"`
+
+	// Admin accounts must enroll in two-factor authentication before using admin routes
+	RequireAdmin2FA bool `mapstructure:"REQUIRE_ADMIN_2FA"`
+
+	// Lifetimes of login tokens. Access tokens are short lived and renewed with the session's refresh token.
+	AccessTokenTTL  time.Duration `mapstructure:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `mapstructure:"REFRESH_TOKEN_TTL"`
+
+	// Brute-force protection for logins. Failures within LoginWindow lock the username or IP out,
+	// starting at LoginLockout and doubling with each repeat up to LoginMaxLockout.
+	LoginMaxAttempts   int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginIPMaxAttempts int           `mapstructure:"LOGIN_IP_MAX_ATTEMPTS"`
+	LoginWindow        time.Duration `mapstructure:"LOGIN_WINDOW"`
+	LoginLockout       time.Duration `mapstructure:"LOGIN_LOCKOUT"`
+	LoginMaxLockout    time.Duration `mapstructure:"LOGIN_MAX_LOCKOUT"`
+
+	// Registrations per IP, successful or not. Reaching RegisterMaxAttempts within RegisterWindow
+	// refuses further registrations from that IP for RegisterWindow.
+	RegisterMaxAttempts int           `mapstructure:"REGISTER_MAX_ATTEMPTS"`
+	RegisterWindow      time.Duration `mapstructure:"REGISTER_WINDOW"`
+
+	// OpenID Connect single sign-on. OIDCRedirectURL must point at /api/v1/auth/oidc/callback and
+	// OIDCPanelURL is where the browser is sent back to once the login is finished.
+	OIDCEnabled        bool   `mapstructure:"OIDC_ENABLED"`
+	OIDCName           string `mapstructure:"OIDC_NAME"` // Shown on the login button
+	OIDCIssuer         string `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID       string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret   string `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL    string `mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCPanelURL       string `mapstructure:"OIDC_PANEL_URL"`
+	OIDCScopes         string `mapstructure:"OIDC_SCOPES"`
+	OIDCUsernameClaim  string `mapstructure:"OIDC_USERNAME_CLAIM"`
+	OIDCAdminClaim     string `mapstructure:"OIDC_ADMIN_CLAIM"`  // e.g. groups; empty leaves admin rights to Atlas
+	OIDCAdminValues    string `mapstructure:"OIDC_ADMIN_VALUES"` // Comma separated claim values that grant admin
+	OIDCAutoProvision  bool   `mapstructure:"OIDC_AUTO_PROVISION"`
+	OIDCLinkByUsername bool   `mapstructure:"OIDC_LINK_BY_USERNAME"`
+	DisableLocalLogin  bool   `mapstructure:"DISABLE_LOCAL_LOGIN"` // Password login is then only allowed for admins
+
+	// LDAP / Active Directory logins. Users are found with LDAPUserFilter (%s is the escaped username)
+	// under LDAPBaseDN using the service account, then bound as themselves to check their password.
+	LDAPEnabled            bool          `mapstructure:"LDAP_ENABLED"`
+	LDAPURL                string        `mapstructure:"LDAP_URL"` // ldap://host:389 or ldaps://host:636
+	LDAPStartTLS           bool          `mapstructure:"LDAP_START_TLS"`
+	LDAPInsecureSkipVerify bool          `mapstructure:"LDAP_INSECURE_SKIP_VERIFY"`
+	LDAPBindDN             string        `mapstructure:"LDAP_BIND_DN"`
+	LDAPBindPassword       string        `mapstructure:"LDAP_BIND_PASSWORD"`
+	LDAPBaseDN             string        `mapstructure:"LDAP_BASE_DN"`
+	LDAPUserFilter         string        `mapstructure:"LDAP_USER_FILTER"`
+	LDAPUsernameAttribute  string        `mapstructure:"LDAP_USERNAME_ATTRIBUTE"`
+	LDAPEmailAttribute     string        `mapstructure:"LDAP_EMAIL_ATTRIBUTE"`
+	LDAPGroupAttribute     string        `mapstructure:"LDAP_GROUP_ATTRIBUTE"` // e.g. memberOf
+	LDAPGroupBaseDN        string        `mapstructure:"LDAP_GROUP_BASE_DN"`
+	LDAPGroupFilter        string        `mapstructure:"LDAP_GROUP_FILTER"` // %s is the user's DN, for directories without memberOf
+	LDAPAdminGroups        string        `mapstructure:"LDAP_ADMIN_GROUPS"` // Semicolon separated group DNs; empty leaves admin rights to Atlas
+	LDAPAutoProvision      bool          `mapstructure:"LDAP_AUTO_PROVISION"`
+	LDAPTimeout            time.Duration `mapstructure:"LDAP_TIMEOUT"`
+
+	// How long a node's old token keeps working after it is rotated
+	NodeTokenGracePeriod time.Duration `mapstructure:"NODE_TOKEN_GRACE_PERIOD"`
+
+	// Ports given to servers users create themselves, the lowest free one on the chosen node
+	SelfServicePortStart int `mapstructure:"SELF_SERVICE_PORT_START"`
+	SelfServicePortEnd   int `mapstructure:"SELF_SERVICE_PORT_END"`
 }
 
 var AppConfig Config
@@ -20,6 +88,37 @@ func LoadConfig() {
 	viper.SetDefault("ENVIRONMENT", "development")
 	viper.SetDefault("DATABASE_URL", "host=localhost user=postgres password=Mandude007 dbname=atlas port=5432 sslmode=disable")
 	viper.SetDefault("JWT_SECRET", "change-me-in-production")
+	viper.SetDefault("ENCRYPTION_KEY", "")
+	viper.SetDefault("ACCESS_TOKEN_TTL", "15m")
+	viper.SetDefault("REFRESH_TOKEN_TTL", "720h")
+	viper.SetDefault("LOGIN_MAX_ATTEMPTS", 5)
+	viper.SetDefault("LOGIN_IP_MAX_ATTEMPTS", 20)
+	viper.SetDefault("LOGIN_WINDOW", "15m")
+	viper.SetDefault("LOGIN_LOCKOUT", "1m")
+	viper.SetDefault("LOGIN_MAX_LOCKOUT", "1h")
+	viper.SetDefault("REGISTER_MAX_ATTEMPTS", 5)
+	viper.SetDefault("REGISTER_WINDOW", "1h")
+	viper.SetDefault("NODE_TOKEN_GRACE_PERIOD", "1h")
+	viper.SetDefault("SELF_SERVICE_PORT_START", 25565)
+	viper.SetDefault("SELF_SERVICE_PORT_END", 25665)
+	viper.SetDefault("OIDC_ENABLED", false)
+	viper.SetDefault("OIDC_NAME", "Single Sign-On")
+	viper.SetDefault("OIDC_PANEL_URL", "/")
+	viper.SetDefault("OIDC_SCOPES", "openid profile email")
+	viper.SetDefault("OIDC_USERNAME_CLAIM", "preferred_username")
+	viper.SetDefault("OIDC_AUTO_PROVISION", true)
+	viper.SetDefault("OIDC_LINK_BY_USERNAME", false)
+	viper.SetDefault("DISABLE_LOCAL_LOGIN", false)
+	viper.SetDefault("LDAP_ENABLED", false)
+	viper.SetDefault("LDAP_START_TLS", false)
+	viper.SetDefault("LDAP_INSECURE_SKIP_VERIFY", false)
+	viper.SetDefault("LDAP_USER_FILTER", "(uid=%s)")
+	viper.SetDefault("LDAP_USERNAME_ATTRIBUTE", "uid")
+	viper.SetDefault("LDAP_EMAIL_ATTRIBUTE", "mail")
+	viper.SetDefault("LDAP_GROUP_ATTRIBUTE", "memberOf")
+	viper.SetDefault("LDAP_AUTO_PROVISION", true)
+	viper.SetDefault("LDAP_TIMEOUT", "10s")
+	viper.SetDefault("REQUIRE_ADMIN_2FA", false)
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("env")
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/secrets"
+)
+
+// MigrateNodeTokens replaces the old plaintext token column with a hash, lookup prefix and
+// encrypted signing key
+func MigrateNodeTokens() {
+	migratePlaintextNodeTokens()
+
+	// An earlier layout kept the previous token's hash, which could sign requests on its own
+	if DB.Migrator().HasColumn(&models.Node{}, "previous_token_hash") {
+		if err := DB.Migrator().DropColumn(&models.Node{}, "previous_token_hash"); err != nil {
+			log.Printf("[Migrate] Failed to drop previous node token hashes: %v", err)
+		}
+	}
+
+	// Nodes hashed before signing keys were stored can't be signed for until they get a new token
+	var stale []string
+	DB.Model(&models.Node{}).Where("token_hash <> '' AND (signing_key IS NULL OR signing_key = '')").Pluck("name", &stale)
+	for _, name := range stale {
+		log.Printf("[Migrate] Node %s has no signing key, rotate its token and set the new one on the daemon by hand", name)
+	}
+}
+
+func migratePlaintextNodeTokens() {
+	if !DB.Migrator().HasColumn(&models.Node{}, "token") {
+		return
+	}
+
+	type legacyNode struct {
+		ID    uint
+		Token string
+	}
+	var nodes []legacyNode
+	if err := DB.Table("nodes").Select("id, token").Where("token <> ''").Find(&nodes).Error; err != nil {
+		log.Printf("[Migrate] Failed to read node tokens: %v", err)
+		return
+	}
+
+	// Same derivation as utils.SetNodeToken (utils imports this package)
+	for _, n := range nodes {
+		sum := sha256.Sum256([]byte(n.Token))
+		mac := hmac.New(sha256.New, []byte(n.Token))
+		mac.Write([]byte("atlas-request-signing"))
+		prefix := n.Token
+		if len(prefix) > 10 {
+			prefix = prefix[:10]
+		}
+		err := DB.Model(&models.Node{}).Where("id = ?", n.ID).Updates(map[string]interface{}{
+			"token_prefix": prefix,
+			"token_hash":   hex.EncodeToString(sum[:]),
+			"signing_key":  secrets.String(hex.EncodeToString(mac.Sum(nil))),
+		}).Error
+		if err != nil {
+			log.Printf("[Migrate] Failed to hash the token of node %d: %v", n.ID, err)
+			return
+		}
+	}
+
+	if err := DB.Migrator().DropColumn(&models.Node{}, "token"); err != nil {
+		log.Printf("[Migrate] Failed to drop plaintext node tokens: %v", err)
+		return
+	}
+	log.Printf("[Migrate] Hashed %d node token(s)", len(nodes))
+}
+
+// locationCodeInvalid matches what can't be part of a location's short code
+var locationCodeInvalid = regexp.MustCompile(`[^a-z0-9.]+`)
+
+// MigrateNodeLocations turns the old free-text node location column into Location records.
+// Nodes left at the old "Unknown" default get no location.
+func MigrateNodeLocations() {
+	if !DB.Migrator().HasColumn(&models.Node{}, "location") {
+		return
+	}
+
+	type legacyNode struct {
+		ID       uint
+		Location string
+	}
+	var nodes []legacyNode
+	if err := DB.Table("nodes").Select("id, location").Where("location_id IS NULL").Find(&nodes).Error; err != nil {
+		log.Printf("[Migrate] Failed to read node locations: %v", err)
+		return
+	}
+
+	created := map[string]uint{} // Old location text to its new record
+	for _, n := range nodes {
+		name := strings.TrimSpace(n.Location)
+		if name == "" || strings.EqualFold(name, "Unknown") {
+			continue
+		}
+
+		id, ok := created[strings.ToLower(name)]
+		if !ok {
+			code := strings.Trim(locationCodeInvalid.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+			if len(code) > 50 {
+				code = code[:50]
+			}
+			if code == "" {
+				code = "location"
+			}
+
+			var location models.Location
+			if err := DB.Where("LOWER(long) = LOWER(?)", name).First(&location).Error; err != nil {
+				location = models.Location{Short: code, Long: name}
+				for i := 2; DB.Where("short = ?", location.Short).First(&models.Location{}).Error == nil; i++ {
+					location.Short = fmt.Sprintf("%s-%d", code, i)
+				}
+				if err := DB.Create(&location).Error; err != nil {
+					log.Printf("[Migrate] Failed to create location %q: %v", name, err)
+					return
+				}
+			}
+			id = location.ID
+			created[strings.ToLower(name)] = id
+		}
+		DB.Table("nodes").Where("id = ?", n.ID).Update("location_id", id)
+	}
+
+	if err := DB.Migrator().DropColumn(&models.Node{}, "location"); err != nil {
+		log.Printf("[Migrate] Failed to drop the old node location column: %v", err)
+		return
+	}
+	log.Printf("[Migrate] Created %d location(s) from the old node locations", len(created))
+}
+
+// MigrateDatabasePasswords encrypts database host and service database passwords stored
+// before they were encrypted at rest
+func MigrateDatabasePasswords() {
+	for _, table := range []string{"database_hosts", "service_databases"} {
+		type row struct {
+			ID       uint
+			Password string
+		}
+		var rows []row
+		if err := DB.Table(table).Select("id, password").Where("password <> ''").Find(&rows).Error; err != nil {
+			log.Printf("[Migrate] Failed to read %s passwords: %v", table, err)
+			continue
+		}
+
+		encrypted := 0
+		for _, r := range rows {
+			if secrets.IsEncrypted(r.Password) {
+				continue
+			}
+			if err := DB.Table(table).Where("id = ?", r.ID).UpdateColumn("password", secrets.String(r.Password)).Error; err != nil {
+				log.Printf("[Migrate] Failed to encrypt a password in %s: %v", table, err)
+				break
+			}
+			encrypted++
+		}
+		if encrypted > 0 {
+			log.Printf("[Migrate] Encrypted %d password(s) in %s", encrypted, table)
+		}
+	}
+}
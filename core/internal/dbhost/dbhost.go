@@ -0,0 +1,216 @@
+package dbhost
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+// connectTimeout bounds how long Core waits for a database host to answer
+const connectTimeout = 5 * time.Second
+
+var (
+	// Database and user names are generated by Core, so anything else is refused rather than quoted
+	identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,63}$`)
+	// MySQL host patterns such as %, 10.0.0.%, or a hostname
+	remotePattern = regexp.MustCompile(`^[A-Za-z0-9.%_:-]{1,255}$`)
+)
+
+// ErrUnsupportedType is returned for a host whose type Core does not know
+var ErrUnsupportedType = errors.New("unsupported database host type")
+
+// ValidRemote reports whether remote can be used as the host part of a MySQL user
+func ValidRemote(remote string) bool {
+	return remotePattern.MatchString(remote)
+}
+
+// Open connects to a database host with its admin account
+func Open(host *models.DatabaseHost) (*sql.DB, error) {
+	addr := net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
+
+	switch host.Type {
+	case models.DatabaseTypeMySQL:
+		cfg := mysql.NewConfig()
+		cfg.User = host.Username
+		cfg.Passwd = string(host.Password)
+		cfg.Net = "tcp"
+		cfg.Addr = addr
+		cfg.Timeout = connectTimeout
+		// Account statements can't take server-side placeholders, so the driver fills them in
+		cfg.InterpolateParams = true
+		connector, err := mysql.NewConnector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(connector), nil
+
+	case models.DatabaseTypePostgres:
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(host.Username, string(host.Password)),
+			Host:     addr,
+			Path:     "/postgres",
+			RawQuery: fmt.Sprintf("connect_timeout=%d", int(connectTimeout.Seconds())),
+		}
+		cfg, err := pgx.ParseConfig(dsn.String())
+		if err != nil {
+			return nil, err
+		}
+		return stdlib.OpenDB(*cfg), nil
+	}
+	return nil, ErrUnsupportedType
+}
+
+// Test checks that Core can log in to a host
+func Test(ctx context.Context, host *models.DatabaseHost) error {
+	conn, err := Open(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	return conn.PingContext(ctx)
+}
+
+// exec runs statements in order on a host, stopping at the first error. It returns how many
+// statements succeeded.
+func exec(ctx context.Context, host *models.DatabaseHost, statements ...statement) (int, error) {
+	conn, err := Open(host)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	for i, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return i, err
+		}
+	}
+	return len(statements), nil
+}
+
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+func stmt(query string, args ...interface{}) statement {
+	return statement{query: query, args: args}
+}
+
+func checkNames(db *models.ServiceDatabase) error {
+	if !identifierPattern.MatchString(db.Name) || !identifierPattern.MatchString(db.Username) {
+		return fmt.Errorf("invalid database or user name")
+	}
+	if !ValidRemote(db.Remote) {
+		return fmt.Errorf("invalid remote host %q", db.Remote)
+	}
+	return nil
+}
+
+// Create makes db on its host, together with a user that has every privilege on db and nothing
+// else. What Create made is dropped again when a later step fails; a database or user that
+// already existed is left alone.
+func Create(ctx context.Context, host *models.DatabaseHost, db *models.ServiceDatabase) error {
+	if err := checkNames(db); err != nil {
+		return err
+	}
+
+	// The user is created first, then the database at step createdDatabase
+	var done, createdDatabase int
+	var err error
+	switch host.Type {
+	case models.DatabaseTypeMySQL:
+		createdDatabase = 2
+		done, err = exec(ctx, host,
+			// The password is passed as a plain string, its driver.Valuer would encrypt it
+			stmt("CREATE USER ?@? IDENTIFIED BY ?", db.Username, db.Remote, string(db.Password)),
+			stmt("CREATE DATABASE `"+db.Name+"` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci"),
+			stmt("GRANT ALL PRIVILEGES ON `"+db.Name+"`.* TO ?@?", db.Username, db.Remote),
+		)
+	case models.DatabaseTypePostgres:
+		user, name := pgx.Identifier{db.Username}.Sanitize(), pgx.Identifier{db.Name}.Sanitize()
+		createdDatabase = 3
+		done, err = exec(ctx, host,
+			stmt("CREATE ROLE "+user+" LOGIN PASSWORD "+quoteLiteral(string(db.Password))),
+			// Owning the database needs membership of the role unless the admin is a superuser
+			stmt("GRANT "+user+" TO CURRENT_USER"),
+			stmt("CREATE DATABASE "+name+" OWNER "+user),
+			stmt("REVOKE ALL ON DATABASE "+name+" FROM PUBLIC"),
+		)
+	default:
+		return ErrUnsupportedType
+	}
+
+	if err != nil && done > 0 {
+		drop(context.WithoutCancel(ctx), host, db, done >= createdDatabase)
+	}
+	return err
+}
+
+// SetPassword changes the password of db's user to db.Password
+func SetPassword(ctx context.Context, host *models.DatabaseHost, db *models.ServiceDatabase) error {
+	if err := checkNames(db); err != nil {
+		return err
+	}
+
+	var err error
+	switch host.Type {
+	case models.DatabaseTypeMySQL:
+		_, err = exec(ctx, host, stmt("ALTER USER ?@? IDENTIFIED BY ?", db.Username, db.Remote, string(db.Password)))
+	case models.DatabaseTypePostgres:
+		_, err = exec(ctx, host, stmt("ALTER ROLE "+pgx.Identifier{db.Username}.Sanitize()+" PASSWORD "+quoteLiteral(string(db.Password))))
+	default:
+		err = ErrUnsupportedType
+	}
+	return err
+}
+
+// Drop deletes db and its user. Either being gone already is not an error.
+func Drop(ctx context.Context, host *models.DatabaseHost, db *models.ServiceDatabase) error {
+	if err := checkNames(db); err != nil {
+		return err
+	}
+	return drop(ctx, host, db, true)
+}
+
+// drop deletes db's user, and the database itself when withDatabase is set
+func drop(ctx context.Context, host *models.DatabaseHost, db *models.ServiceDatabase, withDatabase bool) error {
+	var statements []statement
+	switch host.Type {
+	case models.DatabaseTypeMySQL:
+		if withDatabase {
+			statements = append(statements, stmt("DROP DATABASE IF EXISTS `"+db.Name+"`"))
+		}
+		statements = append(statements, stmt("DROP USER IF EXISTS ?@?", db.Username, db.Remote))
+	case models.DatabaseTypePostgres:
+		if withDatabase {
+			// Open connections would otherwise keep the database alive
+			statements = append(statements, stmt("DROP DATABASE IF EXISTS "+pgx.Identifier{db.Name}.Sanitize()+" WITH (FORCE)"))
+		}
+		statements = append(statements, stmt("DROP ROLE IF EXISTS "+pgx.Identifier{db.Username}.Sanitize()))
+	default:
+		return ErrUnsupportedType
+	}
+	_, err := exec(ctx, host, statements...)
+	return err
+}
+
+// quoteLiteral quotes a PostgreSQL string, which role statements take in place of parameters
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
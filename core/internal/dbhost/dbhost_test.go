@@ -0,0 +1,211 @@
+package dbhost
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/secrets"
+)
+
+func TestCheckNames(t *testing.T) {
+	valid := models.ServiceDatabase{Name: "s12_world", Username: "u12_abcdef", Remote: "%"}
+	if err := checkNames(&valid); err != nil {
+		t.Fatalf("checkNames(%+v) = %v", valid, err)
+	}
+
+	tests := []struct {
+		name  string
+		tweak func(db *models.ServiceDatabase)
+	}{
+		{"empty name", func(db *models.ServiceDatabase) { db.Name = "" }},
+		{"name too long", func(db *models.ServiceDatabase) { db.Name = strings.Repeat("a", 64) }},
+		{"backtick", func(db *models.ServiceDatabase) { db.Name = "s1`; DROP DATABASE mysql; --" }},
+		{"double quote", func(db *models.ServiceDatabase) { db.Name = `s1"x` }},
+		{"space", func(db *models.ServiceDatabase) { db.Name = "s1 world" }},
+		{"dash", func(db *models.ServiceDatabase) { db.Name = "s1-world" }},
+		{"dot", func(db *models.ServiceDatabase) { db.Name = "mysql.user" }},
+		{"unicode", func(db *models.ServiceDatabase) { db.Name = "s1_wörld" }},
+		{"empty user", func(db *models.ServiceDatabase) { db.Username = "" }},
+		{"quoted user", func(db *models.ServiceDatabase) { db.Username = "u1'@'%" }},
+		{"user with newline", func(db *models.ServiceDatabase) { db.Username = "u1\nx" }},
+		{"empty remote", func(db *models.ServiceDatabase) { db.Remote = "" }},
+		{"remote with quote", func(db *models.ServiceDatabase) { db.Remote = "%' OR '1" }},
+		{"remote with space", func(db *models.ServiceDatabase) { db.Remote = "10.0.0.% x" }},
+		{"remote too long", func(db *models.ServiceDatabase) { db.Remote = strings.Repeat("a", 256) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := valid
+			tt.tweak(&db)
+			if err := checkNames(&db); err == nil {
+				t.Fatalf("checkNames accepted %+v", db)
+			}
+
+			// Nothing is sent to the host for a name that fails the check
+			host := &models.DatabaseHost{Type: models.DatabaseTypeMySQL, Host: "192.0.2.1", Port: 1}
+			for _, call := range []func(context.Context, *models.DatabaseHost, *models.ServiceDatabase) error{Create, SetPassword, Drop} {
+				if err := call(context.Background(), host, &db); err == nil || !strings.Contains(err.Error(), "invalid") {
+					t.Fatalf("got %v, want the name check to fail first", err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidRemote(t *testing.T) {
+	for _, remote := range []string{"%", "10.0.0.%", "db.example.com", "::1", "node_1"} {
+		if !ValidRemote(remote) {
+			t.Errorf("ValidRemote(%q) = false", remote)
+		}
+	}
+	for _, remote := range []string{"", "a b", "x'y", "a`b", "a;b", "a/b"} {
+		if ValidRemote(remote) {
+			t.Errorf("ValidRemote(%q) = true", remote)
+		}
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := map[string]string{
+		"plain":       "'plain'",
+		"it's":        "'it''s'",
+		"'; DROP --":  "'''; DROP --'",
+		`back\slash`:  `'back\slash'`,
+		"":            "''",
+		"''":          "''''''",
+		"new\nline":   "'new\nline'",
+		"dollar$$sql": "'dollar$$sql'",
+	}
+	for in, want := range tests {
+		if got := quoteLiteral(in); got != want {
+			t.Errorf("quoteLiteral(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+// testHosts returns the database hosts of the docker-compose "databases" profile, and skips the
+// test unless ATLAS_TEST_DB_HOSTS is set:
+//
+//	docker compose --profile databases up -d
+//	ATLAS_TEST_DB_HOSTS=1 go test ./internal/dbhost/
+//
+// DB_HOST_TEST_PASSWORD must match what the containers were started with.
+func testHosts(t *testing.T) []*models.DatabaseHost {
+	t.Helper()
+	if os.Getenv("ATLAS_TEST_DB_HOSTS") == "" {
+		t.Skip("set ATLAS_TEST_DB_HOSTS and start the docker-compose databases profile to run this test")
+	}
+	password := os.Getenv("DB_HOST_TEST_PASSWORD")
+	if password == "" {
+		password = "atlas_test"
+	}
+	return []*models.DatabaseHost{
+		{Name: "mariadb", Type: models.DatabaseTypeMySQL, Host: "127.0.0.1", Port: 3306, Username: "root", Password: secrets.String(password)},
+		{Name: "postgres", Type: models.DatabaseTypePostgres, Host: "127.0.0.1", Port: 5433, Username: "postgres", Password: secrets.String(password)},
+	}
+}
+
+// loginAs connects to db's own database as its user and creates a table there, which only
+// works with the right password and privileges
+func loginAs(host *models.DatabaseHost, db *models.ServiceDatabase, password string) error {
+	addr := net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
+	var conn *sql.DB
+	switch host.Type {
+	case models.DatabaseTypeMySQL:
+		cfg := mysql.NewConfig()
+		cfg.User, cfg.Passwd, cfg.Net, cfg.Addr, cfg.DBName = db.Username, password, "tcp", addr, db.Name
+		connector, err := mysql.NewConnector(cfg)
+		if err != nil {
+			return err
+		}
+		conn = sql.OpenDB(connector)
+	case models.DatabaseTypePostgres:
+		dsn := url.URL{Scheme: "postgres", User: url.UserPassword(db.Username, password), Host: addr, Path: "/" + db.Name}
+		cfg, err := pgx.ParseConfig(dsn.String())
+		if err != nil {
+			return err
+		}
+		conn = stdlib.OpenDB(*cfg)
+	}
+	defer conn.Close()
+	_, err := conn.Exec("CREATE TABLE IF NOT EXISTS atlas_login_check (id INT)")
+	return err
+}
+
+func TestHostLifecycle(t *testing.T) {
+	for _, host := range testHosts(t) {
+		t.Run(host.Name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := Test(ctx, host); err != nil {
+				t.Fatalf("can't reach %s: %v", host.Name, err)
+			}
+
+			db := &models.ServiceDatabase{
+				Name:     "s0_test_" + host.Name,
+				Username: "u0_" + host.Name,
+				Password: "first'Pass$1",
+				Remote:   "%",
+			}
+			t.Cleanup(func() { Drop(context.Background(), host, db) })
+
+			if err := Create(ctx, host, db); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if err := loginAs(host, db, "first'Pass$1"); err != nil {
+				t.Fatalf("login with the new user: %v", err)
+			}
+
+			// Creating it again fails and leaves the existing database and user alone
+			if err := Create(ctx, host, db); err == nil {
+				t.Fatal("Create succeeded for an existing database")
+			}
+			if err := loginAs(host, db, "first'Pass$1"); err != nil {
+				t.Fatalf("login after a failed second Create: %v", err)
+			}
+
+			db.Password = "second\"Pass$2"
+			if err := SetPassword(ctx, host, db); err != nil {
+				t.Fatalf("SetPassword: %v", err)
+			}
+			if err := loginAs(host, db, "second\"Pass$2"); err != nil {
+				t.Fatalf("login with the new password: %v", err)
+			}
+			if err := loginAs(host, db, "first'Pass$1"); err == nil {
+				t.Fatal("the old password still works")
+			}
+
+			if err := Drop(ctx, host, db); err != nil {
+				t.Fatalf("Drop: %v", err)
+			}
+			if err := loginAs(host, db, "second\"Pass$2"); err == nil {
+				t.Fatal("the user still works after Drop")
+			}
+			if err := Drop(ctx, host, db); err != nil {
+				t.Fatalf("second Drop: %v", err)
+			}
+		})
+	}
+}
+
+func TestWrongAdminPassword(t *testing.T) {
+	for _, host := range testHosts(t) {
+		t.Run(host.Name, func(t *testing.T) {
+			wrong := *host
+			wrong.Password = secrets.String(fmt.Sprintf("not-%s", host.Password))
+			if err := Test(context.Background(), &wrong); err == nil {
+				t.Fatal("logged in with the wrong admin password")
+			}
+		})
+	}
+}
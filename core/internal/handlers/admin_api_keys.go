@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+type CreateApplicationKeyRequest struct {
+	Name        string            `json:"name" binding:"required"`
+	Permissions map[string]string `json:"permissions" binding:"required"` // resource -> "read" or "write"
+	AllowedIPs  []string          `json:"allowed_ips"`
+	ExpiresAt   *time.Time        `json:"expires_at"`
+}
+
+// GetApplicationKeys returns all active application keys
+func GetApplicationKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := database.DB.Where("type = ? AND revoked_at IS NULL", "application").Preload("User").Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch application keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateApplicationKey issues an admin application key. The key itself is only returned once.
+func CreateApplicationKey(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req CreateApplicationKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for resource, level := range req.Permissions {
+		if !slices.Contains(models.ApplicationKeyResources, resource) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown resource: %s", resource)})
+			return
+		}
+		if level != "read" && level != "write" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Permission for %s must be read or write", resource)})
+			return
+		}
+	}
+	for _, entry := range req.AllowedIPs {
+		if !utils.ValidIPEntry(entry) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid IP address or range: %s", entry)})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	key, prefix, hash := utils.GenerateAPIKey(utils.ApplicationKeyPrefix)
+	permissions, _ := json.Marshal(req.Permissions)
+	allowedIPs := ""
+	if len(req.AllowedIPs) > 0 {
+		ips, _ := json.Marshal(req.AllowedIPs)
+		allowedIPs = string(ips)
+	}
+
+	apiKey := models.APIKey{
+		UserID:      userID,
+		Type:        "application",
+		Name:        req.Name,
+		Prefix:      prefix,
+		KeyHash:     hash,
+		Permissions: string(permissions),
+		AllowedIPs:  allowedIPs,
+		ExpiresAt:   req.ExpiresAt,
+	}
+
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create application key"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "api_key_create", apiKey.Prefix, fmt.Sprintf("Created application key: %s", apiKey.Name), map[string]interface{}{
+		"permissions": req.Permissions,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// RevokeApplicationKey revokes an application key
+func RevokeApplicationKey(c *gin.Context) {
+	var apiKey models.APIKey
+	if err := database.DB.Where("id = ? AND type = ?", c.Param("id"), "application").First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application key not found"})
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		if err := database.DB.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke application key"})
+			return
+		}
+		utils.LogActivity(c, 0, "api_key_revoke", apiKey.Prefix, fmt.Sprintf("Revoked application key: %s", apiKey.Name), nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
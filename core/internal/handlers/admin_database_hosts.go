@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/dbhost"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+type DatabaseHostResponse struct {
+	models.DatabaseHost
+	Databases int64 `json:"databases"` // Service databases on this host
+}
+
+// validateDatabaseHost checks an admin's host settings and fills in the default port
+func validateDatabaseHost(host *models.DatabaseHost) error {
+	host.Name = strings.TrimSpace(host.Name)
+	host.Host = strings.TrimSpace(host.Host)
+	host.PublicHost = strings.TrimSpace(host.PublicHost)
+	if host.Name == "" || host.Host == "" || host.Username == "" {
+		return fmt.Errorf("name, host and username are required")
+	}
+
+	switch host.Type {
+	case models.DatabaseTypeMySQL:
+		if host.Port == 0 {
+			host.Port = 3306
+		}
+	case models.DatabaseTypePostgres:
+		if host.Port == 0 {
+			host.Port = 5432
+		}
+	default:
+		return fmt.Errorf("type must be %q or %q", models.DatabaseTypeMySQL, models.DatabaseTypePostgres)
+	}
+	if host.Port < 1 || host.Port > 65535 {
+		return fmt.Errorf("invalid port")
+	}
+	if host.MaxDatabases < 0 {
+		return fmt.Errorf("max_databases can't be negative")
+	}
+
+	if host.NodeID != nil {
+		if *host.NodeID == 0 {
+			host.NodeID = nil
+		} else if err := database.DB.First(&models.Node{}, *host.NodeID).Error; err != nil {
+			return fmt.Errorf("node not found")
+		}
+	}
+	return nil
+}
+
+func databaseHostResponse(host models.DatabaseHost) DatabaseHostResponse {
+	var count int64
+	database.DB.Model(&models.ServiceDatabase{}).Where("database_host_id = ?", host.ID).Count(&count)
+	host.Password = ""
+	return DatabaseHostResponse{DatabaseHost: host, Databases: count}
+}
+
+// GetDatabaseHosts returns every database host with the number of databases on it
+func GetDatabaseHosts(c *gin.Context) {
+	var hosts []models.DatabaseHost
+	if err := database.DB.Preload("Node").Order("id").Find(&hosts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch database hosts"})
+		return
+	}
+
+	response := make([]DatabaseHostResponse, 0, len(hosts))
+	for _, host := range hosts {
+		response = append(response, databaseHostResponse(host))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateDatabaseHost adds a database host once Core has managed to log in to it
+func CreateDatabaseHost(c *gin.Context) {
+	var host models.DatabaseHost
+	if err := c.ShouldBindJSON(&host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	host.ID = 0
+	if err := validateDatabaseHost(&host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dbhost.Test(c.Request.Context(), &host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not connect to the database host: " + err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&host).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create database host"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "create", "database_host", fmt.Sprintf("Added database host: %s", host.Name), map[string]interface{}{
+		"type": host.Type,
+		"host": host.Host,
+	})
+
+	c.JSON(http.StatusCreated, databaseHostResponse(host))
+}
+
+// UpdateDatabaseHost changes a host's settings. An empty password keeps the current one.
+func UpdateDatabaseHost(c *gin.Context) {
+	var host models.DatabaseHost
+	if err := database.DB.First(&host, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Database host not found"})
+		return
+	}
+
+	current := host
+	host.Password = ""
+	if err := c.ShouldBindJSON(&host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	host.ID = current.ID
+	host.CreatedAt = current.CreatedAt
+	host.Node = nil
+	if host.Password == "" {
+		host.Password = current.Password
+	}
+
+	// Existing databases were created for one engine and can't move to another
+	if host.Type != current.Type {
+		var count int64
+		database.DB.Model(&models.ServiceDatabase{}).Where("database_host_id = ?", host.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The type of a host with databases can't be changed"})
+			return
+		}
+	}
+
+	if err := validateDatabaseHost(&host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dbhost.Test(c.Request.Context(), &host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not connect to the database host: " + err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&host).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update database host"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "update", "database_host", fmt.Sprintf("Updated database host: %s", host.Name), nil)
+
+	c.JSON(http.StatusOK, databaseHostResponse(host))
+}
+
+// TestDatabaseHost checks that Core can still log in to a host
+func TestDatabaseHost(c *gin.Context) {
+	var host models.DatabaseHost
+	if err := database.DB.First(&host, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Database host not found"})
+		return
+	}
+
+	if err := dbhost.Test(c.Request.Context(), &host); err != nil {
+		c.JSON(http.StatusOK, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// DeleteDatabaseHost removes a host that no longer has any databases
+func DeleteDatabaseHost(c *gin.Context) {
+	var host models.DatabaseHost
+	if err := database.DB.First(&host, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Database host not found"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.ServiceDatabase{}).Where("database_host_id = ?", host.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The host still has %d database(s), delete them first", count)})
+		return
+	}
+
+	if err := database.DB.Delete(&host).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete database host"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "delete", "database_host", fmt.Sprintf("Removed database host: %s", host.Name), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
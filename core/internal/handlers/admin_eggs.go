@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"path"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -15,6 +18,35 @@ type ImportEggRequest struct {
 	Content string `json:"content"` // JSON string of the egg (Atlas or Pterodactyl format)
 }
 
+// encodeFileDenylist checks denylist patterns and stores them as a JSON list, empty when there
+// are none. Patterns follow .gitignore: "*.jar" matches at any depth, "config/ac.yml" from the root.
+func encodeFileDenylist(patterns []string) (string, error) {
+	var clean []string
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		glob := strings.Trim(pattern, "/")
+		if _, err := path.Match(glob, ""); err != nil || glob == "" {
+			return "", fmt.Errorf("invalid file denylist pattern %q", pattern)
+		}
+		clean = append(clean, pattern)
+	}
+	if len(clean) == 0 {
+		return "", nil
+	}
+	data, _ := json.Marshal(clean)
+	return string(data), nil
+}
+
+// fileDenylist returns an egg's denylist patterns
+func fileDenylist(egg *models.Egg) []string {
+	var patterns []string
+	json.Unmarshal([]byte(egg.FileDenylist), &patterns)
+	return patterns
+}
+
 // GetEggs returns all eggs
 func GetEggs(c *gin.Context) {
 	var eggs []models.Egg
@@ -85,6 +117,7 @@ func ImportEgg(c *gin.Context) {
 		ScriptInstall   string   `json:"script_install"`
 		ScriptContainer string   `json:"script_container"`
 		ScriptEntry     string   `json:"script_entry"`
+		FileDenylist    []string `json:"file_denylist"`
 		Variables       []struct {
 			Name         string `json:"name"`
 			EnvVariable  string `json:"env_variable"`
@@ -103,6 +136,12 @@ func ImportEgg(c *gin.Context) {
 			return
 		}
 
+		denylist, err := encodeFileDenylist(atlasJSON.FileDenylist)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		dockerImagesJSON, _ := json.Marshal(atlasJSON.DockerImages)
 		egg := models.Egg{
 			UUID:            uuid.New().String(),
@@ -115,6 +154,7 @@ func ImportEgg(c *gin.Context) {
 			ScriptInstall:   atlasJSON.ScriptInstall,
 			ScriptContainer: atlasJSON.ScriptContainer,
 			ScriptEntry:     atlasJSON.ScriptEntry,
+			FileDenylist:    denylist,
 		}
 
 		if err := database.DB.Create(&egg).Error; err != nil {
@@ -145,6 +185,7 @@ func ImportEgg(c *gin.Context) {
 		Description  string            `json:"description"`
 		DockerImages map[string]string `json:"docker_images"`
 		Startup      string            `json:"startup"`
+		FileDenylist []string          `json:"file_denylist"`
 		Config       struct {
 			Stop string `json:"stop"`
 		} `json:"config"`
@@ -170,6 +211,12 @@ func ImportEgg(c *gin.Context) {
 		return
 	}
 
+	denylist, err := encodeFileDenylist(ptEgg.FileDenylist)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Convert Pterodactyl to Atlas... (Legacy logic)
 	var nest models.Nest
 	database.DB.First(&nest, req.NestID)
@@ -191,6 +238,7 @@ func ImportEgg(c *gin.Context) {
 		ScriptInstall:   ptEgg.Scripts.Installation.Script,
 		ScriptContainer: ptEgg.Scripts.Installation.Container,
 		ScriptEntry:     ptEgg.Scripts.Installation.Entrypoint,
+		FileDenylist:    denylist,
 	}
 
 	database.DB.Create(&egg)
@@ -224,6 +272,20 @@ func UpdateEgg(c *gin.Context) {
 		return
 	}
 
+	var patterns []string
+	if strings.TrimSpace(egg.FileDenylist) != "" {
+		if err := json.Unmarshal([]byte(egg.FileDenylist), &patterns); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File denylist must be a JSON list of patterns"})
+			return
+		}
+	}
+	denylist, err := encodeFileDenylist(patterns)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	egg.FileDenylist = denylist
+
 	if err := database.DB.Save(&egg).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update egg"})
 		return
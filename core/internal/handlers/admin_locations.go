@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+// locationCodePattern allows short codes such as "eu", "us.nyc" or "de-fra-1"
+var locationCodePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,59}$`)
+
+type LocationResponse struct {
+	models.Location
+	Nodes int64 `json:"nodes"` // Nodes in this location
+}
+
+// validateLocation checks an admin's location settings, including that the short code is free
+func validateLocation(location *models.Location) error {
+	location.Short = strings.TrimSpace(location.Short)
+	location.Long = strings.TrimSpace(location.Long)
+	location.Region = strings.TrimSpace(location.Region)
+	if !locationCodePattern.MatchString(location.Short) {
+		return fmt.Errorf("short codes are up to 60 letters, numbers, dots, dashes and underscores")
+	}
+
+	var existing int64
+	database.DB.Model(&models.Location{}).Where("LOWER(short) = LOWER(?) AND id <> ?", location.Short, location.ID).Count(&existing)
+	if existing > 0 {
+		return fmt.Errorf("short code %q is already used", location.Short)
+	}
+	return nil
+}
+
+// validateNodeLocation checks the location a node is being put in. 0 takes it out of its location.
+func validateNodeLocation(node *models.Node) error {
+	node.Location = nil
+	if node.LocationID == nil {
+		return nil
+	}
+	if *node.LocationID == 0 {
+		node.LocationID = nil
+		return nil
+	}
+	if err := database.DB.First(&models.Location{}, *node.LocationID).Error; err != nil {
+		return fmt.Errorf("location not found")
+	}
+	return nil
+}
+
+// findLocation looks a location up by ID or short code
+func findLocation(ref string) (*models.Location, error) {
+	var location models.Location
+	query := database.DB.Where("LOWER(short) = LOWER(?)", ref)
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		query = database.DB.Where("id = ?", id)
+	}
+	if err := query.First(&location).Error; err != nil {
+		return nil, fmt.Errorf("location not found")
+	}
+	return &location, nil
+}
+
+// locationQuery returns the location named by the request's ?location= filter, or nil when
+// there is none. It responds with an error itself when the location doesn't exist.
+func locationQuery(c *gin.Context) (*models.Location, bool) {
+	ref := c.Query("location")
+	if ref == "" {
+		return nil, true
+	}
+	location, err := findLocation(ref)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return nil, false
+	}
+	return location, true
+}
+
+func locationResponse(location models.Location) LocationResponse {
+	var count int64
+	database.DB.Model(&models.Node{}).Where("location_id = ?", location.ID).Count(&count)
+	return LocationResponse{Location: location, Nodes: count}
+}
+
+// GetLocations returns every location with how many nodes it has
+func GetLocations(c *gin.Context) {
+	var locations []models.Location
+	if err := database.DB.Order("region, short").Find(&locations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+
+	response := make([]LocationResponse, 0, len(locations))
+	for _, location := range locations {
+		response = append(response, locationResponse(location))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateLocation adds a location nodes can be put in
+func CreateLocation(c *gin.Context) {
+	var location models.Location
+	if err := c.ShouldBindJSON(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	location.ID = 0
+	if err := validateLocation(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create location"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "create", "location", fmt.Sprintf("Added location: %s", location.Short), nil)
+
+	c.JSON(http.StatusCreated, locationResponse(location))
+}
+
+// UpdateLocation changes a location's code or names
+func UpdateLocation(c *gin.Context) {
+	var location models.Location
+	if err := database.DB.First(&location, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	current := location
+	if err := c.ShouldBindJSON(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	location.ID = current.ID
+	location.CreatedAt = current.CreatedAt
+	if err := validateLocation(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "update", "location", fmt.Sprintf("Updated location: %s", location.Short), nil)
+
+	c.JSON(http.StatusOK, locationResponse(location))
+}
+
+// DeleteLocation removes a location that no longer has any nodes
+func DeleteLocation(c *gin.Context) {
+	var location models.Location
+	if err := database.DB.First(&location, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.Node{}).Where("location_id = ?", location.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The location still has %d node(s), move them first", count)})
+		return
+	}
+
+	// Deleted nodes still point at the location
+	database.DB.Unscoped().Model(&models.Node{}).Where("location_id = ?", location.ID).Update("location_id", nil)
+	if err := database.DB.Delete(&location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "delete", "location", fmt.Sprintf("Removed location: %s", location.Short), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+type UnlockRequest struct {
+	Type  string `json:"type" binding:"required"` // user, ip or register
+	Value string `json:"value" binding:"required"`
+}
+
+// GetLockouts returns the usernames and IPs currently locked out after failed logins, and the
+// IPs refused further registrations
+func GetLockouts(c *gin.Context) {
+	lockouts := utils.LoginLockouts()
+	if lockouts == nil {
+		lockouts = []utils.Lockout{}
+	}
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// UnlockLogin lifts a lockout and resets its failure count
+func UnlockLogin(c *gin.Context) {
+	var req UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Type != "user" && req.Type != "ip" && req.Type != "register" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type must be user, ip or register"})
+		return
+	}
+
+	if !utils.UnlockLogin(req.Type, req.Value) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No lockout found"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "login_unlock", req.Type+":"+req.Value, fmt.Sprintf("Unlocked %s %s", req.Type, req.Value), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "unlocked"})
+}
@@ -1,20 +1,33 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/config"
 	"github.com/luketaylor45/atlas/core/internal/database"
 	"github.com/luketaylor45/atlas/core/internal/models"
 	"github.com/luketaylor45/atlas/core/internal/utils"
 )
 
-// GetNodes returns a list of all nodes
+// GetNodes returns a list of all nodes, optionally only those in ?location= (ID or short code)
 func GetNodes(c *gin.Context) {
+	location, ok := locationQuery(c)
+	if !ok {
+		return
+	}
+
 	var nodes []models.Node
-	if err := database.DB.Find(&nodes).Error; err != nil {
+	query := database.DB.Preload("Location")
+	if location != nil {
+		query = query.Where("location_id = ?", location.ID)
+	}
+	if err := query.Find(&nodes).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch nodes"})
 		return
 	}
@@ -42,9 +55,24 @@ func CreateNode(c *gin.Context) {
 		return
 	}
 
-	// Generate a secure token for the node
-	// Re-using a simple helper or just uuid.
-	req.Token = "n_" + utils.RandomString(32)
+	// Generate a secure token for the node. Only its hash is stored, so it is shown once.
+	token := utils.GenerateNodeToken()
+	utils.SetNodeToken(&req, token)
+	req.TokenConfirmed = true
+
+	// A fingerprint may be supplied up front, otherwise it is pinned from the first heartbeat
+	req.TLSFingerprint = utils.NormalizeFingerprint(req.TLSFingerprint)
+	if req.Scheme == "" {
+		req.Scheme = "https"
+	}
+	if _, err := utils.NodePullAllowlist(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateNodeLocation(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := database.DB.Create(&req).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create node"})
@@ -56,7 +84,7 @@ func CreateNode(c *gin.Context) {
 	// Return the token explicitly since it's hidden in the JSON struct output
 	c.JSON(http.StatusCreated, gin.H{
 		"node":  req,
-		"token": req.Token,
+		"token": token,
 	})
 }
 
@@ -69,10 +97,28 @@ func UpdateNode(c *gin.Context) {
 		return
 	}
 
+	// Token state is only changed through RotateNodeToken
+	tokenState := node
 	if err := c.ShouldBindJSON(&node); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	node.TokenPrefix = tokenState.TokenPrefix
+	node.PreviousTokenExpiresAt = tokenState.PreviousTokenExpiresAt
+	node.TokenConfirmed = tokenState.TokenConfirmed
+	node.TokenRotatedAt = tokenState.TokenRotatedAt
+
+	// Clearing the fingerprint re-pins the node on its next heartbeat
+	node.TLSFingerprint = utils.NormalizeFingerprint(node.TLSFingerprint)
+
+	if _, err := utils.NodePullAllowlist(&node); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateNodeLocation(&node); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := database.DB.Save(&node).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update node"})
@@ -84,6 +130,85 @@ func UpdateNode(c *gin.Context) {
 	c.JSON(http.StatusOK, node)
 }
 
+// RotateNodeToken issues a new token for a node. The old token keeps working for the grace period
+// while the daemon switches over; Core pushes the new token to the daemon if it is reachable.
+func RotateNodeToken(c *gin.Context) {
+	nodeID := c.Param("id")
+	var node models.Node
+	if err := database.DB.First(&node, nodeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	var req struct {
+		GracePeriod int `json:"grace_period"` // Seconds, defaults to NODE_TOKEN_GRACE_PERIOD
+	}
+	c.ShouldBindJSON(&req)
+
+	grace := config.AppConfig.NodeTokenGracePeriod
+	if req.GracePeriod > 0 {
+		grace = time.Duration(req.GracePeriod) * time.Second
+	}
+
+	// Keep signing the push with whatever key the daemon currently accepts
+	previous := node
+	token := utils.GenerateNodeToken()
+	now := time.Now()
+	expires := now.Add(grace)
+
+	node.PreviousTokenPrefix, node.PreviousSigningKey = utils.NodeStoredSigningKey(&previous)
+	node.PreviousTokenExpiresAt = &expires
+	utils.SetNodeToken(&node, token)
+	node.TokenConfirmed = false
+	node.TokenRotatedAt = &now
+
+	if err := database.DB.Save(&node).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate node token"})
+		return
+	}
+
+	pushed := pushNodeToken(&previous, token, grace)
+
+	utils.LogActivity(c, 0, "rotate_token", "node", fmt.Sprintf("Rotated token for node: %s", node.Name), map[string]interface{}{
+		"node_id":      node.ID,
+		"token_prefix": node.TokenPrefix,
+		"grace_period": int(grace.Seconds()),
+		"pushed":       pushed,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"node":       node,
+		"token":      token,
+		"pushed":     pushed,
+		"expires_at": expires,
+	})
+}
+
+// pushNodeToken hands a rotated token to the daemon, signed with the key it still trusts
+func pushNodeToken(node *models.Node, token string, grace time.Duration) bool {
+	body, _ := json.Marshal(map[string]interface{}{
+		"token":        token,
+		"grace_period": int(grace.Seconds()),
+	})
+	req, err := utils.NewNodeRequest(node, "POST", "/api/system/token", body)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := utils.NodeClient(node, 10*time.Second).Do(req)
+	if err != nil {
+		log.Printf("[Core] Failed to push rotated token to node %s: %v", node.Name, err)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("[Core] Node %s rejected rotated token (status %d)", node.Name, resp.StatusCode)
+		return false
+	}
+	return true
+}
+
 // DeleteNode removes a node
 func DeleteNode(c *gin.Context) {
 	nodeID := c.Param("id")
@@ -91,6 +216,9 @@ func DeleteNode(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete node"})
 		return
 	}
+	if id, err := strconv.ParseUint(nodeID, 10, 64); err == nil {
+		utils.ForgetNodeTransport(uint(id))
+	}
 
 	utils.LogActivity(c, 0, "delete", "node", fmt.Sprintf("Removed node ID: %s from the network", nodeID), nil)
 
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -18,7 +17,8 @@ import (
 type CreateServiceRequest struct {
 	Name        string `json:"name"`
 	NodeID      uint   `json:"node_id"`
-	UserID      uint   `json:"user_id"` // Explicit owner
+	LocationID  uint   `json:"location_id"` // Instead of NodeID, to let Core pick a node there
+	UserID      uint   `json:"user_id"`     // Explicit owner
 	EggID       uint   `json:"egg_id"`
 	Memory      uint64 `json:"memory"`
 	Disk        uint64 `json:"disk"`
@@ -26,6 +26,20 @@ type CreateServiceRequest struct {
 	Port        int    `json:"port"`
 	Environment string `json:"environment"`
 	DockerImage string `json:"docker_image"`
+
+	DatabaseLimit int `json:"database_limit"`
+}
+
+// maxResource caps the memory and disk (MB) and CPU (%) of a service or quota. It is far beyond any
+// real node, so sums of allocations stay well inside a uint64 and PostgreSQL's bigint.
+const maxResource = 1 << 40
+
+// validateResources rejects resource values too large to be real, before anything adds them up
+func validateResources(memory, disk, cpu uint64) error {
+	if memory > maxResource || disk > maxResource || cpu > maxResource {
+		return fmt.Errorf("memory, disk and CPU can be at most %d", uint64(maxResource))
+	}
+	return nil
 }
 
 func checkNodeResources(nodeID uint, reqMem, reqDisk uint64, excludeServiceID uint) error {
@@ -53,20 +67,30 @@ func checkNodeResources(nodeID uint, reqMem, reqDisk uint64, excludeServiceID ui
 		usedDisk += s.Disk
 	}
 
-	if usedMem+reqMem > node.TotalRAM {
-		return fmt.Errorf("insufficient RAM on node (Available: %dMB, Requested: %dMB)", node.TotalRAM-usedMem, reqMem)
+	// Compared against what is left, since adding the request to the total could wrap around
+	if reqMem > remaining(node.TotalRAM, usedMem) {
+		return fmt.Errorf("insufficient RAM on node (Available: %dMB, Requested: %dMB)", remaining(node.TotalRAM, usedMem), reqMem)
 	}
-	if usedDisk+reqDisk > node.TotalDisk {
-		return fmt.Errorf("insufficient Disk on node (Available: %dMB, Requested: %dMB)", node.TotalDisk-usedDisk, reqDisk)
+	if reqDisk > remaining(node.TotalDisk, usedDisk) {
+		return fmt.Errorf("insufficient Disk on node (Available: %dMB, Requested: %dMB)", remaining(node.TotalDisk, usedDisk), reqDisk)
 	}
 
 	return nil
 }
 
-// GetServices returns all services with their relations
+// GetServices returns all services with their relations, optionally only those in ?location=
 func GetServices(c *gin.Context) {
+	location, ok := locationQuery(c)
+	if !ok {
+		return
+	}
+
 	var services []models.Service
-	if err := database.DB.Preload("Node").Preload("Egg.Nest").Preload("Egg.Variables").Preload("User").Find(&services).Error; err != nil {
+	query := database.DB.Preload("Node.Location").Preload("Egg.Nest").Preload("Egg.Variables").Preload("User")
+	if location != nil {
+		query = query.Where("node_id IN (?)", database.DB.Model(&models.Node{}).Select("id").Where("location_id = ?", location.ID))
+	}
+	if err := query.Find(&services).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch services"})
 		return
 	}
@@ -81,19 +105,41 @@ func CreateService(c *gin.Context) {
 		return
 	}
 
-	// 1. Fetch Node
-	var node models.Node
-	if err := database.DB.First(&node, req.NodeID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+	if req.DatabaseLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "database_limit can't be negative"})
 		return
 	}
-
-	// 1.5 Check Resources
-	if err := checkNodeResources(req.NodeID, req.Memory, req.Disk, 0); err != nil {
+	if err := validateResources(req.Memory, req.Disk, req.Cpu); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 1. Fetch Node, or pick one in the location. A port of 0 is then picked too.
+	var node models.Node
+	if req.NodeID == 0 && req.LocationID != 0 {
+		if err := database.DB.First(&models.Location{}, req.LocationID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		picked, port, err := pickNode(nodeFilter{LocationIDs: []uint{req.LocationID}}, req.Memory, req.Disk, req.Port)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		node, req.NodeID, req.Port = *picked, picked.ID, port
+	} else {
+		if err := database.DB.First(&node, req.NodeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+			return
+		}
+
+		// 1.5 Check Resources
+		if err := checkNodeResources(req.NodeID, req.Memory, req.Disk, 0); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// 2. Fetch Egg
 	var egg models.Egg
 	if err := database.DB.Preload("Variables").First(&egg, req.EggID).Error; err != nil {
@@ -102,23 +148,14 @@ func CreateService(c *gin.Context) {
 	}
 
 	// 2a. Merge Environment Overrides with Defaults
-	envMap := make(map[string]string)
+	overrides := make(map[string]string)
 	if req.Environment != "" {
-		json.Unmarshal([]byte(req.Environment), &envMap)
-	}
-
-	// Fill in defaults for missing keys
-	for _, v := range egg.Variables {
-		if _, exists := envMap[v.EnvironmentVariable]; !exists {
-			envMap[v.EnvironmentVariable] = v.DefaultValue
-		}
+		json.Unmarshal([]byte(req.Environment), &overrides)
 	}
-	envJSON, _ := json.Marshal(envMap)
-	req.Environment = string(envJSON)
+	req.Environment, _ = eggEnvironment(&egg, overrides, false)
 
 	// 3. Create Service Record
 	service := models.Service{
-		UUID:        uuid.New().String(),
 		Name:        req.Name,
 		UserID:      req.UserID,
 		NodeID:      req.NodeID,
@@ -129,8 +166,26 @@ func CreateService(c *gin.Context) {
 		Port:        req.Port,
 		Environment: req.Environment,
 		DockerImage: req.DockerImage,
+
+		DatabaseLimit: req.DatabaseLimit,
+	}
+
+	// 4. Save and send Create Request to Daemon
+	if status, err := provisionService(&node, &service, &egg); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
 	}
 
+	utils.LogActivity(c, service.ID, "create", "service", fmt.Sprintf("Provisioned new service: %s", service.Name), nil)
+
+	c.JSON(http.StatusCreated, service)
+}
+
+// provisionService saves a new service and has its node create it, removing the record again
+// if the node fails. It returns the HTTP status to respond with on error.
+func provisionService(node *models.Node, service *models.Service, egg *models.Egg) (int, error) {
+	service.UUID = uuid.New().String()
+
 	// Default to first image if none selected
 	if service.DockerImage == "" {
 		var images []string
@@ -140,25 +195,18 @@ func CreateService(c *gin.Context) {
 		}
 	}
 
-	if err := database.DB.Create(&service).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service record"})
-		return
+	if err := database.DB.Create(service).Error; err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Failed to create service record")
 	}
 
-	// 4. Send Create Request to Daemon
-	if err := notifyDaemon(&node, &service, &egg); err != nil {
-		database.DB.Delete(&service)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to contact node: " + err.Error()})
-		return
+	if err := notifyDaemon(node, service, egg); err != nil {
+		database.DB.Delete(service)
+		return http.StatusBadGateway, fmt.Errorf("Failed to contact node: %v", err)
 	}
-
-	utils.LogActivity(c, service.ID, "create", "service", fmt.Sprintf("Provisioned new service: %s", service.Name), nil)
-
-	c.JSON(http.StatusCreated, service)
+	return 0, nil
 }
 
 func notifyDaemon(node *models.Node, service *models.Service, egg *models.Egg) error {
-	url := fmt.Sprintf("http://%s:%s/api/servers", node.Address, node.Port)
 
 	eggImage := service.DockerImage
 	if eggImage == "" {
@@ -183,16 +231,13 @@ func notifyDaemon(node *models.Node, service *models.Service, egg *models.Egg) e
 	}
 
 	body, _ := json.Marshal(payload)
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	req.Header.Set("X-Node-Token", node.Token)
+	client := utils.NodeClient(node, 10*time.Second)
+	req, _ := utils.NewNodeRequest(node, "POST", "/api/servers", body)
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("[Core] !! Daemon Connection Error !! URL: %s, Error: %v", url, err)
+		log.Printf("[Core] !! Daemon Connection Error !! Node: %s, Error: %v", node.Name, err)
 		return err
 	}
 	defer resp.Body.Close()
@@ -229,13 +274,16 @@ func DeleteService(c *gin.Context) {
 	}
 
 	// Delete related records first to avoid foreign key constraints
-	// 1. Delete service_users
+	// 1. Drop its SQL databases
+	dropServiceDatabases(c.Request.Context(), &service)
+
+	// 2. Delete service_users
 	database.DB.Where("service_id = ?", service.ID).Delete(&models.ServiceUser{})
 
-	// 2. Delete activity logs (if they exist)
+	// 3. Delete activity logs (if they exist)
 	database.DB.Exec("DELETE FROM activity_logs WHERE service_id = ?", service.ID)
 
-	// 3. Now delete the service itself
+	// 4. Now delete the service itself
 	if err := database.DB.Unscoped().Delete(&service).Error; err != nil {
 		log.Printf("[Core] Error deleting service from database: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from database: " + err.Error()})
@@ -248,13 +296,8 @@ func DeleteService(c *gin.Context) {
 }
 
 func notifyDaemonDelete(node *models.Node, uuid string) error {
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s", node.Address, node.Port, uuid)
-
-	client := &http.Client{
-		Timeout: 1 * time.Second,
-	}
-	req, _ := http.NewRequest("DELETE", url, nil)
-	req.Header.Set("X-Node-Token", node.Token)
+	client := utils.NodeClient(node, 1*time.Second)
+	req, _ := utils.NewNodeRequest(node, "DELETE", fmt.Sprintf("/api/servers/%s", uuid), nil)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -284,6 +327,15 @@ func UpdateService(c *gin.Context) {
 		return
 	}
 
+	if req.DatabaseLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "database_limit can't be negative"})
+		return
+	}
+	if err := validateResources(req.Memory, req.Disk, req.Cpu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check resources if limits changed
 	if req.Memory != service.Memory || req.Disk != service.Disk {
 		if err := checkNodeResources(service.NodeID, req.Memory, req.Disk, service.ID); err != nil {
@@ -298,6 +350,7 @@ func UpdateService(c *gin.Context) {
 	service.Disk = req.Disk
 	service.Cpu = req.Cpu
 	service.DockerImage = req.DockerImage
+	service.DatabaseLimit = req.DatabaseLimit
 
 	if err := database.DB.Save(&service).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service"})
@@ -315,8 +368,6 @@ func UpdateService(c *gin.Context) {
 }
 
 func notifyDaemonUpdate(node *models.Node, service *models.Service, egg *models.Egg) error {
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s", node.Address, node.Port, service.UUID)
-
 	payload := map[string]interface{}{
 		"memory":          service.Memory,
 		"disk":            service.Disk,
@@ -328,11 +379,8 @@ func notifyDaemonUpdate(node *models.Node, service *models.Service, egg *models.
 	}
 
 	body, _ := json.Marshal(payload)
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(body))
-	req.Header.Set("X-Node-Token", node.Token)
+	client := utils.NodeClient(node, 5*time.Second)
+	req, _ := utils.NewNodeRequest(node, "PUT", fmt.Sprintf("/api/servers/%s", service.UUID), body)
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
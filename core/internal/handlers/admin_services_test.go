@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+func TestCheckNodeResources(t *testing.T) {
+	testDB(t)
+
+	owner := models.User{Username: "owner", Password: "x"}
+	node := models.Node{Name: "node", Address: "127.0.0.1", TotalRAM: 8192, TotalDisk: 102400}
+	untracked := models.Node{Name: "untracked", Address: "127.0.0.2"}
+	for _, record := range []interface{}{&owner, &node, &untracked} {
+		if err := database.DB.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	existing := models.Service{UUID: "11111111-1111-1111-1111-111111111111", Name: "existing", UserID: owner.ID, NodeID: node.ID, Memory: 6144, Disk: 51200, Cpu: 100, Port: 25565}
+	if err := database.DB.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		nodeID    uint
+		mem, disk uint64
+		exclude   uint
+		wantErr   string
+	}{
+		{name: "fits", nodeID: node.ID, mem: 2048, disk: 51200},
+		{name: "memory", nodeID: node.ID, mem: 2049, disk: 1, wantErr: "Available: 2048MB"},
+		{name: "disk", nodeID: node.ID, mem: 1, disk: 51201, wantErr: "insufficient Disk"},
+		// Resizing a service doesn't count its current allocation against it
+		{name: "resize", nodeID: node.ID, mem: 8192, disk: 102400, exclude: existing.ID},
+		// used + request wraps to a small number, which the old comparison let through
+		{name: "wraps around", nodeID: node.ID, mem: math.MaxUint64 - 1000, disk: 1, wantErr: "insufficient RAM"},
+		{name: "untracked node", nodeID: untracked.ID, mem: math.MaxUint64, disk: math.MaxUint64},
+		{name: "missing node", nodeID: untracked.ID + 100, mem: 1, disk: 1, wantErr: "node not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNodeResources(tt.nodeID, tt.mem, tt.disk, tt.exclude)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkNodeResources: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkNodeResources = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
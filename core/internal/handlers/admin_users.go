@@ -1,18 +1,20 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luketaylor45/atlas/core/internal/database"
 	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // GetUsers returns all users in the system
 func GetUsers(c *gin.Context) {
 	var users []models.User
-	if err := database.DB.Find(&users).Error; err != nil {
+	if err := database.DB.Preload("Quota").Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
@@ -24,7 +26,10 @@ func CreateUser(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required,min=8"`
+		Email    string `json:"email"` // Used to link the account on first SSO login
 		IsAdmin  bool   `json:"is_admin"`
+
+		Quota *models.UserQuota `json:"quota"` // Optional self-service limits
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,6 +37,13 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	if req.Quota != nil {
+		if err := validateUserQuota(req.Quota); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Check if username is taken
 	var existing models.User
 	if err := database.DB.Where("LOWER(username) = LOWER(?)", req.Username).First(&existing).Error; err == nil {
@@ -49,6 +61,7 @@ func CreateUser(c *gin.Context) {
 	user := models.User{
 		Username: req.Username,
 		Password: string(hashedPassword),
+		Email:    req.Email,
 		IsAdmin:  req.IsAdmin,
 	}
 
@@ -56,6 +69,11 @@ func CreateUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
+	if req.Quota != nil {
+		req.Quota.UserID = user.ID
+		database.DB.Create(req.Quota)
+		user.Quota = req.Quota
+	}
 
 	c.JSON(http.StatusCreated, user)
 }
@@ -70,9 +88,12 @@ func UpdateUser(c *gin.Context) {
 	}
 
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		IsAdmin  *bool  `json:"is_admin"` // Pointer to distinguish between false and unset
+		Username string  `json:"username"`
+		Password string  `json:"password"`
+		Email    *string `json:"email"`
+		IsAdmin  *bool   `json:"is_admin"` // Pointer to distinguish between false and unset
+
+		Quota *models.UserQuota `json:"quota"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -89,15 +110,43 @@ func UpdateUser(c *gin.Context) {
 		}
 		user.Username = req.Username
 	}
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+
+	// Password and privilege changes log the user out everywhere
+	revokeSessions := false
 	if req.Password != "" {
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		user.Password = string(hashedPassword)
+		revokeSessions = true
 	}
 	if req.IsAdmin != nil {
+		revokeSessions = revokeSessions || user.IsAdmin != *req.IsAdmin
 		user.IsAdmin = *req.IsAdmin
 	}
 
-	database.DB.Save(&user)
+	if req.Quota != nil {
+		if err := validateUserQuota(req.Quota); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var current models.UserQuota
+		if database.DB.Where("user_id = ?", user.ID).First(&current).Error == nil {
+			req.Quota.CreatedAt = current.CreatedAt
+		}
+		req.Quota.UserID = user.ID
+		if err := database.DB.Save(req.Quota).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quota"})
+			return
+		}
+		user.Quota = req.Quota
+	}
+
+	database.DB.Omit("Quota").Save(&user)
+	if revokeSessions {
+		utils.RevokeUserSessions(user.ID)
+	}
 	c.JSON(http.StatusOK, user)
 }
 
@@ -113,10 +162,37 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&models.User{}, id).Error; err != nil {
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
+	utils.RevokeUserSessions(user.ID)
+	database.DB.Where("user_id = ?", user.ID).Delete(&models.SSHKey{})
+	database.DB.Where("user_id = ?", user.ID).Delete(&models.UserQuota{})
 
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
+
+// validateUserQuota checks an admin's quota settings and tidies its ID lists
+func validateUserQuota(quota *models.UserQuota) error {
+	if quota.Services < 0 || quota.DatabaseLimit < 0 {
+		return fmt.Errorf("quota limits can't be negative")
+	}
+	if err := validateResources(quota.Memory, quota.Disk, quota.Cpu); err != nil {
+		return err
+	}
+	for _, list := range []*string{&quota.AllowedNests, &quota.AllowedEggs, &quota.AllowedNodes, &quota.AllowedLocations} {
+		normalized, err := normalizeQuotaIDs(*list)
+		if err != nil {
+			return err
+		}
+		*list = normalized
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Scopes     []string   `json:"scopes" binding:"required"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// GetAPIKeys returns the current user's personal API keys
+func GetAPIKeys(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var keys []models.APIKey
+	if err := database.DB.Where("user_id = ? AND type = ? AND revoked_at IS NULL", userID, "personal").Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey issues a personal API key. The key itself is only returned once.
+func CreateAPIKey(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.PersonalKeyScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown scope: %s", scope)})
+			return
+		}
+	}
+	for _, entry := range req.AllowedIPs {
+		if !utils.ValidIPEntry(entry) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid IP address or range: %s", entry)})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	key, prefix, hash := utils.GenerateAPIKey(utils.PersonalKeyPrefix)
+	scopes, _ := json.Marshal(req.Scopes)
+	allowedIPs := ""
+	if len(req.AllowedIPs) > 0 {
+		ips, _ := json.Marshal(req.AllowedIPs)
+		allowedIPs = string(ips)
+	}
+
+	apiKey := models.APIKey{
+		UserID:     userID,
+		Type:       "personal",
+		Name:       req.Name,
+		Prefix:     prefix,
+		KeyHash:    hash,
+		Scopes:     string(scopes),
+		AllowedIPs: allowedIPs,
+		ExpiresAt:  req.ExpiresAt,
+	}
+
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "api_key_create", apiKey.Prefix, fmt.Sprintf("Created API key: %s", apiKey.Name), map[string]interface{}{
+		"scopes": req.Scopes,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// RevokeAPIKey revokes one of the current user's personal API keys
+func RevokeAPIKey(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var apiKey models.APIKey
+	if err := database.DB.Where("id = ? AND user_id = ? AND type = ?", c.Param("id"), userID, "personal").First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		if err := database.DB.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		utils.LogActivity(c, 0, "api_key_revoke", apiKey.Prefix, fmt.Sprintf("Revoked API key: %s", apiKey.Name), nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/auth"
+	"github.com/luketaylor45/atlas/core/internal/config"
 	"github.com/luketaylor45/atlas/core/internal/database"
 	"github.com/luketaylor45/atlas/core/internal/models"
 	"github.com/luketaylor45/atlas/core/internal/utils"
@@ -15,6 +21,11 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3"`
 	Password string `json:"password" binding:"required,min=8"`
@@ -27,42 +38,128 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := database.DB.Where("LOWER(username) = LOWER(?)", req.Username).First(&user).Error; err != nil {
+	if rejectLocked(c, c.ClientIP(), req.Username) {
+		return
+	}
+
+	// Check the password with the local database or the configured directory
+	user, err := auth.Authenticate(req.Username, req.Password)
+	if errors.Is(err, auth.ErrUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication service is unavailable, please try again later"})
+		return
+	}
+	if err != nil {
+		utils.RecordLoginFailure(c.ClientIP(), req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
-	// ... [rest of Login function is same]
-	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+
+	if localLoginDisabled(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password login is disabled, please use single sign-on"})
+		return
+	}
+
+	// With 2FA enabled the password only earns a challenge token for LoginTwoFactor
+	if user.TOTPEnabled {
+		challenge, err := utils.GenerateChallengeToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
+		return
+	}
+
+	// Start a session
+	utils.RecordLoginSuccess(user.Username)
+	token, refreshToken, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user,
+	})
+}
+
+// LoginTwoFactor completes a login with the challenge token from Login and a TOTP or recovery code
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := utils.ValidateChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login has expired, please sign in again"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil || !user.TOTPEnabled {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate JWT
-	token, err := utils.GenerateToken(user.ID, user.IsAdmin)
+	if rejectLocked(c, c.ClientIP(), user.Username) {
+		return
+	}
+	if !verifySecondFactor(&user, req.Code) {
+		utils.RecordLoginFailure(c.ClientIP(), user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	utils.RecordLoginSuccess(user.Username)
+
+	token, refreshToken, err := startSession(c, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user,
 	})
 }
 
 // Register creates a new regular user account
 func Register(c *gin.Context) {
+	if config.AppConfig.DisableLocalLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled, please use single sign-on"})
+		return
+	}
+
+	if rejectLocked(c, c.ClientIP(), "") {
+		return
+	}
+	if wait, locked := utils.RegistrationLocked(c.ClientIP()); locked {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Too many registrations, try again in %s", wait.Round(time.Second))})
+		return
+	}
+	// Every attempt counts, including the ones that create an account
+	utils.RecordRegistration(c.ClientIP())
+
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RecordLoginFailure(c.ClientIP(), "")
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if username is taken
+	// Check if username is taken (counted as a failure so usernames can't be enumerated quickly)
 	var existing models.User
 	if err := database.DB.Where("LOWER(username) = LOWER(?)", req.Username).First(&existing).Error; err == nil {
+		utils.RecordLoginFailure(c.ClientIP(), "")
 		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
 		return
 	}
@@ -84,24 +181,30 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Generate token for immediate login
-	token, err := utils.GenerateToken(user.ID, user.IsAdmin)
+	// Start a session for immediate login
+	token, refreshToken, err := startSession(c, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User created but login failed: " + err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"token":   token,
-		"user":    user,
+		"message":       "User registered successfully",
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user,
 	})
 }
 
 // InitialSetup creates the first admin user if no users exist
 func InitialSetup(c *gin.Context) {
+	if rejectLocked(c, c.ClientIP(), "") {
+		return
+	}
+
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RecordLoginFailure(c.ClientIP(), "")
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -110,6 +213,7 @@ func InitialSetup(c *gin.Context) {
 	var count int64
 	database.DB.Model(&models.User{}).Count(&count)
 	if count > 0 {
+		utils.RecordLoginFailure(c.ClientIP(), "")
 		c.JSON(http.StatusForbidden, gin.H{"error": "Setup already completed"})
 		return
 	}
@@ -134,16 +238,34 @@ func InitialSetup(c *gin.Context) {
 	// Seed default eggs as part of the setup procedure
 	//database.SeedDefaults()
 
-	// Generate token for automatic login
-	token, _ := utils.GenerateToken(user.ID, user.IsAdmin)
+	// Start a session for automatic login
+	token, refreshToken, _ := startSession(c, &user)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Admin user created and defaults seeded",
-		"token":   token,
-		"user":    user,
+		"message":       "Admin user created and defaults seeded",
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user,
 	})
 }
 
+// localLoginDisabled reports whether user may not log in with their local password. Local password
+// login can be limited to admins when SSO is the primary sign-in method.
+func localLoginDisabled(user *models.User) bool {
+	return config.AppConfig.DisableLocalLogin && user.AuthSource == models.AuthSourceLocal && !user.IsAdmin
+}
+
+// rejectLocked answers 429 if the IP or username is locked out after too many failures
+func rejectLocked(c *gin.Context, ip, username string) bool {
+	wait, locked := utils.LoginLocked(ip, username)
+	if !locked {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Too many failed attempts, try again in %s", wait.Round(time.Second))})
+	return true
+}
+
 // GetSetupStatus checks if the system needs setup
 func GetSetupStatus(c *gin.Context) {
 	var count int64
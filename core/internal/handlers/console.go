@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+var consoleUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ServiceStats proxies a resource usage snapshot from the node
+func ServiceStats(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	uuid := c.Param("uuid")
+
+	service, _, ok := utils.FindServiceForUser(uuid, userID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found or no access"})
+		return
+	}
+
+	req, _ := utils.NewNodeRequest(&service.Node, "GET", fmt.Sprintf("/api/servers/%s/stats", service.UUID), nil)
+
+	client := utils.NodeClient(&service.Node, 10*time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
+		return
+	}
+	defer resp.Body.Close()
+
+	c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+}
+
+// ServiceConsole bridges the browser's console websocket to the node's console stream
+func ServiceConsole(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	uuid := c.Param("uuid")
+
+	service, subUser, ok := utils.FindServiceForUser(uuid, userID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found or no access"})
+		return
+	}
+
+	// Permission check
+	if subUser != nil && !subUser.CanViewConsole {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to view the console for this server"})
+		return
+	}
+
+	// Connect to the node first so failures are still reported over plain HTTP
+	nodeReq, _ := utils.NewNodeRequest(&service.Node, "GET", fmt.Sprintf("/api/servers/%s/console", service.UUID), nil)
+	wsURL := strings.Replace(nodeReq.URL.String(), "http", "ws", 1)
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:  utils.NodeTLSConfig(&service.Node),
+	}
+	nodeConn, _, err := dialer.Dial(wsURL, nodeReq.Header)
+	if err != nil {
+		log.Printf("[Core] Failed to open console for %s on node %s: %v", service.UUID, service.Node.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
+		return
+	}
+	defer nodeConn.Close()
+
+	clientConn, err := consoleUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer clientConn.Close()
+
+	// Close the node stream when the browser goes away
+	go func() {
+		for {
+			if _, _, err := clientConn.ReadMessage(); err != nil {
+				nodeConn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		msgType, data, err := nodeConn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := clientConn.WriteMessage(msgType, data); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testDB points database.DB at a fresh schema in the PostgreSQL database named by
+// ATLAS_TEST_DATABASE_URL, and skips the test when that isn't set. For example:
+//
+//	docker run --rm -d -p 5432:5432 -e POSTGRES_PASSWORD=atlas postgres:16-alpine
+//	ATLAS_TEST_DATABASE_URL="host=localhost user=postgres password=atlas sslmode=disable" go test ./...
+func testDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("ATLAS_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("set ATLAS_TEST_DATABASE_URL to a PostgreSQL database to run this test")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to the test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One connection, so the search path set below applies to every query
+	sqlDB.SetMaxOpenConns(1)
+
+	schema := "atlas_test_" + utils.RandomString(6)
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	db.Exec("SET search_path TO " + schema)
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		sqlDB.Close()
+	})
+
+	err = db.AutoMigrate(&models.User{}, &models.Location{}, &models.Node{}, &models.Nest{}, &models.Egg{}, &models.EggVariable{}, &models.Service{}, &models.ServiceUser{}, &models.ActivityLog{}, &models.News{}, &models.APIKey{}, &models.Session{}, &models.SSHKey{}, &models.DatabaseHost{}, &models.ServiceDatabase{}, &models.UserQuota{})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+}
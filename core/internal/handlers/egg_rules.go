@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+var (
+	alphaNumPattern  = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+	alphaDashPattern = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+	// The end of a PHP style /pattern/flags, which may itself contain |
+	regexEndPattern = regexp.MustCompile(`/[imsxu]*$`)
+)
+
+// splitRules breaks an egg variable's Laravel style rules (e.g. required|string|max:20) into
+// their parts, keeping a regex that contains | in one piece
+func splitRules(rules string) []string {
+	parts := strings.Split(rules, "|")
+	out := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		part := strings.TrimSpace(parts[i])
+		if name, _, _ := strings.Cut(part, ":"); name == "regex" || name == "not_regex" {
+			for i+1 < len(parts) && !regexComplete(part[len(name)+1:]) {
+				i++
+				part += "|" + parts[i]
+			}
+		}
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// regexComplete reports whether expr is a whole /pattern/flags
+func regexComplete(expr string) bool {
+	return len(expr) > 1 && expr[0] == '/' && regexEndPattern.MatchString(expr[1:])
+}
+
+// compileRuleRegex turns a PHP style /pattern/flags into a Go regexp
+func compileRuleRegex(expr string) (*regexp.Regexp, error) {
+	if len(expr) < 2 || expr[0] != '/' {
+		return nil, fmt.Errorf("missing delimiters")
+	}
+	end := strings.LastIndex(expr, "/")
+	if end == 0 {
+		return nil, fmt.Errorf("missing delimiters")
+	}
+	pattern, flags := expr[1:end], ""
+	for _, f := range expr[end+1:] {
+		if strings.ContainsRune("ims", f) {
+			flags += string(f)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// validateEggVariable checks value against the variable's rules. Rules Core doesn't know are
+// ignored, like a malformed regex, which is logged for the admin to fix.
+func validateEggVariable(v models.EggVariable, value string) error {
+	rules := splitRules(v.Rules)
+
+	numeric := false
+	for _, rule := range rules {
+		switch rule {
+		case "numeric", "integer", "int":
+			numeric = true
+		}
+	}
+
+	if value == "" {
+		for _, rule := range rules {
+			if rule == "required" {
+				return fmt.Errorf("%s is required", v.Name)
+			}
+		}
+		return nil
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, ":")
+		switch name {
+		case "numeric":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("%s must be a number", v.Name)
+			}
+		case "integer", "int":
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("%s must be a whole number", v.Name)
+			}
+		case "boolean", "bool":
+			switch value {
+			case "0", "1", "true", "false":
+			default:
+				return fmt.Errorf("%s must be true or false", v.Name)
+			}
+		case "alpha_num":
+			if !alphaNumPattern.MatchString(value) {
+				return fmt.Errorf("%s may only contain letters and numbers", v.Name)
+			}
+		case "alpha_dash":
+			if !alphaDashPattern.MatchString(value) {
+				return fmt.Errorf("%s may only contain letters, numbers, dashes and underscores", v.Name)
+			}
+		case "url":
+			if u, err := url.ParseRequestURI(value); err != nil || u.Host == "" {
+				return fmt.Errorf("%s must be a URL", v.Name)
+			}
+		case "in", "not_in":
+			found := false
+			for _, option := range strings.Split(arg, ",") {
+				if value == option {
+					found = true
+					break
+				}
+			}
+			if name == "in" && !found {
+				return fmt.Errorf("%s must be one of: %s", v.Name, strings.ReplaceAll(arg, ",", ", "))
+			}
+			if name == "not_in" && found {
+				return fmt.Errorf("%s can't be %q", v.Name, value)
+			}
+		case "min", "max", "size", "between":
+			bounds := strings.Split(arg, ",")
+			limits := make([]float64, 0, len(bounds))
+			for _, b := range bounds {
+				n, err := strconv.ParseFloat(b, 64)
+				if err != nil {
+					break
+				}
+				limits = append(limits, n)
+			}
+			if len(limits) != len(bounds) || (name == "between") != (len(limits) == 2) || len(limits) == 0 {
+				log.Printf("[Eggs] Ignoring malformed rule %q of variable %s", rule, v.EnvironmentVariable)
+				continue
+			}
+
+			measure, unit := float64(utf8.RuneCountInString(value)), " characters"
+			if numeric {
+				measure, _ = strconv.ParseFloat(value, 64)
+				unit = ""
+			}
+			switch {
+			case name == "min" && measure < limits[0]:
+				return fmt.Errorf("%s must be at least %s%s", v.Name, bounds[0], unit)
+			case name == "max" && measure > limits[0]:
+				return fmt.Errorf("%s may not be greater than %s%s", v.Name, bounds[0], unit)
+			case name == "size" && measure != limits[0]:
+				return fmt.Errorf("%s must be %s%s", v.Name, bounds[0], unit)
+			case name == "between" && (measure < limits[0] || measure > limits[1]):
+				return fmt.Errorf("%s must be between %s and %s%s", v.Name, bounds[0], bounds[1], unit)
+			}
+		case "regex", "not_regex":
+			re, err := compileRuleRegex(arg)
+			if err != nil {
+				log.Printf("[Eggs] Ignoring malformed rule %q of variable %s: %v", rule, v.EnvironmentVariable, err)
+				continue
+			}
+			if re.MatchString(value) != (name == "regex") {
+				return fmt.Errorf("%s is not in the expected format", v.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// eggEnvironment merges environment overrides into the egg's variable defaults. Users may only
+// set variables they can edit and the result must pass every variable's rules; admins
+// (userSet false) may set anything.
+func eggEnvironment(egg *models.Egg, overrides map[string]string, userSet bool) (string, error) {
+	variables := make(map[string]models.EggVariable, len(egg.Variables))
+	for _, v := range egg.Variables {
+		variables[v.EnvironmentVariable] = v
+	}
+
+	env := make(map[string]string, len(egg.Variables)+len(overrides))
+	for key, value := range overrides {
+		if userSet {
+			v, ok := variables[key]
+			if !ok {
+				return "", fmt.Errorf("unknown variable %s", key)
+			}
+			if !v.UserEditable {
+				return "", fmt.Errorf("%s can't be changed", v.Name)
+			}
+		}
+		env[key] = value
+	}
+
+	for _, v := range egg.Variables {
+		if _, exists := env[v.EnvironmentVariable]; !exists {
+			env[v.EnvironmentVariable] = v.DefaultValue
+		}
+		if userSet {
+			if err := validateEggVariable(v, env[v.EnvironmentVariable]); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	envJSON, _ := json.Marshal(env)
+	return string(envJSON), nil
+}
@@ -9,7 +9,6 @@ import (
 )
 
 type ServiceStatusRequest struct {
-	Token    string `json:"token" binding:"required"`
 	Status   string `json:"status" binding:"required"`
 	Stage    string `json:"stage"`
 	Progress int    `json:"progress"`
@@ -23,12 +22,8 @@ func HandleServerStatusUpdate(c *gin.Context) {
 		return
 	}
 
-	// Verify node token
-	var node models.Node
-	if err := database.DB.Where("token = ?", req.Token).First(&node).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid node token"})
-		return
-	}
+	// Node authenticated by NodeAuthMiddleware
+	node := c.MustGet("node").(*models.Node)
 
 	// Update service status
 	updates := map[string]interface{}{
@@ -41,7 +36,8 @@ func HandleServerStatusUpdate(c *gin.Context) {
 		updates["installation_progress"] = req.Progress
 	}
 
-	if err := database.DB.Model(&models.Service{}).Where("uuid = ?", uuid).Updates(updates).Error; err != nil {
+	// A node may only report on services it hosts
+	if err := database.DB.Model(&models.Service{}).Where("uuid = ? AND node_id = ?", uuid, node.ID).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
 		return
 	}
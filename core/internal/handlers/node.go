@@ -1,17 +1,21 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luketaylor45/atlas/core/internal/database"
 	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
 )
 
 type HeartbeatRequest struct {
-	Token string `json:"token" binding:"required"`
-	Stats struct {
+	TLSFingerprint  string `json:"tls_fingerprint"`
+	SFTPFingerprint string `json:"sftp_fingerprint"`
+	Stats           struct {
 		CPU float64 `json:"cpu"`
 		RAM float64 `json:"ram"`
 	} `json:"stats"`
@@ -24,20 +28,35 @@ func HandleHeartbeat(c *gin.Context) {
 		return
 	}
 
-	// Find node by token
-	var node models.Node
-	if err := database.DB.Where("token = ?", req.Token).First(&node).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid node token"})
-		return
+	// Node authenticated by NodeAuthMiddleware
+	node := c.MustGet("node").(*models.Node)
+
+	// Only the heartbeat columns are written. The node was loaded before the request, and saving
+	// the whole row could put back credentials a concurrent token rotation has just replaced.
+	updates := map[string]interface{}{
+		"last_heartbeat": time.Now(),
+		"is_online":      true,
+		"used_cpu":       req.Stats.CPU,
+		"used_ram":       uint64(req.Stats.RAM),
 	}
 
-	// Update heartbeat
-	node.IsOnline = true
-	node.LastHeartbeat = time.Now()
-	node.UsedCPU = req.Stats.CPU
-	node.UsedRAM = uint64(req.Stats.RAM)
+	// Pin the daemon certificate on first contact. A changed certificate is never
+	// accepted automatically; an admin has to clear or update the pin on the node.
+	reported := utils.NormalizeFingerprint(req.TLSFingerprint)
+	if reported != "" {
+		if node.TLSFingerprint == "" {
+			updates["tls_fingerprint"] = reported
+			log.Printf("[Core] Pinned TLS certificate for node %s: %s", node.Name, reported)
+			utils.LogActivityDirect(0, 0, "pin", "node", fmt.Sprintf("Pinned TLS certificate for node: %s", node.Name), c.ClientIP())
+		} else if utils.NormalizeFingerprint(node.TLSFingerprint) != reported {
+			log.Printf("[Core] !! Node %s reported certificate %s but %s is pinned !!", node.Name, reported, node.TLSFingerprint)
+		}
+	}
+	if req.SFTPFingerprint != "" {
+		updates["sftp_fingerprint"] = req.SFTPFingerprint
+	}
 
-	database.DB.Save(&node)
+	database.DB.Model(node).Updates(updates)
 
 	c.JSON(http.StatusOK, gin.H{"status": "acknowledged"})
 }
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+// A heartbeat that was authenticated before a token rotation must not write the old token back
+func TestHeartbeatKeepsRotatedToken(t *testing.T) {
+	testDB(t)
+
+	node := models.Node{Name: "node", Address: "127.0.0.1"}
+	utils.SetNodeToken(&node, "n_old-token")
+	node.TokenConfirmed = true
+	if err := database.DB.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The middleware loaded the node, then the token was rotated
+	stale := node
+	rotated := node
+	utils.SetNodeToken(&rotated, "n_new-token")
+	rotated.TokenConfirmed = false
+	if err := database.DB.Save(&rotated).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/heartbeat", func(c *gin.Context) {
+		c.Set("node", &stale)
+		HandleHeartbeat(c)
+	})
+	body := `{"tls_fingerprint":"AB:CD","sftp_fingerprint":"SHA256:x","stats":{"cpu":12.5,"ram":2048}}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/heartbeat", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("heartbeat = %d %s", w.Code, w.Body.String())
+	}
+
+	var stored models.Node
+	if err := database.DB.First(&stored, node.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokenHash != rotated.TokenHash || stored.TokenPrefix != rotated.TokenPrefix || stored.SigningKey != rotated.SigningKey {
+		t.Fatal("the heartbeat put the old token back")
+	}
+	if stored.TokenConfirmed {
+		t.Fatal("the heartbeat confirmed the rotated token")
+	}
+	if !stored.IsOnline || stored.UsedCPU != 12.5 || stored.UsedRAM != 2048 || stored.SFTPFingerprint != "SHA256:x" {
+		t.Fatalf("heartbeat not recorded: %+v", stored)
+	}
+	if stored.TLSFingerprint != "abcd" {
+		t.Fatalf("TLSFingerprint = %q, want the reported certificate pinned", stored.TLSFingerprint)
+	}
+}
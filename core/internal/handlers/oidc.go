@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/sso"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcStateCookie ties the callback to the browser that started the login
+const oidcStateCookie = "atlas_oidc_state"
+
+type OIDCExchangeRequest struct {
+	Ticket string `json:"ticket" binding:"required"`
+}
+
+// GetAuthProviders tells the login page which sign-in methods are available
+func GetAuthProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"local_login": !config.AppConfig.DisableLocalLogin,
+		"oidc": gin.H{
+			"enabled": sso.Enabled(),
+			"name":    config.AppConfig.OIDCName,
+		},
+	})
+}
+
+// OIDCLogin redirects the browser to the identity provider
+func OIDCLogin(c *gin.Context) {
+	provider, err := sso.GetProvider(c.Request.Context())
+	if err != nil {
+		log.Printf("[OIDC] %v", err)
+		redirectToPanel(c, "sso_error", "Single sign-on is unavailable")
+		return
+	}
+
+	authURL, state := provider.Begin()
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 600, "/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes the login, finds or provisions the user and hands the panel a one-time ticket
+func OIDCCallback(c *gin.Context) {
+	if errParam := c.Query("error"); errParam != "" {
+		redirectToPanel(c, "sso_error", "Sign-in was cancelled or denied")
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+	if state == "" || cookie != state {
+		redirectToPanel(c, "sso_error", "Sign-in request did not match, please try again")
+		return
+	}
+
+	provider, err := sso.GetProvider(c.Request.Context())
+	if err != nil {
+		redirectToPanel(c, "sso_error", "Single sign-on is unavailable")
+		return
+	}
+
+	identity, err := provider.Finish(c.Request.Context(), state, c.Query("code"))
+	if err != nil {
+		log.Printf("[OIDC] Login failed: %v", err)
+		redirectToPanel(c, "sso_error", "Sign-in could not be verified")
+		return
+	}
+
+	user, err := resolveOIDCUser(identity, c.ClientIP())
+	if err != nil {
+		redirectToPanel(c, "sso_error", err.Error())
+		return
+	}
+
+	redirectToPanel(c, "sso_ticket", sso.IssueTicket(user.ID))
+}
+
+// OIDCExchange swaps a ticket from OIDCCallback for a session
+func OIDCExchange(c *gin.Context) {
+	var req OIDCExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := sso.RedeemTicket(req.Ticket)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in has expired, please try again"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	token, refreshToken, err := startSession(c, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user,
+	})
+}
+
+// resolveOIDCUser finds the user linked to identity, links an existing user by verified email
+// (or username, if enabled), or provisions a new one. Admin rights follow the claim mapping if set.
+func resolveOIDCUser(identity *sso.Identity, ip string) (*models.User, error) {
+	cfg := config.AppConfig
+
+	var user models.User
+	err := database.DB.Where("oidc_issuer = ? AND oidc_subject = ?", identity.Issuer, identity.Subject).First(&user).Error
+	if err != nil {
+		linked := false
+		if identity.EmailVerified && identity.Email != "" {
+			linked = database.DB.Where("LOWER(email) = LOWER(?)", identity.Email).First(&user).Error == nil
+		}
+		if !linked && cfg.OIDCLinkByUsername && identity.Username != "" {
+			linked = database.DB.Where("LOWER(username) = LOWER(?)", identity.Username).First(&user).Error == nil
+		}
+
+		if linked {
+			if user.OIDCSubject != "" {
+				return nil, errors.New("This Atlas account is linked to a different identity")
+			}
+			updates := map[string]interface{}{"oidc_issuer": identity.Issuer, "oidc_subject": identity.Subject}
+			if user.Email == "" && identity.EmailVerified {
+				updates["email"] = identity.Email
+			}
+			database.DB.Model(&user).Updates(updates)
+			utils.LogActivityDirect(0, user.ID, "sso_link", "oidc", "Linked account to single sign-on identity", ip)
+		} else {
+			if !cfg.OIDCAutoProvision {
+				return nil, errors.New("No Atlas account is linked to this identity")
+			}
+			created, err := provisionOIDCUser(identity)
+			if err != nil {
+				return nil, err
+			}
+			user = *created
+			utils.LogActivityDirect(0, user.ID, "sso_provision", "oidc", "Created account from single sign-on", ip)
+		}
+	}
+
+	if identity.IsAdmin != nil && *identity.IsAdmin != user.IsAdmin {
+		user.IsAdmin = *identity.IsAdmin
+		database.DB.Model(&user).Update("is_admin", user.IsAdmin)
+		utils.RevokeUserSessions(user.ID)
+		utils.LogActivityDirect(0, user.ID, "sso_admin_sync", "oidc", fmt.Sprintf("Admin rights set to %t from identity provider", user.IsAdmin), ip)
+	}
+
+	return &user, nil
+}
+
+// provisionOIDCUser creates a user for a first-time SSO login. They get an unusable random password.
+func provisionOIDCUser(identity *sso.Identity) (*models.User, error) {
+	username := identity.Username
+	if username == "" && identity.Email != "" {
+		username = strings.Split(identity.Email, "@")[0]
+	}
+	if len(username) < 3 {
+		return nil, errors.New("Identity provider did not supply a usable username")
+	}
+
+	var existing models.User
+	if database.DB.Where("LOWER(username) = LOWER(?)", username).First(&existing).Error == nil {
+		return nil, fmt.Errorf("Username %s is already taken by another account", username)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(utils.RandomString(32)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("Failed to create user")
+	}
+
+	user := models.User{
+		Username:    username,
+		Password:    string(hashedPassword),
+		OIDCIssuer:  identity.Issuer,
+		OIDCSubject: identity.Subject,
+	}
+	if identity.EmailVerified {
+		user.Email = identity.Email
+	}
+	if identity.IsAdmin != nil {
+		user.IsAdmin = *identity.IsAdmin
+	}
+
+	if err := database.DB.Create(&user).Error; err != nil {
+		return nil, errors.New("Failed to create user")
+	}
+	return &user, nil
+}
+
+// redirectToPanel sends the browser back to the panel login page with a result in the URL fragment
+func redirectToPanel(c *gin.Context, key, value string) {
+	target := strings.TrimRight(config.AppConfig.OIDCPanelURL, "/") + "/login#" + key + "=" + url.QueryEscape(value)
+	c.Redirect(http.StatusFound, target)
+}
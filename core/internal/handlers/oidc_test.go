@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/sso"
+	"github.com/luketaylor45/atlas/core/internal/sso/ssotest"
+)
+
+// oidcLogin runs the browser side of a login against the mock provider and returns the
+// key and value Core hands back to the panel. Without withCookie the callback arrives from a
+// browser that didn't start the login.
+func oidcLogin(t *testing.T, mock *ssotest.Provider, claims map[string]interface{}, withCookie bool) (string, string) {
+	t.Helper()
+	router := gin.New()
+	router.GET("/api/v1/auth/oidc/login", OIDCLogin)
+	router.GET("/api/v1/auth/oidc/callback", OIDCCallback)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login answered %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+
+	code, state, err := mock.Authorize(w.Header().Get("Location"), claims)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/auth/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	if withCookie {
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	_, fragment, _ := strings.Cut(w.Header().Get("Location"), "#")
+	key, value, _ := strings.Cut(fragment, "=")
+	value, _ = url.QueryUnescape(value)
+	return key, value
+}
+
+// redeemedUser returns the user a ticket from the callback signs in as
+func redeemedUser(t *testing.T, key, value string) models.User {
+	t.Helper()
+	if key != "sso_ticket" {
+		t.Fatalf("callback returned %s=%s, want a ticket", key, value)
+	}
+	userID, ok := sso.RedeemTicket(value)
+	if !ok {
+		t.Fatal("ticket could not be redeemed")
+	}
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestOIDCCallbackLinksUsers(t *testing.T) {
+	testDB(t)
+
+	// The provider is discovered once per process, so every case shares this mock
+	mock := ssotest.NewProvider(t, "atlas", "client-secret")
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+	config.AppConfig.OIDCEnabled = true
+	config.AppConfig.OIDCIssuer = mock.URL
+	config.AppConfig.OIDCClientID = mock.ClientID
+	config.AppConfig.OIDCClientSecret = mock.ClientSecret
+	config.AppConfig.OIDCRedirectURL = "http://core.test/api/v1/auth/oidc/callback"
+	config.AppConfig.OIDCPanelURL = "http://panel.test"
+	config.AppConfig.OIDCScopes = "openid profile email"
+	config.AppConfig.OIDCUsernameClaim = "preferred_username"
+	config.AppConfig.OIDCAdminClaim = "groups"
+	config.AppConfig.OIDCAdminValues = "atlas-admins"
+	config.AppConfig.OIDCAutoProvision = true
+
+	alice := models.User{Username: "alice", Password: "x", Email: "Alice@Example.com"}
+	bob := models.User{Username: "bob", Password: "x", Email: "bob@example.com"}
+	carol := models.User{Username: "carol", Password: "x", Email: "carol@example.com", OIDCIssuer: mock.URL, OIDCSubject: "carol-old"}
+	for _, u := range []*models.User{&alice, &bob, &carol} {
+		if err := database.DB.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("links an existing user by verified email", func(t *testing.T) {
+		key, value := oidcLogin(t, mock, map[string]interface{}{
+			"sub": "alice-sub", "email": "alice@example.com", "email_verified": true, "preferred_username": "alice",
+		}, true)
+		user := redeemedUser(t, key, value)
+		if user.ID != alice.ID || user.OIDCSubject != "alice-sub" || user.OIDCIssuer != mock.URL {
+			t.Fatalf("signed in as %+v, want alice linked to alice-sub", user)
+		}
+	})
+
+	t.Run("finds a linked user by subject", func(t *testing.T) {
+		key, value := oidcLogin(t, mock, map[string]interface{}{
+			"sub": "alice-sub", "email": "changed@example.com", "email_verified": true, "groups": []string{"atlas-admins"},
+		}, true)
+		user := redeemedUser(t, key, value)
+		if user.ID != alice.ID || !user.IsAdmin {
+			t.Fatalf("signed in as %+v, want alice with admin rights from her groups", user)
+		}
+	})
+
+	t.Run("does not link by an unverified email", func(t *testing.T) {
+		key, value := oidcLogin(t, mock, map[string]interface{}{
+			"sub": "mallory", "email": "bob@example.com", "email_verified": false, "preferred_username": "bob",
+		}, true)
+		if key != "sso_error" || !strings.Contains(value, "already taken") {
+			t.Fatalf("callback returned %s=%s, want the username clash", key, value)
+		}
+		var reloaded models.User
+		database.DB.First(&reloaded, bob.ID)
+		if reloaded.OIDCSubject != "" {
+			t.Fatalf("bob was linked to %q", reloaded.OIDCSubject)
+		}
+	})
+
+	t.Run("refuses an account linked to another identity", func(t *testing.T) {
+		key, _ := oidcLogin(t, mock, map[string]interface{}{
+			"sub": "carol-new", "email": "carol@example.com", "email_verified": true,
+		}, true)
+		if key != "sso_error" {
+			t.Fatalf("callback returned %s, want sso_error", key)
+		}
+	})
+
+	t.Run("provisions a new user", func(t *testing.T) {
+		key, value := oidcLogin(t, mock, map[string]interface{}{
+			"sub": "dave-sub", "email": "dave@example.com", "email_verified": true, "preferred_username": "dave",
+		}, true)
+		user := redeemedUser(t, key, value)
+		if user.Username != "dave" || user.Email != "dave@example.com" || user.IsAdmin {
+			t.Fatalf("provisioned %+v", user)
+		}
+	})
+
+	t.Run("refuses new users without auto-provisioning", func(t *testing.T) {
+		config.AppConfig.OIDCAutoProvision = false
+		defer func() { config.AppConfig.OIDCAutoProvision = true }()
+		key, _ := oidcLogin(t, mock, map[string]interface{}{"sub": "erin-sub", "preferred_username": "erin"}, true)
+		if key != "sso_error" {
+			t.Fatalf("callback returned %s, want sso_error", key)
+		}
+	})
+
+	t.Run("refuses a callback from another browser", func(t *testing.T) {
+		key, _ := oidcLogin(t, mock, map[string]interface{}{"sub": "frank-sub", "preferred_username": "frank"}, false)
+		if key != "sso_error" {
+			t.Fatalf("callback returned %s, want sso_error", key)
+		}
+		var count int64
+		database.DB.Model(&models.User{}).Where("username = ?", "frank").Count(&count)
+		if count != 0 {
+			t.Fatal("a user was created without a matching state cookie")
+		}
+	})
+}
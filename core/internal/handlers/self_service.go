@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+// selfServiceMu serializes self-service creation, so two requests can't both fit in the
+// last of a quota or be given the same port
+var selfServiceMu sync.Mutex
+
+type SelfServiceCreateRequest struct {
+	Name        string            `json:"name" binding:"required"`
+	EggID       uint              `json:"egg_id" binding:"required"`
+	Memory      uint64            `json:"memory"`
+	Disk        uint64            `json:"disk"`
+	Cpu         uint64            `json:"cpu"`
+	Environment map[string]string `json:"environment"` // Values for user editable variables
+	DockerImage string            `json:"docker_image"`
+	LocationID  uint              `json:"location_id"` // Optional, any allowed location otherwise
+}
+
+// QuotaUsage is what a user's services take up of their quota
+type QuotaUsage struct {
+	Services int64  `json:"services"`
+	Memory   uint64 `json:"memory"`
+	Disk     uint64 `json:"disk"`
+	Cpu      uint64 `json:"cpu"`
+}
+
+// SelfServiceEgg is an egg a user may deploy, without its install script and hidden variables
+type SelfServiceEgg struct {
+	ID           uint                 `json:"id"`
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	NestID       uint                 `json:"nest_id"`
+	NestName     string               `json:"nest_name"`
+	DockerImages []string             `json:"docker_images"`
+	Variables    []models.EggVariable `json:"variables"`
+}
+
+// userQuota returns the user's quota, or nil when they can't create services themselves
+func userQuota(userID uint) *models.UserQuota {
+	var quota models.UserQuota
+	if err := database.DB.Where("user_id = ?", userID).First(&quota).Error; err != nil || quota.Services <= 0 {
+		return nil
+	}
+	return &quota
+}
+
+// quotaUsage adds up the services the user owns
+func quotaUsage(userID uint) QuotaUsage {
+	var usage QuotaUsage
+	database.DB.Model(&models.Service{}).
+		Select("COUNT(*) AS services, COALESCE(SUM(memory), 0) AS memory, COALESCE(SUM(disk), 0) AS disk, COALESCE(SUM(cpu), 0) AS cpu").
+		Where("user_id = ?", userID).
+		Scan(&usage)
+	return usage
+}
+
+// quotaIDs parses one of a quota's JSON ID lists
+func quotaIDs(list string) []uint {
+	var ids []uint
+	if list != "" {
+		json.Unmarshal([]byte(list), &ids)
+	}
+	return ids
+}
+
+// quotaAllows reports whether any of ids is on a quota's list. An empty list allows everything.
+func quotaAllows(list string, ids ...uint) bool {
+	allowed := quotaIDs(list)
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		for _, id := range ids {
+			if a == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// quotaAllowsEgg checks an egg against the quota's eggs and nests. An egg in a sub-nest is
+// allowed by its parent nest too.
+func quotaAllowsEgg(quota *models.UserQuota, egg *models.Egg) bool {
+	if !quotaAllows(quota.AllowedEggs, egg.ID) {
+		return false
+	}
+	nests := []uint{egg.NestID}
+	if egg.Nest.ParentID != nil {
+		nests = append(nests, *egg.Nest.ParentID)
+	}
+	return quotaAllows(quota.AllowedNests, nests...)
+}
+
+// normalizeQuotaIDs checks that a quota's ID list is valid JSON and stores it compactly
+func normalizeQuotaIDs(list string) (string, error) {
+	if strings.TrimSpace(list) == "" {
+		return "", nil
+	}
+	var ids []uint
+	if err := json.Unmarshal([]byte(list), &ids); err != nil {
+		return "", fmt.Errorf("ID lists must be JSON arrays of numbers")
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+	encoded, _ := json.Marshal(ids)
+	return string(encoded), nil
+}
+
+// freeServicePort returns the lowest self-service port no service on the node uses, or 0
+func freeServicePort(nodeID uint) int {
+	var used []int
+	database.DB.Model(&models.Service{}).Where("node_id = ?", nodeID).Pluck("port", &used)
+	taken := make(map[int]bool, len(used))
+	for _, p := range used {
+		taken[p] = true
+	}
+	for p := config.AppConfig.SelfServicePortStart; p <= config.AppConfig.SelfServicePortEnd; p++ {
+		if !taken[p] {
+			return p
+		}
+	}
+	return 0
+}
+
+// nodeFilter limits the nodes pickNode chooses from. Empty lists allow every node.
+type nodeFilter struct {
+	NodeIDs     []uint
+	LocationIDs []uint
+}
+
+// pickNode chooses the online node matching filter with the most unallocated RAM that fits
+// the service. A port of 0 is given the node's lowest free self-service port, any other port
+// must be unused on the node.
+func pickNode(filter nodeFilter, memory, disk uint64, port int) (*models.Node, int, error) {
+	var nodes []models.Node
+	query := database.DB.Where("is_online = ?", true)
+	if len(filter.NodeIDs) > 0 {
+		query = query.Where("id IN ?", filter.NodeIDs)
+	}
+	if len(filter.LocationIDs) > 0 {
+		query = query.Where("location_id IN ?", filter.LocationIDs)
+	}
+	query.Order("id").Find(&nodes)
+
+	var best *models.Node
+	var bestPort int
+	var bestFree int64
+	for i := range nodes {
+		node := &nodes[i]
+		if checkNodeResources(node.ID, memory, disk, 0) != nil {
+			continue
+		}
+		nodePort := port
+		if nodePort == 0 {
+			if nodePort = freeServicePort(node.ID); nodePort == 0 {
+				continue
+			}
+		} else {
+			var taken int64
+			database.DB.Model(&models.Service{}).Where("node_id = ? AND port = ?", node.ID, port).Count(&taken)
+			if taken > 0 {
+				continue
+			}
+		}
+
+		// Nodes without resource tracking are only used when no tracked node has room
+		free := int64(-1)
+		if node.TotalRAM > 0 {
+			var allocated uint64
+			database.DB.Model(&models.Service{}).Where("node_id = ?", node.ID).
+				Select("COALESCE(SUM(memory), 0)").Scan(&allocated)
+			free = int64(node.TotalRAM) - int64(allocated)
+		}
+		if best == nil || free > bestFree {
+			best, bestPort, bestFree = node, nodePort, free
+		}
+	}
+
+	if best == nil {
+		return nil, 0, fmt.Errorf("no node currently has room for this server, try fewer resources or ask an administrator")
+	}
+	return best, bestPort, nil
+}
+
+// quotaLocations returns the locations a quota allows that have at least one node
+func quotaLocations(quota *models.UserQuota) []models.Location {
+	var locations []models.Location
+	query := database.DB.Where("id IN (?)", database.DB.Model(&models.Node{}).Select("location_id").Where("location_id IS NOT NULL"))
+	if ids := quotaIDs(quota.AllowedLocations); len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	query.Order("region, short").Find(&locations)
+	return locations
+}
+
+// GetSelfServiceOptions returns the user's quota, what they use of it, and the eggs they may deploy
+func GetSelfServiceOptions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	quota := userQuota(userID)
+	if quota == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	var eggs []models.Egg
+	if err := database.DB.Preload("Nest").Preload("Variables").Order("name").Find(&eggs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch eggs"})
+		return
+	}
+
+	options := make([]SelfServiceEgg, 0, len(eggs))
+	for i := range eggs {
+		egg := &eggs[i]
+		if !quotaAllowsEgg(quota, egg) {
+			continue
+		}
+
+		option := SelfServiceEgg{
+			ID:          egg.ID,
+			Name:        egg.Name,
+			Description: egg.Description,
+			NestID:      egg.NestID,
+			NestName:    egg.Nest.Name,
+			Variables:   []models.EggVariable{},
+		}
+		json.Unmarshal([]byte(egg.DockerImages), &option.DockerImages)
+		for _, v := range egg.Variables {
+			if v.UserViewable {
+				option.Variables = append(option.Variables, v)
+			}
+		}
+		options = append(options, option)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   true,
+		"quota":     quota,
+		"used":      quotaUsage(userID),
+		"eggs":      options,
+		"locations": quotaLocations(quota),
+	})
+}
+
+// CreateSelfService lets a user create a server for themselves within their quota. Core picks
+// the node and port.
+func CreateSelfService(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req SelfServiceCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name of up to 255 characters is required"})
+		return
+	}
+	if req.Memory == 0 || req.Disk == 0 || req.Cpu == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Memory, disk and CPU must be set"})
+		return
+	}
+	if err := validateResources(req.Memory, req.Disk, req.Cpu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	selfServiceMu.Lock()
+	defer selfServiceMu.Unlock()
+
+	quota := userQuota(userID)
+	if quota == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't create servers yourself, contact an administrator"})
+		return
+	}
+
+	if err := checkQuota(quota, quotaUsage(userID), req.Memory, req.Disk, req.Cpu); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var egg models.Egg
+	if err := database.DB.Preload("Nest").Preload("Variables").First(&egg, req.EggID).Error; err != nil || !quotaAllowsEgg(quota, &egg) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service type not found"})
+		return
+	}
+
+	if req.DockerImage != "" {
+		var images []string
+		json.Unmarshal([]byte(egg.DockerImages), &images)
+		found := false
+		for _, image := range images {
+			found = found || image == req.DockerImage
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Docker image is not offered by this service type"})
+			return
+		}
+	}
+
+	environment, err := eggEnvironment(&egg, req.Environment, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := nodeFilter{NodeIDs: quotaIDs(quota.AllowedNodes), LocationIDs: quotaIDs(quota.AllowedLocations)}
+	if req.LocationID != 0 {
+		if !quotaAllows(quota.AllowedLocations, req.LocationID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can't deploy to this location"})
+			return
+		}
+		filter.LocationIDs = []uint{req.LocationID}
+	}
+
+	node, port, err := pickNode(filter, req.Memory, req.Disk, 0)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := models.Service{
+		Name:        req.Name,
+		UserID:      userID,
+		NodeID:      node.ID,
+		EggID:       egg.ID,
+		Memory:      req.Memory,
+		Disk:        req.Disk,
+		Cpu:         req.Cpu,
+		Port:        port,
+		Environment: environment,
+		DockerImage: req.DockerImage,
+
+		DatabaseLimit: quota.DatabaseLimit,
+	}
+	if status, err := provisionService(node, &service, &egg); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	utils.LogActivity(c, service.ID, "create", "service", fmt.Sprintf("Created server %s from quota", service.Name), map[string]interface{}{
+		"node":   node.Name,
+		"egg":    egg.Name,
+		"memory": service.Memory,
+		"disk":   service.Disk,
+		"cpu":    service.Cpu,
+	})
+
+	c.JSON(http.StatusCreated, service)
+}
+
+// checkQuota reports whether one more server with these resources fits in a quota. Requests are
+// compared against what is left, since adding them to the usage could wrap around.
+func checkQuota(quota *models.UserQuota, used QuotaUsage, memory, disk, cpu uint64) error {
+	switch {
+	case used.Services >= int64(quota.Services):
+		return fmt.Errorf("You have reached your limit of %d server(s)", quota.Services)
+	case memory > remaining(quota.Memory, used.Memory):
+		return fmt.Errorf("Not enough memory left in your quota (Available: %dMB)", remaining(quota.Memory, used.Memory))
+	case disk > remaining(quota.Disk, used.Disk):
+		return fmt.Errorf("Not enough disk left in your quota (Available: %dMB)", remaining(quota.Disk, used.Disk))
+	case cpu > remaining(quota.Cpu, used.Cpu):
+		return fmt.Errorf("Not enough CPU left in your quota (Available: %d%%)", remaining(quota.Cpu, used.Cpu))
+	}
+	return nil
+}
+
+// remaining returns how much of limit is left after used, or 0 when used is over it
+func remaining(limit, used uint64) uint64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+func TestRemaining(t *testing.T) {
+	tests := []struct {
+		limit, used, want uint64
+	}{
+		{100, 40, 60},
+		{100, 100, 0},
+		{100, 150, 0},
+		{0, 0, 0},
+		{math.MaxUint64, 1, math.MaxUint64 - 1},
+	}
+	for _, tt := range tests {
+		if got := remaining(tt.limit, tt.used); got != tt.want {
+			t.Errorf("remaining(%d, %d) = %d, want %d", tt.limit, tt.used, got, tt.want)
+		}
+	}
+}
+
+func TestValidateResources(t *testing.T) {
+	tests := []struct {
+		memory, disk, cpu uint64
+		ok                bool
+	}{
+		{1024, 10240, 100, true},
+		{maxResource, maxResource, maxResource, true},
+		{maxResource + 1, 1, 1, false},
+		{1, maxResource + 1, 1, false},
+		{1, 1, maxResource + 1, false},
+		{math.MaxUint64, 1, 1, false},
+	}
+	for _, tt := range tests {
+		if err := validateResources(tt.memory, tt.disk, tt.cpu); (err == nil) != tt.ok {
+			t.Errorf("validateResources(%d, %d, %d) = %v, want ok=%v", tt.memory, tt.disk, tt.cpu, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	quota := &models.UserQuota{Services: 3, Memory: 4096, Disk: 20480, Cpu: 200}
+
+	tests := []struct {
+		name              string
+		used              QuotaUsage
+		memory, disk, cpu uint64
+		wantErr           string
+	}{
+		{name: "fits", used: QuotaUsage{Services: 1, Memory: 1024, Disk: 10240, Cpu: 100}, memory: 3072, disk: 10240, cpu: 100},
+		{name: "server limit", used: QuotaUsage{Services: 3}, memory: 1, disk: 1, cpu: 1, wantErr: "limit of 3 server"},
+		{name: "memory", used: QuotaUsage{Memory: 4000}, memory: 97, disk: 1, cpu: 1, wantErr: "Available: 96MB"},
+		{name: "disk", memory: 1, disk: 20481, cpu: 1, wantErr: "disk"},
+		{name: "cpu", used: QuotaUsage{Cpu: 150}, memory: 1, disk: 1, cpu: 51, wantErr: "Available: 50%"},
+		// Usage already past the quota, e.g. after an admin lowered it
+		{name: "over quota", used: QuotaUsage{Memory: 8192}, memory: 1, disk: 1, cpu: 1, wantErr: "Available: 0MB"},
+		// used + request wraps to a small number, which the old comparison let through
+		{name: "wraps around", used: QuotaUsage{Memory: 1024}, memory: math.MaxUint64 - 1000, disk: 1, cpu: 1, wantErr: "memory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkQuota(quota, tt.used, tt.memory, tt.disk, tt.cpu)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkQuota: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkQuota = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/dbhost"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/secrets"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+// databaseNamePattern limits the part of a database name users choose; Core prefixes it with
+// the service ID
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,48}$`)
+
+type CreateServiceDatabaseRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Remote string `json:"remote"` // Hosts the user may connect from, % for any (MySQL only)
+}
+
+// ServiceDatabaseResponse is a service database with what is needed to connect to it
+type ServiceDatabaseResponse struct {
+	models.ServiceDatabase
+	Type string `json:"type"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+func serviceDatabaseResponse(db models.ServiceDatabase) ServiceDatabaseResponse {
+	host := db.DatabaseHost.PublicHost
+	if host == "" {
+		host = db.DatabaseHost.Host
+	}
+	return ServiceDatabaseResponse{ServiceDatabase: db, Type: db.DatabaseHost.Type, Host: host, Port: db.DatabaseHost.Port}
+}
+
+// findDatabaseService loads a service for database management, which is left to its owner and admins
+func findDatabaseService(c *gin.Context) (*models.Service, bool) {
+	service, subUser, ok := utils.FindServiceForUser(c.Param("uuid"), c.MustGet("user_id").(uint))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found or no access"})
+		return nil, false
+	}
+	if subUser != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the server owner can manage databases"})
+		return nil, false
+	}
+	return service, true
+}
+
+// findServiceDatabase loads one of the service's databases from the :id parameter
+func findServiceDatabase(c *gin.Context, service *models.Service) (*models.ServiceDatabase, bool) {
+	var db models.ServiceDatabase
+	if err := database.DB.Preload("DatabaseHost").Where("id = ? AND service_id = ?", c.Param("id"), service.ID).First(&db).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Database not found"})
+		return nil, false
+	}
+	return &db, true
+}
+
+// pickDatabaseHost returns the host for a new database of service: a host linked to the
+// service's node if there is one with room, otherwise a host serving every node
+func pickDatabaseHost(service *models.Service) (*models.DatabaseHost, error) {
+	var hosts []models.DatabaseHost
+	database.DB.Where("node_id = ? OR node_id IS NULL", service.NodeID).
+		Order("node_id IS NULL, id").Find(&hosts)
+
+	for i := range hosts {
+		if hosts[i].MaxDatabases > 0 {
+			var count int64
+			database.DB.Model(&models.ServiceDatabase{}).Where("database_host_id = ?", hosts[i].ID).Count(&count)
+			if count >= int64(hosts[i].MaxDatabases) {
+				continue
+			}
+		}
+		return &hosts[i], nil
+	}
+	if len(hosts) > 0 {
+		return nil, fmt.Errorf("all database hosts for this node are full")
+	}
+	return nil, fmt.Errorf("no database host is available for this node")
+}
+
+// GetServiceDatabases lists a service's databases with their credentials
+func GetServiceDatabases(c *gin.Context) {
+	service, ok := findDatabaseService(c)
+	if !ok {
+		return
+	}
+
+	var dbs []models.ServiceDatabase
+	if err := database.DB.Preload("DatabaseHost").Where("service_id = ?", service.ID).Order("id").Find(&dbs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch databases"})
+		return
+	}
+
+	response := make([]ServiceDatabaseResponse, 0, len(dbs))
+	for _, db := range dbs {
+		response = append(response, serviceDatabaseResponse(db))
+	}
+	c.JSON(http.StatusOK, gin.H{"databases": response, "limit": service.DatabaseLimit})
+}
+
+// CreateServiceDatabase creates a database and a user limited to it on one of the node's hosts
+func CreateServiceDatabase(c *gin.Context) {
+	service, ok := findDatabaseService(c)
+	if !ok {
+		return
+	}
+
+	var req CreateServiceDatabaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !databaseNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Database names may only contain letters, numbers and underscores (up to 48)"})
+		return
+	}
+	if req.Remote == "" {
+		req.Remote = "%"
+	}
+	if !dbhost.ValidRemote(req.Remote) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid remote host"})
+		return
+	}
+
+	if service.DatabaseLimit <= 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Databases are not enabled for this service"})
+		return
+	}
+	var count int64
+	database.DB.Model(&models.ServiceDatabase{}).Where("service_id = ?", service.ID).Count(&count)
+	if count >= int64(service.DatabaseLimit) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("This service is limited to %d database(s)", service.DatabaseLimit)})
+		return
+	}
+
+	host, err := pickDatabaseHost(service)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if host.Type == models.DatabaseTypePostgres {
+		req.Remote = "%" // PostgreSQL leaves this to pg_hba.conf
+	}
+
+	db := models.ServiceDatabase{
+		ServiceID:      service.ID,
+		DatabaseHostID: host.ID,
+		Name:           fmt.Sprintf("s%d_%s", service.ID, req.Name),
+		Username:       fmt.Sprintf("u%d_%s", service.ID, utils.RandomString(5)),
+		Password:       secrets.String(utils.RandomString(16)),
+		Remote:         req.Remote,
+	}
+	var existing int64
+	database.DB.Model(&models.ServiceDatabase{}).Where("database_host_id = ? AND name = ?", host.ID, db.Name).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A database with this name already exists"})
+		return
+	}
+
+	if err := dbhost.Create(c.Request.Context(), host, &db); err != nil {
+		log.Printf("[Databases] Failed to create %s on %s: %v", db.Name, host.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create the database: " + err.Error()})
+		return
+	}
+	if err := database.DB.Create(&db).Error; err != nil {
+		dbhost.Drop(context.WithoutCancel(c.Request.Context()), host, &db)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save the database"})
+		return
+	}
+
+	utils.LogActivity(c, service.ID, "database_create", "databases", "Created database "+db.Name, map[string]interface{}{
+		"host":     host.Name,
+		"username": db.Username,
+		"remote":   db.Remote,
+	})
+
+	db.DatabaseHost = *host
+	c.JSON(http.StatusCreated, serviceDatabaseResponse(db))
+}
+
+// RotateServiceDatabasePassword gives a database user a new random password
+func RotateServiceDatabasePassword(c *gin.Context) {
+	service, ok := findDatabaseService(c)
+	if !ok {
+		return
+	}
+	db, ok := findServiceDatabase(c, service)
+	if !ok {
+		return
+	}
+
+	previous := db.Password
+	db.Password = secrets.String(utils.RandomString(16))
+	if err := dbhost.SetPassword(c.Request.Context(), &db.DatabaseHost, db); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to change the password: " + err.Error()})
+		return
+	}
+	if err := database.DB.Model(db).Update("password", db.Password).Error; err != nil {
+		// Keep the stored password in line with the host
+		db.Password = previous
+		dbhost.SetPassword(context.WithoutCancel(c.Request.Context()), &db.DatabaseHost, db)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save the new password"})
+		return
+	}
+
+	utils.LogActivity(c, service.ID, "database_rotate_password", "databases", "Rotated the password of database "+db.Name, nil)
+
+	c.JSON(http.StatusOK, serviceDatabaseResponse(*db))
+}
+
+// DeleteServiceDatabase drops a database and its user
+func DeleteServiceDatabase(c *gin.Context) {
+	service, ok := findDatabaseService(c)
+	if !ok {
+		return
+	}
+	db, ok := findServiceDatabase(c, service)
+	if !ok {
+		return
+	}
+
+	if err := dbhost.Drop(c.Request.Context(), &db.DatabaseHost, db); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to drop the database: " + err.Error()})
+		return
+	}
+	database.DB.Delete(db)
+
+	utils.LogActivity(c, service.ID, "database_delete", "databases", "Deleted database "+db.Name, nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// dropServiceDatabases drops every database of a service that is being deleted. Databases on
+// unreachable hosts are logged and forgotten, so they may need removing by hand.
+func dropServiceDatabases(ctx context.Context, service *models.Service) {
+	var dbs []models.ServiceDatabase
+	database.DB.Preload("DatabaseHost").Where("service_id = ?", service.ID).Find(&dbs)
+	for i := range dbs {
+		if err := dbhost.Drop(ctx, &dbs[i].DatabaseHost, &dbs[i]); err != nil {
+			log.Printf("[Databases] Failed to drop %s of deleted service %s: %v", dbs[i].Name, service.UUID, err)
+		}
+		database.DB.Delete(&dbs[i])
+	}
+}
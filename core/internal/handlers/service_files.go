@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+// maxEditorBody bounds text editor saves: 8 MB of content, which JSON escaping can double
+const maxEditorBody = 16<<20 + 4096
+
+type fileMove struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to"`
+}
+
+// findFileService loads the service for a file operation and checks the caller may manage its files
+func findFileService(c *gin.Context) (*models.Service, bool) {
+	userID := c.MustGet("user_id").(uint)
+
+	service, subUser, ok := utils.FindServiceForUser(c.Param("uuid"), userID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found or no access"})
+		return nil, false
+	}
+
+	if subUser != nil && !subUser.CanManageFiles {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to manage files for this server"})
+		return nil, false
+	}
+	return service, true
+}
+
+// fileEditor names the user making a change, for file revisions
+func fileEditor(c *gin.Context) string {
+	var user models.User
+	database.DB.Select("username").First(&user, c.MustGet("user_id").(uint))
+	return user.Username
+}
+
+// applyFileDenylist passes the egg's file denylist to the node, which keeps the user away from
+// the files it matches. Admins are not restricted. The node refuses file requests without a
+// denylist, so an empty one is sent explicitly.
+func applyFileDenylist(c *gin.Context, service *models.Service, req *http.Request) {
+	denylist := "[]"
+	if service.Egg.FileDenylist != "" && !c.GetBool("is_admin") {
+		denylist = service.Egg.FileDenylist
+	}
+	utils.SetNodeRequestHeader(&service.Node, req, utils.SignatureHeaderDenylist, denylist)
+}
+
+// forwardFileAction posts a JSON payload to the node's file API and relays the answer.
+// It returns the node's answer and whether the node accepted the request.
+func forwardFileAction(c *gin.Context, service *models.Service, action string, payload interface{}) ([]byte, bool) {
+	body, _ := json.Marshal(payload)
+	req, _ := utils.NewNodeRequest(&service.Node, "POST", fmt.Sprintf("/api/servers/%s/files/%s", service.UUID, action), body)
+	applyFileDenylist(c, service, req)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Long operations stop on the node when the user goes away
+	client := utils.NodeClient(&service.Node, 0)
+	resp, err := client.Do(req.WithContext(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", data)
+	return data, resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// ServiceRenameFiles renames or moves a batch of files
+func ServiceRenameFiles(c *gin.Context) {
+	var req struct {
+		Files []fileMove `json:"files" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide files as a list of {from, to}"})
+		return
+	}
+	for _, move := range req.Files {
+		if move.To == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every file needs a destination"})
+			return
+		}
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := forwardFileAction(c, service, "rename", req); ok {
+		utils.LogActivity(c, service.ID, "file_rename", "files", fmt.Sprintf("Renamed %d file(s)", len(req.Files)), map[string]interface{}{
+			"files": req.Files,
+		})
+	}
+}
+
+// ServiceCopyFiles copies a batch of files; entries without a destination get a "copy" name
+func ServiceCopyFiles(c *gin.Context) {
+	var req struct {
+		Files []fileMove `json:"files" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide files as a list of {from, to}"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	// The node has no record of the disk limit, so it travels with the request
+	payload := gin.H{"files": req.Files, "disk": service.Disk}
+	if data, ok := forwardFileAction(c, service, "copy", payload); ok {
+		// Log the names the node picked for the copies
+		var result struct {
+			Files []fileMove `json:"files"`
+		}
+		if json.Unmarshal(data, &result) != nil || len(result.Files) == 0 {
+			result.Files = req.Files
+		}
+		utils.LogActivity(c, service.ID, "file_copy", "files", fmt.Sprintf("Copied %d file(s)", len(result.Files)), map[string]interface{}{
+			"files": result.Files,
+		})
+	}
+}
+
+// ServiceChmodFiles changes the permission bits of a batch of files, modes given in octal
+func ServiceChmodFiles(c *gin.Context) {
+	var req struct {
+		Files []struct {
+			Path string `json:"path" binding:"required"`
+			Mode string `json:"mode" binding:"required"`
+		} `json:"files" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide files as a list of {path, mode}"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := forwardFileAction(c, service, "chmod", req); ok {
+		utils.LogActivity(c, service.ID, "file_chmod", "files", fmt.Sprintf("Changed permissions of %d file(s)", len(req.Files)), map[string]interface{}{
+			"files": req.Files,
+		})
+	}
+}
+
+// ServiceFixPermissions hands a directory (the whole service by default) back to the container
+// user and restores owner access, for files left unwritable by installers or SFTP clients
+func ServiceFixPermissions(c *gin.Context) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	// The body is optional
+	c.ShouldBindJSON(&req)
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	if data, ok := forwardFileAction(c, service, "fix-permissions", req); ok {
+		var result struct {
+			Entries int `json:"entries"`
+			Failed  int `json:"failed"`
+		}
+		json.Unmarshal(data, &result)
+		path := req.Path
+		if path == "" {
+			path = "/"
+		}
+		utils.LogActivity(c, service.ID, "file_fix_permissions", "files", "Fixed file permissions in "+path, map[string]interface{}{
+			"path":    path,
+			"entries": result.Entries,
+			"failed":  result.Failed,
+		})
+	}
+}
+
+// ServiceCompressFiles packs files from one directory into a zip or tar.gz archive
+func ServiceCompressFiles(c *gin.Context) {
+	var req struct {
+		Root   string   `json:"root"`
+		Files  []string `json:"files" binding:"required,min=1"`
+		Format string   `json:"format"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide the files to compress"})
+		return
+	}
+	if req.Format == "" {
+		req.Format = "tar.gz"
+	}
+	if req.Format != "zip" && req.Format != "tar.gz" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be zip or tar.gz"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	payload := gin.H{"root": req.Root, "files": req.Files, "format": req.Format, "disk": service.Disk}
+	if data, ok := forwardFileAction(c, service, "compress", payload); ok {
+		var result struct {
+			File string `json:"file"`
+		}
+		json.Unmarshal(data, &result)
+		utils.LogActivity(c, service.ID, "file_compress", "files", fmt.Sprintf("Compressed %d file(s) into %s", len(req.Files), result.File), map[string]interface{}{
+			"root":    req.Root,
+			"files":   req.Files,
+			"archive": result.File,
+		})
+	}
+}
+
+// ServiceDecompressFile extracts an archive on the node
+func ServiceDecompressFile(c *gin.Context) {
+	var req struct {
+		File string `json:"file" binding:"required"`
+		Root string `json:"root"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide the archive to decompress"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	payload := gin.H{"file": req.File, "root": req.Root, "disk": service.Disk}
+	if _, ok := forwardFileAction(c, service, "decompress", payload); ok {
+		utils.LogActivity(c, service.ID, "file_decompress", "files", fmt.Sprintf("Decompressed %s", req.File), map[string]interface{}{
+			"file": req.File,
+			"root": req.Root,
+		})
+	}
+}
+
+// ServicePullFile has the node download a URL straight into the service directory
+func ServicePullFile(c *gin.Context) {
+	var req struct {
+		URL      string `json:"url" binding:"required"`
+		Root     string `json:"root"`
+		Filename string `json:"filename"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide the URL to download"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	allow, err := utils.NodePullAllowlist(&service.Node)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Node pull allowlist is invalid"})
+		return
+	}
+
+	payload := gin.H{"url": req.URL, "root": req.Root, "filename": req.Filename, "disk": service.Disk, "allow": allow}
+	if data, ok := forwardFileAction(c, service, "pull", payload); ok {
+		var result struct {
+			ID   string `json:"id"`
+			Path string `json:"path"`
+		}
+		if json.Unmarshal(data, &result) == nil && result.ID != "" {
+			utils.LogActivity(c, service.ID, "file_pull", "files", fmt.Sprintf("Started downloading %s", result.Path), map[string]interface{}{
+				"url":  req.URL,
+				"path": result.Path,
+			})
+		}
+	}
+}
+
+// relayNodeRequest sends a bodiless request to the node and relays the answer.
+// It returns the node's status code, or 0 when the node could not be reached.
+func relayNodeRequest(c *gin.Context, service *models.Service, method, path string) int {
+	req, _ := utils.NewNodeRequest(&service.Node, method, path, nil)
+	applyFileDenylist(c, service, req)
+	client := utils.NodeClient(&service.Node, 10*time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
+		return 0
+	}
+	defer resp.Body.Close()
+
+	c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+	return resp.StatusCode
+}
+
+// ServiceListPulls shows the progress of the service's downloads
+func ServiceListPulls(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+	relayNodeRequest(c, service, "GET", fmt.Sprintf("/api/servers/%s/files/pull", service.UUID))
+}
+
+// ServiceCancelPull stops a running download
+func ServiceCancelPull(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	status := relayNodeRequest(c, service, "DELETE", fmt.Sprintf("/api/servers/%s/files/pull/%s", service.UUID, url.PathEscape(c.Param("id"))))
+	if status == http.StatusOK {
+		utils.LogActivity(c, service.ID, "file_pull_cancel", "files", "Cancelled a download", map[string]interface{}{
+			"id": c.Param("id"),
+		})
+	}
+}
+
+// ServiceDownloadFile streams a file from the node. Range requests are passed through so
+// browsers and download managers can resume.
+func ServiceDownloadFile(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	req, _ := utils.NewNodeRequest(&service.Node, "GET", fmt.Sprintf("/api/servers/%s/files/download?path=%s", service.UUID, url.QueryEscape(c.Query("path"))), nil)
+	applyFileDenylist(c, service, req)
+	for _, header := range []string{"Range", "If-Range", "If-Modified-Since"} {
+		if value := c.GetHeader(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	client := utils.NodeClient(&service.Node, 0)
+	resp, err := client.Do(req.WithContext(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
+		return
+	}
+	defer resp.Body.Close()
+
+	extra := map[string]string{}
+	for _, header := range []string{"Content-Disposition", "Content-Range", "Accept-Ranges", "Last-Modified"} {
+		if value := resp.Header.Get(header); value != "" {
+			extra[header] = value
+		}
+	}
+	c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, extra)
+}
+
+// ServiceCreateUpload starts a chunked upload; the chunks are sent to ServiceUploadChunk
+func ServiceCreateUpload(c *gin.Context) {
+	var req struct {
+		Path string `json:"path" binding:"required"`
+		Size int64  `json:"size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Size < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide the path and size of the file"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	payload := gin.H{"path": req.Path, "size": req.Size, "disk": service.Disk}
+	forwardFileAction(c, service, "uploads", payload)
+}
+
+// ServiceGetUpload returns how much of an upload the node has, for resuming
+func ServiceGetUpload(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+	relayNodeRequest(c, service, "GET", fmt.Sprintf("/api/servers/%s/files/uploads/%s", service.UUID, url.PathEscape(c.Param("id"))))
+}
+
+// ServiceUploadChunk streams one chunk of an upload to the node. The Upload-Offset header says
+// where the chunk starts.
+func ServiceUploadChunk(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	req, _ := utils.NewNodeStreamRequest(&service.Node, "PATCH", fmt.Sprintf("/api/servers/%s/files/uploads/%s", service.UUID, url.PathEscape(c.Param("id"))), c.Request.Body)
+	applyFileDenylist(c, service, req)
+	req.ContentLength = c.Request.ContentLength
+	req.Header.Set("Upload-Offset", c.GetHeader("Upload-Offset"))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+
+	client := utils.NodeClient(&service.Node, 0)
+	resp, err := client.Do(req.WithContext(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
+		return
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if offset := resp.Header.Get("Upload-Offset"); offset != "" {
+		c.Header("Upload-Offset", offset)
+	}
+	c.Data(resp.StatusCode, "application/json", data)
+
+	var result struct {
+		Path     string `json:"path"`
+		Size     int64  `json:"size"`
+		Complete bool   `json:"complete"`
+	}
+	if resp.StatusCode == http.StatusOK && json.Unmarshal(data, &result) == nil && result.Complete {
+		utils.LogActivity(c, service.ID, "file_upload", "files", fmt.Sprintf("Uploaded %s", result.Path), map[string]interface{}{
+			"path": result.Path,
+			"size": result.Size,
+		})
+	}
+}
+
+// ServiceDeleteUpload abandons an unfinished upload
+func ServiceDeleteUpload(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+	relayNodeRequest(c, service, "DELETE", fmt.Sprintf("/api/servers/%s/files/uploads/%s", service.UUID, url.PathEscape(c.Param("id"))))
+}
+
+// ServiceSearchFiles streams the node's search results (newline-delimited JSON) as they arrive.
+// Closing the request cancels the search on the node.
+func ServiceSearchFiles(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	query := url.Values{}
+	for _, key := range []string{"root", "name", "query", "regex", "case_sensitive", "max_size", "limit"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	req, _ := utils.NewNodeRequest(&service.Node, "GET", fmt.Sprintf("/api/servers/%s/files/search?%s", service.UUID, query.Encode()), nil)
+	applyFileDenylist(c, service, req)
+	client := utils.NodeClient(&service.Node, 0)
+	resp, err := client.Do(req.WithContext(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
+		return
+	}
+	defer resp.Body.Close()
+
+	c.Header("Content-Type", resp.Header.Get("Content-Type"))
+	c.Status(resp.StatusCode)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ServiceListTrash lists the service's deleted files
+func ServiceListTrash(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+	relayNodeRequest(c, service, "GET", fmt.Sprintf("/api/servers/%s/files/trash", service.UUID))
+}
+
+// ServiceRestoreTrash moves an item out of the trash, to its original path unless "to" is given
+func ServiceRestoreTrash(c *gin.Context) {
+	var req struct {
+		ID string `json:"id" binding:"required"`
+		To string `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide the id of the item to restore"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	if data, ok := forwardFileAction(c, service, "trash/restore", req); ok {
+		var result struct {
+			Item struct {
+				Path string `json:"path"`
+			} `json:"item"`
+		}
+		json.Unmarshal(data, &result)
+		utils.LogActivity(c, service.ID, "file_restore", "files", "Restored "+result.Item.Path+" from the trash", map[string]interface{}{
+			"trash_id": req.ID,
+			"path":     result.Item.Path,
+		})
+	}
+}
+
+// ServicePurgeTrash deletes one item in the trash for good
+func ServicePurgeTrash(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	status := relayNodeRequest(c, service, "DELETE", fmt.Sprintf("/api/servers/%s/files/trash/%s", service.UUID, url.PathEscape(id)))
+	if status == http.StatusOK {
+		utils.LogActivity(c, service.ID, "trash_purge", "files", "Permanently deleted an item from the trash", map[string]interface{}{
+			"trash_id": id,
+		})
+	}
+}
+
+// ServiceEmptyTrash deletes everything in the trash for good
+func ServiceEmptyTrash(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	status := relayNodeRequest(c, service, "DELETE", fmt.Sprintf("/api/servers/%s/files/trash", service.UUID))
+	if status == http.StatusOK {
+		utils.LogActivity(c, service.ID, "trash_empty", "files", "Emptied the trash", nil)
+	}
+}
+
+// ServiceListRevisions lists the saved versions of a file
+func ServiceListRevisions(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+	relayNodeRequest(c, service, "GET", fmt.Sprintf("/api/servers/%s/files/revisions?path=%s", service.UUID, url.QueryEscape(c.Query("path"))))
+}
+
+// ServiceDiffRevision compares a revision with another one, or with the current file
+func ServiceDiffRevision(c *gin.Context) {
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	query := url.Values{}
+	for _, key := range []string{"path", "from", "to"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+	relayNodeRequest(c, service, "GET", fmt.Sprintf("/api/servers/%s/files/revisions/diff?%s", service.UUID, query.Encode()))
+}
+
+// ServiceRestoreRevision writes an earlier version of a file back
+func ServiceRestoreRevision(c *gin.Context) {
+	var req struct {
+		Path string `json:"path" binding:"required"`
+		ID   string `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide the path and the revision id"})
+		return
+	}
+
+	service, ok := findFileService(c)
+	if !ok {
+		return
+	}
+
+	editor := fileEditor(c)
+	payload := gin.H{"path": req.Path, "id": req.ID, "author": editor}
+	if data, ok := forwardFileAction(c, service, "revisions/restore", payload); ok {
+		var result struct {
+			Revision *struct {
+				ID string `json:"id"`
+			} `json:"revision"`
+		}
+		json.Unmarshal(data, &result)
+		metadata := map[string]interface{}{"path": req.Path, "editor": editor, "restored_from": req.ID}
+		if result.Revision != nil {
+			metadata["revision"] = result.Revision.ID
+		}
+		utils.LogActivity(c, service.ID, "file_revision_restore", "files", "Restored an earlier version of "+req.Path, metadata)
+	}
+}
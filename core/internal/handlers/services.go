@@ -1,11 +1,12 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luketaylor45/atlas/core/internal/database"
@@ -47,23 +48,39 @@ func GetUserOverview(c *gin.Context) {
 		}
 	}
 
+	// Self-service quota and how much of it the user's own services take up
+	var quota gin.H
+	if limits := userQuota(userID); limits != nil {
+		quota = gin.H{"limits": limits, "used": quotaUsage(userID)}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"total_services":   totalServices,
 		"running_services": runningServices,
 		"health":           health,
+		"quota":            quota,
 	})
 }
 
-// GetUserServices returns services the user owns or has sub-user access to
+// GetUserServices returns services the user owns or has sub-user access to, optionally only
+// those in ?location=
 func GetUserServices(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 
+	location, ok := locationQuery(c)
+	if !ok {
+		return
+	}
+
 	var services []models.Service
 
 	// Query services where user is owner OR user is a sub-user
-	err := database.DB.Preload("Node").Preload("Egg.Nest").Preload("Egg.Variables").
-		Where("user_id = ? OR id IN (SELECT service_id FROM service_users WHERE user_id = ?)", userID, userID).
-		Find(&services).Error
+	query := database.DB.Preload("Node.Location").Preload("Egg.Nest").Preload("Egg.Variables").
+		Where("user_id = ? OR id IN (SELECT service_id FROM service_users WHERE user_id = ?)", userID, userID)
+	if location != nil {
+		query = query.Where("node_id IN (?)", database.DB.Model(&models.Node{}).Select("id").Where("location_id = ?", location.ID))
+	}
+	err := query.Find(&services).Error
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch services"})
@@ -152,8 +169,6 @@ func ServicePowerAction(c *gin.Context) {
 	finalEnvJSON, _ := json.Marshal(mergedEnv)
 
 	// Proxy to Daemon
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/power", service.Node.Address, service.Node.Port, service.UUID)
-
 	payloadObj := struct {
 		Action         string `json:"action"`
 		StartupCommand string `json:"startup_command"`
@@ -171,9 +186,8 @@ func ServicePowerAction(c *gin.Context) {
 	log.Printf("[Core] Sending Power Action '%s' to Node %s (Service: %s). Env: %s", req.Action, service.Node.Name, service.UUID, payloadObj.Environment)
 
 	payload, _ := json.Marshal(payloadObj)
-	client := &http.Client{}
-	proxyReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	proxyReq.Header.Set("X-Node-Token", service.Node.Token)
+	client := utils.NodeClient(&service.Node, 0)
+	proxyReq, _ := utils.NewNodeRequest(&service.Node, "POST", fmt.Sprintf("/api/servers/%s/power", service.UUID), payload)
 	proxyReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(proxyReq)
@@ -222,12 +236,10 @@ func ServiceSendCommand(c *gin.Context) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/command", service.Node.Address, service.Node.Port, service.UUID)
 	payload, _ := json.Marshal(req)
 
-	client := &http.Client{}
-	proxyReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	proxyReq.Header.Set("X-Node-Token", service.Node.Token)
+	client := utils.NodeClient(&service.Node, 0)
+	proxyReq, _ := utils.NewNodeRequest(&service.Node, "POST", fmt.Sprintf("/api/servers/%s/command", service.UUID), payload)
 	proxyReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(proxyReq)
@@ -257,8 +269,6 @@ func ServiceReinstall(c *gin.Context) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/reinstall", service.Node.Address, service.Node.Port, service.UUID)
-
 	// MERGE Environment for Installer
 	mergedEnv := make(map[string]string)
 	for _, v := range service.Egg.Variables {
@@ -281,9 +291,8 @@ func ServiceReinstall(c *gin.Context) {
 	}
 	body, _ := json.Marshal(payload)
 
-	client := &http.Client{}
-	proxyReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	proxyReq.Header.Set("X-Node-Token", service.Node.Token)
+	client := utils.NodeClient(&service.Node, 0)
+	proxyReq, _ := utils.NewNodeRequest(&service.Node, "POST", fmt.Sprintf("/api/servers/%s/reinstall", service.UUID), body)
 	proxyReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(proxyReq)
@@ -353,11 +362,10 @@ func ServiceListFiles(c *gin.Context) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/files/list?path=%s", service.Node.Address, service.Node.Port, service.UUID, path)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Node-Token", service.Node.Token)
+	req, _ := utils.NewNodeRequest(&service.Node, "GET", fmt.Sprintf("/api/servers/%s/files/list?path=%s", service.UUID, url.QueryEscape(path)), nil)
+	applyFileDenylist(c, service, req)
 
-	client := &http.Client{}
+	client := utils.NodeClient(&service.Node, 0)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
@@ -385,11 +393,10 @@ func ServiceGetFileContent(c *gin.Context) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/files/content?path=%s", service.Node.Address, service.Node.Port, service.UUID, path)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Node-Token", service.Node.Token)
+	req, _ := utils.NewNodeRequest(&service.Node, "GET", fmt.Sprintf("/api/servers/%s/files/content?path=%s", service.UUID, url.QueryEscape(path)), nil)
+	applyFileDenylist(c, service, req)
 
-	client := &http.Client{}
+	client := utils.NodeClient(&service.Node, 0)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
@@ -417,12 +424,33 @@ func ServiceWriteFile(c *gin.Context) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/files/write?path=%s", service.Node.Address, service.Node.Port, service.UUID, path)
-	req, _ := http.NewRequest("POST", url, c.Request.Body)
-	req.Header.Set("X-Node-Token", service.Node.Token)
+	// The node refuses anything the editor could not have produced anyway
+	var file struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxEditorBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to save from the editor"})
+		return
+	}
+	if err := json.Unmarshal(body, &file); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if file.Path == "" {
+		file.Path = path
+	}
+
+	// The node keeps the saved content as a revision, credited to the editor
+	editor := fileEditor(c)
+	body, _ = json.Marshal(gin.H{"path": file.Path, "content": file.Content, "author": editor})
+
+	req, _ := utils.NewNodeRequest(&service.Node, "POST", fmt.Sprintf("/api/servers/%s/files/write?path=%s", service.UUID, url.QueryEscape(file.Path)), body)
+	applyFileDenylist(c, service, req)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := utils.NodeClient(&service.Node, 0)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
@@ -430,7 +458,22 @@ func ServiceWriteFile(c *gin.Context) {
 	}
 	defer resp.Body.Close()
 
-	c.JSON(resp.StatusCode, gin.H{"status": "success"})
+	data, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", data)
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	var result struct {
+		Revision *struct {
+			ID string `json:"id"`
+		} `json:"revision"`
+	}
+	json.Unmarshal(data, &result)
+	metadata := map[string]interface{}{"path": file.Path, "editor": editor}
+	if result.Revision != nil {
+		metadata["revision"] = result.Revision.ID
+	}
+	utils.LogActivity(c, service.ID, "file_write", "files", "Edited "+file.Path, metadata)
 }
 
 func ServiceCreateFolder(c *gin.Context) {
@@ -449,12 +492,17 @@ func ServiceCreateFolder(c *gin.Context) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/files/create-folder", service.Node.Address, service.Node.Port, service.UUID)
-	req, _ := http.NewRequest("POST", url, c.Request.Body)
-	req.Header.Set("X-Node-Token", service.Node.Token)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	req, _ := utils.NewNodeRequest(&service.Node, "POST", fmt.Sprintf("/api/servers/%s/files/create-folder", service.UUID), body)
+	applyFileDenylist(c, service, req)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := utils.NodeClient(&service.Node, 0)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
@@ -462,31 +510,35 @@ func ServiceCreateFolder(c *gin.Context) {
 	}
 	defer resp.Body.Close()
 
-	c.JSON(resp.StatusCode, gin.H{"status": "success"})
+	// Pass the node's answer on, so a refused path reports why instead of looking like success
+	data, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", data)
 }
 
+// ServiceDeleteFile moves a file into the service's trash. Deleting for good needs
+// permanent=true and the path repeated in confirm, so it never happens by accident.
 func ServiceDeleteFile(c *gin.Context) {
-	userID := c.MustGet("user_id").(uint)
-	uuid := c.Param("uuid")
 	path := c.Query("path")
-
-	service, subUser, ok := utils.FindServiceForUser(uuid, userID)
-	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found or no access"})
+	permanent := c.Query("permanent") == "true"
+	if permanent && c.Query("confirm") != path {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirm a permanent delete by repeating the path in confirm"})
 		return
 	}
 
-	// Permission check
-	if subUser != nil && !subUser.CanManageFiles {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to manage files for this server"})
+	service, ok := findFileService(c)
+	if !ok {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/files?path=%s", service.Node.Address, service.Node.Port, service.UUID, path)
-	req, _ := http.NewRequest("DELETE", url, nil)
-	req.Header.Set("X-Node-Token", service.Node.Token)
+	target := fmt.Sprintf("/api/servers/%s/files?path=%s", service.UUID, url.QueryEscape(path))
+	if permanent {
+		target += "&permanent=true"
+	}
+	req, _ := utils.NewNodeRequest(&service.Node, "DELETE", target, nil)
+	applyFileDenylist(c, service, req)
 
-	client := &http.Client{}
+	// Large directories can take a while to measure or remove
+	client := utils.NodeClient(&service.Node, 0)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
@@ -494,7 +546,27 @@ func ServiceDeleteFile(c *gin.Context) {
 	}
 	defer resp.Body.Close()
 
-	c.JSON(resp.StatusCode, gin.H{"status": "success"})
+	data, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", data)
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	if permanent {
+		utils.LogActivity(c, service.ID, "file_delete_permanent", "files", "Permanently deleted "+path, map[string]interface{}{
+			"path": path,
+		})
+		return
+	}
+	var result struct {
+		Item struct {
+			ID string `json:"id"`
+		} `json:"item"`
+	}
+	json.Unmarshal(data, &result)
+	utils.LogActivity(c, service.ID, "file_delete", "files", "Moved "+path+" to the trash", map[string]interface{}{
+		"path":     path,
+		"trash_id": result.Item.ID,
+	})
 }
 
 func ServiceUploadFile(c *gin.Context) {
@@ -514,14 +586,12 @@ func ServiceUploadFile(c *gin.Context) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:%s/api/servers/%s/files/upload?path=%s", service.Node.Address, service.Node.Port, service.UUID, path)
-
-	// Proxy the multipart body
-	req, _ := http.NewRequest("POST", url, c.Request.Body)
-	req.Header.Set("X-Node-Token", service.Node.Token)
+	// Proxy the multipart body (streamed, so the payload itself is not hashed)
+	req, _ := utils.NewNodeStreamRequest(&service.Node, "POST", fmt.Sprintf("/api/servers/%s/files/upload?path=%s&disk=%d", service.UUID, url.QueryEscape(path), service.Disk), c.Request.Body)
+	applyFileDenylist(c, service, req)
 	req.Header.Set("Content-Type", c.GetHeader("Content-Type"))
 
-	client := &http.Client{}
+	client := utils.NodeClient(&service.Node, 0)
 	resp, err := client.Do(req)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Node unreachable"})
@@ -529,5 +599,5 @@ func ServiceUploadFile(c *gin.Context) {
 	}
 	defer resp.Body.Close()
 
-	c.JSON(resp.StatusCode, gin.H{"status": "success"})
+	c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
 }
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// startSession records a new login for user and returns its access and refresh tokens
+func startSession(c *gin.Context, user *models.User) (string, string, error) {
+	refreshToken := utils.RandomString(32)
+	now := time.Now()
+
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        c.GetHeader("User-Agent"),
+		IPAddress:        c.ClientIP(),
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(config.AppConfig.RefreshTokenTTL),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := utils.GenerateToken(user.ID, user.IsAdmin, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// RefreshSession swaps a refresh token for a new access token and a new refresh token.
+// Presenting a refresh token that was already rotated out revokes the whole session.
+func RefreshSession(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash := utils.HashToken(req.RefreshToken)
+	now := time.Now()
+
+	var session models.Session
+	if err := database.DB.Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+		// An old token being replayed means it leaked; end the session it belonged to
+		var reused models.Session
+		if database.DB.Where("previous_token_hash = ? AND revoked_at IS NULL", hash).First(&reused).Error == nil {
+			database.DB.Model(&reused).Update("revoked_at", now)
+			utils.LogActivityDirect(0, reused.UserID, "session_revoke", "session", "Session revoked after a refresh token was reused", c.ClientIP())
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired"})
+		return
+	}
+
+	refreshToken := utils.RandomString(32)
+	result := database.DB.Model(&session).Where("refresh_token_hash = ?", hash).Updates(map[string]interface{}{
+		"refresh_token_hash":  utils.HashToken(refreshToken),
+		"previous_token_hash": hash,
+		"last_seen_at":        now,
+		"ip_address":          c.ClientIP(),
+		"expires_at":          now.Add(config.AppConfig.RefreshTokenTTL),
+	})
+	if result.Error != nil || result.RowsAffected != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	accessToken, err := utils.GenerateToken(user.ID, user.IsAdmin, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"user":          user,
+	})
+}
+
+// GetSessions returns the current user's active sessions
+func GetSessions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	currentID := c.GetUint("session_id")
+	result := make([]gin.H, len(sessions))
+	for i, s := range sessions {
+		result[i] = gin.H{
+			"session": s,
+			"current": s.ID == currentID,
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RevokeSession logs out one of the current user's sessions
+func RevokeSession(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "session_revoke", "session", "Revoked a login session", map[string]interface{}{"session_id": c.Param("id")})
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// RevokeAllSessions logs the current user out everywhere, including this session
+func RevokeAllSessions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	utils.RevokeUserSessions(userID)
+	utils.LogActivity(c, 0, "session_revoke", "session", "Logged out of all sessions", nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// Logout ends the current session
+func Logout(c *gin.Context) {
+	database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", c.GetUint("session_id")).
+		Update("revoked_at", time.Now())
+
+	c.JSON(http.StatusOK, gin.H{"status": "logged_out"})
+}
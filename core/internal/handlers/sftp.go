@@ -1,20 +1,30 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/auth"
 	"github.com/luketaylor45/atlas/core/internal/database"
 	"github.com/luketaylor45/atlas/core/internal/models"
 	"github.com/luketaylor45/atlas/core/internal/utils"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type SFTPAuthRequest struct {
 	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Password string `json:"password"`
+	TOTPCode string `json:"totp_code"` // Asked for by the daemon once we reply totp_required
+	ClientIP string `json:"client_ip"` // Address of the SFTP client, as seen by the daemon
+
+	// Public key logins send the key's SHA256 fingerprint instead of a password. The daemon asks once
+	// when the key is offered and again with key_verified once the client has proven it holds the key.
+	PublicKey   string `json:"public_key"`
+	KeyVerified bool   `json:"key_verified"`
 }
 
 // ValidateSFTPCredentials validates SFTP login credentials
@@ -35,22 +45,69 @@ func ValidateSFTPCredentials(c *gin.Context) {
 	serviceIDPrefix := parts[0]
 	actualUsername := strings.Join(parts[1:], ".")
 
-	// Find user by username
-	var user models.User
-	if err := database.DB.Where("LOWER(username) = LOWER(?)", actualUsername).First(&user).Error; err != nil {
-		c.JSON(http.StatusOK, gin.H{"valid": false})
+	// Rate limit on the real client address, falling back to the daemon's
+	clientIP := req.ClientIP
+	if net.ParseIP(clientIP) == nil {
+		clientIP = c.ClientIP()
+	}
+	if _, locked := utils.LoginLocked(clientIP, actualUsername); locked {
+		c.JSON(http.StatusOK, gin.H{"valid": false, "locked": true})
 		return
 	}
 
-	// Validate user's account password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusOK, gin.H{"valid": false})
-		return
+	var user *models.User
+	var sshKey *models.SSHKey
+	if req.PublicKey != "" {
+		// Key logins are checked against the user's registered keys. Clients try every key they
+		// have, so a key that doesn't match is not counted as a failed login.
+		var ok bool
+		user, sshKey, ok = findSSHKeyUser(actualUsername, req.PublicKey)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"valid": false})
+			return
+		}
+	} else {
+		if req.Password == "" {
+			c.JSON(http.StatusOK, gin.H{"valid": false})
+			return
+		}
+
+		// Check the password with the local database or the configured directory
+		authenticated, err := auth.Authenticate(actualUsername, req.Password)
+		if err != nil {
+			if !errors.Is(err, auth.ErrUnavailable) {
+				utils.RecordLoginFailure(clientIP, actualUsername)
+			}
+			c.JSON(http.StatusOK, gin.H{"valid": false})
+			return
+		}
+		user = authenticated
+
+		// The same password isn't accepted over SFTP when the panel refuses it
+		if localLoginDisabled(user) {
+			c.JSON(http.StatusOK, gin.H{"valid": false})
+			return
+		}
+
+		// Accounts with 2FA need a code as well; the daemon prompts for it with keyboard-interactive auth
+		if user.TOTPEnabled {
+			if req.TOTPCode == "" {
+				c.JSON(http.StatusOK, gin.H{"valid": false, "totp_required": true})
+				return
+			}
+			if !verifySecondFactor(user, req.TOTPCode) {
+				utils.RecordLoginFailure(clientIP, actualUsername)
+				c.JSON(http.StatusOK, gin.H{"valid": false})
+				return
+			}
+		}
+		utils.RecordLoginSuccess(actualUsername)
 	}
 
-	// Find the targeted service
+	// Find the targeted service, limited to the node asking
+	node := c.MustGet("node").(*models.Node)
 	var service models.Service
-	if err := database.DB.Where("uuid LIKE ?", serviceIDPrefix+"%").First(&service).Error; err != nil {
+	if err := database.DB.Where("uuid LIKE ? AND node_id = ?", serviceIDPrefix+"%", node.ID).First(&service).Error; err != nil {
 		c.JSON(http.StatusOK, gin.H{"valid": false})
 		return
 	}
@@ -58,6 +115,7 @@ func ValidateSFTPCredentials(c *gin.Context) {
 	// Check access
 	hasAccess := false
 	accessLevel := ""
+	readOnly := false
 
 	if user.IsAdmin {
 		hasAccess = true
@@ -71,17 +129,55 @@ func ValidateSFTPCredentials(c *gin.Context) {
 		if err := database.DB.Where("service_id = ? AND user_id = ? AND can_access_sftp = ?", service.ID, user.ID, true).First(&su).Error; err == nil {
 			hasAccess = true
 			accessLevel = "Sub-user"
+			readOnly = !su.CanManageFiles // SFTP access alone only allows downloading
 		}
 	}
 
 	if hasAccess {
-		utils.LogActivityDirect(service.ID, user.ID, "sftp_login", "SFTP", fmt.Sprintf("SFTP connection established (%s)", accessLevel), c.ClientIP())
+		// An offered key is only a login once the client has signed with it
+		if sshKey != nil && !req.KeyVerified {
+			c.JSON(http.StatusOK, gin.H{"valid": true, "service_uuid": service.UUID, "read_only": readOnly})
+			return
+		}
+
+		method := "password"
+		if sshKey != nil {
+			method = "key " + sshKey.Fingerprint
+			now := time.Now()
+			database.DB.Model(sshKey).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP})
+		}
+
+		// Admins manage the files the egg keeps customers away from
+		denylist := []string{}
+		if !user.IsAdmin {
+			var egg models.Egg
+			database.DB.Select("file_denylist").First(&egg, service.EggID)
+			denylist = append(denylist, fileDenylist(&egg)...)
+		}
+
+		utils.LogActivityDirect(service.ID, user.ID, "sftp_login", "SFTP", fmt.Sprintf("SFTP connection established (%s, %s)", accessLevel, method), clientIP)
 		c.JSON(http.StatusOK, gin.H{
-			"valid":        true,
-			"service_uuid": service.UUID,
+			"valid":         true,
+			"service_uuid":  service.UUID,
+			"read_only":     readOnly,
+			"file_denylist": denylist,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"valid": false})
 }
+
+// findSSHKeyUser returns the user and their key matching a public key fingerprint
+func findSSHKeyUser(username, fingerprint string) (*models.User, *models.SSHKey, bool) {
+	var user models.User
+	if err := database.DB.Where("LOWER(username) = LOWER(?)", username).First(&user).Error; err != nil {
+		return nil, nil, false
+	}
+
+	var key models.SSHKey
+	if err := database.DB.Where("user_id = ? AND fingerprint = ?", user.ID, fingerprint).First(&key).Error; err != nil {
+		return nil, nil, false
+	}
+	return &user, &key, true
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/auth"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+type stubProvider struct {
+	user *models.User
+}
+
+func (s stubProvider) Name() string { return "stub" }
+
+func (s stubProvider) Authenticate(username, password string) (*models.User, error) {
+	if password != "correct" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return s.user, nil
+}
+
+func TestLocalLoginDisabled(t *testing.T) {
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	tests := []struct {
+		disabled bool
+		user     models.User
+		want     bool
+	}{
+		{false, models.User{AuthSource: models.AuthSourceLocal}, false},
+		{true, models.User{AuthSource: models.AuthSourceLocal}, true},
+		{true, models.User{AuthSource: models.AuthSourceLocal, IsAdmin: true}, false},
+		{true, models.User{AuthSource: models.AuthSourceLDAP}, false},
+	}
+	for _, tt := range tests {
+		config.AppConfig.DisableLocalLogin = tt.disabled
+		if got := localLoginDisabled(&tt.user); got != tt.want {
+			t.Errorf("localLoginDisabled(disabled=%v, %+v) = %v, want %v", tt.disabled, tt.user, got, tt.want)
+		}
+	}
+}
+
+// With DISABLE_LOCAL_LOGIN a local user's password opens SFTP no more than it opens the panel
+func TestSFTPRefusesDisabledLocalLogin(t *testing.T) {
+	previous := config.AppConfig
+	t.Cleanup(func() {
+		config.AppConfig = previous
+		auth.SetProviders()
+	})
+	config.AppConfig.DisableLocalLogin = true
+	auth.SetProviders(stubProvider{user: &models.User{ID: 7, Username: "customer", AuthSource: models.AuthSourceLocal}})
+
+	router := gin.New()
+	router.POST("/sftp/auth", func(c *gin.Context) {
+		c.Set("node", &models.Node{ID: 1})
+		ValidateSFTPCredentials(c)
+	})
+
+	body, _ := json.Marshal(SFTPAuthRequest{Username: "abcd1234.customer", Password: "correct", ClientIP: "203.0.113.9"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/sftp/auth", bytes.NewReader(body)))
+
+	var resp struct {
+		Valid bool `json:"valid"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Valid {
+		t.Fatal("SFTP accepted the password of a local user while local login is disabled")
+	}
+}
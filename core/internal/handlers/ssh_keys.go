@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for SFTP logins
+const minRSAKeyBits = 2048
+
+type CreateSSHKeyRequest struct {
+	Name      string `json:"name" binding:"required,max=100"`
+	PublicKey string `json:"public_key" binding:"required"`
+}
+
+// GetSSHKeys returns the current user's SSH public keys
+func GetSSHKeys(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var keys []models.SSHKey
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch SSH keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateSSHKey adds a public key (in authorized_keys format) to the current user's account
+func CreateSSHKey(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var req CreateSSHKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	publicKey, _, _, rest, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(req.PublicKey)))
+	if err != nil || len(strings.TrimSpace(string(rest))) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid public key, paste a single line from your .pub file"})
+		return
+	}
+	if err := checkSSHKeyStrength(publicKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fingerprint := ssh.FingerprintSHA256(publicKey)
+	var existing models.SSHKey
+	if err := database.DB.Where("user_id = ? AND fingerprint = ?", userID, fingerprint).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This key is already added to your account"})
+		return
+	}
+
+	key := models.SSHKey{
+		UserID:      userID,
+		Name:        req.Name,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		Fingerprint: fingerprint,
+		KeyType:     publicKey.Type(),
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add SSH key"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "ssh_key_create", fingerprint, fmt.Sprintf("Added SSH key: %s", key.Name), map[string]interface{}{
+		"type": key.KeyType,
+	})
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// DeleteSSHKey removes one of the current user's SSH keys
+func DeleteSSHKey(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var key models.SSHKey
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&key).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSH key not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete SSH key"})
+		return
+	}
+	utils.LogActivity(c, 0, "ssh_key_delete", key.Fingerprint, fmt.Sprintf("Removed SSH key: %s", key.Name), nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// checkSSHKeyStrength rejects key types and sizes that are no longer safe
+func checkSSHKeyStrength(key ssh.PublicKey) error {
+	switch key.Type() {
+	case ssh.KeyAlgoRSA:
+		cryptoKey, ok := key.(ssh.CryptoPublicKey)
+		if !ok {
+			return fmt.Errorf("Unsupported RSA key")
+		}
+		if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); !ok || rsaKey.N.BitLen() < minRSAKeyBits {
+			return fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+	case ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256:
+	default:
+		return fmt.Errorf("Unsupported key type %s, use ed25519, ECDSA or RSA", key.Type())
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/auth"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recoveryCodeCount is how many recovery codes are issued when 2FA is enabled
+const recoveryCodeCount = 10
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// GetTwoFactorStatus returns whether 2FA is enabled for the current user
+func GetTwoFactorStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"recovery_codes_remaining": len(utils.ParseStringList(user.RecoveryCodes)),
+	})
+}
+
+// SetupTwoFactor generates a new secret for the current user. It is not enforced until confirmed.
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret := utils.GenerateTOTPSecret()
+	if err := database.DB.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI("Atlas", user.Username, secret),
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app and returns recovery codes
+func EnableTwoFactor(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(user.TOTPSecret, req.Code, user.TOTPLastStep)
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_enabled":   true,
+		"totp_last_step": step,
+		"recovery_codes": hashed,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	utils.LogActivity(c, 0, "2fa_enable", "account", "Enabled two-factor authentication", nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.TOTPEnabled || !verifySecondFactor(user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	database.DB.Model(user).Update("recovery_codes", hashed)
+
+	utils.LogActivity(c, 0, "2fa_recovery_codes", "account", "Regenerated two-factor recovery codes", nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns off 2FA after checking the password and a current code
+func DisableTwoFactor(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !auth.CheckPassword(user, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	if !user.TOTPEnabled || !verifySecondFactor(user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	clearTwoFactor(user)
+	utils.LogActivity(c, 0, "2fa_disable", "account", "Disabled two-factor authentication", nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "disabled"})
+}
+
+// currentUser loads the authenticated user, writing a 404 if they no longer exist
+func currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := database.DB.First(&user, c.MustGet("user_id").(uint)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// verifySecondFactor accepts a TOTP code or consumes one of the user's recovery codes.
+// Updates are conditional on the stored value so a code can't be used twice by concurrent requests.
+func verifySecondFactor(user *models.User, code string) bool {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, user.TOTPLastStep); ok {
+		result := database.DB.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		user.TOTPLastStep = step
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	hashes := utils.ParseStringList(user.RecoveryCodes)
+	for i, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			remaining, _ := json.Marshal(append(hashes[:i:i], hashes[i+1:]...))
+			result := database.DB.Model(&models.User{}).Where("id = ? AND recovery_codes = ?", user.ID, user.RecoveryCodes).Update("recovery_codes", string(remaining))
+			user.RecoveryCodes = string(remaining)
+			return result.Error == nil && result.RowsAffected == 1
+		}
+	}
+	return false
+}
+
+// clearTwoFactor removes a user's 2FA enrollment
+func clearTwoFactor(user *models.User) {
+	database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_enabled":   false,
+		"totp_secret":    "",
+		"totp_last_step": 0,
+		"recovery_codes": "",
+	})
+}
+
+// newRecoveryCodes returns fresh recovery codes and the JSON list of their hashes
+func newRecoveryCodes() ([]string, string, error) {
+	codes := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		hashes[i] = string(hash)
+	}
+	encoded, _ := json.Marshal(hashes)
+	return codes, string(encoded), nil
+}
@@ -1,16 +1,29 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
 	"github.com/luketaylor45/atlas/core/internal/utils"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+
+		// Browsers cannot set headers on websocket handshakes, so those may pass the token as a query parameter
+		if authHeader == "" && c.Query("token") != "" && strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			authHeader = "Bearer " + c.Query("token")
+		}
+
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
 			c.Abort()
@@ -25,6 +38,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
+		if strings.HasPrefix(tokenString, utils.PersonalKeyPrefix) || strings.HasPrefix(tokenString, utils.ApplicationKeyPrefix) {
+			if authenticateAPIKey(c, tokenString) {
+				c.Next()
+			}
+			return
+		}
+
 		claims, err := utils.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
@@ -32,22 +52,169 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// The session must still be active and the user must still exist. Admin rights are
+		// read from the user rather than the token so demotions apply immediately.
+		var session models.Session
+		if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.SessionID, claims.UserID, time.Now()).First(&session).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := database.DB.Select("id", "is_admin").First(&user, claims.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		if time.Since(session.LastSeenAt) > time.Minute {
+			database.DB.Model(&session).Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip_address": c.ClientIP()})
+		}
+
 		// Set context values
-		c.Set("user_id", claims.UserID)
-		c.Set("is_admin", claims.IsAdmin)
+		c.Set("user_id", user.ID)
+		c.Set("is_admin", user.IsAdmin)
+		c.Set("session_id", session.ID)
+
+		c.Next()
+	}
+}
+
+// authenticateAPIKey checks a personal or application API key and sets the same context values as a JWT would.
+// It writes the error response itself and returns false if the key is not usable.
+func authenticateAPIKey(c *gin.Context, key string) bool {
+	var apiKey models.APIKey
+	if err := database.DB.Where("prefix = ?", utils.APIKeyPrefix(key)).First(&apiKey).Error; err != nil ||
+		subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(utils.HashAPIKey(key))) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return false
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has expired or been revoked"})
+		return false
+	}
+
+	if !utils.IPAllowed(utils.ParseStringList(apiKey.AllowedIPs), c.ClientIP()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is not allowed from this IP address"})
+		return false
+	}
+
+	// Application keys stop working if their owner loses admin rights
+	application := strings.HasPrefix(key, utils.ApplicationKeyPrefix)
+	var user models.User
+	if err := database.DB.First(&user, apiKey.UserID).Error; err != nil ||
+		application != (apiKey.Type == "application") || (application && !user.IsAdmin) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return false
+	}
 
+	// Only record usage once a minute so busy scripts don't write on every request
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute || apiKey.LastUsedIP != c.ClientIP() {
+		database.DB.Model(&apiKey).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": c.ClientIP()})
+	}
+
+	// Keys act as their owner, but never carry the is_admin claim. Application keys have no
+	// scopes, so they are limited to the admin routes their permissions allow.
+	c.Set("user_id", apiKey.UserID)
+	c.Set("is_admin", false)
+	c.Set("api_key_id", apiKey.ID)
+	c.Set("api_key_name", apiKey.Name)
+	if application {
+		c.Set("api_key_scopes", []string{})
+		c.Set("api_key_permissions", utils.ParsePermissions(apiKey.Permissions))
+	} else {
+		c.Set("api_key_scopes", utils.ParseStringList(apiKey.Scopes))
+	}
+	return true
+}
+
+// RequireScope limits API key requests to keys holding scope. Requests made with a login token are unaffected.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scopes, ok := c.Get("api_key_scopes"); ok && !slices.Contains(scopes.([]string), scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionOnly rejects API keys, for routes that manage credentials
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This action cannot be performed with an API key"})
+			return
+		}
 		c.Next()
 	}
 }
 
+// adminResources maps the first segment of an admin route to the application key resource that guards it.
+// Admin routes not listed here cannot be used with application keys.
+var adminResources = map[string]string{
+	"users":       models.ResourceUsers,
+	"lockouts":    models.ResourceUsers,
+	"nodes":       models.ResourceNodes,
+	"locations":   models.ResourceNodes,
+	"nests":       models.ResourceNests,
+	"eggs":        models.ResourceNests,
+	"services":    models.ResourceServices,
+	"allocations": models.ResourceAllocations,
+}
+
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if permissions, ok := c.Get("api_key_permissions"); ok {
+			applicationKeyAccess(c, permissions.(map[string]string))
+			return
+		}
+
 		isAdmin, exists := c.Get("is_admin")
 		if !exists || !isAdmin.(bool) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
 		}
+
+		if config.AppConfig.RequireAdmin2FA {
+			var user models.User
+			if err := database.DB.Select("id", "totp_enabled").First(&user, c.MustGet("user_id").(uint)).Error; err != nil || !user.TOTPEnabled {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error":                     "Two-factor authentication must be enabled to use admin features",
+					"two_factor_setup_required": true,
+				})
+				return
+			}
+		}
 		c.Next()
 	}
 }
+
+// applicationKeyAccess checks an application key against the admin route being called and records the call
+func applicationKeyAccess(c *gin.Context, permissions map[string]string) {
+	segment := strings.TrimPrefix(c.FullPath(), "/api/v1/admin/")
+	if i := strings.Index(segment, "/"); i >= 0 {
+		segment = segment[:i]
+	}
+
+	resource, ok := adminResources[segment]
+	level := permissions[resource]
+	allowed := ok && (level == "write" || (level == "read" && c.Request.Method == http.MethodGet))
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Application key does not have access to this resource"})
+	} else {
+		c.Next()
+	}
+
+	utils.LogActivity(c, 0, "api_request", c.Request.Method+" "+c.Request.URL.Path,
+		fmt.Sprintf("Application key %s called %s %s", c.GetString("api_key_name"), c.Request.Method, c.Request.URL.Path),
+		map[string]interface{}{
+			"resource": resource,
+			"status":   c.Writer.Status(),
+			"allowed":  allowed,
+		})
+}
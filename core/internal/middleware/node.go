@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/secrets"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+)
+
+// maxSignedBody caps how much of a request body is buffered to verify its hash
+const maxSignedBody = 8 << 20
+
+var nodeNonces = utils.NewNonceCache()
+
+// NodeAuthMiddleware authenticates daemon requests by their HMAC signature and sets "node"
+func NodeAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBody+1))
+		if err != nil || len(body) > maxSignedBody {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		contentHash := utils.HashBody(body)
+
+		keyID := c.GetHeader(utils.SignatureHeaderKey)
+		if len(keyID) < 10 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid node signature"})
+			return
+		}
+
+		// The key ID is only a lookup hint; the signature decides which node this is.
+		// A node's previous token is still accepted during its rotation grace period.
+		var candidates []models.Node
+		database.DB.Where("token_prefix = ? OR (previous_token_prefix = ? AND previous_token_expires_at > ?)", keyID, keyID, time.Now()).Find(&candidates)
+
+		var node *models.Node
+		usedCurrent := false
+		for i := range candidates {
+			candidate := &candidates[i]
+			if candidate.TokenPrefix == keyID && verifyNodeKey(candidate.SigningKey, c.Request, contentHash) {
+				node, usedCurrent = candidate, true
+				break
+			}
+			if candidate.PreviousTokenPrefix == keyID && utils.NodePreviousTokenActive(candidate) && verifyNodeKey(candidate.PreviousSigningKey, c.Request, contentHash) {
+				node = candidate
+				break
+			}
+		}
+		if node == nil {
+			log.Printf("[Core] Rejected unsigned or badly signed internal request to %s from %s", c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid node signature"})
+			return
+		}
+
+		if !nodeNonces.Use(keyID + ":" + c.GetHeader(utils.SignatureHeaderNonce)) {
+			log.Printf("[Core] Rejected replayed internal request to %s from node %s", c.Request.URL.Path, node.Name)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid node signature"})
+			return
+		}
+
+		// The daemon has picked up a rotated token, so Core can start signing with it too
+		if usedCurrent && !node.TokenConfirmed {
+			node.TokenConfirmed = true
+			database.DB.Model(node).Update("token_confirmed", true)
+			log.Printf("[Core] Node %s is now using its rotated token", node.Name)
+		}
+
+		c.Set("node", node)
+		c.Next()
+	}
+}
+
+func verifyNodeKey(stored secrets.String, r *http.Request, contentHash string) bool {
+	key := utils.DecodeSigningKey(stored)
+	if key == nil {
+		return false
+	}
+	return utils.VerifySignature(key, r, contentHash) == nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// Scopes a personal API key can be granted
+const (
+	ScopeServicesRead      = "services:read"
+	ScopeServicesCreate    = "services:create"
+	ScopeServicesPower     = "services:power"
+	ScopeServicesConsole   = "services:console"
+	ScopeServicesStartup   = "services:startup"
+	ScopeServicesUsers     = "services:users"
+	ScopeServicesDatabases = "services:databases"
+	ScopeFilesRead         = "files:read"
+	ScopeFilesWrite        = "files:write"
+)
+
+// PersonalKeyScopes lists every scope a personal key may hold
+var PersonalKeyScopes = []string{
+	ScopeServicesRead,
+	ScopeServicesCreate,
+	ScopeServicesPower,
+	ScopeServicesConsole,
+	ScopeServicesStartup,
+	ScopeServicesUsers,
+	ScopeServicesDatabases,
+	ScopeFilesRead,
+	ScopeFilesWrite,
+}
+
+// Resources an application key can be given read or write access to
+const (
+	ResourceUsers       = "users"
+	ResourceNodes       = "nodes"
+	ResourceNests       = "nests" // Nests and eggs
+	ResourceServices    = "services"
+	ResourceAllocations = "allocations"
+)
+
+// ApplicationKeyResources lists every resource an application key may be granted
+var ApplicationKeyResources = []string{
+	ResourceUsers,
+	ResourceNodes,
+	ResourceNests,
+	ResourceServices,
+	ResourceAllocations,
+}
+
+// APIKey is a long-lived credential for scripts and integrations. Only a hash of the key is stored.
+type APIKey struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"not null;index" json:"user_id"`
+	User   User `json:"-" gorm:"foreignKey:UserID"`
+
+	Type    string `gorm:"size:20;not null;default:'personal'" json:"type"` // personal or application
+	Name    string `gorm:"size:100;not null" json:"name"`
+	Prefix  string `gorm:"size:16;uniqueIndex;not null" json:"prefix"` // Identifies the key in lists and lookups
+	KeyHash string `gorm:"size:64;not null" json:"-"`
+
+	Scopes      string `gorm:"type:text" json:"scopes"`      // JSON list of scopes (personal keys)
+	Permissions string `gorm:"type:text" json:"permissions"` // JSON map of resource to "read" or "write" (application keys)
+	AllowedIPs  string `gorm:"type:text" json:"allowed_ips"` // JSON list of IPs/CIDRs, empty allows any
+
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
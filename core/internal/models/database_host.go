@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/luketaylor45/atlas/core/internal/secrets"
+)
+
+// Database engines a host can run
+const (
+	DatabaseTypeMySQL    = "mysql" // MySQL or MariaDB
+	DatabaseTypePostgres = "postgres"
+)
+
+// DatabaseHost is a MySQL/MariaDB or PostgreSQL server Core creates service databases on. The
+// account needs rights to create databases and users, and to grant privileges on them.
+type DatabaseHost struct {
+	ID       uint           `gorm:"primaryKey" json:"id"`
+	Name     string         `gorm:"size:255;not null" json:"name"`
+	Type     string         `gorm:"size:20;not null;default:'mysql'" json:"type"`
+	Host     string         `gorm:"size:255;not null" json:"host"` // As Core connects to it
+	Port     int            `gorm:"not null" json:"port"`
+	Username string         `gorm:"size:255;not null" json:"username"`
+	Password secrets.String `gorm:"type:text" json:"password,omitempty"` // Only accepted, never returned. Encrypted at rest.
+
+	// Address shown to users, for hosts Core reaches on a private network. Defaults to Host.
+	PublicHost string `gorm:"size:255" json:"public_host"`
+
+	// Services on this node get their databases here; hosts without a node serve any node
+	NodeID *uint `json:"node_id"`
+	Node   *Node `json:"node,omitempty" gorm:"foreignKey:NodeID"`
+
+	MaxDatabases int `gorm:"default:0" json:"max_databases"` // 0 for no limit
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ServiceDatabase is a database created for a service, with a user that can only reach it
+type ServiceDatabase struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	ServiceID uint    `gorm:"not null;index" json:"service_id"`
+	Service   Service `json:"-" gorm:"foreignKey:ServiceID"`
+
+	DatabaseHostID uint         `gorm:"not null;uniqueIndex:idx_service_database_host_name" json:"database_host_id"`
+	DatabaseHost   DatabaseHost `json:"-" gorm:"foreignKey:DatabaseHostID"`
+
+	Name     string         `gorm:"size:64;not null;uniqueIndex:idx_service_database_host_name" json:"name"`
+	Username string         `gorm:"size:32;not null" json:"username"`
+	Password secrets.String `gorm:"type:text;not null" json:"password"`          // Encrypted at rest
+	Remote   string         `gorm:"size:255;not null;default:'%'" json:"remote"` // Hosts the user may connect from (MySQL)
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -43,6 +43,7 @@ type Egg struct {
 	ScriptEntry     string `gorm:"size:255" json:"script_entry"`
 	ScriptContainer string `gorm:"size:255" json:"script_container"`
 	ScriptCovers    bool   `gorm:"default:false" json:"script_covers"` // If true, script runs on every start? (Legacy compat)
+	FileDenylist    string `gorm:"type:text" json:"file_denylist"`     // JSON list of globs customers can't see or edit
 
 	// Constraint: Deleting an Egg deletes all its Variables
 	Variables []EggVariable `json:"variables" gorm:"foreignKey:EggID;constraint:OnDelete:CASCADE"`
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// Location groups nodes by where they run, e.g. "us.nyc" in "North America"
+type Location struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	Short  string `gorm:"size:60;uniqueIndex;not null" json:"short"` // Code used in the API and lists
+	Long   string `gorm:"size:255" json:"long"`                      // Display name
+	Region string `gorm:"size:100;index" json:"region"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/luketaylor45/atlas/core/internal/secrets"
 	"gorm.io/gorm"
 )
 
@@ -12,7 +13,24 @@ type Node struct {
 	Address  string `gorm:"not null" json:"address"` // IP or Domain
 	Port     string `gorm:"default:'8081'" json:"port"`
 	SFTPPort string `gorm:"default:'2022'" json:"sftp_port"`
-	Token    string `gorm:"uniqueIndex;not null" json:"-"`
+
+	// Authentication. Only a hash of the node token is stored; the prefix doubles as the signing key ID.
+	// The key requests are signed with is derived from the token and stored encrypted.
+	TokenPrefix string         `gorm:"size:10;index" json:"token_prefix"`
+	TokenHash   string         `gorm:"size:64" json:"-"`
+	SigningKey  secrets.String `gorm:"type:text" json:"-"`
+
+	// While a rotation is in progress the previous token stays valid until PreviousTokenExpiresAt
+	PreviousTokenPrefix    string         `gorm:"size:10;index" json:"-"`
+	PreviousSigningKey     secrets.String `gorm:"type:text" json:"-"`
+	PreviousTokenExpiresAt *time.Time     `json:"previous_token_expires_at"`
+	TokenConfirmed         bool           `gorm:"default:true" json:"token_confirmed"` // The daemon has signed a request with the current token
+	TokenRotatedAt         *time.Time     `json:"token_rotated_at"`
+
+	// Transport security
+	Scheme          string `gorm:"size:10;default:'https'" json:"scheme"` // https, or http for nodes with TLS disabled
+	TLSFingerprint  string `gorm:"size:64" json:"tls_fingerprint"`        // SHA-256 of the daemon certificate, pinned at enrollment
+	SFTPFingerprint string `gorm:"size:100" json:"sftp_fingerprint"`      // SHA256 fingerprint of the SFTP host key
 
 	// Resources
 	TotalRAM  uint64  `gorm:"not null;default:0" json:"total_ram"`  // In MB
@@ -20,8 +38,13 @@ type Node struct {
 	UsedRAM   uint64  `gorm:"default:0" json:"used_ram"`
 	UsedCPU   float64 `gorm:"default:0" json:"used_cpu"`
 
+	// Private IPs or CIDR ranges services may download files from, comma separated.
+	// Everything non-public is blocked by the daemon unless listed here.
+	PullAllowlist string `gorm:"type:text" json:"pull_allowlist"`
+
 	// Location
-	Location string `gorm:"size:255;default:'Unknown'" json:"location"` // Ensure simple string for now, maybe JSON later
+	LocationID *uint     `gorm:"index" json:"location_id"`
+	Location   *Location `json:"location,omitempty" gorm:"foreignKey:LocationID"`
 
 	IsOnline      bool           `gorm:"default:false" json:"is_online"`
 	LastHeartbeat time.Time      `json:"last_heartbeat"`
@@ -32,6 +32,8 @@ type Service struct {
 	Disk   uint64 `gorm:"not null" json:"disk"`   // MB
 	Cpu    uint64 `gorm:"not null" json:"cpu"`    // % (100 = 1 core)
 
+	DatabaseLimit int `gorm:"default:0" json:"database_limit"` // SQL databases the owner may create
+
 	// Network
 	Port int `gorm:"not null" json:"port"`
 
@@ -31,6 +31,7 @@ type ActivityLog struct {
 	ID        uint `gorm:"primaryKey" json:"id"`
 	ServiceID uint `gorm:"not null;index" json:"service_id"`
 	UserID    uint `gorm:"not null;index" json:"user_id"`
+	APIKeyID  uint `gorm:"index" json:"api_key_id,omitempty"` // Set when the action was made with an API key
 
 	// Action details
 	Action      string `gorm:"size:50;not null;index" json:"action"` // power, sftp, file, startup, etc.
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login on one device. Its refresh token is rotated on every use and only stored hashed.
+type Session struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"not null;index" json:"user_id"`
+
+	RefreshTokenHash  string `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	PreviousTokenHash string `gorm:"size:64;index" json:"-"` // Last rotated-out token, used to detect reuse
+
+	UserAgent  string    `gorm:"type:text" json:"user_agent"`
+	IPAddress  string    `gorm:"size:45" json:"ip_address"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// SSHKey is a public key a user can log in to SFTP with instead of their password
+type SSHKey struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null;uniqueIndex:idx_ssh_key_user_fingerprint" json:"user_id"`
+	Name   string `gorm:"size:100;not null" json:"name"`
+
+	PublicKey   string `gorm:"type:text;not null" json:"public_key"`                                         // authorized_keys format
+	Fingerprint string `gorm:"size:64;not null;uniqueIndex:idx_ssh_key_user_fingerprint" json:"fingerprint"` // SHA256:...
+	KeyType     string `gorm:"size:64" json:"key_type"`
+
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
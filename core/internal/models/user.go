@@ -6,11 +6,35 @@ import (
 	"gorm.io/gorm"
 )
 
+// Values for User.AuthSource
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+)
+
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Username  string         `gorm:"uniqueIndex;not null" json:"username"`
-	Password  string         `gorm:"not null" json:"-"` // Hide password in JSON
-	IsAdmin   bool           `gorm:"default:false" json:"is_admin"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"uniqueIndex;not null" json:"username"`
+	Password string `gorm:"not null" json:"-"` // Hide password in JSON
+	IsAdmin  bool   `gorm:"default:false" json:"is_admin"`
+	Email    string `gorm:"size:255;index" json:"email"`
+
+	// Where the password is checked. LDAP users have an unusable local password.
+	AuthSource string `gorm:"size:16;default:local" json:"auth_source"`
+
+	// Identity provider account this user is linked to, if they sign in with SSO
+	OIDCIssuer  string `gorm:"size:255;index:idx_user_oidc" json:"-"`
+	OIDCSubject string `gorm:"size:255;index:idx_user_oidc" json:"-"`
+
+	// Two-factor authentication. The secret is set at enrollment and only enforced once TOTPEnabled is true.
+	TOTPEnabled   bool   `gorm:"default:false" json:"totp_enabled"`
+	TOTPSecret    string `gorm:"size:64" json:"-"`
+	TOTPLastStep  int64  `gorm:"default:0" json:"-"` // Last accepted time step, so codes can't be reused
+	RecoveryCodes string `gorm:"type:text" json:"-"` // JSON list of bcrypt hashed single-use codes
+
+	// Self-service limits, nil when the user can't create services themselves
+	Quota *UserQuota `json:"quota,omitempty" gorm:"foreignKey:UserID"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
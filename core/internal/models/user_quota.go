@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// UserQuota limits what a user may create for themselves. Users without one, or with Services
+// set to 0, can only be given services by an admin.
+type UserQuota struct {
+	UserID uint `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+
+	// Totals across every service the user owns, including ones an admin created
+	Services int    `gorm:"default:0" json:"services"`
+	Memory   uint64 `gorm:"default:0" json:"memory"` // MB
+	Disk     uint64 `gorm:"default:0" json:"disk"`   // MB
+	Cpu      uint64 `gorm:"default:0" json:"cpu"`    // % (100 = 1 core)
+
+	// Databases each self-service server may have
+	DatabaseLimit int `gorm:"default:0" json:"database_limit"`
+
+	// JSON lists of IDs the user may deploy with; an empty list allows all of them
+	AllowedNests     string `gorm:"type:text" json:"allowed_nests"`
+	AllowedEggs      string `gorm:"type:text" json:"allowed_eggs"`
+	AllowedNodes     string `gorm:"type:text" json:"allowed_nodes"`
+	AllowedLocations string `gorm:"type:text" json:"allowed_locations"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
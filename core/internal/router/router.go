@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/luketaylor45/atlas/core/internal/handlers"
 	"github.com/luketaylor45/atlas/core/internal/middleware"
+	"github.com/luketaylor45/atlas/core/internal/models"
 )
 
 func Setup(r *gin.Engine) {
@@ -14,8 +15,8 @@ func Setup(r *gin.Engine) {
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Range", "Upload-Offset"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "Content-Range", "Upload-Offset"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -25,19 +26,29 @@ func Setup(r *gin.Engine) {
 		auth := api.Group("/auth")
 		{
 			auth.POST("/login", handlers.Login)
+			auth.POST("/login/2fa", handlers.LoginTwoFactor)
+			auth.POST("/refresh", handlers.RefreshSession)
 			auth.POST("/register", handlers.Register)
 			auth.POST("/setup", handlers.InitialSetup)
 			auth.GET("/setup-status", handlers.GetSetupStatus)
+			auth.GET("/providers", handlers.GetAuthProviders)
+
+			// Single sign-on (OpenID Connect)
+			auth.GET("/oidc/login", handlers.OIDCLogin)
+			auth.GET("/oidc/callback", handlers.OIDCCallback)
+			auth.POST("/oidc/exchange", handlers.OIDCExchange)
 		}
 
+		// Daemon Routes (HMAC signed with the node token)
 		internal := api.Group("/internal")
+		internal.Use(middleware.NodeAuthMiddleware())
 		{
 			internal.POST("/heartbeat", handlers.HandleHeartbeat)
 			internal.POST("/services/:uuid/status", handlers.HandleServerStatusUpdate)
 			internal.POST("/sftp/validate", handlers.ValidateSFTPCredentials)
 		}
 
-		// Admin Routes (Protected)
+		// Admin Routes (Protected, or application keys with permission for the resource)
 		admin := api.Group("/admin")
 		admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
 		{
@@ -45,11 +56,18 @@ func Setup(r *gin.Engine) {
 			admin.GET("/nodes", handlers.GetNodes)
 			admin.POST("/nodes", handlers.CreateNode)
 			admin.PUT("/nodes/:id", handlers.UpdateNode)
+			admin.POST("/nodes/:id/rotate-token", handlers.RotateNodeToken)
 			admin.DELETE("/nodes/:id", handlers.DeleteNode)
+			admin.GET("/locations", handlers.GetLocations)
+			admin.POST("/locations", handlers.CreateLocation)
+			admin.PUT("/locations/:id", handlers.UpdateLocation)
+			admin.DELETE("/locations/:id", handlers.DeleteLocation)
 			admin.GET("/users", handlers.GetUsers)
 			admin.POST("/users", handlers.CreateUser)
 			admin.PUT("/users/:id", handlers.UpdateUser)
 			admin.DELETE("/users/:id", handlers.DeleteUser)
+			admin.GET("/lockouts", handlers.GetLockouts)
+			admin.POST("/lockouts/unlock", handlers.UnlockLogin)
 
 			admin.GET("/eggs", handlers.GetEggs)
 			admin.PUT("/eggs/:id", handlers.UpdateEgg)
@@ -59,45 +77,116 @@ func Setup(r *gin.Engine) {
 			admin.PUT("/nests/:id", handlers.UpdateNest)
 			admin.DELETE("/nests/:id", handlers.DeleteNest)
 			admin.POST("/eggs/import", handlers.ImportEgg)
+			admin.GET("/database-hosts", handlers.GetDatabaseHosts)
+			admin.POST("/database-hosts", handlers.CreateDatabaseHost)
+			admin.PUT("/database-hosts/:id", handlers.UpdateDatabaseHost)
+			admin.POST("/database-hosts/:id/test", handlers.TestDatabaseHost)
+			admin.DELETE("/database-hosts/:id", handlers.DeleteDatabaseHost)
 			admin.GET("/services", handlers.GetServices)
 			admin.POST("/services", handlers.CreateService)
 			admin.PUT("/services/:id", handlers.UpdateService)
 			admin.DELETE("/services/:id", handlers.DeleteService)
 
+			// Application Keys (only from a login session)
+			admin.GET("/api-keys", middleware.SessionOnly(), handlers.GetApplicationKeys)
+			admin.POST("/api-keys", middleware.SessionOnly(), handlers.CreateApplicationKey)
+			admin.DELETE("/api-keys/:id", middleware.SessionOnly(), handlers.RevokeApplicationKey)
+
 			// News Management (Admin)
 			admin.POST("/news", handlers.CreateNews)
 			admin.PUT("/news/:id", handlers.UpdateNews)
 			admin.DELETE("/news/:id", handlers.DeleteNews)
 		}
 
-		// User Service Routes
+		// Account Routes (credentials can only be managed from a login session)
+		account := api.Group("/account")
+		account.Use(middleware.AuthMiddleware(), middleware.SessionOnly())
+		{
+			account.POST("/logout", handlers.Logout)
+			account.GET("/sessions", handlers.GetSessions)
+			account.DELETE("/sessions", handlers.RevokeAllSessions)
+			account.DELETE("/sessions/:id", handlers.RevokeSession)
+
+			account.GET("/api-keys", handlers.GetAPIKeys)
+			account.POST("/api-keys", handlers.CreateAPIKey)
+			account.DELETE("/api-keys/:id", handlers.RevokeAPIKey)
+
+			account.GET("/ssh-keys", handlers.GetSSHKeys)
+			account.POST("/ssh-keys", handlers.CreateSSHKey)
+			account.DELETE("/ssh-keys/:id", handlers.DeleteSSHKey)
+
+			account.GET("/2fa", handlers.GetTwoFactorStatus)
+			account.POST("/2fa/setup", handlers.SetupTwoFactor)
+			account.POST("/2fa/enable", handlers.EnableTwoFactor)
+			account.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+			account.POST("/2fa/disable", handlers.DisableTwoFactor)
+		}
+
+		// User Service Routes (API keys are further limited by their scopes)
 		services := api.Group("/services")
 		services.Use(middleware.AuthMiddleware())
 		{
-			services.GET("/overview", handlers.GetUserOverview)
-			services.GET("", handlers.GetUserServices)
-			services.GET("/:uuid", handlers.GetServiceDetails)
-			services.POST("/:uuid/power", handlers.ServicePowerAction)
-			services.POST("/:uuid/command", handlers.ServiceSendCommand)
-			services.POST("/:uuid/reinstall", handlers.ServiceReinstall)
-			services.POST("/:uuid/environment", handlers.UpdateServiceEnvironment)
+			read := middleware.RequireScope(models.ScopeServicesRead)
+			services.GET("/overview", read, handlers.GetUserOverview)
+			services.GET("", read, handlers.GetUserServices)
+			services.GET("/create-options", read, handlers.GetSelfServiceOptions)
+			services.POST("", middleware.RequireScope(models.ScopeServicesCreate), handlers.CreateSelfService)
+			services.GET("/:uuid", read, handlers.GetServiceDetails)
+			services.POST("/:uuid/power", middleware.RequireScope(models.ScopeServicesPower), handlers.ServicePowerAction)
+			services.POST("/:uuid/command", middleware.RequireScope(models.ScopeServicesConsole), handlers.ServiceSendCommand)
+			services.POST("/:uuid/reinstall", middleware.RequireScope(models.ScopeServicesStartup), handlers.ServiceReinstall)
+			services.POST("/:uuid/environment", middleware.RequireScope(models.ScopeServicesStartup), handlers.UpdateServiceEnvironment)
+			services.GET("/:uuid/stats", read, handlers.ServiceStats)
+			services.GET("/:uuid/console", middleware.RequireScope(models.ScopeServicesConsole), handlers.ServiceConsole)
 
 			// File Management
-			services.GET("/:uuid/files/list", handlers.ServiceListFiles)
-			services.GET("/:uuid/files/content", handlers.ServiceGetFileContent)
-			services.POST("/:uuid/files/write", handlers.ServiceWriteFile)
-			services.POST("/:uuid/files/create-folder", handlers.ServiceCreateFolder)
-			services.POST("/:uuid/files/upload", handlers.ServiceUploadFile)
-			services.DELETE("/:uuid/files", handlers.ServiceDeleteFile)
+			filesRead := middleware.RequireScope(models.ScopeFilesRead)
+			filesWrite := middleware.RequireScope(models.ScopeFilesWrite)
+			services.GET("/:uuid/files/list", filesRead, handlers.ServiceListFiles)
+			services.GET("/:uuid/files/content", filesRead, handlers.ServiceGetFileContent)
+			services.GET("/:uuid/files/download", filesRead, handlers.ServiceDownloadFile)
+			services.GET("/:uuid/files/search", filesRead, handlers.ServiceSearchFiles)
+			services.POST("/:uuid/files/write", filesWrite, handlers.ServiceWriteFile)
+			services.GET("/:uuid/files/revisions", filesRead, handlers.ServiceListRevisions)
+			services.GET("/:uuid/files/revisions/diff", filesRead, handlers.ServiceDiffRevision)
+			services.POST("/:uuid/files/revisions/restore", filesWrite, handlers.ServiceRestoreRevision)
+			services.POST("/:uuid/files/create-folder", filesWrite, handlers.ServiceCreateFolder)
+			services.POST("/:uuid/files/upload", filesWrite, handlers.ServiceUploadFile)
+			services.DELETE("/:uuid/files", filesWrite, handlers.ServiceDeleteFile)
+			services.POST("/:uuid/files/rename", filesWrite, handlers.ServiceRenameFiles)
+			services.POST("/:uuid/files/copy", filesWrite, handlers.ServiceCopyFiles)
+			services.GET("/:uuid/files/trash", filesRead, handlers.ServiceListTrash)
+			services.POST("/:uuid/files/trash/restore", filesWrite, handlers.ServiceRestoreTrash)
+			services.DELETE("/:uuid/files/trash", filesWrite, handlers.ServiceEmptyTrash)
+			services.DELETE("/:uuid/files/trash/:id", filesWrite, handlers.ServicePurgeTrash)
+			services.POST("/:uuid/files/chmod", filesWrite, handlers.ServiceChmodFiles)
+			services.POST("/:uuid/files/fix-permissions", filesWrite, handlers.ServiceFixPermissions)
+			services.POST("/:uuid/files/compress", filesWrite, handlers.ServiceCompressFiles)
+			services.POST("/:uuid/files/decompress", filesWrite, handlers.ServiceDecompressFile)
+			services.POST("/:uuid/files/pull", filesWrite, handlers.ServicePullFile)
+			services.GET("/:uuid/files/pull", filesWrite, handlers.ServiceListPulls)
+			services.DELETE("/:uuid/files/pull/:id", filesWrite, handlers.ServiceCancelPull)
+			services.POST("/:uuid/files/uploads", filesWrite, handlers.ServiceCreateUpload)
+			services.GET("/:uuid/files/uploads/:id", filesWrite, handlers.ServiceGetUpload)
+			services.PATCH("/:uuid/files/uploads/:id", filesWrite, handlers.ServiceUploadChunk)
+			services.DELETE("/:uuid/files/uploads/:id", filesWrite, handlers.ServiceDeleteUpload)
 
 			// Sub-user Management (unify with :uuid to avoid Gin conflict)
-			services.GET("/:uuid/users", handlers.GetServiceUsers)
-			services.POST("/:uuid/users", handlers.AddServiceUser)
-			services.PUT("/:uuid/users/:userId", handlers.UpdateServiceUser)
-			services.DELETE("/:uuid/users/:userId", handlers.RemoveServiceUser)
+			usersScope := middleware.RequireScope(models.ScopeServicesUsers)
+			services.GET("/:uuid/users", read, handlers.GetServiceUsers)
+			services.POST("/:uuid/users", usersScope, handlers.AddServiceUser)
+			services.PUT("/:uuid/users/:userId", usersScope, handlers.UpdateServiceUser)
+			services.DELETE("/:uuid/users/:userId", usersScope, handlers.RemoveServiceUser)
+
+			// SQL Databases (owner only)
+			databases := middleware.RequireScope(models.ScopeServicesDatabases)
+			services.GET("/:uuid/databases", databases, handlers.GetServiceDatabases)
+			services.POST("/:uuid/databases", databases, handlers.CreateServiceDatabase)
+			services.POST("/:uuid/databases/:id/rotate-password", databases, handlers.RotateServiceDatabasePassword)
+			services.DELETE("/:uuid/databases/:id", databases, handlers.DeleteServiceDatabase)
 
 			// Activity Logs
-			services.GET("/:uuid/logs", handlers.GetServiceActivityLogs)
+			services.GET("/:uuid/logs", read, handlers.GetServiceActivityLogs)
 		}
 
 		// Global Routes
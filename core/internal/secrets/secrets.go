@@ -0,0 +1,112 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/luketaylor45/atlas/core/internal/config"
+)
+
+// prefix marks a value encrypted by Encrypt, so values stored before encryption was added still read
+const prefix = "enc:v1:"
+
+// key derives the AES-256 key from ENCRYPTION_KEY, or JWT_SECRET when that isn't set
+func key() []byte {
+	secret := config.AppConfig.EncryptionKey
+	if secret == "" {
+		secret = config.AppConfig.JWTSecret
+	}
+	sum := sha256.Sum256([]byte("atlas-encryption:" + secret))
+	return sum[:]
+}
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext with AES-GCM under the configured key. Empty strings stay empty.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value from Encrypt. Values without the encrypted prefix are returned as they are.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt value, has ENCRYPTION_KEY changed?")
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// String is a text column encrypted at rest. It holds the plaintext in memory and is only
+// encrypted when written to the database.
+type String string
+
+// Value encrypts the string for the database
+func (s String) Value() (driver.Value, error) {
+	return Encrypt(string(s))
+}
+
+// Scan decrypts a value read from the database
+func (s *String) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		raw = ""
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T for an encrypted column", value)
+	}
+
+	plaintext, err := Decrypt(raw)
+	if err != nil {
+		return err
+	}
+	*s = String(plaintext)
+	return nil
+}
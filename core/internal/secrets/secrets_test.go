@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luketaylor45/atlas/core/internal/config"
+)
+
+func withKey(t *testing.T, encryptionKey, jwtSecret string) {
+	t.Helper()
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+	config.AppConfig.EncryptionKey = encryptionKey
+	config.AppConfig.JWTSecret = jwtSecret
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	withKey(t, "test-key", "jwt")
+
+	sealed, err := Encrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(sealed, "hunter2") {
+		t.Fatalf("Encrypt = %q", sealed)
+	}
+	again, _ := Encrypt("hunter2")
+	if again == sealed {
+		t.Fatal("two encryptions of the same value are identical")
+	}
+	if plaintext, err := Decrypt(sealed); err != nil || plaintext != "hunter2" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	// Values stored before encryption read back as they are
+	if plaintext, err := Decrypt("legacy-password"); err != nil || plaintext != "legacy-password" {
+		t.Fatalf("Decrypt of a plaintext value = %q, %v", plaintext, err)
+	}
+	if empty, _ := Encrypt(""); empty != "" {
+		t.Fatalf("Encrypt(\"\") = %q", empty)
+	}
+
+	// Tampering and a changed key are both refused
+	tampered := sealed[:len(sealed)-4] + "AAAA"
+	if _, err := Decrypt(tampered); err == nil {
+		t.Fatal("decrypted a tampered value")
+	}
+	if _, err := Decrypt(prefix + "not base64!"); err == nil {
+		t.Fatal("decrypted a malformed value")
+	}
+	config.AppConfig.EncryptionKey = "another-key"
+	if _, err := Decrypt(sealed); err == nil {
+		t.Fatal("decrypted with a different key")
+	}
+}
+
+func TestKeyFallsBackToJWTSecret(t *testing.T) {
+	withKey(t, "", "jwt-secret")
+	sealed, err := Encrypt("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext, err := Decrypt(sealed); err != nil || plaintext != "value" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	// Setting ENCRYPTION_KEY later changes the key, so values sealed under the fallback no longer open
+	config.AppConfig.EncryptionKey = "new-key"
+	if _, err := Decrypt(sealed); err == nil {
+		t.Fatal("decrypted a value sealed under the JWT secret with ENCRYPTION_KEY set")
+	}
+}
+
+func TestStringColumn(t *testing.T) {
+	withKey(t, "test-key", "jwt")
+
+	stored, err := String("db-password").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(stored.(string)) {
+		t.Fatalf("Value = %v, want it encrypted", stored)
+	}
+
+	tests := []struct {
+		raw  interface{}
+		want string
+	}{
+		{stored, "db-password"},
+		{[]byte(stored.(string)), "db-password"},
+		{"legacy-password", "legacy-password"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		var s String
+		if err := s.Scan(tt.raw); err != nil {
+			t.Fatalf("Scan(%v): %v", tt.raw, err)
+		}
+		if string(s) != tt.want {
+			t.Errorf("Scan(%v) = %q, want %q", tt.raw, s, tt.want)
+		}
+	}
+
+	var s String
+	if err := s.Scan(42); err == nil {
+		t.Error("scanned a number into an encrypted column")
+	}
+}
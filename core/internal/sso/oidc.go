@@ -0,0 +1,233 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/utils"
+	"golang.org/x/oauth2"
+)
+
+// loginTimeout is how long a user has to finish signing in at the identity provider
+const loginTimeout = 10 * time.Minute
+
+// Identity is what Atlas learned about a user from a verified ID token
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	IsAdmin       *bool // nil when no admin claim mapping is configured
+}
+
+// Provider wraps a discovered OpenID Connect provider
+type Provider struct {
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin // keyed by state
+}
+
+type pendingLogin struct {
+	verifier string // PKCE code verifier
+	nonce    string
+	expires  time.Time
+}
+
+var (
+	providerMu sync.Mutex
+	provider   *Provider
+)
+
+// Enabled reports whether OIDC login is configured
+func Enabled() bool {
+	cfg := config.AppConfig
+	return cfg.OIDCEnabled && cfg.OIDCIssuer != "" && cfg.OIDCClientID != ""
+}
+
+// GetProvider returns the configured provider, running discovery on first use.
+// A failed discovery is retried on the next call.
+func GetProvider(ctx context.Context) (*Provider, error) {
+	if !Enabled() {
+		return nil, errors.New("single sign-on is not configured")
+	}
+
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	cfg := config.AppConfig
+	discovered, err := oidc.NewProvider(ctx, cfg.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	scopes := strings.Fields(cfg.OIDCScopes)
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	provider = &Provider{
+		verifier: discovered.Verifier(&oidc.Config{ClientID: cfg.OIDCClientID}),
+		oauth: oauth2.Config{
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       scopes,
+		},
+		pending: make(map[string]pendingLogin),
+	}
+	return provider, nil
+}
+
+// Begin starts an authorization code + PKCE login and returns the provider URL and state
+func (p *Provider) Begin() (string, string) {
+	state := utils.RandomString(16)
+	login := pendingLogin{
+		verifier: oauth2.GenerateVerifier(),
+		nonce:    utils.RandomString(16),
+		expires:  time.Now().Add(loginTimeout),
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	for s, l := range p.pending {
+		if now.After(l.expires) {
+			delete(p.pending, s)
+		}
+	}
+	p.pending[state] = login
+	p.mu.Unlock()
+
+	url := p.oauth.AuthCodeURL(state, oidc.Nonce(login.nonce), oauth2.S256ChallengeOption(login.verifier))
+	return url, state
+}
+
+// Finish exchanges the authorization code and verifies the ID token it returns
+func (p *Provider) Finish(ctx context.Context, state, code string) (*Identity, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, errors.New("login request expired or unknown")
+	}
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != login.nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid id_token claims: %w", err)
+	}
+
+	return identityFromClaims(idToken.Issuer, idToken.Subject, claims), nil
+}
+
+func identityFromClaims(issuer, subject string, claims map[string]interface{}) *Identity {
+	cfg := config.AppConfig
+	identity := &Identity{Issuer: issuer, Subject: subject}
+
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Username, _ = claims[cfg.OIDCUsernameClaim].(string)
+
+	if cfg.OIDCAdminClaim != "" {
+		isAdmin := claimMatches(claims[cfg.OIDCAdminClaim], strings.Split(cfg.OIDCAdminValues, ","))
+		identity.IsAdmin = &isAdmin
+	}
+	return identity
+}
+
+// claimMatches reports whether a string, bool or list claim contains one of the wanted values
+func claimMatches(claim interface{}, wanted []string) bool {
+	matches := func(v string) bool {
+		for _, w := range wanted {
+			if w = strings.TrimSpace(w); w != "" && strings.EqualFold(v, w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch v := claim.(type) {
+	case bool:
+		return v
+	case string:
+		return matches(v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && matches(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tickets hand a finished SSO login back to the panel without putting tokens in the URL
+var (
+	ticketMu sync.Mutex
+	tickets  = map[string]ticket{}
+)
+
+type ticket struct {
+	userID  uint
+	expires time.Time
+}
+
+// IssueTicket returns a one-time code the panel redeems for a session
+func IssueTicket(userID uint) string {
+	code := utils.RandomString(32)
+
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+	now := time.Now()
+	for c, t := range tickets {
+		if now.After(t.expires) {
+			delete(tickets, c)
+		}
+	}
+	tickets[code] = ticket{userID: userID, expires: now.Add(time.Minute)}
+	return code
+}
+
+// RedeemTicket consumes a code from IssueTicket
+func RedeemTicket(code string) (uint, bool) {
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+
+	t, ok := tickets[code]
+	delete(tickets, code)
+	if !ok || time.Now().After(t.expires) {
+		return 0, false
+	}
+	return t.userID, true
+}
@@ -0,0 +1,235 @@
+package sso
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/sso/ssotest"
+)
+
+// setupProvider points the OIDC settings at a local mock provider and discovers it
+func setupProvider(t *testing.T) (*ssotest.Provider, *Provider) {
+	t.Helper()
+	mock := ssotest.NewProvider(t, "atlas", "client-secret")
+
+	previous := config.AppConfig
+	t.Cleanup(func() {
+		config.AppConfig = previous
+		providerMu.Lock()
+		provider = nil
+		providerMu.Unlock()
+	})
+	config.AppConfig.OIDCEnabled = true
+	config.AppConfig.OIDCIssuer = mock.URL
+	config.AppConfig.OIDCClientID = mock.ClientID
+	config.AppConfig.OIDCClientSecret = mock.ClientSecret
+	config.AppConfig.OIDCRedirectURL = "https://panel.example.com/api/v1/auth/oidc/callback"
+	config.AppConfig.OIDCScopes = "profile email"
+	config.AppConfig.OIDCUsernameClaim = "preferred_username"
+	config.AppConfig.OIDCAdminClaim = "groups"
+	config.AppConfig.OIDCAdminValues = "atlas-admins, ops"
+
+	providerMu.Lock()
+	provider = nil
+	providerMu.Unlock()
+	p, err := GetProvider(context.Background())
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	return mock, p
+}
+
+func TestBeginUsesPKCEAndNonce(t *testing.T) {
+	_, p := setupProvider(t)
+
+	authURL, state := p.Begin()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != state || state == "" {
+		t.Errorf("state = %q, want %q", q.Get("state"), state)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Errorf("missing S256 code challenge: %s", authURL)
+	}
+	if q.Get("nonce") == "" {
+		t.Error("missing nonce")
+	}
+	if scopes := strings.Fields(q.Get("scope")); len(scopes) == 0 || scopes[0] != "openid" {
+		t.Errorf("scope = %q, want openid first", q.Get("scope"))
+	}
+
+	// Every login gets its own state and verifier
+	second, secondState := p.Begin()
+	if secondState == state || second == authURL {
+		t.Error("two logins share a state or challenge")
+	}
+}
+
+func TestFinish(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		unknown  bool // Sign with a key missing from the JWKS
+		wantErr  string
+		wantUser string
+		isAdmin  bool
+	}{
+		{
+			name: "admin by group",
+			claims: map[string]interface{}{
+				"sub": "user-1", "preferred_username": "alice", "email": "alice@example.com", "email_verified": true,
+				"groups": []string{"staff", "atlas-admins"},
+			},
+			wantUser: "alice",
+			isAdmin:  true,
+		},
+		{
+			name:     "not an admin",
+			claims:   map[string]interface{}{"sub": "user-2", "preferred_username": "bob", "groups": []string{"staff"}},
+			wantUser: "bob",
+		},
+		{
+			name:    "nonce mismatch",
+			claims:  map[string]interface{}{"nonce": "replayed"},
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "wrong audience",
+			claims:  map[string]interface{}{"aud": "another-client"},
+			wantErr: "invalid id_token",
+		},
+		{
+			name:    "wrong issuer",
+			claims:  map[string]interface{}{"iss": "https://evil.example.com"},
+			wantErr: "invalid id_token",
+		},
+		{
+			name:    "expired",
+			claims:  map[string]interface{}{"exp": 1},
+			wantErr: "invalid id_token",
+		},
+		{
+			name:    "unknown signing key",
+			unknown: true,
+			wantErr: "invalid id_token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, p := setupProvider(t)
+			mock.SignWithUnknownKey = tt.unknown
+
+			authURL, state := p.Begin()
+			code, returnedState, err := mock.Authorize(authURL, tt.claims)
+			if err != nil {
+				t.Fatalf("authorize: %v", err)
+			}
+			if returnedState != state {
+				t.Fatalf("provider returned state %q, want %q", returnedState, state)
+			}
+
+			identity, err := p.Finish(context.Background(), state, code)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Finish error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Finish: %v", err)
+			}
+			if identity.Issuer != mock.URL || identity.Username != tt.wantUser {
+				t.Errorf("identity = %+v", identity)
+			}
+			if identity.IsAdmin == nil || *identity.IsAdmin != tt.isAdmin {
+				t.Errorf("IsAdmin = %v, want %v", identity.IsAdmin, tt.isAdmin)
+			}
+		})
+	}
+}
+
+func TestFinishRejectsUnknownOrReusedState(t *testing.T) {
+	mock, p := setupProvider(t)
+
+	authURL, state := p.Begin()
+	code, _, err := mock.Authorize(authURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Finish(context.Background(), "forged-state", code); err == nil {
+		t.Fatal("accepted an unknown state")
+	}
+	if _, err := p.Finish(context.Background(), state, code); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	// The state is consumed by the first callback, even with a fresh code
+	code, _, err = mock.Authorize(authURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Finish(context.Background(), state, code); err == nil {
+		t.Fatal("accepted a state twice")
+	}
+}
+
+// A code issued to one login can't be redeemed by another, since its PKCE verifier won't match
+func TestFinishChecksPKCEVerifier(t *testing.T) {
+	mock, p := setupProvider(t)
+
+	stolenURL, _ := p.Begin()
+	_, victimState := p.Begin()
+	code, _, err := mock.Authorize(stolenURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Finish(context.Background(), victimState, code); err == nil || !strings.Contains(err.Error(), "code exchange failed") {
+		t.Fatalf("Finish with another login's code = %v, want code exchange failure", err)
+	}
+}
+
+func TestClaimMatches(t *testing.T) {
+	wanted := []string{"atlas-admins", " Ops "}
+	tests := []struct {
+		claim interface{}
+		want  bool
+	}{
+		{"atlas-admins", true},
+		{"ATLAS-ADMINS", true},
+		{"ops", true},
+		{"staff", false},
+		{[]interface{}{"staff", "ops"}, true},
+		{[]interface{}{"staff", 5}, false},
+		{true, true},
+		{false, false},
+		{nil, false},
+		{3.0, false},
+	}
+	for _, tt := range tests {
+		if got := claimMatches(tt.claim, wanted); got != tt.want {
+			t.Errorf("claimMatches(%v) = %v, want %v", tt.claim, got, tt.want)
+		}
+	}
+	if claimMatches("", []string{"", " "}) {
+		t.Error("empty wanted values matched")
+	}
+}
+
+func TestTickets(t *testing.T) {
+	code := IssueTicket(42)
+	if id, ok := RedeemTicket(code); !ok || id != 42 {
+		t.Fatalf("RedeemTicket = %d, %v", id, ok)
+	}
+	if _, ok := RedeemTicket(code); ok {
+		t.Fatal("ticket redeemed twice")
+	}
+	if _, ok := RedeemTicket("unknown"); ok {
+		t.Fatal("unknown ticket redeemed")
+	}
+}
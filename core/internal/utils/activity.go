@@ -22,9 +22,15 @@ func LogActivity(c *gin.Context, serviceID uint, action string, resource string,
 		}
 	}
 
+	var apiKeyID uint
+	if id, ok := c.Get("api_key_id"); ok {
+		apiKeyID = id.(uint)
+	}
+
 	log := models.ActivityLog{
 		ServiceID:   serviceID,
 		UserID:      userID.(uint),
+		APIKeyID:    apiKeyID,
 		Action:      action,
 		Resource:    resource,
 		Description: description,
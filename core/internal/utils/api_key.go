@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strings"
+)
+
+// Key prefixes tell API keys apart from JWTs in the Authorization header
+const (
+	PersonalKeyPrefix    = "atlp_"
+	ApplicationKeyPrefix = "atla_"
+)
+
+// apiKeyLookupLength is how much of a key is stored in the clear for lookups
+const apiKeyLookupLength = 13
+
+// GenerateAPIKey returns a new key along with its lookup prefix and hash
+func GenerateAPIKey(kind string) (key, prefix, hash string) {
+	key = kind + RandomString(24)
+	return key, APIKeyPrefix(key), HashAPIKey(key)
+}
+
+// APIKeyPrefix returns the part of a key stored for lookups
+func APIKeyPrefix(key string) string {
+	if len(key) > apiKeyLookupLength {
+		return key[:apiKeyLookupLength]
+	}
+	return key
+}
+
+// HashAPIKey returns the hex SHA-256 of a key. Keys are random, so a fast hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseStringList decodes a JSON list column, treating empty or invalid values as an empty list
+func ParseStringList(value string) []string {
+	var list []string
+	if value == "" {
+		return list
+	}
+	json.Unmarshal([]byte(value), &list)
+	return list
+}
+
+// ParsePermissions decodes an application key's resource permissions
+func ParsePermissions(value string) map[string]string {
+	permissions := map[string]string{}
+	if value != "" {
+		json.Unmarshal([]byte(value), &permissions)
+	}
+	return permissions
+}
+
+// IPAllowed reports whether ip matches one of the allowed IPs or CIDR ranges. An empty list allows any IP.
+func IPAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidIPEntry reports whether entry is an IP address or CIDR range
+func ValidIPEntry(entry string) bool {
+	entry = strings.TrimSpace(entry)
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return true
+	}
+	return net.ParseIP(entry) != nil
+}
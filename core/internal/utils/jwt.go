@@ -9,16 +9,23 @@ import (
 )
 
 type Claims struct {
-	UserID  uint `json:"user_id"`
-	IsAdmin bool `json:"is_admin"`
+	UserID    uint   `json:"user_id"`
+	IsAdmin   bool   `json:"is_admin"`
+	SessionID uint   `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"` // Empty for access tokens
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, isAdmin bool) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// ChallengePurpose marks a token that only proves the password step of a two-factor login
+const ChallengePurpose = "2fa_challenge"
+
+// GenerateToken issues a short-lived access token for a session
+func GenerateToken(userID uint, isAdmin bool, sessionID uint) (string, error) {
+	expirationTime := time.Now().Add(config.AppConfig.AccessTokenTTL)
 	claims := &Claims{
-		UserID:  userID,
-		IsAdmin: isAdmin,
+		UserID:    userID,
+		IsAdmin:   isAdmin,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			Issuer:    "atlas-core",
@@ -43,5 +50,36 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if claims.Purpose != "" || claims.SessionID == 0 {
+		return nil, errors.New("not an access token")
+	}
+
 	return claims, nil
 }
+
+// GenerateChallengeToken issues a short-lived token for the second step of a two-factor login
+func GenerateChallengeToken(userID uint) (string, error) {
+	claims := &Claims{
+		UserID:  userID,
+		Purpose: ChallengePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+			Issuer:    "atlas-core",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+}
+
+// ValidateChallengeToken returns the user ID a challenge token was issued for
+func ValidateChallengeToken(tokenString string) (uint, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWTSecret), nil
+	})
+	if err != nil || !token.Valid || claims.Purpose != ChallengePurpose {
+		return 0, errors.New("invalid challenge token")
+	}
+	return claims.UserID, nil
+}
@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luketaylor45/atlas/core/internal/config"
+)
+
+// Limiter counts failures per key in a sliding window. Reaching the limit locks the key out,
+// and each further lockout doubles in length up to maxLockout.
+type Limiter struct {
+	mu          sync.Mutex
+	maxFailures int
+	window      time.Duration
+	baseLockout time.Duration
+	maxLockout  time.Duration
+	entries     map[string]*limiterEntry
+	lastSweep   time.Time
+}
+
+type limiterEntry struct {
+	failures    []time.Time
+	lockouts    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+// Lockout describes a key that is currently locked out
+type Lockout struct {
+	Type        string    `json:"type"` // user, ip or register
+	Value       string    `json:"value"`
+	LockedUntil time.Time `json:"locked_until"`
+	Lockouts    int       `json:"lockouts"`
+}
+
+func NewLimiter(maxFailures int, window, baseLockout, maxLockout time.Duration) *Limiter {
+	return &Limiter{
+		maxFailures: maxFailures,
+		window:      window,
+		baseLockout: baseLockout,
+		maxLockout:  maxLockout,
+		entries:     make(map[string]*limiterEntry),
+	}
+}
+
+// Locked returns how long key remains locked out, if it is
+func (l *Limiter) Locked(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[key]; ok {
+		if remaining := time.Until(e.lockedUntil); remaining > 0 {
+			return remaining, true
+		}
+	}
+	return 0, false
+}
+
+// Fail records a failure for key and returns true if it caused a lockout
+func (l *Limiter) Fail(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	e, ok := l.entries[key]
+	if !ok {
+		e = &limiterEntry{}
+		l.entries[key] = e
+	}
+	e.failures = append(pruneFailures(e.failures, now.Add(-l.window)), now)
+	e.lastFailure = now
+
+	if len(e.failures) < l.maxFailures {
+		return false
+	}
+
+	lockout := l.baseLockout << e.lockouts
+	if lockout > l.maxLockout || lockout <= 0 {
+		lockout = l.maxLockout
+	}
+	e.lockouts++
+	e.lockedUntil = now.Add(lockout)
+	e.failures = nil
+	return true
+}
+
+// Reset forgets all failures and lockouts for key
+func (l *Limiter) Reset(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.entries[key]
+	delete(l.entries, key)
+	return ok
+}
+
+// Lockouts returns the keys that are locked out right now, labelled with kind
+func (l *Limiter) Lockouts(kind string) []Lockout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var locked []Lockout
+	for key, e := range l.entries {
+		if now.Before(e.lockedUntil) {
+			locked = append(locked, Lockout{Type: kind, Value: key, LockedUntil: e.lockedUntil, Lockouts: e.lockouts})
+		}
+	}
+	return locked
+}
+
+// sweep drops entries that have been quiet long enough for their lockout count to decay
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > l.maxLockout+l.window {
+			delete(l.entries, key)
+		}
+	}
+}
+
+func pruneFailures(failures []time.Time, cutoff time.Time) []time.Time {
+	kept := failures[:0]
+	for _, t := range failures {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+var (
+	loginLimitersOnce sync.Once
+	userLimiter       *Limiter
+	ipLimiter         *Limiter
+	registerLimiter   *Limiter
+)
+
+// loginLimiters creates the panel/SFTP login limiters from config on first use
+func loginLimiters() (*Limiter, *Limiter) {
+	loginLimitersOnce.Do(createLimiters)
+	return userLimiter, ipLimiter
+}
+
+// registrationLimiter is the per-IP registration limiter, created with the login limiters
+func registrationLimiter() *Limiter {
+	loginLimitersOnce.Do(createLimiters)
+	return registerLimiter
+}
+
+func createLimiters() {
+	cfg := config.AppConfig
+	userLimiter = NewLimiter(cfg.LoginMaxAttempts, cfg.LoginWindow, cfg.LoginLockout, cfg.LoginMaxLockout)
+	ipLimiter = NewLimiter(cfg.LoginIPMaxAttempts, cfg.LoginWindow, cfg.LoginLockout, cfg.LoginMaxLockout)
+	registerLimiter = NewLimiter(cfg.RegisterMaxAttempts, cfg.RegisterWindow, cfg.RegisterWindow, cfg.RegisterWindow)
+}
+
+// LoginLocked reports whether the IP or username is locked out, and for how long.
+// Pass an empty username for requests that aren't tied to an account.
+func LoginLocked(ip, username string) (time.Duration, bool) {
+	users, ips := loginLimiters()
+	if wait, locked := ips.Locked(ip); locked {
+		return wait, true
+	}
+	if username != "" {
+		return users.Locked(strings.ToLower(username))
+	}
+	return 0, false
+}
+
+// RecordLoginFailure counts a failed attempt against the IP and username
+func RecordLoginFailure(ip, username string) {
+	users, ips := loginLimiters()
+	if ips.Fail(ip) {
+		LogActivityDirect(0, 0, "login_lockout", "ip:"+ip, "Too many failed login attempts from this IP address", ip)
+	}
+	if username != "" && users.Fail(strings.ToLower(username)) {
+		LogActivityDirect(0, 0, "login_lockout", "user:"+strings.ToLower(username), "Too many failed login attempts for this username", ip)
+	}
+}
+
+// RecordLoginSuccess clears the username's failures. The IP keeps its count so an attacker
+// can't reset it by logging into their own account.
+func RecordLoginSuccess(username string) {
+	users, _ := loginLimiters()
+	users.Reset(strings.ToLower(username))
+}
+
+// RegistrationLocked reports whether ip has used up its registrations, and for how long
+func RegistrationLocked(ip string) (time.Duration, bool) {
+	return registrationLimiter().Locked(ip)
+}
+
+// RecordRegistration counts a registration attempt from ip. Successful registrations count
+// too, so one address can't create accounts without limit.
+func RecordRegistration(ip string) {
+	if registrationLimiter().Fail(ip) {
+		LogActivityDirect(0, 0, "register_lockout", "register:"+ip, "Too many registrations from this IP address", ip)
+	}
+}
+
+// LoginLockouts lists the usernames and IPs that are currently locked out, and the IPs
+// refused further registrations
+func LoginLockouts() []Lockout {
+	users, ips := loginLimiters()
+
+	lockouts := append(users.Lockouts("user"), ips.Lockouts("ip")...)
+	lockouts = append(lockouts, registrationLimiter().Lockouts("register")...)
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].LockedUntil.After(lockouts[j].LockedUntil) })
+	return lockouts
+}
+
+// UnlockLogin clears a username ("user"), IP ("ip") or registration ("register") lockout
+func UnlockLogin(kind, value string) bool {
+	users, ips := loginLimiters()
+	switch kind {
+	case "user":
+		return users.Reset(strings.ToLower(value))
+	case "ip":
+		return ips.Reset(value)
+	case "register":
+		return registrationLimiter().Reset(value)
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luketaylor45/atlas/core/internal/config"
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// withLimiters recreates the login limiters from cfg. Lockouts are logged to a database
+// that is never contacted.
+func withLimiters(t *testing.T, cfg config.Config) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousConfig, previousDB := config.AppConfig, database.DB
+	t.Cleanup(func() {
+		config.AppConfig, database.DB = previousConfig, previousDB
+		loginLimitersOnce = sync.Once{}
+	})
+	config.AppConfig, database.DB = cfg, db
+	loginLimitersOnce = sync.Once{}
+}
+
+func TestRegistrationLimit(t *testing.T) {
+	withLimiters(t, config.Config{
+		LoginMaxAttempts: 5, LoginIPMaxAttempts: 20, LoginWindow: 15 * time.Minute, LoginLockout: time.Minute, LoginMaxLockout: time.Hour,
+		RegisterMaxAttempts: 3, RegisterWindow: time.Hour,
+	})
+
+	// Successful registrations count as much as failed ones
+	for i := 0; i < 3; i++ {
+		if _, locked := RegistrationLocked("198.51.100.1"); locked {
+			t.Fatalf("registration %d refused", i+1)
+		}
+		RecordRegistration("198.51.100.1")
+	}
+	wait, locked := RegistrationLocked("198.51.100.1")
+	if !locked || wait <= 59*time.Minute {
+		t.Fatalf("RegistrationLocked = %v, %v, want about an hour", wait, locked)
+	}
+	if _, locked := RegistrationLocked("198.51.100.2"); locked {
+		t.Fatal("another IP is refused too")
+	}
+	// Logging in from the same address is a separate limit
+	if _, locked := LoginLocked("198.51.100.1", "someone"); locked {
+		t.Fatal("registrations locked the IP out of logging in")
+	}
+
+	lockouts := LoginLockouts()
+	if len(lockouts) != 1 || lockouts[0].Type != "register" || lockouts[0].Value != "198.51.100.1" {
+		t.Fatalf("LoginLockouts = %+v", lockouts)
+	}
+	if !UnlockLogin("register", "198.51.100.1") {
+		t.Fatal("UnlockLogin found no registration lockout")
+	}
+	if _, locked := RegistrationLocked("198.51.100.1"); locked {
+		t.Fatal("still refused after the lockout was lifted")
+	}
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luketaylor45/atlas/core/internal/models"
+	"github.com/luketaylor45/atlas/core/internal/secrets"
+)
+
+// NodeURL builds the full URL for a daemon API path on the given node
+func NodeURL(node *models.Node, path string) string {
+	scheme := node.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%s%s", scheme, node.Address, node.Port, path)
+}
+
+// NewNodeRequest builds a request to the node's daemon, signed over body
+func NewNodeRequest(node *models.Node, method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, NodeURL(node, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	keyID, key := NodeSigningKey(node)
+	SignRequest(req, keyID, key, body)
+	return req, nil
+}
+
+// NewNodeStreamRequest builds a signed request whose body is streamed to the daemon without being hashed
+func NewNodeStreamRequest(node *models.Node, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, NodeURL(node, path), body)
+	if err != nil {
+		return nil, err
+	}
+	keyID, key := NodeSigningKey(node)
+	SignUnsignedPayload(req, keyID, key)
+	return req, nil
+}
+
+// SetNodeRequestHeader sets one of the SignedHeaders on a request built by NewNodeRequest or
+// NewNodeStreamRequest, and signs the request again so the header is covered
+func SetNodeRequestHeader(node *models.Node, req *http.Request, name, value string) {
+	req.Header.Set(name, value)
+	keyID, key := NodeSigningKey(node)
+	signWithHash(req, keyID, key, req.Header.Get(SignatureHeaderContent))
+}
+
+// GenerateNodeToken returns a new random node token
+func GenerateNodeToken() string {
+	return "n_" + RandomString(32)
+}
+
+// SetNodeToken stores the hash, lookup prefix and encrypted signing key of token on the node
+func SetNodeToken(node *models.Node, token string) {
+	node.TokenPrefix = SigningKeyID(token)
+	node.TokenHash = HashToken(token)
+	node.SigningKey = secrets.String(hex.EncodeToString(DeriveSigningKey(token)))
+}
+
+// NodeSigningKey returns the key ID and HMAC key Core signs requests to the node with.
+// After a rotation the previous token is used until the daemon has been seen with the new one.
+func NodeSigningKey(node *models.Node) (string, []byte) {
+	prefix, stored := NodeStoredSigningKey(node)
+	return prefix, DecodeSigningKey(stored)
+}
+
+// NodeStoredSigningKey is NodeSigningKey in its stored form (prefix and hex key)
+func NodeStoredSigningKey(node *models.Node) (string, secrets.String) {
+	if !node.TokenConfirmed && NodePreviousTokenActive(node) {
+		return node.PreviousTokenPrefix, node.PreviousSigningKey
+	}
+	return node.TokenPrefix, node.SigningKey
+}
+
+// DecodeSigningKey turns a stored signing key back into bytes, nil if it is missing or malformed
+func DecodeSigningKey(stored secrets.String) []byte {
+	key, err := hex.DecodeString(string(stored))
+	if err != nil || len(key) == 0 {
+		return nil
+	}
+	return key
+}
+
+// NodePreviousTokenActive reports whether the node's previous token is still inside its grace period
+func NodePreviousTokenActive(node *models.Node) bool {
+	return node.PreviousSigningKey != "" && node.PreviousTokenExpiresAt != nil && time.Now().Before(*node.PreviousTokenExpiresAt)
+}
+
+// nodeTransport is the shared transport for one node and the pin and scheme it was built for
+type nodeTransport struct {
+	pin       string
+	scheme    string
+	transport *http.Transport
+}
+
+var (
+	nodeTransportsMu sync.Mutex
+	nodeTransports   = map[uint]*nodeTransport{}
+)
+
+// NodeClient returns an HTTP client for the node's daemon. A zero timeout means no timeout.
+// Clients for the same node share one transport, so keep-alive connections are reused.
+func NodeClient(node *models.Node, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: nodeTransportFor(node),
+	}
+}
+
+// nodeTransportFor returns the node's cached transport, replacing it when the pinned
+// fingerprint or scheme has changed since it was built
+func nodeTransportFor(node *models.Node) *http.Transport {
+	pin := NormalizeFingerprint(node.TLSFingerprint)
+
+	nodeTransportsMu.Lock()
+	defer nodeTransportsMu.Unlock()
+
+	if cached, ok := nodeTransports[node.ID]; ok {
+		if cached.pin == pin && cached.scheme == node.Scheme {
+			return cached.transport
+		}
+		cached.transport.CloseIdleConnections()
+	}
+
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: NodeTLSConfig(node),
+		IdleConnTimeout: 90 * time.Second,
+	}
+	nodeTransports[node.ID] = &nodeTransport{pin: pin, scheme: node.Scheme, transport: transport}
+	return transport
+}
+
+// ForgetNodeTransport closes the node's idle connections and drops its cached transport
+func ForgetNodeTransport(nodeID uint) {
+	nodeTransportsMu.Lock()
+	defer nodeTransportsMu.Unlock()
+
+	if cached, ok := nodeTransports[nodeID]; ok {
+		cached.transport.CloseIdleConnections()
+		delete(nodeTransports, nodeID)
+	}
+}
+
+// NodeTLSConfig only trusts the certificate pinned on the node.
+// Daemons use self-signed certificates, so chain verification is replaced by the fingerprint check.
+func NodeTLSConfig(node *models.Node) *tls.Config {
+	pinned := NormalizeFingerprint(node.TLSFingerprint)
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if pinned == "" {
+				return errors.New("node certificate has not been pinned yet")
+			}
+			if len(rawCerts) == 0 {
+				return errors.New("node presented no certificate")
+			}
+			if CertificateFingerprint(rawCerts[0]) != pinned {
+				return errors.New("node certificate does not match the pinned fingerprint")
+			}
+			return nil
+		},
+	}
+}
+
+// CertificateFingerprint returns the SHA-256 of a DER encoded certificate as lowercase hex
+func CertificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint accepts "AB:CD:..." or "abcd..." and returns lowercase hex
+func NormalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
+
+// NodePullAllowlist splits and validates a node's pull allowlist
+func NodePullAllowlist(node *models.Node) ([]string, error) {
+	var entries []string
+	for _, entry := range strings.FieldsFunc(node.PullAllowlist, func(r rune) bool { return r == ',' || r == '\n' || r == ' ' }) {
+		if strings.Contains(entry, "/") {
+			if _, err := netip.ParsePrefix(entry); err != nil {
+				return nil, fmt.Errorf("invalid pull allowlist entry %q", entry)
+			}
+		} else if _, err := netip.ParseAddr(entry); err != nil {
+			return nil, fmt.Errorf("invalid pull allowlist entry %q", entry)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+func TestNodeClientSharesTransport(t *testing.T) {
+	node := &models.Node{ID: 4242, Scheme: "https", TLSFingerprint: "AB:CD"}
+	t.Cleanup(func() { ForgetNodeTransport(node.ID) })
+
+	first := NodeClient(node, 5*time.Second).Transport
+	if NodeClient(node, 0).Transport != first {
+		t.Fatal("a second client for the same node got a new transport")
+	}
+
+	// The same pin written differently is still the same pin
+	node.TLSFingerprint = "abcd"
+	if NodeClient(node, 0).Transport != first {
+		t.Fatal("a reformatted fingerprint replaced the transport")
+	}
+
+	node.TLSFingerprint = "ef01"
+	repinned := NodeClient(node, 0).Transport
+	if repinned == first {
+		t.Fatal("the transport was kept after the pin changed")
+	}
+
+	node.Scheme = "http"
+	if NodeClient(node, 0).Transport == repinned {
+		t.Fatal("the transport was kept after the scheme changed")
+	}
+
+	if NodeClient(&models.Node{ID: 4243, Scheme: "http"}, 0).Transport == NodeClient(node, 0).Transport {
+		t.Fatal("two nodes share a transport")
+	}
+	ForgetNodeTransport(4243)
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/luketaylor45/atlas/core/internal/database"
+	"github.com/luketaylor45/atlas/core/internal/models"
+)
+
+// RevokeUserSessions ends every active session of a user, e.g. after a password or privilege change
+func RevokeUserSessions(userID uint) {
+	database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+}
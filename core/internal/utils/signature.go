@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request signing shared with the daemon (daemon/internal/signature). Both sides must
+// build the canonical request the same way, so keep the two files in step.
+
+// Headers carried by every signed request between Core and the daemon
+const (
+	SignatureHeaderKey       = "X-Atlas-Key"
+	SignatureHeaderTimestamp = "X-Atlas-Timestamp"
+	SignatureHeaderNonce     = "X-Atlas-Nonce"
+	SignatureHeaderContent   = "X-Atlas-Content-SHA256"
+	SignatureHeader          = "X-Atlas-Signature"
+
+	// SignatureHeaderDenylist carries the file denylist the daemon applies to a file request
+	SignatureHeaderDenylist = "X-Atlas-File-Denylist"
+
+	// UnsignedPayload is sent instead of a body hash for streamed uploads
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// MaxSignatureClockSkew is how far a request timestamp may drift from our clock
+	MaxSignatureClockSkew = 5 * time.Minute
+)
+
+// SigningKeyLabel separates the signing key from the token hash Core stores to recognise tokens
+const SigningKeyLabel = "atlas-request-signing"
+
+// SignedHeaders are the request headers covered by the signature, along with the request line and body.
+// A header that is left out signs as empty.
+var SignedHeaders = []string{SignatureHeaderDenylist}
+
+// DeriveSigningKey turns a node token into the HMAC key used for signing
+func DeriveSigningKey(token string) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(SigningKeyLabel))
+	return mac.Sum(nil)
+}
+
+// HashToken returns the hex SHA-256 of a token, which is what Core stores instead of the token.
+// It can't be used to sign requests.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SigningKeyID returns the public part of a token that identifies it in the X-Atlas-Key header
+func SigningKeyID(token string) string {
+	if len(token) > 10 {
+		return token[:10]
+	}
+	return token
+}
+
+// HashBody returns the hex SHA-256 of a request body
+func HashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// CanonicalRequest returns the string a request's signature is computed over
+func CanonicalRequest(method, uri, timestamp, nonce, contentHash string, header http.Header) string {
+	parts := []string{method, uri, timestamp, nonce, contentHash}
+	for _, name := range SignedHeaders {
+		parts = append(parts, strings.ToLower(name)+":"+header.Get(name))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ComputeSignature returns the hex HMAC over the canonical request
+func ComputeSignature(key []byte, method, uri, timestamp, nonce, contentHash string, header http.Header) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(CanonicalRequest(method, uri, timestamp, nonce, contentHash, header)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest adds the signature headers for body to req
+func SignRequest(req *http.Request, keyID string, key []byte, body []byte) {
+	signWithHash(req, keyID, key, HashBody(body))
+}
+
+// SignUnsignedPayload signs everything but the body, for requests that stream large uploads
+func SignUnsignedPayload(req *http.Request, keyID string, key []byte) {
+	signWithHash(req, keyID, key, UnsignedPayload)
+}
+
+func signWithHash(req *http.Request, keyID string, key []byte, contentHash string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newSignatureNonce()
+
+	req.Header.Set(SignatureHeaderKey, keyID)
+	req.Header.Set(SignatureHeaderTimestamp, timestamp)
+	req.Header.Set(SignatureHeaderNonce, nonce)
+	req.Header.Set(SignatureHeaderContent, contentHash)
+	req.Header.Set(SignatureHeader, ComputeSignature(key, req.Method, req.URL.RequestURI(), timestamp, nonce, contentHash, req.Header))
+}
+
+// VerifySignature checks the timestamp and signature of r against key.
+// contentHash must be computed from the body actually received (or be UnsignedPayload).
+func VerifySignature(key []byte, r *http.Request, contentHash string) error {
+	timestamp := r.Header.Get(SignatureHeaderTimestamp)
+	nonce := r.Header.Get(SignatureHeaderNonce)
+	signature := r.Header.Get(SignatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("missing signature headers")
+	}
+
+	if _, err := ParseSignatureTimestamp(timestamp); err != nil {
+		return err
+	}
+
+	expected := ComputeSignature(key, r.Method, r.URL.RequestURI(), timestamp, nonce, contentHash, r.Header)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// ParseSignatureTimestamp parses a unix timestamp header and rejects it if outside the allowed skew
+func ParseSignatureTimestamp(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("invalid timestamp")
+	}
+	ts := time.Unix(seconds, 0)
+	if d := time.Since(ts); d > MaxSignatureClockSkew || d < -MaxSignatureClockSkew {
+		return time.Time{}, errors.New("request timestamp outside allowed clock skew")
+	}
+	return ts, nil
+}
+
+func newSignatureNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NonceCache remembers nonces for as long as their timestamp would be accepted
+type NonceCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{seen: make(map[string]time.Time)}
+}
+
+// Use records a nonce and returns false if it has already been used
+func (c *NonceCache) Use(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		c.lastSweep = now
+		for n, expires := range c.seen {
+			if now.After(expires) {
+				delete(c.seen, n)
+			}
+		}
+	}
+
+	if expires, ok := c.seen[nonce]; ok && now.Before(expires) {
+		return false
+	}
+	c.seen[nonce] = now.Add(2 * MaxSignatureClockSkew)
+	return true
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The daemon pins the same vectors in daemon/internal/signature, so a change to the
+// canonical request on one side fails the tests on both until the other side follows.
+const (
+	katToken       = "atlas_0123456789abcdef0123456789abcdef"
+	katKey         = "63c5881beeff4f3d209eca89024173283b5afe497d9d79b4d8163607d46af159"
+	katBody        = `{"path":"plugins"}`
+	katBodyHash    = "4a8c36319300cc0bf26022209aa6d826636bd4a450c0f469b5439e849600386c"
+	katMethod      = "POST"
+	katURI         = "/api/services/svc/files/create-folder?x=1"
+	katTimestamp   = "1700000000"
+	katNonce       = "00112233445566778899aabbccddeeff"
+	katDenylist    = `["*.key"]`
+	katCanonical   = "POST\n/api/services/svc/files/create-folder?x=1\n1700000000\n00112233445566778899aabbccddeeff\n4a8c36319300cc0bf26022209aa6d826636bd4a450c0f469b5439e849600386c\nx-atlas-file-denylist:[\"*.key\"]"
+	katSignature   = "fd18f48d7c44e1a5ae59987134e09691ac6f56f1d5c0f3ed18a19557697b01a1"
+	katUnsignedURI = "/api/services/svc/files/upload"
+	katUnsignedSig = "3b5962a153dd84edbb085af1d85d8c6335a81d73a1cc99bb216099f54ced63c5"
+)
+
+func TestSignatureKnownAnswer(t *testing.T) {
+	key := DeriveSigningKey(katToken)
+	if got := hex.EncodeToString(key); got != katKey {
+		t.Fatalf("DeriveSigningKey = %s, want %s", got, katKey)
+	}
+	if HashToken(katToken) == katKey {
+		t.Fatal("the stored token hash doubles as the signing key")
+	}
+	if got := HashBody([]byte(katBody)); got != katBodyHash {
+		t.Fatalf("HashBody = %s, want %s", got, katBodyHash)
+	}
+
+	header := http.Header{}
+	header.Set(SignatureHeaderDenylist, katDenylist)
+	if got := CanonicalRequest(katMethod, katURI, katTimestamp, katNonce, katBodyHash, header); got != katCanonical {
+		t.Fatalf("CanonicalRequest = %q, want %q", got, katCanonical)
+	}
+	if got := ComputeSignature(key, katMethod, katURI, katTimestamp, katNonce, katBodyHash, header); got != katSignature {
+		t.Fatalf("ComputeSignature = %s, want %s", got, katSignature)
+	}
+	if got := ComputeSignature(key, "PUT", katUnsignedURI, katTimestamp, katNonce, UnsignedPayload, http.Header{}); got != katUnsignedSig {
+		t.Fatalf("ComputeSignature for an unsigned payload = %s, want %s", got, katUnsignedSig)
+	}
+	if got := SigningKeyID(katToken); got != "atlas_0123" {
+		t.Fatalf("SigningKeyID = %q", got)
+	}
+}
+
+// signedRequest returns a request signed now with the test token
+func signedRequest(body string) *http.Request {
+	req := httptest.NewRequest(katMethod, katURI, strings.NewReader(body))
+	req.Header.Set(SignatureHeaderDenylist, katDenylist)
+	SignRequest(req, SigningKeyID(katToken), DeriveSigningKey(katToken), []byte(body))
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	key := DeriveSigningKey(katToken)
+
+	tests := []struct {
+		name    string
+		tamper  func(r *http.Request)
+		hash    string // Body hash the receiver computes, defaults to that of katBody
+		wantErr string
+	}{
+		{name: "untouched"},
+		{name: "body", hash: HashBody([]byte(`{"path":"../.."}`)), wantErr: "invalid signature"},
+		{name: "unsigned payload for a hashed body", hash: UnsignedPayload, wantErr: "invalid signature"},
+		{name: "method", tamper: func(r *http.Request) { r.Method = "DELETE" }, wantErr: "invalid signature"},
+		{name: "path", tamper: func(r *http.Request) { r.URL.Path = "/api/services/other/files/create-folder" }, wantErr: "invalid signature"},
+		{name: "query", tamper: func(r *http.Request) { r.URL.RawQuery = "x=2" }, wantErr: "invalid signature"},
+		{name: "nonce", tamper: func(r *http.Request) { r.Header.Set(SignatureHeaderNonce, "ffff") }, wantErr: "invalid signature"},
+		{name: "denylist", tamper: func(r *http.Request) { r.Header.Set(SignatureHeaderDenylist, "[]") }, wantErr: "invalid signature"},
+		{name: "denylist dropped", tamper: func(r *http.Request) { r.Header.Del(SignatureHeaderDenylist) }, wantErr: "invalid signature"},
+		{
+			name: "timestamp moved within the skew",
+			tamper: func(r *http.Request) {
+				r.Header.Set(SignatureHeaderTimestamp, strconv.FormatInt(time.Now().Unix()-60, 10))
+			},
+			wantErr: "invalid signature",
+		},
+		{name: "missing signature", tamper: func(r *http.Request) { r.Header.Del(SignatureHeader) }, wantErr: "missing signature headers"},
+		{name: "missing nonce", tamper: func(r *http.Request) { r.Header.Del(SignatureHeaderNonce) }, wantErr: "missing signature headers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(katBody)
+			if tt.tamper != nil {
+				tt.tamper(req)
+			}
+			hash := tt.hash
+			if hash == "" {
+				hash = HashBody([]byte(katBody))
+			}
+			err := VerifySignature(key, req, hash)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifySignature: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("VerifySignature = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := VerifySignature(DeriveSigningKey("atlas_another-token"), signedRequest(katBody), HashBody([]byte(katBody))); err == nil {
+		t.Error("accepted a signature made with another token")
+	}
+}
+
+func TestVerifySignatureUnsignedPayload(t *testing.T) {
+	key := DeriveSigningKey(katToken)
+	req := httptest.NewRequest("PUT", katUnsignedURI, strings.NewReader("streamed"))
+	SignUnsignedPayload(req, SigningKeyID(katToken), key)
+	if req.Header.Get(SignatureHeaderContent) != UnsignedPayload {
+		t.Fatalf("content header = %q", req.Header.Get(SignatureHeaderContent))
+	}
+	if err := VerifySignature(key, req, UnsignedPayload); err != nil {
+		t.Fatalf("VerifySignature: %v", err)
+	}
+	// A receiver that hashes the body doesn't accept the placeholder
+	if err := VerifySignature(key, req, HashBody([]byte("streamed"))); err == nil {
+		t.Fatal("an unsigned payload verified against the body hash")
+	}
+}
+
+func TestParseSignatureTimestamp(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{strconv.FormatInt(now, 10), true},
+		{strconv.FormatInt(now-240, 10), true},
+		{strconv.FormatInt(now+240, 10), true},
+		{strconv.FormatInt(now-360, 10), false},
+		{strconv.FormatInt(now+360, 10), false},
+		{katTimestamp, false},
+		{"", false},
+		{"soon", false},
+		{"1.7e9", false},
+	}
+	for _, tt := range tests {
+		if _, err := ParseSignatureTimestamp(tt.value); (err == nil) != tt.ok {
+			t.Errorf("ParseSignatureTimestamp(%q) = %v, want ok=%v", tt.value, err, tt.ok)
+		}
+	}
+
+	// A request signed outside the skew fails even with a valid signature
+	key := DeriveSigningKey(katToken)
+	header := http.Header{}
+	header.Set(SignatureHeaderDenylist, katDenylist)
+	req := httptest.NewRequest(katMethod, katURI, nil)
+	req.Header = header
+	req.Header.Set(SignatureHeaderTimestamp, katTimestamp)
+	req.Header.Set(SignatureHeaderNonce, katNonce)
+	req.Header.Set(SignatureHeader, katSignature)
+	if err := VerifySignature(key, req, katBodyHash); err == nil || !strings.Contains(err.Error(), "clock skew") {
+		t.Fatalf("VerifySignature of a stale request = %v, want a clock skew error", err)
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	cache := NewNonceCache()
+	if !cache.Use("a") {
+		t.Fatal("first use of a nonce refused")
+	}
+	if cache.Use("a") {
+		t.Fatal("replayed nonce accepted")
+	}
+	if !cache.Use("b") {
+		t.Fatal("a different nonce was refused")
+	}
+
+	// Once its timestamp can no longer be accepted, a nonce is forgotten
+	cache.seen["a"] = time.Now().Add(-time.Second)
+	if !cache.Use("a") {
+		t.Fatal("expired nonce still refused")
+	}
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
+	"net/http"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/luketaylor45/atlas/daemon/internal/api"
+	"github.com/luketaylor45/atlas/daemon/internal/certs"
 	"github.com/luketaylor45/atlas/daemon/internal/config"
 	"github.com/luketaylor45/atlas/daemon/internal/docker"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
 	"github.com/luketaylor45/atlas/daemon/internal/sftp"
 )
 
@@ -25,23 +29,44 @@ func main() {
 	// Start SFTP Server
 	log.Println("[DEBUG] Starting SFTP subsystem...")
 	sftp.SetAuthValidator(api.ValidateSFTPCredentials)
-	sftpServer := sftp.NewServer(config.NodeConfig.SFTPPort, "C:\\AtlasData")
+	sftpServer := sftp.NewServer(config.NodeConfig.SFTPPort, config.NodeConfig.DataPath)
 	if err := sftpServer.Start(); err != nil {
 		log.Printf("[WARN] SFTP Server failed to start: %v", err)
 	} else {
 		log.Printf("[SFTP] ✓ SFTP Server enabled on port %s", config.NodeConfig.SFTPPort)
 	}
 
+	// Load TLS certificate for the daemon API
+	var tlsConfig *tls.Config
+	tlsFingerprint := ""
+	if config.NodeConfig.TLSEnabled {
+		cert, err := certs.LoadOrCreate(config.NodeConfig.TLSCertFile, config.NodeConfig.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		tlsFingerprint = certs.Fingerprint(cert)
+		log.Printf("[TLS] Certificate fingerprint: %s", tlsFingerprint)
+	} else {
+		log.Println("[WARN] TLS is disabled, Core will talk to this node over plain HTTP")
+	}
+	api.SetFingerprints(tlsFingerprint, sftpServer.HostKeyFingerprint)
+
 	// Start Heartbeat
 	go api.StartHeartbeat()
 
+	filesystem.StartTrashPurge()
+
 	r := gin.Default()
 
 	// CORS Setup
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Node-Token"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -54,26 +79,73 @@ func main() {
 		})
 	})
 
-	// Secure Routes
-	r.POST("/api/servers", api.CreateServer)
-	r.POST("/api/servers/:uuid/power", api.HandlePowerAction)
-	r.GET("/api/servers/:uuid/console", api.HandleConsole)
-	r.GET("/api/servers/:uuid/stats", api.HandleStats)
-	r.POST("/api/servers/:uuid/command", api.HandleSendCommand)
-	r.POST("/api/servers/:uuid/reinstall", api.HandleReinstall)
-	r.PUT("/api/servers/:uuid", api.UpdateServer)
-	r.DELETE("/api/servers/:uuid", api.DeleteServer)
-
-	// File Management
-	r.GET("/api/servers/:uuid/files/list", api.ListFiles)
-	r.GET("/api/servers/:uuid/files/content", api.GetFileContent)
-	r.POST("/api/servers/:uuid/files/write", api.WriteFile)
-	r.POST("/api/servers/:uuid/files/create-folder", api.CreateFolder)
-	r.POST("/api/servers/:uuid/files/upload", api.UploadFile)
-	r.DELETE("/api/servers/:uuid/files", api.DeleteFile)
+	// Secure Routes (every request must be signed by Core)
+	secure := r.Group("/api", api.RequireSignature(false))
+	{
+		secure.POST("/servers", api.CreateServer)
+		secure.POST("/servers/:uuid/power", api.HandlePowerAction)
+		secure.GET("/servers/:uuid/console", api.HandleConsole)
+		secure.GET("/servers/:uuid/stats", api.HandleStats)
+		secure.POST("/servers/:uuid/command", api.HandleSendCommand)
+		secure.POST("/servers/:uuid/reinstall", api.HandleReinstall)
+		secure.PUT("/servers/:uuid", api.UpdateServer)
+		secure.DELETE("/servers/:uuid", api.DeleteServer)
+
+		// File Management
+		secure.GET("/servers/:uuid/files/list", api.ListFiles)
+		secure.GET("/servers/:uuid/files/content", api.GetFileContent)
+		secure.GET("/servers/:uuid/files/download", api.DownloadFile)
+		secure.GET("/servers/:uuid/files/search", api.SearchFiles)
+		secure.POST("/servers/:uuid/files/write", api.WriteFile)
+		secure.GET("/servers/:uuid/files/revisions", api.ListRevisions)
+		secure.GET("/servers/:uuid/files/revisions/diff", api.DiffRevision)
+		secure.POST("/servers/:uuid/files/revisions/restore", api.RestoreRevision)
+		secure.POST("/servers/:uuid/files/create-folder", api.CreateFolder)
+		secure.DELETE("/servers/:uuid/files", api.DeleteFile)
+		secure.GET("/servers/:uuid/files/trash", api.ListTrash)
+		secure.POST("/servers/:uuid/files/trash/restore", api.RestoreTrash)
+		secure.DELETE("/servers/:uuid/files/trash", api.EmptyTrash)
+		secure.DELETE("/servers/:uuid/files/trash/:id", api.PurgeTrash)
+		secure.POST("/servers/:uuid/files/rename", api.RenameFiles)
+		secure.POST("/servers/:uuid/files/copy", api.CopyFiles)
+		secure.POST("/servers/:uuid/files/chmod", api.ChmodFiles)
+		secure.POST("/servers/:uuid/files/fix-permissions", api.FixPermissions)
+		secure.POST("/servers/:uuid/files/compress", api.CompressFiles)
+		secure.POST("/servers/:uuid/files/decompress", api.DecompressFile)
+		secure.POST("/servers/:uuid/files/pull", api.PullFile)
+		secure.GET("/servers/:uuid/files/pull", api.ListPulls)
+		secure.DELETE("/servers/:uuid/files/pull/:id", api.CancelPull)
+		secure.POST("/servers/:uuid/files/uploads", api.CreateUpload)
+		secure.GET("/servers/:uuid/files/uploads/:id", api.GetUpload)
+		secure.DELETE("/servers/:uuid/files/uploads/:id", api.DeleteUpload)
+
+		// System
+		secure.POST("/system/token", api.RotateToken)
+	}
+
+	// Streaming Routes (signed, but the body is not hashed)
+	streaming := r.Group("/api", api.RequireSignature(true))
+	{
+		streaming.POST("/servers/:uuid/files/upload", api.UploadFile)
+		streaming.PATCH("/servers/:uuid/files/uploads/:id", api.PatchUpload)
+	}
+
+	server := &http.Server{
+		Addr:      ":" + config.NodeConfig.Port,
+		Handler:   r,
+		TLSConfig: tlsConfig,
+		// Core keeps connections alive between proxied requests, close the ones it stops using
+		IdleTimeout: 2 * time.Minute,
+	}
 
 	log.Printf("Daemon listening on port %s", config.NodeConfig.Port)
-	if err := r.Run(":" + config.NodeConfig.Port); err != nil {
+	var err error
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("Failed to start daemon: %v", err)
 	}
 }
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+)
+
+// archiveError maps compression errors to a status, falling back to fileError
+func archiveError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, filesystem.ErrUnsupportedArchive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported archive format"})
+	case errors.Is(err, filesystem.ErrUnsafeArchivePath), errors.Is(err, filesystem.ErrCompressionRatio):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to " + action + ": " + err.Error()})
+	default:
+		fileError(c, action, err)
+	}
+}
+
+// CompressFiles packs files from one directory into a new zip or tar.gz archive next to them.
+// Disk is the service's limit in MB, 0 meaning unlimited.
+func CompressFiles(c *gin.Context) {
+	var req struct {
+		Root   string   `json:"root"`
+		Files  []string `json:"files"`
+		Format string   `json:"format"`
+		Disk   int64    `json:"disk"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Format == "" {
+		req.Format = filesystem.FormatTarGz
+	}
+	if req.Format != filesystem.FormatZip && req.Format != filesystem.FormatTarGz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be zip or tar.gz"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	allowance, err := diskAllowance(fs, req.Disk)
+	if err != nil {
+		fileError(c, "compress", err)
+		return
+	}
+	dest, err := fs.ArchiveName(req.Root, req.Format)
+	if err != nil {
+		fileError(c, "compress", err)
+		return
+	}
+	if err := fs.Compress(c.Request.Context(), req.Root, req.Files, dest, req.Format, allowance); err != nil {
+		archiveError(c, "compress", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "file": dest})
+}
+
+// DecompressFile extracts an archive into Root, or the archive's own directory when empty
+func DecompressFile(c *gin.Context) {
+	var req struct {
+		File string `json:"file"`
+		Root string `json:"root"`
+		Disk int64  `json:"disk"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.File == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Root == "" {
+		req.Root = path.Dir(filesystem.Clean(req.File))
+	}
+	if filesystem.IsMetadata(req.File) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	allowance, err := diskAllowance(fs, req.Disk)
+	if err != nil {
+		fileError(c, "decompress", err)
+		return
+	}
+	limits := filesystem.ExtractLimits{MaxBytes: allowance, MaxRatio: filesystem.DefaultMaxRatio}
+	if err := fs.Extract(c.Request.Context(), req.File, req.Root, limits); err != nil {
+		archiveError(c, "decompress", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/signature"
+)
+
+// maxSignedBody caps how much of a request body is buffered to verify its hash
+const maxSignedBody = 32 << 20
+
+var nonces = signature.NewNonceCache()
+
+// RequireSignature rejects any request that was not signed by Core with this node's token.
+// allowUnsignedPayload lets upload routes stream their body without it being hashed first.
+func RequireSignature(allowUnsignedPayload bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contentHash := c.GetHeader(signature.HeaderContent)
+
+		if contentHash != signature.UnsignedPayload || !allowUnsignedPayload {
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBody+1))
+			if err != nil || len(body) > maxSignedBody {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			contentHash = signature.HashBody(body)
+		}
+
+		// During a token rotation Core may still be signing with the previous token
+		token := ""
+		for _, t := range config.AcceptedTokens() {
+			if c.GetHeader(signature.HeaderKey) == signature.KeyID(t) {
+				token = t
+				break
+			}
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		if err := signature.Verify(signature.DeriveKey(token), c.Request, contentHash); err != nil {
+			log.Printf("[Daemon] Rejected request to %s from %s: %v", c.Request.URL.Path, c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		if !nonces.Use(c.GetHeader(signature.HeaderNonce)) {
+			log.Printf("[Daemon] Rejected replayed request to %s from %s", c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// newCoreRequest builds a request to Core signed with this node's token
+func newCoreRequest(method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, config.NodeConfig.CoreURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	signature.Sign(req, config.CurrentToken(), body)
+	return req, nil
+}
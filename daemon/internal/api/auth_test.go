@@ -0,0 +1,191 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/signature"
+)
+
+const testToken = "atlas_0123456789abcdef0123456789abcdef"
+
+// signatureRouter serves /api/echo, which returns the body it received, on a route
+// that hashes bodies and on one that lets them stream unsigned
+func signatureRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	previous := config.NodeConfig.NodeToken
+	config.NodeConfig.NodeToken = testToken
+	t.Cleanup(func() { config.NodeConfig.NodeToken = previous })
+
+	echo := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	}
+	r := gin.New()
+	r.POST("/api/echo", RequireSignature(false), echo)
+	r.POST("/api/stream/echo", RequireSignature(true), echo)
+	return r
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireSignature(t *testing.T) {
+	r := signatureRouter(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		build    func(path string) *http.Request
+		wantCode int
+	}{
+		{
+			name: "signed body",
+			path: "/api/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("hello"))
+				signature.Sign(req, testToken, []byte("hello"))
+				return req
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "body swapped after signing",
+			path: "/api/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("tampered"))
+				signature.Sign(req, testToken, []byte("hello"))
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unsigned payload on a hashed route",
+			path: "/api/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("hello"))
+				signature.SignUnsignedPayload(req, testToken)
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unsigned payload on a streaming route",
+			path: "/api/stream/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("hello"))
+				signature.SignUnsignedPayload(req, testToken)
+				return req
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "hashed body on a streaming route",
+			path: "/api/stream/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("tampered"))
+				signature.Sign(req, testToken, []byte("hello"))
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "signed with another token",
+			path: "/api/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("hello"))
+				signature.Sign(req, "atlas_0123-another-token", []byte("hello"))
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown key",
+			path: "/api/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("hello"))
+				signature.Sign(req, "atlas_9999999999", []byte("hello"))
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "stale timestamp",
+			path: "/api/echo",
+			build: func(path string) *http.Request {
+				req := httptest.NewRequest("POST", path, strings.NewReader("hello"))
+				req.Header.Set(signature.HeaderKey, signature.KeyID(testToken))
+				timestamp := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+				req.Header.Set(signature.HeaderTimestamp, timestamp)
+				req.Header.Set(signature.HeaderNonce, "stale")
+				req.Header.Set(signature.HeaderSignature, signature.Compute(signature.DeriveKey(testToken),
+					"POST", path, timestamp, "stale", signature.HashBody([]byte("hello")), req.Header))
+				return req
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unsigned",
+			path: "/api/echo",
+			build: func(path string) *http.Request {
+				return httptest.NewRequest("POST", path, strings.NewReader("hello"))
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.build(tt.path))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode == http.StatusOK && w.Body.String() != "hello" {
+				t.Fatalf("handler received %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireSignatureRejectsReplay(t *testing.T) {
+	r := signatureRouter(t)
+
+	req := httptest.NewRequest("POST", "/api/echo", strings.NewReader("hello"))
+	signature.Sign(req, testToken, []byte("hello"))
+	if w := serve(r, req); w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", w.Code)
+	}
+
+	replay := httptest.NewRequest("POST", "/api/echo", strings.NewReader("hello"))
+	replay.Header = req.Header.Clone()
+	if w := serve(r, replay); w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed request: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+// Core may sign with the previous token for a while after a rotation
+func TestRequireSignatureAcceptsPreviousToken(t *testing.T) {
+	r := signatureRouter(t)
+	config.NodeConfig.TokenFile = ""
+	if err := config.RotateToken("atlas_fedcba9876543210", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"atlas_fedcba9876543210", testToken} {
+		req := httptest.NewRequest("POST", "/api/echo", strings.NewReader("hello"))
+		signature.Sign(req, token, []byte("hello"))
+		if w := serve(r, req); w.Code != http.StatusOK {
+			t.Errorf("signed with %s: status %d", signature.KeyID(token), w.Code)
+		}
+	}
+}
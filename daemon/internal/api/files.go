@@ -1,15 +1,21 @@
 package api
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+	"github.com/luketaylor45/atlas/daemon/internal/signature"
 )
 
 type FileInfo struct {
@@ -17,53 +23,114 @@ type FileInfo struct {
 	Size  int64  `json:"size"`
 	IsDir bool   `json:"is_dir"`
 	Mime  string `json:"mime"`
+	Mode  string `json:"mode"` // Permission bits in octal, e.g. "644"
+
+	// Denied entries match the egg's file denylist and can't be opened or changed
+	Denied bool `json:"denied,omitempty"`
 }
 
-func securePath(uuid string, subPath string) (string, error) {
-	dataDir := filepath.Join(config.NodeConfig.DataPath, uuid)
+// openServiceFS opens the service's data directory, restricted by the request's denylist, and
+// answers the request itself on failure. Core signs the denylist with the request and always
+// sends one ("[]" for admins), so a request without it is refused rather than left unrestricted.
+func openServiceFS(c *gin.Context) (*filesystem.Filesystem, bool) {
+	header := c.GetHeader(signature.HeaderDenylist)
+	if header == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file denylist"})
+		return nil, false
+	}
+	var patterns []string
+	err := json.Unmarshal([]byte(header), &patterns)
+	var deny *filesystem.Denylist
+	if err == nil {
+		deny, err = filesystem.ParseDenylist(patterns)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file denylist"})
+		return nil, false
+	}
 
-	// Clean the subPath to prevent traversal (.. stuff)
-	cleanPath := filepath.Join("/", subPath)
-	fullPath := filepath.Join(dataDir, cleanPath)
+	fs, err := filesystem.ForService(c.Param("uuid"))
+	if err != nil {
+		if errors.Is(err, filesystem.ErrInvalidUUID) || os.IsNotExist(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open server files: " + err.Error()})
+		}
+		return nil, false
+	}
+	fs.SetDenylist(deny)
+	return fs, true
+}
 
-	// Ensure the result is still within dataDir
-	if !strings.HasPrefix(fullPath, dataDir) {
-		return "", fmt.Errorf("invalid path: directory traversal attempt")
+// fileError answers with a status matching err; action completes "Failed to ..."
+func fileError(c *gin.Context, action string, err error) {
+	switch {
+	case filesystem.IsOutside(err):
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid path: outside the server directory"})
+	case errors.Is(err, filesystem.ErrDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, filesystem.ErrRoot):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, filesystem.ErrNoSpace):
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": "Not enough disk space"})
+	case os.IsNotExist(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + ": " + err.Error()})
 	}
+}
 
-	return fullPath, nil
+// diskAllowance returns how many more bytes a service may write under its disk limit in MB.
+// 0 means no limit; a service already at its limit gets ErrNoSpace.
+func diskAllowance(fs *filesystem.Filesystem, disk int64) (int64, error) {
+	if disk <= 0 {
+		return 0, nil
+	}
+	used, err := fs.Usage(".")
+	if err != nil {
+		return 0, err
+	}
+	remaining := disk*1024*1024 - used
+	if remaining <= 0 {
+		return 0, filesystem.ErrNoSpace
+	}
+	return remaining, nil
 }
 
 func ListFiles(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	fs, ok := openServiceFS(c)
+	if !ok {
 		return
 	}
+	defer fs.Close()
 
-	uuid := c.Param("uuid")
-	subPath := c.Query("path")
-
-	fullPath, err := securePath(uuid, subPath)
+	dir := filesystem.Clean(c.Query("path"))
+	entries, err := fs.ReadDir(dir)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		fileError(c, "read directory", err)
 		return
 	}
 
-	entries, err := os.ReadDir(fullPath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read directory: " + err.Error()})
-		return
-	}
+	// Daemon files such as pending uploads are not part of the server's files
+	atRoot := filesystem.IsRoot(c.Query("path"))
 
 	var files []FileInfo
 	for _, entry := range entries {
-		info, _ := entry.Info()
+		if atRoot && strings.HasPrefix(entry.Name(), filesystem.MetadataPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
 		files = append(files, FileInfo{
 			Name:  entry.Name(),
 			Size:  info.Size(),
 			IsDir: entry.IsDir(),
 			Mime:  "", // Optional: could detect mime here
+			Mode:  strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+
+			Denied: fs.Denied(path.Join(dir, entry.Name())),
 		})
 	}
 
@@ -78,108 +145,127 @@ func ListFiles(c *gin.Context) {
 	c.JSON(http.StatusOK, files)
 }
 
+// GetFileContent returns a file for the text editor. Larger files have to be downloaded.
 func GetFileContent(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	fs, ok := openServiceFS(c)
+	if !ok {
 		return
 	}
+	defer fs.Close()
 
-	uuid := c.Param("uuid")
-	subPath := c.Query("path")
-
-	fullPath, err := securePath(uuid, subPath)
+	if filesystem.IsMetadata(c.Query("path")) {
+		fileError(c, "read file", filesystem.ErrOutsideRoot)
+		return
+	}
+	file, err := fs.Open(c.Query("path"))
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		fileError(c, "read file", err)
 		return
 	}
+	defer file.Close()
 
-	content, err := os.ReadFile(fullPath)
+	info, err := file.Stat()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file: " + err.Error()})
+		fileError(c, "read file", err)
+		return
+	}
+	if info.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot open a directory"})
+		return
+	}
+	if info.Size() > maxContentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to edit, download it instead"})
 		return
 	}
 
-	c.String(http.StatusOK, string(content))
+	c.DataFromReader(http.StatusOK, info.Size(), "text/plain; charset=utf-8", file, nil)
 }
 
 func WriteFile(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	uuid := c.Param("uuid")
 	var req struct {
 		Path    string `json:"path"`
 		Content string `json:"content"`
+		Author  string `json:"author"` // Recorded with the revision
 	}
 
+	limitContent(c)
 	if err := c.ShouldBindJSON(&req); err != nil {
+		if isTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to save from the editor"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if len(req.Content) > maxContentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to save from the editor"})
+		return
+	}
 
-	fullPath, err := securePath(uuid, req.Path)
-	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	fs, ok := openServiceFS(c)
+	if !ok {
 		return
 	}
+	defer fs.Close()
 
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create directory structure"})
+	if filesystem.IsMetadata(req.Path) {
+		fileError(c, "write file", filesystem.ErrOutsideRoot)
 		return
 	}
 
 	// Note: We might want to handle Windows line endings if the user is on Windows editing files for Linux containers
 	// But let's assume they want the raw content for now.
-	if err := os.WriteFile(fullPath, []byte(req.Content), 0644); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write file: " + err.Error()})
+	rev, err := fs.WriteFileRevision(req.Path, []byte(req.Content), 0644, req.Author, config.NodeConfig.FileRevisions)
+	if err != nil {
+		fileError(c, "write file", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "revision": rev})
 }
 
+// DeleteFile moves a file or directory into the service's trash, or removes it for good when
+// permanent=true
 func DeleteFile(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	uuid := c.Param("uuid")
 	subPath := c.Query("path")
 
-	if subPath == "" || subPath == "/" {
+	if filesystem.IsRoot(subPath) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete root directory"})
 		return
 	}
 
-	fullPath, err := securePath(uuid, subPath)
-	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	fs, ok := openServiceFS(c)
+	if !ok {
 		return
 	}
+	defer fs.Close()
 
-	if err := os.RemoveAll(fullPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete: " + err.Error()})
+	if filesystem.IsMetadata(subPath) {
+		fileError(c, "delete", filesystem.ErrOutsideRoot)
+		return
+	}
+	if c.Query("permanent") == "true" {
+		if !fs.Exists(subPath) {
+			fileError(c, "delete", os.ErrNotExist)
+			return
+		}
+		if err := fs.RemoveAll(subPath); err != nil {
+			fileError(c, "delete", err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
-}
-
-func CreateFolder(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	item, err := fs.Trash(subPath)
+	if err != nil {
+		fileError(c, "delete", err)
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"status": "trashed", "item": item})
+}
 
-	uuid := c.Param("uuid")
+func CreateFolder(c *gin.Context) {
 	var req struct {
 		Path string `json:"path"`
 	}
@@ -189,46 +275,334 @@ func CreateFolder(c *gin.Context) {
 		return
 	}
 
-	fullPath, err := securePath(uuid, req.Path)
-	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	fs, ok := openServiceFS(c)
+	if !ok {
 		return
 	}
+	defer fs.Close()
 
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder: " + err.Error()})
+	if filesystem.IsMetadata(req.Path) {
+		fileError(c, "create folder", filesystem.ErrOutsideRoot)
+		return
+	}
+	if err := fs.MkdirAll(req.Path, 0755); err != nil {
+		fileError(c, "create folder", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
+// UploadFile saves the files of a multipart form into path. Parts are streamed straight to
+// disk; disk is the service's limit in MB, 0 meaning unlimited.
 func UploadFile(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	subPath := c.Query("path")
+	disk, _ := strconv.ParseInt(c.Query("disk"), 10, 64)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
 	}
 
-	uuid := c.Param("uuid")
-	subPath := c.Query("path")
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
 
-	file, err := c.FormFile("file")
+	allowance, err := diskAllowance(fs, disk)
 	if err != nil {
+		fileError(c, "save file", err)
+		return
+	}
+
+	limited := allowance > 0
+	saved := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload"})
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		if limited && allowance <= 0 {
+			part.Close()
+			fileError(c, "save file", filesystem.ErrNoSpace)
+			return
+		}
+
+		dest := path.Join(filesystem.Clean(subPath), path.Base(filepath.ToSlash(part.FileName())))
+		written, err := saveUploadedFile(fs, part, dest, allowance)
+		part.Close()
+		if err != nil {
+			fileError(c, "save file", err)
+			return
+		}
+		allowance -= written
+		saved++
+	}
+
+	if saved == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
 
-	fullPath, err := securePath(uuid, filepath.Join(subPath, file.Filename))
+// saveUploadedFile writes src to dest, failing with ErrNoSpace past limit bytes (0 for none).
+// A failed file is removed rather than left half written.
+func saveUploadedFile(fs *filesystem.Filesystem, src io.Reader, dest string, limit int64) (int64, error) {
+	if filesystem.IsMetadata(dest) {
+		return 0, filesystem.ErrOutsideRoot
+	}
+	out, err := fs.Create(dest)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return 0, err
+	}
+	if limit > 0 {
+		src = io.LimitReader(src, limit+1)
+	}
+	written, err := io.Copy(out, src)
+	if err == nil && limit > 0 && written > limit {
+		err = filesystem.ErrNoSpace
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fs.Remove(dest)
+	}
+	return written, err
+}
+
+type FileMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// moveError answers for the failed entry of a batch, listing what was done before it
+func moveError(c *gin.Context, action string, failed FileMove, done []FileMove, err error) {
+	status, message := http.StatusInternalServerError, "Failed to "+action+" "+failed.From+": "+err.Error()
+	switch {
+	case filesystem.IsOutside(err):
+		status, message = http.StatusForbidden, "invalid path: outside the server directory"
+	case errors.Is(err, filesystem.ErrDenied):
+		status, message = http.StatusForbidden, err.Error()
+	case errors.Is(err, filesystem.ErrRoot), errors.Is(err, filesystem.ErrIntoItself):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, os.ErrNotExist):
+		status, message = http.StatusNotFound, "File not found: "+failed.From
+	case errors.Is(err, os.ErrExist):
+		status, message = http.StatusConflict, "Destination already exists: "+failed.To
+	case errors.Is(err, filesystem.ErrNoSpace):
+		status, message = http.StatusInsufficientStorage, "Not enough disk space"
+	}
+	c.JSON(status, gin.H{"error": message, "completed": done})
+}
+
+// RenameFiles renames or moves files in order, stopping at the first failure
+func RenameFiles(c *gin.Context) {
+	var req struct {
+		Files []FileMove `json:"files"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	if err := c.SaveUploadedFile(file, fullPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file: " + err.Error()})
+	fs, ok := openServiceFS(c)
+	if !ok {
 		return
 	}
+	defer fs.Close()
+
+	done := make([]FileMove, 0, len(req.Files))
+	for _, move := range req.Files {
+		move.From, move.To = filesystem.Clean(move.From), filesystem.Clean(move.To)
+		if filesystem.IsMetadata(move.From) || filesystem.IsMetadata(move.To) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot move daemon files", "completed": done})
+			return
+		}
+		if move.From == move.To {
+			done = append(done, move)
+			continue
+		}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+		var err error
+		switch {
+		case filesystem.IsRoot(move.From) || filesystem.IsRoot(move.To):
+			err = filesystem.ErrRoot
+		case filesystem.Within(move.To, move.From):
+			err = filesystem.ErrIntoItself
+		case fs.Exists(move.To):
+			// rename(2) would silently replace a file at the destination
+			err = os.ErrExist
+		default:
+			if err = fs.MkdirAll(path.Dir(move.To), 0755); err == nil {
+				err = fs.Rename(move.From, move.To)
+			}
+		}
+		if err != nil {
+			moveError(c, "move", move, done, err)
+			return
+		}
+		done = append(done, move)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "files": done})
+}
+
+// CopyFiles copies files and directories. Entries without a destination are copied next to
+// the original as "name copy.ext". Disk is the service's limit in MB, 0 meaning unlimited.
+func CopyFiles(c *gin.Context) {
+	var req struct {
+		Files []FileMove `json:"files"`
+		Disk  int64      `json:"disk"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	var required int64
+	for _, move := range req.Files {
+		if filesystem.IsMetadata(move.From) || (move.To != "" && filesystem.IsMetadata(move.To)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot copy daemon files"})
+			return
+		}
+		size, err := fs.Usage(move.From)
+		if err != nil {
+			fileError(c, "copy", err)
+			return
+		}
+		required += size
+	}
+
+	allowance, err := diskAllowance(fs, req.Disk)
+	if err == nil && allowance > 0 && required > allowance {
+		err = filesystem.ErrNoSpace
+	}
+	if err != nil {
+		fileError(c, "copy", err)
+		return
+	}
+
+	done := make([]FileMove, 0, len(req.Files))
+	for _, move := range req.Files {
+		move.From = filesystem.Clean(move.From)
+		var err error
+		if move.To == "" {
+			move.To, err = fs.CopyName(move.From)
+		} else {
+			move.To = filesystem.Clean(move.To)
+		}
+		if err == nil {
+			err = fs.Copy(move.From, move.To)
+		}
+		if err != nil {
+			moveError(c, "copy", move, done, err)
+			return
+		}
+		done = append(done, move)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "files": done})
+}
+
+// FileMode is a chmod request for one path, the mode given in octal ("644", "0755")
+type FileMode struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+// ChmodFiles changes the permission bits of files and directories in order, stopping at the
+// first failure. Symlinks are refused since chmod would change their target.
+func ChmodFiles(c *gin.Context) {
+	var req struct {
+		Files []FileMode `json:"files"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	done := make([]FileMode, 0, len(req.Files))
+	for _, file := range req.Files {
+		file.Path = filesystem.Clean(file.Path)
+		mode, err := strconv.ParseUint(file.Mode, 8, 32)
+		if err != nil || mode > 0777 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode for " + file.Path + ": use octal permission bits like 644", "completed": done})
+			return
+		}
+		if filesystem.IsMetadata(file.Path) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot change daemon files", "completed": done})
+			return
+		}
+		if filesystem.IsRoot(file.Path) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": filesystem.ErrRoot.Error(), "completed": done})
+			return
+		}
+
+		info, err := fs.Lstat(file.Path)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change the mode of a symlink: " + file.Path, "completed": done})
+			return
+		}
+		if err == nil {
+			err = fs.Chmod(file.Path, os.FileMode(mode))
+		}
+		if err != nil {
+			fileError(c, "change mode of "+file.Path, err)
+			return
+		}
+		file.Mode = strconv.FormatUint(mode, 8)
+		done = append(done, file)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "files": done})
+}
+
+// FixPermissions hands everything below path (the whole directory by default) back to the
+// container user and restores the owner's read and write access
+func FixPermissions(c *gin.Context) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	stats, err := fs.FixPermissions(c.Request.Context(), req.Path)
+	if err != nil {
+		fileError(c, "fix permissions", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "entries": stats.Entries, "failed": stats.Failed, "ownership": filesystem.ManagesOwnership()})
 }
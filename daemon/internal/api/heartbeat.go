@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"log"
@@ -10,18 +9,33 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types/events"
-	"github.com/luketaylor45/atlas/daemon/internal/config"
 	"github.com/luketaylor45/atlas/daemon/internal/docker"
 )
 
 type HeartbeatPayload struct {
-	Token string `json:"token"`
+	// Identity used by Core to pin this node on first contact
+	TLSFingerprint  string `json:"tls_fingerprint"`
+	SFTPFingerprint string `json:"sftp_fingerprint"`
+
 	Stats struct {
 		CPU float64 `json:"cpu"`
 		RAM float64 `json:"ram"`
 	} `json:"stats"`
 }
 
+var nodeFingerprints struct {
+	TLS  string
+	SFTP string
+}
+
+// SetFingerprints sets the certificate and host key fingerprints reported in heartbeats
+func SetFingerprints(tlsFingerprint, sftpFingerprint string) {
+	nodeFingerprints.TLS = tlsFingerprint
+	nodeFingerprints.SFTP = sftpFingerprint
+}
+
+var coreClient = &http.Client{Timeout: 10 * time.Second}
+
 func StartHeartbeat() {
 	ticker := time.NewTicker(5 * time.Second)
 	go func() {
@@ -85,31 +99,38 @@ func MonitorEvents() {
 
 func sendHeartbeat() {
 	payload := HeartbeatPayload{
-		Token: config.NodeConfig.NodeToken,
+		TLSFingerprint:  nodeFingerprints.TLS,
+		SFTPFingerprint: nodeFingerprints.SFTP,
 	}
 	// Mock stats for now
 	payload.Stats.CPU = 10.5
 	payload.Stats.RAM = 512.0
 
 	data, _ := json.Marshal(payload)
-	_, err := http.Post(config.NodeConfig.CoreURL+"/api/v1/internal/heartbeat", "application/json", bytes.NewBuffer(data))
+	req, _ := newCoreRequest("POST", "/api/v1/internal/heartbeat", data)
+	resp, err := coreClient.Do(req)
 	if err != nil {
 		log.Printf("Failed to send heartbeat: %v", err)
-	} else {
-		// log.Println("Heartbeat sent") // Too spammy
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		log.Printf("Heartbeat rejected by Core: check NODE_TOKEN and the system clock")
 	}
 }
 
 func NotifyStatus(uuid string, status string) {
 	payload := map[string]string{
-		"token":  config.NodeConfig.NodeToken,
 		"status": status,
 	}
 	data, _ := json.Marshal(payload)
-	url := config.NodeConfig.CoreURL + "/api/v1/internal/services/" + uuid + "/status"
 
-	_, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	req, _ := newCoreRequest("POST", "/api/v1/internal/services/"+uuid+"/status", data)
+	resp, err := coreClient.Do(req)
 	if err != nil {
 		log.Printf("Failed to notify status for %s: %v", uuid, err)
+		return
 	}
+	resp.Body.Close()
 }
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/download"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+)
+
+// PullFile starts downloading a URL into the service directory. The file is named after the
+// URL unless Filename is given; Disk is the service's limit in MB and Allow the node's
+// allowlist of private addresses.
+func PullFile(c *gin.Context) {
+	var req struct {
+		URL      string   `json:"url"`
+		Root     string   `json:"root"`
+		Filename string   `json:"filename"`
+		Disk     int64    `json:"disk"`
+		Allow    []string `json:"allow"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	name := path.Base(filesystem.Clean(req.Filename))
+	if req.Filename == "" {
+		if u, err := url.Parse(req.URL); err == nil {
+			name = path.Base(filesystem.Clean(u.Path))
+		}
+	}
+	if name == "." || name == "" {
+		name = "download"
+	}
+
+	dest := path.Join(filesystem.Clean(req.Root), name)
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	allowance, err := diskAllowance(fs, req.Disk)
+	if err == nil && fs.Denied(dest) {
+		err = filesystem.ErrDenied
+	}
+	deny := fs.Denylist()
+	fs.Close()
+	if err != nil {
+		fileError(c, "download", err)
+		return
+	}
+
+	d, err := download.Start(c.Param("uuid"), download.Request{
+		URL:      req.URL,
+		Path:     dest,
+		MaxBytes: allowance,
+		Allow:    req.Allow,
+		Deny:     deny,
+	})
+	if err != nil {
+		if errors.Is(err, download.ErrInvalidURL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			fileError(c, "download", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, d)
+}
+
+// ListPulls returns the running and recently finished downloads of a service
+func ListPulls(c *gin.Context) {
+	if !filesystem.ValidUUID(c.Param("uuid")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		return
+	}
+	c.JSON(http.StatusOK, download.List(c.Param("uuid")))
+}
+
+// CancelPull stops a running download
+func CancelPull(c *gin.Context) {
+	if err := download.Cancel(c.Param("uuid"), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Download not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "cancelled"})
+}
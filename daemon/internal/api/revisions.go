@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// revisionError answers for a failed revision lookup
+func revisionError(c *gin.Context, action string, err error) {
+	if errors.Is(err, filesystem.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+	fileError(c, action, err)
+}
+
+// ListRevisions lists the saved versions of a file, newest first
+func ListRevisions(c *gin.Context) {
+	p := filesystem.Clean(c.Query("path"))
+	if filesystem.IsMetadata(p) {
+		fileError(c, "list revisions", filesystem.ErrOutsideRoot)
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	revisions, err := fs.ListRevisions(p)
+	if err != nil {
+		revisionError(c, "list revisions", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": p, "revisions": revisions})
+}
+
+// DiffRevision returns a unified diff from one revision to another, or to the current file
+// when to is not given
+func DiffRevision(c *gin.Context) {
+	p := filesystem.Clean(c.Query("path"))
+	if filesystem.IsMetadata(p) {
+		fileError(c, "diff revision", filesystem.ErrOutsideRoot)
+		return
+	}
+	from, to := c.Query("from"), c.Query("to")
+	if from == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	before, _, err := fs.ReadRevision(p, from)
+	if err != nil {
+		revisionError(c, "read revision", err)
+		return
+	}
+
+	var after []byte
+	toName := "current"
+	if to != "" {
+		after, _, err = fs.ReadRevision(p, to)
+		toName = to
+	} else if info, statErr := fs.Lstat(p); statErr == nil && info.Size() > filesystem.MaxRevisionSize {
+		err = errors.New("the current file is too large to compare")
+	} else {
+		after, err = fs.ReadFile(p)
+	}
+	if err != nil {
+		revisionError(c, "read file", err)
+		return
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(before)),
+		B:        difflib.SplitLines(string(after)),
+		FromFile: p + "@" + from,
+		ToFile:   p + "@" + toName,
+		Context:  3,
+	})
+	c.JSON(http.StatusOK, gin.H{"path": p, "from": from, "to": toName, "diff": diff})
+}
+
+// RestoreRevision writes an earlier version back to the file. The restore is itself saved as a
+// revision, so it can be undone the same way.
+func RestoreRevision(c *gin.Context) {
+	var req struct {
+		Path   string `json:"path"`
+		ID     string `json:"id"`
+		Author string `json:"author"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	p := filesystem.Clean(req.Path)
+	if filesystem.IsMetadata(p) {
+		fileError(c, "restore revision", filesystem.ErrOutsideRoot)
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	data, _, err := fs.ReadRevision(p, req.ID)
+	if err != nil {
+		revisionError(c, "read revision", err)
+		return
+	}
+	rev, err := fs.WriteFileRevision(p, data, 0644, req.Author, config.NodeConfig.FileRevisions)
+	if err != nil {
+		fileError(c, "restore revision", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "restored", "path": p, "restored_from": req.ID, "revision": rev})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+	"github.com/luketaylor45/atlas/daemon/internal/signature"
+)
+
+func TestRevisionsHonourDenylist(t *testing.T) {
+	testService(t)
+	fs, err := filesystem.ForService("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	var first string
+	for _, content := range []string{"token: a", "token: b"} {
+		rev, err := fs.WriteFileRevision("config/server.yml", []byte(content), 0644, "admin", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == "" && rev != nil {
+			first = rev.ID
+		}
+	}
+
+	r := gin.New()
+	r.GET("/servers/:uuid/files/revisions", ListRevisions)
+	r.GET("/servers/:uuid/files/revisions/diff", DiffRevision)
+	get := func(target, denylist string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set(signature.HeaderDenylist, denylist)
+		return serve(r, req)
+	}
+	list := "/servers/svc/files/revisions?path=" + url.QueryEscape("config/server.yml")
+	diff := "/servers/svc/files/revisions/diff?path=" + url.QueryEscape("config/server.yml") + "&from=" + first
+
+	w := get(list, "[]")
+	var listed struct {
+		Revisions []filesystem.Revision `json:"revisions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if w.Code != http.StatusOK || len(listed.Revisions) == 0 {
+		t.Fatalf("list without a denylist = %d %s", w.Code, w.Body.String())
+	}
+
+	// A denied file's history is refused the same way as its content
+	denied, read := get(list, `["*.yml"]`), get(diff, `["*.yml"]`)
+	if denied.Code != http.StatusForbidden || denied.Code != read.Code || denied.Body.String() != read.Body.String() {
+		t.Fatalf("list of a denied file = %d %s, reading it = %d %s", denied.Code, denied.Body.String(), read.Code, read.Body.String())
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+)
+
+// SearchFiles streams matches as newline-delimited JSON while it walks the service directory,
+// ending with a {"done": true, ...} summary. The search stops when the client goes away.
+func SearchFiles(c *gin.Context) {
+	maxSize, _ := strconv.ParseInt(c.Query("max_size"), 10, 64)
+	maxResults, _ := strconv.Atoi(c.Query("limit"))
+	opts := filesystem.SearchOptions{
+		Root:          c.Query("root"),
+		Name:          c.Query("name"),
+		Query:         c.Query("query"),
+		Regex:         c.Query("regex") == "true",
+		CaseSensitive: c.Query("case_sensitive") == "true",
+		MaxFileSize:   maxSize,
+		MaxResults:    maxResults,
+	}
+	if _, err := filesystem.CompileSearch(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	if info, err := fs.Stat(opts.Root); err != nil || !info.IsDir() || filesystem.IsMetadata(opts.Root) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Directory not found"})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+
+	stats, err := fs.Search(c.Request.Context(), opts, func(result filesystem.SearchResult) error {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+
+	summary := gin.H{"done": true, "files_scanned": stats.FilesScanned, "results": stats.Results, "truncated": stats.Truncated}
+	if err != nil {
+		if errors.Is(err, c.Request.Context().Err()) {
+			return
+		}
+		summary["error"] = err.Error()
+	}
+	encoder.Encode(summary)
+	c.Writer.Flush()
+}
@@ -9,7 +9,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -21,8 +20,8 @@ import (
 	"github.com/docker/go-connections/nat"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"github.com/luketaylor45/atlas/daemon/internal/config"
 	"github.com/luketaylor45/atlas/daemon/internal/docker"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
 	"github.com/luketaylor45/atlas/daemon/internal/installer"
 )
 
@@ -44,13 +43,6 @@ type CreateServerRequest struct {
 }
 
 func CreateServer(c *gin.Context) {
-	// 1. Auth Check (Simple Token Check)
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Token"})
-		return
-	}
-
 	var req CreateServerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -59,6 +51,12 @@ func CreateServer(c *gin.Context) {
 
 	log.Printf("Received Create Server Request: %s (%s)", req.UUID, req.EggImage)
 
+	dataDir, err := filesystem.ServiceDir(req.UUID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx := context.Background()
 
 	// 2. Pull Image
@@ -97,15 +95,19 @@ func CreateServer(c *gin.Context) {
 		Mounts: []mount.Mount{
 			{
 				Type:   mount.TypeBind,
-				Source: filepath.Join(config.NodeConfig.DataPath, req.UUID),
+				Source: dataDir,
 				Target: "/home/container",
 			},
 		},
 	}
 
-	// Ensure data directory exists
-	dataDir := filepath.Join(config.NodeConfig.DataPath, req.UUID)
-	os.MkdirAll(dataDir, 0755)
+	// Ensure data directory exists and belongs to the container user
+	fs, err := filesystem.CreateForService(req.UUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare data directory: " + err.Error()})
+		return
+	}
+	fs.Close()
 
 	// 3. Handle Installation Phase
 	if req.InstallScript != "" {
@@ -136,34 +138,27 @@ func CreateServer(c *gin.Context) {
 			if err != nil {
 				log.Printf("[Daemon] Installation FAILED for %s: %v", req.UUID, err)
 				NotifyStatus(req.UUID, "installation_failed")
-				os.WriteFile(filepath.Join(dataDir, ".atlas_install_failed"), []byte(err.Error()), 0644)
+				writeServiceFile(req.UUID, ".atlas_install_failed", []byte(err.Error()), 0644)
 				return
 			}
 
 			log.Printf("[Daemon] Installation SUCCEEDED for %s", req.UUID)
-			os.WriteFile(filepath.Join(dataDir, ".atlas_installed"), []byte(time.Now().Format(time.RFC3339)), 0644)
+			writeServiceFile(req.UUID, ".atlas_installed", []byte(time.Now().Format(time.RFC3339)), 0644)
 
 			NotifyStatus(req.UUID, "offline")
 		}()
 	}
 
 	// 4. Write Start Script
-	writeStartScript(req.UUID, req.StartupCommand, req.Port, req.Memory, req.Environment, config.NodeConfig.NodeToken)
-
-	// Determine how the container should reach the Core.
-	containerCoreURL := config.NodeConfig.CoreURL
-	if strings.Contains(containerCoreURL, "localhost") || strings.Contains(containerCoreURL, "127.0.0.1") {
-		containerCoreURL = strings.Replace(containerCoreURL, "localhost", "host.docker.internal", 1)
-		containerCoreURL = strings.Replace(containerCoreURL, "127.0.0.1", "host.docker.internal", 1)
-	}
+	writeStartScript(req.UUID, req.StartupCommand, req.Port, req.Memory, req.Environment)
 
+	// The node token never enters the container: game servers are user controlled,
+	// and the "running" status is reported by the Docker event monitor instead.
 	env := []string{
 		"STARTUP=bash start.sh",
 		"SERVER_MEMORY=" + fmt.Sprintf("%d", req.Memory),
 		"SERVER_PORT=" + fmt.Sprintf("%d", req.Port),
 		"SERVER_UUID=" + req.UUID,
-		"CORE_URL=" + containerCoreURL,
-		"NODE_TOKEN=" + config.NodeConfig.NodeToken,
 	}
 
 	// Parse Egg Environment JSON for actual container env too
@@ -176,8 +171,10 @@ func CreateServer(c *gin.Context) {
 		}
 	}
 
+	uid, gid := filesystem.Owner()
 	containerConfig := &container.Config{
 		Image:     req.EggImage,
+		User:      fmt.Sprintf("%d:%d", uid, gid),
 		Tty:       true,
 		OpenStdin: true,
 		Env:       env,
@@ -220,12 +217,6 @@ type UpdateServerRequest struct {
 }
 
 func UpdateServer(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
 	uuid := c.Param("uuid")
 	var req UpdateServerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -248,7 +239,7 @@ func UpdateServer(c *gin.Context) {
 	}
 
 	// 2. Regenerate Start Script
-	writeStartScript(uuid, req.StartupCommand, req.Port, int64(req.Memory), req.Environment, config.NodeConfig.NodeToken)
+	writeStartScript(uuid, req.StartupCommand, req.Port, int64(req.Memory), req.Environment)
 
 	// 3. We can't change the Image of a running container without recreating it.
 	// But we can update the record. Recreations should happen on Reinstall or manual rebuild.
@@ -279,14 +270,19 @@ func HandleReinstall(c *gin.Context) {
 	docker.Client.ContainerStop(ctx, uuid, container.StopOptions{})
 
 	// 2. Wipe files except start.sh and steamcmd
-	dataDir := filepath.Join(config.NodeConfig.DataPath, uuid)
-	files, _ := os.ReadDir(dataDir)
+	fs, err := filesystem.CreateForService(uuid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	files, _ := fs.ReadDir(".")
 	for _, f := range files {
 		if f.Name() == "start.sh" || f.Name() == "steamcmd" {
 			continue
 		}
-		os.RemoveAll(filepath.Join(dataDir, f.Name()))
+		fs.RemoveAll(f.Name())
 	}
+	fs.Close()
 
 	// 3. Notify Core
 	NotifyStatus(uuid, "installing")
@@ -316,12 +312,12 @@ func HandleReinstall(c *gin.Context) {
 		if err != nil {
 			log.Printf("[Daemon] Re-installation FAILED for %s: %v", uuid, err)
 			NotifyStatus(uuid, "installation_failed")
-			os.WriteFile(filepath.Join(dataDir, ".atlas_install_failed"), []byte(err.Error()), 0644)
+			writeServiceFile(uuid, ".atlas_install_failed", []byte(err.Error()), 0644)
 			return
 		}
 
 		log.Printf("[Daemon] Re-installation SUCCEEDED for %s", uuid)
-		os.WriteFile(filepath.Join(dataDir, ".atlas_installed"), []byte(time.Now().Format(time.RFC3339)), 0644)
+		writeServiceFile(uuid, ".atlas_installed", []byte(time.Now().Format(time.RFC3339)), 0644)
 
 		NotifyStatus(uuid, "offline")
 	}()
@@ -329,10 +325,7 @@ func HandleReinstall(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "reinstall_triggered"})
 }
 
-func writeStartScript(uuid string, startupCmd string, port int, memory int64, environment string, nodeToken string) {
-	dataDir := filepath.Join(config.NodeConfig.DataPath, uuid)
-	os.MkdirAll(dataDir, 0755)
-
+func writeStartScript(uuid string, startupCmd string, port int, memory int64, environment string) {
 	// Create a map for all available replacements
 	replacements := map[string]string{
 		"SERVER_PORT":   fmt.Sprintf("%d", port),
@@ -369,9 +362,6 @@ echo "--- Atlas Instance Wrapper ---"
 echo "Working Directory: $(pwd)"
 echo "Environment: Port=%d, Memory=%dMB"
 
-# Notify Running
-curl -X POST "${CORE_URL}/api/v1/internal/services/${SERVER_UUID}/status" -H "Content-Type: application/json" -d "{\"status\":\"running\", \"token\": \"${NODE_TOKEN}\"}" > /dev/null 2>&1
-
 echo "Starting Server..."
 # Anchor CWD to game root
 cd "/home/container"
@@ -383,12 +373,12 @@ cd "/home/container"
 	// Normalize line endings for Linux
 	startScript = strings.ReplaceAll(startScript, "\r\n", "\n")
 
-	os.WriteFile(filepath.Join(dataDir, "start.sh"), []byte(startScript), 0755)
+	if err := writeServiceFile(uuid, "start.sh", []byte(startScript), 0755); err != nil {
+		log.Printf("[Daemon] Failed to write start.sh for %s: %v", uuid, err)
+	}
 }
 
 func writeInstallScript(uuid string, installScript string, environment string) {
-	dataDir := filepath.Join(config.NodeConfig.DataPath, uuid)
-
 	// Replace placeholders in install script too
 	if environment != "" {
 		var envVars map[string]string
@@ -402,7 +392,24 @@ func writeInstallScript(uuid string, installScript string, environment string) {
 	// Normalize line endings for Linux
 	installScript = strings.ReplaceAll(installScript, "\r\n", "\n")
 
-	os.WriteFile(filepath.Join(dataDir, "install.sh"), []byte(installScript), 0755)
+	if err := writeServiceFile(uuid, "install.sh", []byte(installScript), 0755); err != nil {
+		log.Printf("[Daemon] Failed to write install.sh for %s: %v", uuid, err)
+	}
+}
+
+// writeServiceFile writes a daemon-managed file into a service directory. A symlink left in its
+// place (e.g. by the game) is replaced rather than followed.
+func writeServiceFile(uuid, name string, data []byte, perm os.FileMode) error {
+	fs, err := filesystem.CreateForService(uuid)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	if info, err := fs.Lstat(name); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		fs.Remove(name)
+	}
+	return fs.WriteFile(name, data, perm)
 }
 
 type PowerActionRequest struct {
@@ -414,12 +421,6 @@ type PowerActionRequest struct {
 }
 
 func HandlePowerAction(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
 	uuid := c.Param("uuid")
 	var req PowerActionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -432,7 +433,7 @@ func HandlePowerAction(c *gin.Context) {
 	// Re-write start script if we have the data
 	if req.StartupCommand != "" {
 		log.Printf("[Daemon] Regenerating start.sh for %s", uuid)
-		writeStartScript(uuid, req.StartupCommand, req.Port, req.Memory, req.Environment, config.NodeConfig.NodeToken)
+		writeStartScript(uuid, req.StartupCommand, req.Port, req.Memory, req.Environment)
 	}
 
 	ctx := context.Background()
@@ -667,12 +668,6 @@ func HandleSendCommand(c *gin.Context) {
 }
 
 func DeleteServer(c *gin.Context) {
-	token := c.GetHeader("X-Node-Token")
-	if token != config.NodeConfig.NodeToken {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Token"})
-		return
-	}
-
 	uuid := c.Param("uuid")
 	ctx := context.Background()
 
@@ -688,8 +683,9 @@ func DeleteServer(c *gin.Context) {
 	}
 
 	// 2. Remove data directory
-	dataDir := filepath.Join(config.NodeConfig.DataPath, uuid)
-	if err := os.RemoveAll(dataDir); err != nil {
+	if dataDir, err := filesystem.ServiceDir(uuid); err != nil {
+		log.Printf("[Daemon] Refusing to clean up directory for %q: %v", uuid, err)
+	} else if err := os.RemoveAll(dataDir); err != nil {
 		log.Printf("[Daemon] Error cleaning up directory %s: %v", dataDir, err)
 	}
 
@@ -1,71 +1,84 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
 
-	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/sftp"
 )
 
 type SFTPAuthRequest struct {
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
+	TOTPCode string `json:"totp_code,omitempty"`
+	ClientIP string `json:"client_ip"`
+
+	PublicKey   string `json:"public_key,omitempty"`
+	KeyVerified bool   `json:"key_verified,omitempty"`
 }
 
 type SFTPAuthResponse struct {
-	Valid       bool   `json:"valid"`
-	ServiceUUID string `json:"service_uuid"`
+	Valid        bool   `json:"valid"`
+	ServiceUUID  string `json:"service_uuid"`
+	TOTPRequired bool   `json:"totp_required"`
+	ReadOnly     bool   `json:"read_only"`
+
+	FileDenylist []string `json:"file_denylist"`
 }
 
 // ValidateSFTPCredentials calls Core API to validate SFTP login
-func ValidateSFTPCredentials(username, password string) (bool, string) {
+func ValidateSFTPCredentials(attempt sftp.AuthRequest) sftp.AuthResult {
 	reqBody := SFTPAuthRequest{
-		Username: username,
-		Password: password,
+		Username: attempt.Username,
+		Password: attempt.Password,
+		TOTPCode: attempt.TOTPCode,
+		ClientIP: attempt.ClientIP,
+
+		PublicKey:   attempt.PublicKey,
+		KeyVerified: attempt.KeyVerified,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		log.Printf("[SFTP-Auth] Failed to marshal request: %v", err)
-		return false, ""
+		return sftp.AuthResult{}
 	}
 
 	// Call Core API
-	url := fmt.Sprintf("%s/api/v1/internal/sftp/validate", config.NodeConfig.CoreURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := newCoreRequest("POST", "/api/v1/internal/sftp/validate", jsonData)
 	if err != nil {
 		log.Printf("[SFTP-Auth] Failed to create request: %v", err)
-		return false, ""
+		return sftp.AuthResult{}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Node-Token", config.NodeConfig.NodeToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := coreClient.Do(req)
 	if err != nil {
 		log.Printf("[SFTP-Auth] Failed to contact Core: %v", err)
-		return false, ""
+		return sftp.AuthResult{}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return false, ""
+		return sftp.AuthResult{}
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false, ""
+		return sftp.AuthResult{}
 	}
 
 	var authResp SFTPAuthResponse
 	if err := json.Unmarshal(body, &authResp); err != nil {
-		return false, ""
+		return sftp.AuthResult{}
 	}
 
-	return authResp.Valid, authResp.ServiceUUID
+	return sftp.AuthResult{
+		Valid:        authResp.Valid,
+		ServiceUUID:  authResp.ServiceUUID,
+		TOTPRequired: authResp.TOTPRequired,
+		ReadOnly:     authResp.ReadOnly,
+		FileDenylist: authResp.FileDenylist,
+	}
 }
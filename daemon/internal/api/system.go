@@ -0,0 +1,38 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+)
+
+type RotateTokenRequest struct {
+	Token       string `json:"token"`
+	GracePeriod int    `json:"grace_period"` // Seconds the old token stays valid
+}
+
+// RotateToken switches this node to a new token issued by Core
+func RotateToken(c *gin.Context) {
+	var req RotateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	grace := time.Duration(req.GracePeriod) * time.Second
+	if grace <= 0 {
+		grace = time.Hour
+	}
+
+	if err := config.RotateToken(req.Token, grace); err != nil {
+		log.Printf("[Daemon] Failed to save rotated token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save token"})
+		return
+	}
+
+	log.Printf("[Daemon] Node token rotated, previous token accepted for %s", grace)
+	c.JSON(http.StatusOK, gin.H{"status": "rotated"})
+}
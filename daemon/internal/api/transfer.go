@@ -0,0 +1,375 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+)
+
+const (
+	// maxContentSize is the largest file the text editor endpoints read or write
+	maxContentSize = 8 << 20
+
+	// Chunked uploads live in the service's metadata directory until they are complete
+	uploadDir = filesystem.MetadataPrefix + "/uploads"
+	// uploadExpiry is how long an unfinished upload can be resumed
+	uploadExpiry = 24 * time.Hour
+
+	// HeaderUploadOffset carries the byte offset a chunk starts at, and the new offset in answers
+	HeaderUploadOffset = "Upload-Offset"
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+var (
+	// uploadLocks keeps two chunks of the same upload from being written at once
+	uploadLocks sync.Map
+	// reserveLocks keeps two uploads to the same service from reserving the same free space
+	reserveLocks sync.Map
+)
+
+type uploadSession struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func uploadDataPath(id string) string { return uploadDir + "/" + id }
+func uploadMetaPath(id string) string { return uploadDir + "/" + id + ".json" }
+
+// DownloadFile streams a file with its content type, honouring Range requests so large
+// downloads can be resumed
+func DownloadFile(c *gin.Context) {
+	p := c.Query("path")
+	if filesystem.IsMetadata(p) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	file, err := fs.Open(p)
+	if err != nil {
+		fileError(c, "open file", err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		fileError(c, "open file", err)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only files can be downloaded"})
+		return
+	}
+
+	name := path.Base(filesystem.Clean(p))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	// ServeContent picks the type from the extension or the first bytes and handles Range and If-Range
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+}
+
+// CreateUpload starts a chunked upload of Size bytes to Path. Disk is the service's limit in
+// MB, 0 meaning unlimited.
+func CreateUpload(c *gin.Context) {
+	var req struct {
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+		Disk int64  `json:"disk"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Size < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	dest := filesystem.Clean(req.Path)
+	if filesystem.IsRoot(dest) || filesystem.IsMetadata(dest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload path"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	if fs.Denied(dest) {
+		fileError(c, "start upload", filesystem.ErrDenied)
+		return
+	}
+
+	lock, _ := reserveLocks.LoadOrStore(c.Param("uuid"), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	expireUploads(fs)
+
+	// Space promised to unfinished uploads is not free, or several uploads could each claim all of it
+	allowance, err := diskAllowance(fs, req.Disk)
+	if err == nil && allowance > 0 && req.Size > allowance-reservedUploadSpace(fs) {
+		err = filesystem.ErrNoSpace
+	}
+	if err != nil {
+		fileError(c, "start upload", err)
+		return
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	session := uploadSession{ID: hex.EncodeToString(id), Path: dest, Size: req.Size, CreatedAt: time.Now()}
+
+	meta, _ := json.Marshal(session)
+	if err := fs.WriteFile(uploadMetaPath(session.ID), meta, 0600); err != nil {
+		fileError(c, "start upload", err)
+		return
+	}
+	if err := fs.WriteFile(uploadDataPath(session.ID), nil, 0644); err != nil {
+		fs.Remove(uploadMetaPath(session.ID))
+		fileError(c, "start upload", err)
+		return
+	}
+
+	// An empty file has nothing to wait for
+	if session.Size == 0 {
+		if err := finishUpload(fs, &session); err != nil {
+			fileError(c, "save file", err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": session.ID, "path": session.Path, "size": 0, "offset": 0, "complete": true})
+		return
+	}
+
+	c.Header(HeaderUploadOffset, "0")
+	c.JSON(http.StatusCreated, session)
+}
+
+// loadUpload reads an upload session and its current offset, answering the request on failure
+func loadUpload(c *gin.Context, fs *filesystem.Filesystem) (*uploadSession, bool) {
+	id := c.Param("id")
+	if !uploadIDPattern.MatchString(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+	meta, err := fs.ReadFile(uploadMetaPath(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+	var session uploadSession
+	if err := json.Unmarshal(meta, &session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload state is corrupt"})
+		return nil, false
+	}
+	info, err := fs.Lstat(uploadDataPath(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+	session.Offset = info.Size()
+	return &session, true
+}
+
+// GetUpload reports how much of an upload has arrived, so a client can resume after a failure
+func GetUpload(c *gin.Context) {
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	session, ok := loadUpload(c, fs)
+	if !ok {
+		return
+	}
+	c.Header(HeaderUploadOffset, strconv.FormatInt(session.Offset, 10))
+	c.JSON(http.StatusOK, session)
+}
+
+// PatchUpload appends the request body to an upload. The Upload-Offset header must match what
+// has been received so far; the file is moved into place once the last byte arrives.
+func PatchUpload(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader(HeaderUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid Upload-Offset header"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	// Only uploads that exist get a lock, so unknown IDs don't leave entries behind
+	session, ok := loadUpload(c, fs)
+	if !ok {
+		return
+	}
+	lock, _ := uploadLocks.LoadOrStore(session.ID, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another chunk of this upload is being written"})
+		return
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	// Read the offset again now that no other chunk is being written; the upload may also
+	// have been finished or cancelled in the meantime
+	if session, ok = loadUpload(c, fs); !ok {
+		uploadLocks.Delete(c.Param("id"))
+		return
+	}
+	if offset != session.Offset {
+		c.Header(HeaderUploadOffset, strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Offset does not match the upload", "offset": session.Offset})
+		return
+	}
+
+	out, err := fs.OpenFile(uploadDataPath(session.ID), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		fileError(c, "write upload", err)
+		return
+	}
+	// Whatever arrives before a dropped connection is kept, so the client resumes from there
+	remaining := session.Size - session.Offset
+	written, err := io.Copy(out, io.LimitReader(c.Request.Body, remaining+1))
+	if written > remaining {
+		out.Truncate(session.Offset)
+		out.Close()
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk goes past the declared upload size"})
+		return
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	session.Offset += written
+	c.Header(HeaderUploadOffset, strconv.FormatInt(session.Offset, 10))
+	if err != nil {
+		fileError(c, "write upload", err)
+		return
+	}
+
+	complete := session.Offset == session.Size
+	if complete {
+		if err := finishUpload(fs, session); err != nil {
+			fileError(c, "save file", err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"id": session.ID, "path": session.Path, "size": session.Size, "offset": session.Offset, "complete": complete})
+}
+
+// DeleteUpload abandons an unfinished upload
+func DeleteUpload(c *gin.Context) {
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	session, ok := loadUpload(c, fs)
+	if !ok {
+		return
+	}
+	removeUpload(fs, session.ID)
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+func finishUpload(fs *filesystem.Filesystem, session *uploadSession) error {
+	if err := fs.MkdirAll(path.Dir(session.Path), 0755); err != nil {
+		return err
+	}
+	// Replace a symlink at the destination instead of renaming onto whatever it points to
+	if info, err := fs.Lstat(session.Path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		fs.Remove(session.Path)
+	}
+	if err := fs.Rename(uploadDataPath(session.ID), session.Path); err != nil {
+		return err
+	}
+	fs.Remove(uploadMetaPath(session.ID))
+	uploadLocks.Delete(session.ID)
+	return nil
+}
+
+// reservedUploadSpace returns the bytes unfinished uploads still have to receive. What they have
+// received so far is already part of the service's disk usage.
+func reservedUploadSpace(fs *filesystem.Filesystem) int64 {
+	entries, err := fs.ReadDir(uploadDir)
+	if err != nil {
+		return 0
+	}
+	var reserved int64
+	for _, entry := range entries {
+		id := entry.Name()
+		if !uploadIDPattern.MatchString(id) {
+			continue
+		}
+		meta, err := fs.ReadFile(uploadMetaPath(id))
+		if err != nil {
+			continue
+		}
+		var session uploadSession
+		info, err := entry.Info()
+		if err != nil || json.Unmarshal(meta, &session) != nil {
+			continue
+		}
+		if left := session.Size - info.Size(); left > 0 {
+			reserved += left
+		}
+	}
+	return reserved
+}
+
+func removeUpload(fs *filesystem.Filesystem, id string) {
+	fs.Remove(uploadDataPath(id))
+	fs.Remove(uploadMetaPath(id))
+	uploadLocks.Delete(id)
+}
+
+// expireUploads removes uploads nobody has touched for uploadExpiry
+func expireUploads(fs *filesystem.Filesystem) {
+	entries, err := fs.ReadDir(uploadDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id := entry.Name()
+		if !uploadIDPattern.MatchString(id) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > uploadExpiry {
+			removeUpload(fs, id)
+		}
+	}
+}
+
+// limitContent caps request bodies of the text editor endpoints. JSON escaping can double the
+// size of a file, which the extra room allows for.
+func limitContent(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 2*maxContentSize+4096)
+}
+
+func isTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
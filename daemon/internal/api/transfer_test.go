@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/signature"
+)
+
+// testService creates the directory of service "svc" in a temporary data path
+func testService(t *testing.T) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	previous := config.NodeConfig
+	t.Cleanup(func() { config.NodeConfig = previous })
+	config.NodeConfig.DataPath = t.TempDir()
+	config.NodeConfig.ContainerUID, config.NodeConfig.ContainerGID = os.Getuid(), os.Getgid()
+
+	dir := filepath.Join(config.NodeConfig.DataPath, "svc")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// uploadRouter serves the upload endpoints for service "svc", without the signature middleware
+func uploadRouter(t *testing.T) (*gin.Engine, string) {
+	t.Helper()
+	dir := testService(t)
+
+	r := gin.New()
+	r.POST("/servers/:uuid/files/uploads", CreateUpload)
+	r.GET("/servers/:uuid/files/uploads/:id", GetUpload)
+	r.PATCH("/servers/:uuid/files/uploads/:id", PatchUpload)
+	r.DELETE("/servers/:uuid/files/uploads/:id", DeleteUpload)
+	return r, dir
+}
+
+func uploadRequest(method, target, body string, offset int64) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(signature.HeaderDenylist, "[]")
+	if offset >= 0 {
+		req.Header.Set(HeaderUploadOffset, strconv.FormatInt(offset, 10))
+	}
+	return req
+}
+
+// createUpload starts an upload and returns its ID, or the response when it was refused
+func createUpload(t *testing.T, r *gin.Engine, path string, size, disk int64) (string, *httptest.ResponseRecorder) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"path": path, "size": size, "disk": disk})
+	w := serve(r, uploadRequest("POST", "/servers/svc/files/uploads", string(body), -1))
+	if w.Code != http.StatusCreated {
+		return "", w
+	}
+	var session uploadSession
+	json.Unmarshal(w.Body.Bytes(), &session)
+	return session.ID, w
+}
+
+func lockCount() int {
+	n := 0
+	uploadLocks.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestPatchUploadLocks(t *testing.T) {
+	r, dir := uploadRouter(t)
+
+	// Unknown, malformed and expired IDs are answered without taking a lock
+	for _, id := range []string{"0123456789abcdef0123456789abcdef", "not-an-id", "..%2F..%2Fetc"} {
+		if w := serve(r, uploadRequest("PATCH", "/servers/svc/files/uploads/"+id, "x", 0)); w.Code != http.StatusNotFound {
+			t.Fatalf("PATCH %s = %d, want 404", id, w.Code)
+		}
+	}
+	if n := lockCount(); n != 0 {
+		t.Fatalf("%d locks left behind by unknown uploads", n)
+	}
+
+	id, w := createUpload(t, r, "world/level.dat", 6, 0)
+	if id == "" {
+		t.Fatalf("create = %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(r, uploadRequest("PATCH", "/servers/svc/files/uploads/"+id, "abc", 0)); w.Code != http.StatusOK {
+		t.Fatalf("first chunk = %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(r, uploadRequest("PATCH", "/servers/svc/files/uploads/"+id, "def", 3)); w.Code != http.StatusOK {
+		t.Fatalf("last chunk = %d %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "world", "level.dat")); string(data) != "abcdef" {
+		t.Fatalf("uploaded file = %q", data)
+	}
+	if n := lockCount(); n != 0 {
+		t.Fatalf("%d locks left after the upload finished", n)
+	}
+
+	// A chunk for an upload that has been cancelled leaves nothing behind either
+	id, _ = createUpload(t, r, "other.dat", 6, 0)
+	serve(r, uploadRequest("PATCH", "/servers/svc/files/uploads/"+id, "abc", 0))
+	if w := serve(r, uploadRequest("DELETE", "/servers/svc/files/uploads/"+id, "", -1)); w.Code != http.StatusOK {
+		t.Fatalf("delete = %d", w.Code)
+	}
+	if w := serve(r, uploadRequest("PATCH", "/servers/svc/files/uploads/"+id, "def", 3)); w.Code != http.StatusNotFound {
+		t.Fatalf("chunk after cancel = %d, want 404", w.Code)
+	}
+	if n := lockCount(); n != 0 {
+		t.Fatalf("%d locks left after the upload was cancelled", n)
+	}
+}
+
+func TestCreateUploadReservesSpace(t *testing.T) {
+	r, _ := uploadRouter(t)
+	const mb = 1 << 20
+
+	first, w := createUpload(t, r, "a.dat", 700*1024, 1)
+	if first == "" {
+		t.Fatalf("first upload = %d %s", w.Code, w.Body.String())
+	}
+	// The first upload has received nothing yet, but its size is already spoken for
+	if id, w := createUpload(t, r, "b.dat", 700*1024, 1); id != "" || w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("second upload = %d, want 507", w.Code)
+	}
+	// What is left, less room for the session file of the first upload
+	if id, w := createUpload(t, r, "c.dat", mb-700*1024-1024, 1); id == "" {
+		t.Fatalf("upload filling the rest = %d %s", w.Code, w.Body.String())
+	}
+
+	// Cancelling gives the space back
+	serve(r, uploadRequest("DELETE", "/servers/svc/files/uploads/"+first, "", -1))
+	if id, w := createUpload(t, r, "b.dat", 700*1024, 1); id == "" {
+		t.Fatalf("upload after cancelling = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+)
+
+// trashError answers for a failed trash operation
+func trashError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, filesystem.ErrNotInTrash):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found in trash"})
+	case errors.Is(err, os.ErrExist):
+		c.JSON(http.StatusConflict, gin.H{"error": "Something already exists at the restore location, restore it elsewhere"})
+	default:
+		fileError(c, action, err)
+	}
+}
+
+// ListTrash lists a service's deleted files
+func ListTrash(c *gin.Context) {
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	items, err := fs.ListTrash()
+	if err != nil {
+		fileError(c, "read trash", err)
+		return
+	}
+	var size int64
+	for _, item := range items {
+		size += item.Size
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "size": size})
+}
+
+// RestoreTrash moves an item out of the trash, to its original path unless To is given
+func RestoreTrash(c *gin.Context) {
+	var req struct {
+		ID string `json:"id"`
+		To string `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	item, err := fs.RestoreTrash(req.ID, req.To)
+	if err != nil {
+		trashError(c, "restore", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "restored", "item": item})
+}
+
+// PurgeTrash deletes one item in the trash for good
+func PurgeTrash(c *gin.Context) {
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	if err := fs.PurgeTrash(c.Param("id")); err != nil {
+		trashError(c, "purge", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "purged"})
+}
+
+// EmptyTrash deletes everything in the trash for good
+func EmptyTrash(c *gin.Context) {
+	fs, ok := openServiceFS(c)
+	if !ok {
+		return
+	}
+	defer fs.Close()
+
+	purged, err := fs.EmptyTrash(0)
+	if err != nil {
+		trashError(c, "empty trash", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "purged", "purged": purged})
+}
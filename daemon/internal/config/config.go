@@ -12,6 +12,24 @@ type Config struct {
 	NodeToken string `mapstructure:"NODE_TOKEN"`
 	SFTPPort  string `mapstructure:"SFTP_PORT"`
 	DataPath  string `mapstructure:"DATA_PATH"`
+
+	// Containers run as this user and group, and the daemon hands everything it writes to them
+	ContainerUID int `mapstructure:"CONTAINER_UID"`
+	ContainerGID int `mapstructure:"CONTAINER_GID"`
+
+	// Deleted files stay in a service's trash this many days; 0 keeps them until purged
+	TrashRetentionDays int `mapstructure:"TRASH_RETENTION_DAYS"`
+
+	// Versions kept of each file saved from the editor; 0 turns revision history off
+	FileRevisions int `mapstructure:"FILE_REVISIONS"`
+
+	// A rotated token pushed by Core is saved here and takes precedence over NODE_TOKEN
+	TokenFile string `mapstructure:"TOKEN_FILE"`
+
+	// TLS for the daemon API. If no certificate exists at TLSCertFile a self-signed one is generated.
+	TLSEnabled  bool   `mapstructure:"TLS_ENABLED"`
+	TLSCertFile string `mapstructure:"TLS_CERT_FILE"`
+	TLSKeyFile  string `mapstructure:"TLS_KEY_FILE"`
 }
 
 var NodeConfig Config
@@ -22,6 +40,14 @@ func LoadConfig() {
 	viper.SetDefault("NODE_TOKEN", "change-me")
 	viper.SetDefault("SFTP_PORT", "2022")
 	viper.SetDefault("DATA_PATH", "/var/lib/atlas/data")
+	viper.SetDefault("CONTAINER_UID", 1000)
+	viper.SetDefault("CONTAINER_GID", 1000)
+	viper.SetDefault("TRASH_RETENTION_DAYS", 7)
+	viper.SetDefault("FILE_REVISIONS", 10)
+	viper.SetDefault("TOKEN_FILE", "/var/lib/atlas/tls/node_token")
+	viper.SetDefault("TLS_ENABLED", true)
+	viper.SetDefault("TLS_CERT_FILE", "/var/lib/atlas/tls/cert.pem")
+	viper.SetDefault("TLS_KEY_FILE", "/var/lib/atlas/tls/key.pem")
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("env")
@@ -37,4 +63,6 @@ func LoadConfig() {
 	if err := viper.Unmarshal(&NodeConfig); err != nil {
 		log.Fatalf("Unable to decode into struct: %v", err)
 	}
+
+	loadTokenFile()
 }
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	tokenMu         sync.RWMutex
+	previousToken   string
+	previousExpires time.Time
+)
+
+// loadTokenFile picks up a token saved by an earlier rotation
+func loadTokenFile() {
+	if NodeConfig.TokenFile == "" {
+		return
+	}
+	data, err := os.ReadFile(NodeConfig.TokenFile)
+	if err != nil {
+		return
+	}
+	if token := strings.TrimSpace(string(data)); token != "" {
+		NodeConfig.NodeToken = token
+		log.Printf("[Daemon] Using rotated node token from %s", NodeConfig.TokenFile)
+	}
+}
+
+// CurrentToken returns the token this node signs its requests with
+func CurrentToken() string {
+	tokenMu.RLock()
+	defer tokenMu.RUnlock()
+	return NodeConfig.NodeToken
+}
+
+// AcceptedTokens returns the current token and, during a rotation grace period, the previous one
+func AcceptedTokens() []string {
+	tokenMu.RLock()
+	defer tokenMu.RUnlock()
+	tokens := []string{NodeConfig.NodeToken}
+	if previousToken != "" && time.Now().Before(previousExpires) {
+		tokens = append(tokens, previousToken)
+	}
+	return tokens
+}
+
+// RotateToken saves a new token and switches to it, accepting the old one for grace
+func RotateToken(token string, grace time.Duration) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return errors.New("empty token")
+	}
+
+	if NodeConfig.TokenFile != "" {
+		if err := os.MkdirAll(filepath.Dir(NodeConfig.TokenFile), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(NodeConfig.TokenFile, []byte(token+"\n"), 0600); err != nil {
+			return err
+		}
+	}
+
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	previousToken = NodeConfig.NodeToken
+	previousExpires = time.Now().Add(grace)
+	NodeConfig.NodeToken = token
+	return nil
+}
@@ -0,0 +1,266 @@
+package download
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+)
+
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+
+	// Finished downloads stay listed this long so the panel can show how they ended
+	keepFinished = 10 * time.Minute
+)
+
+var (
+	ErrTooLarge    = errors.New("file is larger than the allowed size")
+	ErrInvalidURL  = errors.New("only http and https URLs can be downloaded")
+	ErrNotFound    = errors.New("download not found")
+	downloadPrefix = filesystem.MetadataPrefix + "-download-"
+)
+
+// Request describes a file to fetch into a service directory
+type Request struct {
+	URL      string
+	Path     string   // Destination file, relative to the service root
+	MaxBytes int64    // 0 for no limit
+	Allow    []string // IPs or CIDR ranges allowed despite being private
+	Deny     *filesystem.Denylist
+}
+
+// Download is a fetch in progress or recently finished
+type Download struct {
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	Path      string     `json:"path"`
+	Total     int64      `json:"total"` // -1 while unknown
+	Written   int64      `json:"written"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+
+	service string
+	cancel  context.CancelFunc
+	written atomic.Int64
+}
+
+var (
+	mu        sync.Mutex
+	downloads = map[string]*Download{}
+)
+
+// Start validates the request and fetches the file in the background
+func Start(service string, req Request) (*Download, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	guard, err := NewGuard(req.Allow)
+	if err != nil {
+		return nil, err
+	}
+	dest := filesystem.Clean(req.Path)
+	if filesystem.IsRoot(dest) {
+		return nil, filesystem.ErrRoot
+	}
+	if filesystem.IsMetadata(dest) {
+		return nil, filesystem.ErrOutsideRoot
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Download{
+		ID:        hex.EncodeToString(id),
+		URL:       u.Redacted(),
+		Path:      dest,
+		Total:     -1,
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+		service:   service,
+		cancel:    cancel,
+	}
+
+	mu.Lock()
+	downloads[d.ID] = d
+	started := d.snapshot()
+	mu.Unlock()
+
+	go d.run(ctx, u.String(), guard, req.MaxBytes, req.Deny)
+	return started, nil
+}
+
+// List returns the downloads of a service
+func List(service string) []*Download {
+	mu.Lock()
+	defer mu.Unlock()
+	list := []*Download{}
+	for _, d := range downloads {
+		if d.service == service {
+			list = append(list, d.snapshot())
+		}
+	}
+	return list
+}
+
+// Cancel stops a running download of a service
+func Cancel(service, id string) error {
+	mu.Lock()
+	d, ok := downloads[id]
+	mu.Unlock()
+	if !ok || d.service != service {
+		return ErrNotFound
+	}
+	d.cancel()
+	return nil
+}
+
+// snapshot copies the public fields so they can be serialised safely; mu must be held
+func (d *Download) snapshot() *Download {
+	return &Download{
+		ID:        d.ID,
+		URL:       d.URL,
+		Path:      d.Path,
+		Total:     atomic.LoadInt64(&d.Total),
+		Written:   d.written.Load(),
+		Status:    d.Status,
+		Error:     d.Error,
+		StartedAt: d.StartedAt,
+		EndedAt:   d.EndedAt,
+	}
+}
+
+func (d *Download) run(ctx context.Context, rawURL string, guard *Guard, maxBytes int64, deny *filesystem.Denylist) {
+	err := d.fetch(ctx, rawURL, guard, maxBytes, deny)
+
+	mu.Lock()
+	now := time.Now()
+	d.EndedAt = &now
+	switch {
+	case err == nil:
+		d.Status = StatusCompleted
+	case errors.Is(err, context.Canceled):
+		d.Status = StatusCancelled
+	default:
+		d.Status = StatusFailed
+		d.Error = err.Error()
+		log.Printf("[Download] %s for %s failed: %v", d.URL, d.service, err)
+	}
+	mu.Unlock()
+	d.cancel()
+
+	time.AfterFunc(keepFinished, func() {
+		mu.Lock()
+		delete(downloads, d.ID)
+		mu.Unlock()
+	})
+}
+
+func (d *Download) fetch(ctx context.Context, rawURL string, guard *Guard, maxBytes int64, deny *filesystem.Denylist) error {
+	fs, err := filesystem.ForService(d.service)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	fs.SetDenylist(deny)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Atlas-Daemon")
+
+	// Each download has its own client, so its connections are closed once it is done
+	client := Client(guard)
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return ErrTooLarge
+	}
+	atomic.StoreInt64(&d.Total, resp.ContentLength)
+
+	// Write to a hidden file first so a half-finished download never looks like the real thing
+	partial := downloadPrefix + d.ID
+	out, err := fs.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, &progressReader{r: resp.Body, d: d, max: maxBytes})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if err = fs.MkdirAll(path.Dir(d.Path), 0755); err == nil {
+			err = fs.Rename(partial, d.Path)
+		}
+	}
+	if err != nil {
+		fs.Remove(partial)
+	}
+	return err
+}
+
+// Client returns an HTTP client whose connections are checked by guard. Proxies from the
+// environment are ignored, since the proxy would make the connection instead of us.
+func Client(guard *Guard) *http.Client {
+	dialer := &net.Dialer{Timeout: 15 * time.Second, Control: guard.control}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   15 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrInvalidURL
+			}
+			return nil
+		},
+	}
+}
+
+type progressReader struct {
+	r   io.Reader
+	d   *Download
+	max int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	written := p.d.written.Add(int64(n))
+	if p.max > 0 && written > p.max {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,233 @@
+package download
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+)
+
+// serviceDir points the data path at a temporary directory with one service in it
+func serviceDir(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	config.NodeConfig.DataPath = base
+	config.NodeConfig.ContainerUID, config.NodeConfig.ContainerGID = os.Getuid(), os.Getgid()
+	dir := filepath.Join(base, "svc")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// wait returns the download once it has finished
+func wait(t *testing.T, id string) *Download {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, d := range List("svc") {
+			if d.ID == id && d.Status != StatusRunning {
+				return d
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("download %s did not finish", id)
+	return nil
+}
+
+// partialFiles lists the hidden files downloads write to before they finish
+func partialFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, downloadPrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestStartValidatesRequest(t *testing.T) {
+	serviceDir(t)
+	tests := []Request{
+		{URL: "file:///etc/passwd", Path: "passwd"},
+		{URL: "ftp://example.com/file", Path: "file"},
+		{URL: "http://", Path: "file"},
+		{URL: "https://example.com/file", Path: "/"},
+		{URL: "https://example.com/file", Path: ".atlas-trash/file"},
+		{URL: "https://example.com/file", Path: "file", Allow: []string{"not-an-ip"}},
+	}
+	for _, req := range tests {
+		if d, err := Start("svc", req); err == nil {
+			t.Errorf("Start(%+v) = %+v, want an error", req, d)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	dir := serviceDir(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plugin contents"))
+	}))
+	defer server.Close()
+
+	started, err := Start("svc", Request{URL: server.URL + "/plugin.jar", Path: "plugins/plugin.jar", Allow: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := wait(t, started.ID); d.Status != StatusCompleted {
+		t.Fatalf("download ended %s: %s", d.Status, d.Error)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "plugins", "plugin.jar"))
+	if err != nil || string(data) != "plugin contents" {
+		t.Fatalf("downloaded file = %q, %v", data, err)
+	}
+	if partial := partialFiles(t, dir); len(partial) != 0 {
+		t.Errorf("partial files left behind: %v", partial)
+	}
+}
+
+func TestDownloadClosesConnections(t *testing.T) {
+	serviceDir(t)
+	var open atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plugin contents"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for i := 0; i < 5; i++ {
+		started, err := Start("svc", Request{URL: server.URL + "/plugin.jar", Path: fmt.Sprintf("plugin%d.jar", i), Allow: []string{"127.0.0.1"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := wait(t, started.ID); d.Status != StatusCompleted {
+			t.Fatalf("download ended %s: %s", d.Status, d.Error)
+		}
+	}
+
+	// Finished downloads don't keep connections alive
+	deadline := time.Now().Add(5 * time.Second)
+	for open.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections still open after the downloads finished", open.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDownloadBlockedByDefault(t *testing.T) {
+	dir := serviceDir(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a loopback server was contacted without an allowlist")
+	}))
+	defer server.Close()
+
+	started, err := Start("svc", Request{URL: server.URL + "/secret", Path: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := wait(t, started.ID)
+	if d.Status != StatusFailed || !strings.Contains(d.Error, ErrBlockedAddress.Error()) {
+		t.Fatalf("download ended %s: %s, want blocked", d.Status, d.Error)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secret")); !os.IsNotExist(err) {
+		t.Errorf("destination exists: %v", err)
+	}
+}
+
+func TestDownloadSizeCap(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentLength bool
+	}{
+		// A declared length over the cap is refused before reading
+		{name: "declared", contentLength: true},
+		// Without one the cap is hit part way through the body
+		{name: "streamed", contentLength: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := serviceDir(t)
+			body := strings.Repeat("x", 64*1024)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tt.contentLength {
+					// Flushing before writing the body makes the response chunked
+					w.(http.Flusher).Flush()
+				}
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			started, err := Start("svc", Request{URL: server.URL, Path: "big.bin", MaxBytes: 1024, Allow: []string{"127.0.0.1"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := wait(t, started.ID)
+			if d.Status != StatusFailed || d.Error != ErrTooLarge.Error() {
+				t.Fatalf("download ended %s: %s, want %v", d.Status, d.Error, ErrTooLarge)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "big.bin")); !os.IsNotExist(err) {
+				t.Errorf("destination exists: %v", err)
+			}
+			if partial := partialFiles(t, dir); len(partial) != 0 {
+				t.Errorf("partial files left behind: %v", partial)
+			}
+		})
+	}
+}
+
+func TestDownloadCancel(t *testing.T) {
+	dir := serviceDir(t)
+	sent := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first part"))
+		w.(http.Flusher).Flush()
+		close(sent)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	started, err := Start("svc", Request{URL: server.URL, Path: "slow.bin", Allow: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-sent
+
+	// The partial file exists while the body is still arriving
+	deadline := time.Now().Add(5 * time.Second)
+	for len(partialFiles(t, dir)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := Cancel("other", started.ID); err != ErrNotFound {
+		t.Fatalf("Cancel from another service = %v, want %v", err, ErrNotFound)
+	}
+	if err := Cancel("svc", started.ID); err != nil {
+		t.Fatal(err)
+	}
+	if d := wait(t, started.ID); d.Status != StatusCancelled {
+		t.Fatalf("download ended %s: %s, want cancelled", d.Status, d.Error)
+	}
+	if partial := partialFiles(t, dir); len(partial) != 0 {
+		t.Errorf("partial files left behind: %v", partial)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "slow.bin")); !os.IsNotExist(err) {
+		t.Errorf("destination exists: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned when a URL resolves to an address the node must not fetch from
+var ErrBlockedAddress = errors.New("address is not allowed")
+
+// blockedRanges are never fetched unless allowlisted: loopback, private networks, link-local
+// (cloud metadata endpoints live there), carrier-grade NAT and other special-purpose ranges.
+// NAT64 and 6to4 addresses embed an IPv4 address the host may route to, so they are blocked too.
+var blockedRanges = mustPrefixes(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+	"2002::/16",
+)
+
+func mustPrefixes(cidrs ...string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		prefixes[i] = netip.MustParsePrefix(cidr)
+	}
+	return prefixes
+}
+
+// Guard decides which addresses downloads may connect to. The check runs on the resolved
+// address of every connection, so DNS tricks and redirects to internal hosts are caught too.
+type Guard struct {
+	allow []netip.Prefix
+}
+
+// NewGuard builds a guard that also allows the given IPs or CIDR ranges
+func NewGuard(allowlist []string) (*Guard, error) {
+	g := &Guard{}
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, err := ParseAllowEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		g.allow = append(g.allow, prefix)
+	}
+	return g, nil
+}
+
+// ParseAllowEntry parses an allowlist entry, either a single IP or a CIDR range
+func ParseAllowEntry(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid allowlist entry %q", entry)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid allowlist entry %q", entry)
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// Allowed reports whether a connection to addr may be made
+func (g *Guard) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range g.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if !addr.IsGlobalUnicast() {
+		return false
+	}
+	for _, prefix := range blockedRanges {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// control is a net.Dialer Control hook that refuses blocked addresses before connecting
+func (g *Guard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !g.Allowed(addr) {
+		return fmt.Errorf("%s: %w", addr, ErrBlockedAddress)
+	}
+	return nil
+}
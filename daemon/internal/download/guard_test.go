@@ -0,0 +1,170 @@
+package download
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestGuardAllowed(t *testing.T) {
+	tests := []struct {
+		addr  string
+		allow []string
+		want  bool
+	}{
+		{"93.184.216.34", nil, true},
+		{"2606:2800:220:1:248:1893:25c8:1946", nil, true},
+		{"127.0.0.1", nil, false},
+		{"127.8.9.10", nil, false},
+		{"::1", nil, false},
+		{"10.1.2.3", nil, false},
+		{"172.20.0.1", nil, false},
+		{"192.168.1.1", nil, false},
+		{"100.64.0.1", nil, false},
+		{"169.254.169.254", nil, false},
+		{"fd00:ec2::254", nil, false},
+		{"fe80::1", nil, false},
+		{"0.0.0.0", nil, false},
+		{"::", nil, false},
+		{"224.0.0.1", nil, false},
+		{"255.255.255.255", nil, false},
+		// IPv4 addresses written as IPv6 are judged by the IPv4 address
+		{"::ffff:127.0.0.1", nil, false},
+		{"::ffff:169.254.169.254", nil, false},
+		{"::ffff:93.184.216.34", nil, true},
+		// So are NAT64 and 6to4 addresses, which a NAT64 host routes to the embedded IPv4 address
+		{"64:ff9b::7f00:1", nil, false},
+		{"64:ff9b::a9fe:a9fe", nil, false},
+		{"64:ff9b:1::a00:1", nil, false},
+		{"2002:7f00:1::1", nil, false},
+		{"2002:a9fe:a9fe::1", nil, false},
+		// The allowlist opens single addresses or ranges, however the address is written
+		{"127.0.0.1", []string{"127.0.0.1"}, true},
+		{"::ffff:127.0.0.1", []string{"127.0.0.1"}, true},
+		{"127.0.0.2", []string{"127.0.0.1"}, false},
+		{"10.20.30.40", []string{"10.20.0.0/16"}, true},
+		{"10.21.30.40", []string{"10.20.0.0/16"}, false},
+		{"169.254.169.254", []string{"10.0.0.0/8"}, false},
+	}
+	for _, tt := range tests {
+		guard, err := NewGuard(tt.allow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := guard.Allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Allowed(%s) with allowlist %v = %v, want %v", tt.addr, tt.allow, got, tt.want)
+		}
+	}
+}
+
+func TestParseAllowEntry(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{entry: "127.0.0.1", want: "127.0.0.1/32"},
+		{entry: "::ffff:10.0.0.1", want: "10.0.0.1/32"},
+		{entry: "10.1.2.3/8", want: "10.0.0.0/8"},
+		{entry: "fd00::/8", want: "fd00::/8"},
+		{entry: "localhost", wantErr: true},
+		{entry: "10.0.0.0/33", wantErr: true},
+	}
+	for _, tt := range tests {
+		prefix, err := ParseAllowEntry(tt.entry)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAllowEntry(%q) = %s, want an error", tt.entry, prefix)
+			}
+			continue
+		}
+		if err != nil || prefix.String() != tt.want {
+			t.Errorf("ParseAllowEntry(%q) = %s, %v, want %s", tt.entry, prefix, err, tt.want)
+		}
+	}
+	if _, err := NewGuard([]string{"10.0.0.0/8", "bogus"}); err == nil {
+		t.Error("NewGuard accepted an invalid entry")
+	}
+}
+
+func TestClientBlocksLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	guard, _ := NewGuard(nil)
+	if _, err := Client(guard).Get(server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("GET %s = %v, want %v", server.URL, err, ErrBlockedAddress)
+	}
+
+	// The same address written as IPv4-mapped IPv6
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	mapped := "http://[::ffff:127.0.0.1]:" + port
+	if _, err := Client(guard).Get(mapped); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("GET %s = %v, want %v", mapped, err, ErrBlockedAddress)
+	}
+
+	allowed, _ := NewGuard([]string{"127.0.0.1"})
+	resp, err := Client(allowed).Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET with 127.0.0.1 allowlisted: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// A host the guard allows can't redirect the download to one it doesn't. 127.0.0.2 stands in
+// for the public host, with only that address allowlisted.
+func TestClientBlocksRedirects(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the redirect target was contacted")
+	}))
+	defer internal.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	var target string
+	public := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, http.StatusFound)
+	}))
+	public.Listener.Close()
+	public.Listener = listener
+	public.Start()
+	defer public.Close()
+
+	guard, _ := NewGuard([]string{"127.0.0.2"})
+	for _, target = range []string{
+		internal.URL + "/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::ffff:169.254.169.254]/latest/meta-data/",
+	} {
+		if _, err := Client(guard).Get(public.URL); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("redirect to %s = %v, want %v", target, err, ErrBlockedAddress)
+		}
+	}
+
+	target = "file:///etc/passwd"
+	if _, err := Client(guard).Get(public.URL); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("redirect to %s = %v, want %v", target, err, ErrInvalidURL)
+	}
+}
+
+// Proxy settings from the environment would make the proxy connect for us, bypassing the guard
+func TestClientIgnoresProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request went through the proxy")
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("http_proxy", proxy.URL)
+
+	guard, _ := NewGuard(nil)
+	if _, err := Client(guard).Get("http://169.254.169.254/"); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("GET through a proxy = %v, want %v", err, ErrBlockedAddress)
+	}
+}
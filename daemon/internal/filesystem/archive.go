@@ -0,0 +1,489 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Archive formats Compress can write
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+const (
+	// DefaultMaxRatio is how far an archive may expand before it is treated as a zip bomb
+	DefaultMaxRatio = 250
+	// ratioFloor is the output size below which the ratio is not checked, since small text
+	// files legitimately compress very well
+	ratioFloor = 64 << 20
+)
+
+var (
+	ErrUnsupportedArchive = errors.New("unsupported archive format")
+	ErrUnsafeArchivePath  = errors.New("archive contains a path outside the target directory")
+	ErrCompressionRatio   = errors.New("archive expands too far to be extracted safely")
+)
+
+// ExtractLimits bound what an extraction may write
+type ExtractLimits struct {
+	MaxBytes int64   // total bytes written, 0 for no limit
+	MaxRatio float64 // written bytes per archive byte, 0 for no limit
+}
+
+// ArchiveFormat returns the format of an archive from its name, or "" when it is not one
+func ArchiveFormat(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return "tar.xz"
+	}
+	return ""
+}
+
+// ArchiveName picks a free name for a new archive in dir
+func (f *Filesystem) ArchiveName(dir, format string) (string, error) {
+	name := path.Join(Clean(dir), "archive-"+time.Now().Format("2006-01-02-150405")+"."+format)
+	if !f.Exists(name) {
+		return name, nil
+	}
+	return f.CopyName(name)
+}
+
+// Compress writes files, given relative to dir, into a new archive at dest. Directories are
+// added recursively; symlinks are stored as links in tar archives and left out of zips.
+// limit caps the archive size in bytes, 0 for no cap. A failed archive is removed.
+func (f *Filesystem) Compress(ctx context.Context, dir string, files []string, dest, format string, limit int64) (err error) {
+	if format != FormatZip && format != FormatTarGz {
+		return ErrUnsupportedArchive
+	}
+	dir, dest = Clean(dir), Clean(dest)
+
+	out, err := f.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			f.Remove(dest)
+		}
+	}()
+
+	var w io.Writer = out
+	if limit > 0 {
+		w = &limitWriter{w: out, remaining: limit}
+	}
+
+	var add func(name string, info fs.FileInfo, p string) error
+	var finish func() error
+	switch format {
+	case FormatZip:
+		zw := zip.NewWriter(w)
+		add = func(name string, info fs.FileInfo, p string) error { return f.addZip(zw, name, info, p) }
+		finish = zw.Close
+	default:
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		add = func(name string, info fs.FileInfo, p string) error { return f.addTar(tw, name, info, p) }
+		finish = func() error {
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			return gz.Close()
+		}
+	}
+
+	for _, file := range files {
+		start := Clean(path.Join(dir, Clean(file)))
+		if start == dir || IsMetadata(start) {
+			return fmt.Errorf("%s: %w", file, ErrRoot)
+		}
+		err := fs.WalkDir(f.root.FS(), start, func(p string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if p == dest {
+				return nil
+			}
+			info, err := f.Lstat(p)
+			if err != nil {
+				return err
+			}
+			name := strings.TrimPrefix(p, dir+"/")
+			if dir == "." {
+				name = p
+			}
+			return add(name, info, p)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return finish()
+}
+
+func (f *Filesystem) addTar(tw *tar.Writer, name string, info fs.FileInfo, p string) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := f.Readlink(p)
+		if err != nil {
+			return err
+		}
+		link = filepath.ToSlash(target)
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() && link == "" {
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	// Host user names mean nothing inside the container
+	header.Uname, header.Gname = "", ""
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	return f.copyInto(tw, p)
+}
+
+func (f *Filesystem) addZip(zw *zip.Writer, name string, info fs.FileInfo, p string) error {
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	} else {
+		header.Method = zip.Deflate
+	}
+	w, err := zw.CreateHeader(header)
+	if err != nil || info.IsDir() {
+		return err
+	}
+	return f.copyInto(w, p)
+}
+
+func (f *Filesystem) copyInto(w io.Writer, p string) error {
+	file, err := f.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// Extract unpacks a zip, tar, tar.gz or tar.xz archive into dest, overwriting files that
+// already exist. Entries are streamed from disk; paths leaving dest fail the whole
+// extraction, and files and directories created by a failed extraction are removed again.
+func (f *Filesystem) Extract(ctx context.Context, archive, dest string, limits ExtractLimits) error {
+	format := ArchiveFormat(archive)
+	if format == "" {
+		return ErrUnsupportedArchive
+	}
+	if IsMetadata(dest) {
+		return ErrUnsafeArchivePath
+	}
+
+	file, err := f.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return ErrUnsupportedArchive
+	}
+
+	x := &extractor{f: f, ctx: ctx, dest: Clean(dest), limits: limits, archiveSize: info.Size()}
+	if !IsRoot(dest) && !f.Exists(dest) {
+		x.created = append(x.created, x.dest)
+	}
+	if format == "zip" {
+		err = x.zip(file, info.Size())
+	} else {
+		err = x.tar(file, format)
+	}
+	if err != nil {
+		x.rollback()
+	}
+	return err
+}
+
+type extractor struct {
+	f           *Filesystem
+	ctx         context.Context
+	dest        string
+	limits      ExtractLimits
+	archiveSize int64
+	written     int64
+	created     []string
+}
+
+func (x *extractor) zip(file *os.File, size int64) error {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+
+	// The declared sizes can lie, so this only rejects honest oversized archives early
+	var declared uint64
+	for _, entry := range reader.File {
+		declared += entry.UncompressedSize64
+	}
+	if x.limits.MaxBytes > 0 && declared > uint64(x.limits.MaxBytes) {
+		return ErrNoSpace
+	}
+
+	for _, entry := range reader.File {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.dir(entry.Name)
+		case mode&os.ModeSymlink != 0:
+			err = x.zipSymlink(entry)
+		case mode.IsRegular():
+			var r io.ReadCloser
+			if r, err = entry.Open(); err == nil {
+				err = x.file(entry.Name, mode.Perm(), r)
+				r.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) zipSymlink(entry *zip.File) error {
+	r, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	target, err := io.ReadAll(io.LimitReader(r, 4096))
+	if err != nil {
+		return err
+	}
+	return x.symlink(entry.Name, string(target))
+}
+
+func (x *extractor) tar(file *os.File, format string) error {
+	var r io.Reader = file
+	switch format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case "tar.xz":
+		xzr, err := xz.NewReader(file)
+		if err != nil {
+			return err
+		}
+		r = xzr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(header.Name)
+		case tar.TypeReg:
+			err = x.file(header.Name, os.FileMode(header.Mode).Perm(), tr)
+		case tar.TypeSymlink:
+			err = x.symlink(header.Name, header.Linkname)
+		}
+		// Hard links, devices and fifos are skipped
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// target resolves an entry name inside dest, refusing anything that would leave it
+func (x *extractor) target(name string) (string, error) {
+	name = filepath.ToSlash(name)
+	if name == "" || path.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(name, `\`) {
+		return "", fmt.Errorf("%s: %w", name, ErrUnsafeArchivePath)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%s: %w", name, ErrUnsafeArchivePath)
+		}
+	}
+	target := Clean(path.Join(x.dest, name))
+	if target == x.dest {
+		return "", nil
+	}
+	if IsMetadata(target) {
+		return "", fmt.Errorf("%s: %w", name, ErrUnsafeArchivePath)
+	}
+	return target, nil
+}
+
+// track remembers p for rollback when it does not exist yet, along with missing parents
+func (x *extractor) track(p string) {
+	var missing []string
+	for ; p != x.dest && p != "." && !x.f.Exists(p); p = path.Dir(p) {
+		missing = append(missing, p)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		x.created = append(x.created, missing[i])
+	}
+}
+
+func (x *extractor) rollback() {
+	for i := len(x.created) - 1; i >= 0; i-- {
+		x.f.RemoveAll(x.created[i])
+	}
+}
+
+func (x *extractor) dir(name string) error {
+	target, err := x.target(name)
+	if err != nil || target == "" {
+		return err
+	}
+	x.track(target)
+	return x.f.MkdirAll(target, 0755)
+}
+
+func (x *extractor) file(name string, perm os.FileMode, r io.Reader) error {
+	target, err := x.target(name)
+	if err != nil || target == "" {
+		return err
+	}
+	x.track(target)
+	if err := x.f.MkdirAll(path.Dir(target), 0755); err != nil {
+		return err
+	}
+	// Replace a symlink instead of writing through it
+	if info, err := x.f.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := x.f.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	out, err := x.f.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, &countingReader{r: r, x: x})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (x *extractor) symlink(name, link string) error {
+	target, err := x.target(name)
+	if err != nil || target == "" {
+		return err
+	}
+	// Links out of the directory are dropped rather than failing the extraction
+	if !SymlinkStaysInside(target, link) || IsMetadata(path.Join(path.Dir(target), link)) {
+		return nil
+	}
+	x.track(target)
+	if err := x.f.MkdirAll(path.Dir(target), 0755); err != nil {
+		return err
+	}
+	if x.f.Exists(target) {
+		if err := x.f.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	return x.f.Symlink(link, target)
+}
+
+// countingReader enforces the extraction limits on the bytes actually decompressed
+type countingReader struct {
+	r io.Reader
+	x *extractor
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	x := c.x
+	x.written += int64(n)
+	if x.limits.MaxBytes > 0 && x.written > x.limits.MaxBytes {
+		return n, ErrNoSpace
+	}
+	if x.limits.MaxRatio > 0 && x.written > ratioFloor && float64(x.written) > float64(x.archiveSize)*x.limits.MaxRatio {
+		return n, ErrCompressionRatio
+	}
+	if ctxErr := x.ctx.Err(); ctxErr != nil {
+		return n, ctxErr
+	}
+	return n, err
+}
+
+// limitWriter fails once more than remaining bytes are written
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining {
+		return 0, ErrNoSpace
+	}
+	l.remaining -= int64(len(p))
+	return l.w.Write(p)
+}
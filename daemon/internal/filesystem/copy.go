@@ -0,0 +1,161 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrIntoItself is returned when a directory would be copied or moved below itself
+var ErrIntoItself = errors.New("cannot copy or move a directory into itself")
+
+// Exists reports whether p exists, without following a final symlink
+func (f *Filesystem) Exists(p string) bool {
+	_, err := f.Lstat(p)
+	return err == nil
+}
+
+// Usage returns the total size in bytes of p and everything below it. Symlinks are counted
+// as themselves and never followed.
+func (f *Filesystem) Usage(p string) (int64, error) {
+	var total int64
+	err := fs.WalkDir(f.root.FS(), Clean(p), func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files deleted mid-walk don't make the total wrong enough to matter
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// Within reports whether p is below dir (or is dir itself)
+func Within(p, dir string) bool {
+	p, dir = Clean(p), Clean(dir)
+	return dir == "." || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// CopyName picks a free name next to p for a copy of it: "name copy.ext", then
+// "name copy 2.ext" and so on
+func (f *Filesystem) CopyName(p string) (string, error) {
+	p = Clean(p)
+	if p == "." {
+		return "", ErrRoot
+	}
+	dir, base := path.Split(p)
+
+	stem, ext := base, ""
+	if info, err := f.Lstat(p); err == nil && !info.IsDir() {
+		// Dotfiles like ".env" have no extension to keep
+		if e := path.Ext(base); e != base {
+			stem, ext = strings.TrimSuffix(base, e), e
+		}
+	}
+
+	for i := 1; i <= 1000; i++ {
+		name := stem + " copy" + ext
+		if i > 1 {
+			name = fmt.Sprintf("%s copy %d%s", stem, i, ext)
+		}
+		if candidate := dir + name; !f.Exists(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for a copy of %s", p)
+}
+
+// Copy copies from to to, recursing into directories. to must not exist yet. Symlinks are
+// recreated rather than followed, and left out when their target would point outside the
+// directory from the new location.
+func (f *Filesystem) Copy(from, to string) error {
+	if IsRoot(from) || IsRoot(to) {
+		return ErrRoot
+	}
+	if Within(to, from) {
+		return ErrIntoItself
+	}
+	if f.Exists(to) {
+		return fmt.Errorf("%s: %w", Clean(to), fs.ErrExist)
+	}
+	// Refuse up front rather than leave half a copy behind
+	if err := f.checkTreeDenied(from, from); err != nil {
+		return err
+	}
+	if err := f.checkTreeDenied(from, to); err != nil {
+		return err
+	}
+	if err := f.MkdirAll(path.Dir(Clean(to)), 0755); err != nil {
+		return err
+	}
+	return f.copy(Clean(from), Clean(to))
+}
+
+func (f *Filesystem) copy(from, to string) error {
+	info, err := f.Lstat(from)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := f.Readlink(from)
+		if err != nil {
+			return err
+		}
+		if !SymlinkStaysInside(to, target) {
+			return nil
+		}
+		return f.Symlink(target, to)
+
+	case info.IsDir():
+		if err := f.Mkdir(to, info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		entries, err := f.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := f.copy(path.Join(from, entry.Name()), path.Join(to, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case info.Mode().IsRegular():
+		return f.copyFile(from, to, info.Mode().Perm())
+	}
+
+	// Sockets, devices and pipes have no business in a service directory
+	return nil
+}
+
+func (f *Filesystem) copyFile(from, to string, perm os.FileMode) error {
+	src, err := f.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := f.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,157 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrDenied is returned for files the service's egg keeps users away from
+var ErrDenied = errors.New("access to this file is restricted")
+
+// Denylist holds an egg's file_denylist. Patterns are globs in the style of .gitignore: one
+// without a slash ("*.jar") matches a name at any depth, one with a slash ("config/ac.yml")
+// matches from the service root. Everything below a matching directory is denied as well.
+type Denylist struct {
+	patterns []denyPattern
+}
+
+type denyPattern struct {
+	glob     string
+	anywhere bool // Matched against each name rather than the full path
+}
+
+// ParseDenylist validates patterns and builds a denylist, nil when there are none
+func ParseDenylist(patterns []string) (*Denylist, error) {
+	var d Denylist
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		glob := strings.Trim(pattern, "/")
+		if _, err := path.Match(glob, ""); err != nil || glob == "" {
+			return nil, fmt.Errorf("invalid denylist pattern %q", pattern)
+		}
+		d.patterns = append(d.patterns, denyPattern{glob: glob, anywhere: !strings.Contains(glob, "/")})
+	}
+	if len(d.patterns) == 0 {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+// Match reports whether p or one of its parent directories is denied
+func (d *Denylist) Match(p string) bool {
+	if d == nil {
+		return false
+	}
+	p = Clean(p)
+	if p == "." || IsMetadata(p) {
+		return false
+	}
+	for dir := p; dir != "."; dir = path.Dir(dir) {
+		for _, pattern := range d.patterns {
+			subject := dir
+			if pattern.anywhere {
+				subject = path.Base(dir)
+			}
+			if ok, _ := path.Match(pattern.glob, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetDenylist restricts the operations of f to files outside d. Daemon metadata is never
+// restricted.
+func (f *Filesystem) SetDenylist(d *Denylist) {
+	f.deny = d
+}
+
+// Denylist returns the denylist set on f, nil when nothing is restricted
+func (f *Filesystem) Denylist() *Denylist {
+	return f.deny
+}
+
+// Denied reports whether p is off limits
+func (f *Filesystem) Denied(p string) bool {
+	return f.checkDenied(p) != nil
+}
+
+// checkDenied returns ErrDenied when p is off limits, also under the name a symlink gives it
+func (f *Filesystem) checkDenied(p string) error {
+	return f.checkDeniedPath(p, true)
+}
+
+// checkDeniedEntry is checkDenied for operations on a directory entry itself, which do not
+// follow a final symlink (remove, rename, creating a link)
+func (f *Filesystem) checkDeniedEntry(p string) error {
+	return f.checkDeniedPath(p, false)
+}
+
+func (f *Filesystem) checkDeniedPath(p string, followFinal bool) error {
+	if f.deny == nil {
+		return nil
+	}
+	if f.deny.Match(p) || f.deny.Match(f.resolve(p, followFinal)) {
+		return fmt.Errorf("%s: %w", Clean(p), ErrDenied)
+	}
+	return nil
+}
+
+// resolve follows the symlinks in p like a lookup through the root would, so a link can't
+// reach a denied file under another name
+func (f *Filesystem) resolve(p string, followFinal bool) string {
+	parts := strings.Split(Clean(p), "/")
+	resolved := "."
+	for hops := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		next := Clean(path.Join(resolved, part))
+		if len(parts) == 0 && !followFinal {
+			return next
+		}
+		info, err := f.root.Lstat(native(next))
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		target, err := f.root.Readlink(native(next))
+		target = filepath.ToSlash(target)
+		// Absolute or endless links fail the lookup itself
+		if err != nil || path.IsAbs(target) || hops >= 40 {
+			return next
+		}
+		hops++
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return resolved
+}
+
+// checkTreeDenied returns ErrDenied when src, or anything below it, would be off limits once
+// placed at as. Moving, copying or removing a directory counts for everything inside it.
+func (f *Filesystem) checkTreeDenied(src, as string) error {
+	if f.deny == nil || IsMetadata(as) {
+		return nil
+	}
+	if err := f.checkDeniedEntry(as); err != nil {
+		return err
+	}
+	src, as = Clean(src), Clean(as)
+	info, err := f.root.Lstat(native(src))
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	return fs.WalkDir(f.root.FS(), src, func(p string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		return f.checkDenied(path.Join(as, strings.TrimPrefix(p, src)))
+	})
+}
@@ -0,0 +1,342 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+)
+
+// MetadataPrefix marks files the daemon keeps in a service directory (install markers, etc.)
+const MetadataPrefix = ".atlas"
+
+var (
+	ErrInvalidUUID = errors.New("invalid service identifier")
+	ErrRoot        = errors.New("operation not allowed on the root directory")
+	ErrOutsideRoot = errors.New("path is outside the service directory")
+	ErrNoSpace     = errors.New("not enough disk space")
+)
+
+// Filesystem is one service's data directory. Paths are resolved a component at a time with
+// openat-style lookups through an os.Root, so neither ".." nor a symlink (created by the game,
+// an installer or a user) can reach anything outside the directory.
+//
+// Paths passed to its methods are slash-separated and relative to the service root; a leading
+// "/" is allowed and ".." is clamped at the root. Files and directories created through it are
+// handed to the container user (see Owner), and files matching its denylist are refused.
+type Filesystem struct {
+	root *os.Root
+	dir  string
+	deny *Denylist
+}
+
+// ValidUUID reports whether uuid is safe to use as a directory name under the data path
+func ValidUUID(uuid string) bool {
+	return uuid != "" && uuid != "." && uuid != ".." && !strings.ContainsAny(uuid, `/\:`) && !strings.HasPrefix(uuid, MetadataPrefix)
+}
+
+// ServiceDir returns the host path of a service's data directory
+func ServiceDir(uuid string) (string, error) {
+	if !ValidUUID(uuid) {
+		return "", ErrInvalidUUID
+	}
+	return filepath.Join(config.NodeConfig.DataPath, uuid), nil
+}
+
+// ForService opens the data directory of a service
+func ForService(uuid string) (*Filesystem, error) {
+	dir, err := ServiceDir(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return New(dir)
+}
+
+// CreateForService creates the data directory of a service if needed, hands it to the container
+// user and opens it
+func CreateForService(uuid string) (*Filesystem, error) {
+	dir, err := ServiceDir(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := New(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.own("."); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// New opens dir as a Filesystem
+func New(dir string) (*Filesystem, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Filesystem{root: root, dir: dir}, nil
+}
+
+func (f *Filesystem) Close() error {
+	return f.root.Close()
+}
+
+// Dir returns the host path of the directory, e.g. for bind mounts
+func (f *Filesystem) Dir() string {
+	return f.dir
+}
+
+// Clean turns a client path into a path relative to the root, "." being the root itself
+func Clean(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// IsRoot reports whether p refers to the root directory
+func IsRoot(p string) bool {
+	return Clean(p) == "."
+}
+
+// IsMetadata reports whether p is inside daemon metadata at the top of the directory
+func IsMetadata(p string) bool {
+	first, _, _ := strings.Cut(Clean(p), "/")
+	return strings.HasPrefix(first, MetadataPrefix)
+}
+
+// IsOutside reports whether err came from a path that would resolve outside the root
+func IsOutside(err error) bool {
+	if errors.Is(err, ErrOutsideRoot) {
+		return true
+	}
+	// os.Root does not export its error, so match the message
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) && strings.Contains(pathErr.Err.Error(), "path escapes from parent")
+}
+
+func native(p string) string {
+	return filepath.FromSlash(Clean(p))
+}
+
+func (f *Filesystem) Open(p string) (*os.File, error) {
+	if err := f.checkDenied(p); err != nil {
+		return nil, err
+	}
+	return f.root.Open(native(p))
+}
+
+// OpenFile opens a file with the given flags. A file opened with O_CREATE is handed to the
+// container user.
+func (f *Filesystem) OpenFile(p string, flag int, perm os.FileMode) (*os.File, error) {
+	if err := f.checkDenied(p); err != nil {
+		return nil, err
+	}
+	file, err := f.root.OpenFile(native(p), flag, perm)
+	if err != nil || flag&os.O_CREATE == 0 {
+		return file, err
+	}
+	if err := ownFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// Create truncates or creates a file for writing, creating its parent directories
+func (f *Filesystem) Create(p string) (*os.File, error) {
+	if IsRoot(p) {
+		return nil, ErrRoot
+	}
+	if err := f.checkDenied(p); err != nil {
+		return nil, err
+	}
+	if err := f.mkdirAll(path.Dir(Clean(p)), 0755); err != nil {
+		return nil, err
+	}
+	return f.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func (f *Filesystem) ReadFile(p string) ([]byte, error) {
+	if err := f.checkDenied(p); err != nil {
+		return nil, err
+	}
+	return f.root.ReadFile(native(p))
+}
+
+// WriteFile writes data to a file, creating its parent directories
+func (f *Filesystem) WriteFile(p string, data []byte, perm os.FileMode) error {
+	if IsRoot(p) {
+		return ErrRoot
+	}
+	if err := f.checkDenied(p); err != nil {
+		return err
+	}
+	if err := f.mkdirAll(path.Dir(Clean(p)), 0755); err != nil {
+		return err
+	}
+	if err := f.root.WriteFile(native(p), data, perm); err != nil {
+		return err
+	}
+	return f.own(p)
+}
+
+// ReadDir lists a directory. Entries are not followed, so symlinks show up as symlinks.
+func (f *Filesystem) ReadDir(p string) ([]os.DirEntry, error) {
+	if err := f.checkDenied(p); err != nil {
+		return nil, err
+	}
+	dir, err := f.root.Open(native(p))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	return dir.ReadDir(-1)
+}
+
+func (f *Filesystem) Stat(p string) (os.FileInfo, error) {
+	return f.root.Stat(native(p))
+}
+
+func (f *Filesystem) Lstat(p string) (os.FileInfo, error) {
+	return f.root.Lstat(native(p))
+}
+
+func (f *Filesystem) Mkdir(p string, perm os.FileMode) error {
+	if err := f.checkDenied(p); err != nil {
+		return err
+	}
+	if err := f.root.Mkdir(native(p), perm); err != nil {
+		return err
+	}
+	return f.own(p)
+}
+
+// MkdirAll creates a directory and its parents, handing the ones it creates to the container user
+func (f *Filesystem) MkdirAll(p string, perm os.FileMode) error {
+	if err := f.checkDenied(p); err != nil {
+		return err
+	}
+	return f.mkdirAll(p, perm)
+}
+
+// Remove deletes a file or an empty directory
+func (f *Filesystem) Remove(p string) error {
+	if IsRoot(p) {
+		return ErrRoot
+	}
+	if err := f.checkDeniedEntry(p); err != nil {
+		return err
+	}
+	return f.root.Remove(native(p))
+}
+
+// RemoveAll deletes p and everything below it without following symlinks
+func (f *Filesystem) RemoveAll(p string) error {
+	if IsRoot(p) {
+		return ErrRoot
+	}
+	if err := f.checkTreeDenied(p, p); err != nil {
+		return err
+	}
+	return f.root.RemoveAll(native(p))
+}
+
+func (f *Filesystem) Rename(from, to string) error {
+	if IsRoot(from) || IsRoot(to) {
+		return ErrRoot
+	}
+	if err := f.checkTreeDenied(from, from); err != nil {
+		return err
+	}
+	if err := f.checkTreeDenied(from, to); err != nil {
+		return err
+	}
+	return f.root.Rename(native(from), native(to))
+}
+
+func (f *Filesystem) Chmod(p string, mode os.FileMode) error {
+	if err := f.checkDenied(p); err != nil {
+		return err
+	}
+	return f.root.Chmod(native(p), mode)
+}
+
+func (f *Filesystem) Chown(p string, uid, gid int) error {
+	return f.root.Lchown(native(p), uid, gid)
+}
+
+func (f *Filesystem) Chtimes(p string, atime, mtime time.Time) error {
+	if err := f.checkDenied(p); err != nil {
+		return err
+	}
+	return f.root.Chtimes(native(p), atime, mtime)
+}
+
+func (f *Filesystem) Link(from, to string) error {
+	if err := f.checkDenied(from); err != nil {
+		return err
+	}
+	if err := f.checkDeniedEntry(to); err != nil {
+		return err
+	}
+	return f.root.Link(native(from), native(to))
+}
+
+func (f *Filesystem) Readlink(p string) (string, error) {
+	return f.root.Readlink(native(p))
+}
+
+// Symlink creates link pointing at target. Only relative targets that stay inside the
+// directory are allowed, since an absolute target would mean the host's filesystem.
+func (f *Filesystem) Symlink(target, link string) error {
+	if !SymlinkStaysInside(link, target) {
+		return fmt.Errorf("symlink %s -> %s: %w", link, target, ErrOutsideRoot)
+	}
+	if err := f.checkDeniedEntry(link); err != nil {
+		return err
+	}
+	if err := f.root.Symlink(filepath.FromSlash(target), native(link)); err != nil {
+		return err
+	}
+	return f.own(link)
+}
+
+// SymlinkStaysInside reports whether a link at link pointing to target resolves inside the root
+func SymlinkStaysInside(link, target string) bool {
+	target = filepath.ToSlash(target)
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return false
+	}
+
+	// Walk the target from the link's directory and fail as soon as it climbs above the root
+	depth := 0
+	if dir := path.Dir(Clean(link)); dir != "." {
+		depth = strings.Count(dir, "/") + 1
+	}
+	for _, part := range strings.Split(target, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return false
+			}
+		default:
+			depth++
+		}
+	}
+	return true
+}
@@ -0,0 +1,470 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+)
+
+// testLayout is a data path with one service directory, a sibling whose name shares its
+// prefix, and a directory outside the data path, each holding a secret.txt
+type testLayout struct {
+	fs      *Filesystem
+	root    string // The service directory
+	sibling string // data/svc-evil
+	outside string
+}
+
+func newTestLayout(t *testing.T) *testLayout {
+	t.Helper()
+	base := t.TempDir()
+	config.NodeConfig.DataPath = filepath.Join(base, "data")
+	config.NodeConfig.ContainerUID, config.NodeConfig.ContainerGID = os.Getuid(), os.Getgid()
+
+	l := &testLayout{
+		root:    filepath.Join(base, "data", "svc"),
+		sibling: filepath.Join(base, "data", "svc-evil"),
+		outside: filepath.Join(base, "outside"),
+	}
+	for _, dir := range []string{l.root, l.sibling, l.outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{l.sibling, l.outside} {
+		if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := ForService("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	l.fs = fs
+	return l
+}
+
+// link creates a symlink directly on disk, the way a game or installer could
+func (l *testLayout) link(t *testing.T, target, name string) {
+	t.Helper()
+	p := filepath.Join(l.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (l *testLayout) assertUntouched(t *testing.T) {
+	t.Helper()
+	for _, dir := range []string{l.sibling, l.outside} {
+		data, err := os.ReadFile(filepath.Join(dir, "secret.txt"))
+		if err != nil || string(data) != "secret" {
+			t.Fatalf("%s/secret.txt was changed: %q, %v", dir, data, err)
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Fatalf("%s gained files: %v", dir, entries)
+		}
+	}
+}
+
+func TestValidUUID(t *testing.T) {
+	tests := []struct {
+		uuid string
+		want bool
+	}{
+		{"0b9c6d4e-1f2a-4b3c-8d7e-9f0a1b2c3d4e", true},
+		{"svc", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../svc", false},
+		{"svc/../other", false},
+		{"/etc", false},
+		{`svc\..\other`, false},
+		{"C:", false},
+		{".atlas", false},
+		{".atlas-trash", false},
+	}
+	for _, tt := range tests {
+		if got := ValidUUID(tt.uuid); got != tt.want {
+			t.Errorf("ValidUUID(%q) = %v, want %v", tt.uuid, got, tt.want)
+		}
+		if _, err := ServiceDir(tt.uuid); (err == nil) != tt.want {
+			t.Errorf("ServiceDir(%q) error = %v", tt.uuid, err)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := map[string]string{
+		"":                      ".",
+		"/":                     ".",
+		"..":                    ".",
+		"../../etc/passwd":      "etc/passwd",
+		"/etc/passwd":           "etc/passwd",
+		"a/../../b":             "b",
+		"a/./b//c":              "a/b/c",
+		"../svc-evil/secret":    "svc-evil/secret",
+		`..\..\windows\system`:  `..\..\windows\system`,
+		"plugins/../server.jar": "server.jar",
+	}
+	for in, want := range tests {
+		if got := Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// Traversal and absolute paths are clamped to the service root, never resolved against the host
+func TestTraversalIsClamped(t *testing.T) {
+	paths := []string{
+		"../outside/secret.txt",
+		"../../outside/secret.txt",
+		"../svc-evil/secret.txt",
+		"ABSOLUTE",
+		"a/../../../outside/secret.txt",
+	}
+	for _, p := range paths {
+		t.Run(p, func(t *testing.T) {
+			l := newTestLayout(t)
+			if p == "ABSOLUTE" {
+				p = filepath.ToSlash(filepath.Join(l.outside, "secret.txt"))
+			}
+			if data, err := l.fs.ReadFile(p); err == nil {
+				t.Fatalf("read %q outside the root: %q", p, data)
+			}
+			if err := l.fs.WriteFile(p, []byte("owned"), 0644); err != nil {
+				t.Fatalf("write %q: %v", p, err)
+			}
+			if _, err := os.Stat(filepath.Join(l.root, filepath.FromSlash(Clean(p)))); err != nil {
+				t.Fatalf("write %q did not land inside the root: %v", p, err)
+			}
+			l.assertUntouched(t)
+		})
+	}
+}
+
+// Symlinks left in the directory can't be used to reach anything outside it
+func TestSymlinkEscapes(t *testing.T) {
+	tests := []struct {
+		name   string
+		links  map[string]string // link name -> target
+		access string            // Directory to read secret.txt from and write into
+	}{
+		{"absolute", map[string]string{"abs": "OUTSIDE"}, "abs"},
+		{"relative", map[string]string{"rel": "../../outside"}, "rel"},
+		{"nested relative", map[string]string{"a/b/up": "../../../../outside"}, "a/b/up"},
+		{"through intermediate directory", map[string]string{"hop": "a/out", "a/out": "../../../outside"}, "hop"},
+		{"chained links", map[string]string{"first": "second", "second": "../../outside"}, "first"},
+		{"parent is a link", map[string]string{"up": "../.."}, "up/outside"},
+		{"sibling with shared prefix", map[string]string{"evil": "../svc-evil"}, "evil"},
+		{"absolute sibling", map[string]string{"evil": "SIBLING"}, "evil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLayout(t)
+			for name, target := range tt.links {
+				switch target {
+				case "OUTSIDE":
+					target = l.outside
+				case "SIBLING":
+					target = l.sibling
+				}
+				l.link(t, target, name)
+			}
+
+			secret := tt.access + "/secret.txt"
+			if data, err := l.fs.ReadFile(secret); err == nil {
+				t.Fatalf("read %s through a link: %q", secret, data)
+			} else if !IsOutside(err) && !os.IsNotExist(err) {
+				t.Fatalf("read %s: unexpected error %v", secret, err)
+			}
+			if f, err := l.fs.Open(secret); err == nil {
+				f.Close()
+				t.Fatalf("opened %s through a link", secret)
+			}
+			if _, err := l.fs.Stat(secret); err == nil {
+				t.Fatalf("stat %s through a link", secret)
+			}
+			if err := l.fs.WriteFile(tt.access+"/planted.txt", []byte("x"), 0644); err == nil {
+				t.Fatalf("wrote through %s", tt.access)
+			}
+			if err := l.fs.Chmod(secret, 0777); err == nil {
+				t.Fatalf("chmod through %s", tt.access)
+			}
+			if err := l.fs.MkdirAll(tt.access+"/new/dir", 0755); err == nil {
+				t.Fatalf("mkdir through %s", tt.access)
+			}
+			if _, err := l.fs.ReadDir(tt.access); err == nil {
+				t.Fatalf("listed %s through a link", tt.access)
+			}
+			l.assertUntouched(t)
+		})
+	}
+}
+
+func TestFileSymlinkOutside(t *testing.T) {
+	l := newTestLayout(t)
+	l.link(t, filepath.Join(l.outside, "secret.txt"), "abs.txt")
+	l.link(t, "../../outside/secret.txt", "rel.txt")
+
+	for _, name := range []string{"abs.txt", "rel.txt"} {
+		if data, err := l.fs.ReadFile(name); err == nil {
+			t.Fatalf("read %s: %q", name, data)
+		}
+		if err := l.fs.WriteFile(name, []byte("owned"), 0644); err == nil {
+			t.Fatalf("wrote through %s", name)
+		}
+		if f, err := l.fs.OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0); err == nil {
+			f.Close()
+			t.Fatalf("truncated through %s", name)
+		}
+		// The link itself is still a directory entry that can be inspected and removed
+		if _, err := l.fs.Lstat(name); err != nil {
+			t.Fatalf("lstat %s: %v", name, err)
+		}
+		if err := l.fs.Remove(name); err != nil {
+			t.Fatalf("remove %s: %v", name, err)
+		}
+	}
+	l.assertUntouched(t)
+}
+
+func TestSymlinkStaysInside(t *testing.T) {
+	tests := []struct {
+		link, target string
+		want         bool
+	}{
+		{"link", "target", true},
+		{"link", "./a/b", true},
+		{"a/link", "../target", true},
+		{"a/b/link", "../../target", true},
+		{"a/b/link", "../x/../../y", true},
+		{"link", "..", false},
+		{"link", "../svc-evil", false},
+		{"a/link", "../../target", false},
+		{"a/link", "b/../../../target", false},
+		{"link", "/etc/passwd", false},
+		{"link", "", false},
+		{"../../link", "../x", false},
+	}
+	for _, tt := range tests {
+		if got := SymlinkStaysInside(tt.link, tt.target); got != tt.want {
+			t.Errorf("SymlinkStaysInside(%q, %q) = %v, want %v", tt.link, tt.target, got, tt.want)
+		}
+	}
+
+	l := newTestLayout(t)
+	for _, target := range []string{"../outside", l.outside, "../svc-evil"} {
+		if err := l.fs.Symlink(target, "made"); !IsOutside(err) {
+			t.Fatalf("Symlink(%q) error = %v, want outside root", target, err)
+		}
+	}
+	if err := l.fs.Symlink("target", "inside"); err != nil {
+		t.Fatalf("Symlink inside: %v", err)
+	}
+}
+
+// Removing or moving a tree that holds links out only touches the links themselves
+func TestTreeOperationsWithLinksOut(t *testing.T) {
+	l := newTestLayout(t)
+	if err := l.fs.WriteFile("tree/file.txt", []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l.link(t, l.outside, "tree/abs")
+	l.link(t, "../../../outside", "tree/rel")
+	l.link(t, "../../svc-evil", "tree/deep/sibling")
+
+	if err := l.fs.Rename("tree", "moved"); err != nil {
+		t.Fatalf("rename tree: %v", err)
+	}
+	l.assertUntouched(t)
+
+	escapes := [][2]string{
+		{"moved/abs/secret.txt", "stolen.txt"},
+		{"moved/rel/secret.txt", "stolen.txt"},
+		{"moved/file.txt", "moved/abs/planted.txt"},
+		{"moved/file.txt", "moved/deep/sibling/planted.txt"},
+	}
+	for _, e := range escapes {
+		if err := l.fs.Rename(e[0], e[1]); err == nil {
+			t.Fatalf("rename %s -> %s escaped the root", e[0], e[1])
+		}
+	}
+	if err := l.fs.MkdirAll("outside", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.fs.Rename("moved/file.txt", "../../outside/planted.txt"); err != nil {
+		t.Fatalf("clamped rename: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(l.root, "outside", "planted.txt")); err != nil {
+		t.Fatalf("clamped rename did not land inside the root: %v", err)
+	}
+
+	if err := l.fs.RemoveAll("moved"); err != nil {
+		t.Fatalf("remove tree: %v", err)
+	}
+	if err := l.fs.RemoveAll("../outside"); err != nil && !os.IsNotExist(err) {
+		t.Fatalf("clamped remove: %v", err)
+	}
+	l.assertUntouched(t)
+
+	if err := l.fs.RemoveAll("/"); !errors.Is(err, ErrRoot) {
+		t.Fatalf("RemoveAll of the root = %v, want ErrRoot", err)
+	}
+	if err := l.fs.Rename(".", "elsewhere"); !errors.Is(err, ErrRoot) {
+		t.Fatalf("Rename of the root = %v, want ErrRoot", err)
+	}
+}
+
+func TestCopyWithLinksOut(t *testing.T) {
+	l := newTestLayout(t)
+	if err := l.fs.WriteFile("tree/file.txt", []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l.link(t, l.outside, "tree/abs")
+
+	if err := l.fs.Copy("tree/abs/secret.txt", "copied.txt"); err == nil {
+		t.Fatal("copied a file through a link out")
+	}
+	if err := l.fs.Copy("tree/file.txt", "tree/abs/planted.txt"); err == nil {
+		t.Fatal("copied a file out through a link")
+	}
+	l.assertUntouched(t)
+}
+
+func TestDenylistMatch(t *testing.T) {
+	deny, err := ParseDenylist([]string{"server.jar", "*.key", "plugins/AntiCheat/config.yml", "secrets", "# comment", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"server.jar":                         true,
+		"/server.jar":                        true,
+		"backups/server.jar":                 true,
+		"certs/site.key":                     true,
+		"plugins/AntiCheat/config.yml":       true,
+		"other/plugins/AntiCheat/config.yml": false,
+		"secrets":                            true,
+		"secrets/nested/file.txt":            true,
+		"server.properties":                  false,
+		".":                                  false,
+		".atlas/trash/server.jar":            false,
+		"../server.jar":                      true,
+	}
+	for p, want := range tests {
+		if got := deny.Match(p); got != want {
+			t.Errorf("Match(%q) = %v, want %v", p, got, want)
+		}
+	}
+
+	if _, err := ParseDenylist([]string{"[broken"}); err == nil {
+		t.Error("ParseDenylist accepted a malformed pattern")
+	}
+	if d, err := ParseDenylist([]string{"", "# only comments"}); d != nil || err != nil {
+		t.Errorf("ParseDenylist of nothing = %v, %v, want nil", d, err)
+	}
+}
+
+// A denied file can't be reached under the name a symlink gives it
+func TestDenylistThroughSymlinks(t *testing.T) {
+	l := newTestLayout(t)
+	if err := l.fs.WriteFile("config/server.yml", []byte("token: x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.fs.WriteFile("config/public.yml", []byte("motd: hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l.link(t, "config/server.yml", "alias.yml")
+	l.link(t, "config", "cfg")
+	l.link(t, "cfg", "cfg2")
+	l.link(t, "../config/server.yml", "nested/alias.yml")
+	l.link(t, "missing", "dangling")
+
+	deny, err := ParseDenylist([]string{"config/server.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.fs.SetDenylist(deny)
+
+	tests := []struct {
+		path         string
+		follow       bool
+		noFollow     bool // Denied as a directory entry
+		readDenied   bool
+		removeDenied bool
+	}{
+		{"config/server.yml", true, true, true, true},
+		{"config/public.yml", false, false, false, false},
+		{"alias.yml", true, false, true, false},
+		{"nested/alias.yml", true, false, true, false},
+		{"cfg/server.yml", true, true, true, true},
+		{"cfg2/server.yml", true, true, true, true},
+		{"cfg/public.yml", false, false, false, false},
+		{"cfg", false, false, false, false},
+		{"dangling", false, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := l.fs.checkDeniedPath(tt.path, true); (err != nil) != tt.follow {
+				t.Errorf("checkDeniedPath(follow) = %v, want denied %v", err, tt.follow)
+			}
+			if err := l.fs.checkDeniedPath(tt.path, false); (err != nil) != tt.noFollow {
+				t.Errorf("checkDeniedPath(no follow) = %v, want denied %v", err, tt.noFollow)
+			}
+			if _, err := l.fs.ReadFile(tt.path); errors.Is(err, ErrDenied) != tt.readDenied {
+				t.Errorf("ReadFile = %v, want denied %v", err, tt.readDenied)
+			}
+			if l.fs.Denied(tt.path) != tt.readDenied {
+				t.Errorf("Denied = %v, want %v", !tt.readDenied, tt.readDenied)
+			}
+			if err := l.fs.checkDeniedEntry(tt.path); (err != nil) != tt.removeDenied {
+				t.Errorf("checkDeniedEntry = %v, want denied %v", err, tt.removeDenied)
+			}
+		})
+	}
+
+	// Writing through a link to a denied file is refused, removing the link itself is not
+	if err := l.fs.WriteFile("alias.yml", []byte("token: stolen"), 0644); !errors.Is(err, ErrDenied) {
+		t.Fatalf("write through alias = %v, want ErrDenied", err)
+	}
+	if err := l.fs.Remove("alias.yml"); err != nil {
+		t.Fatalf("remove alias: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(l.root, "config", "server.yml")); string(data) != "token: x" {
+		t.Fatalf("denied file changed: %q", data)
+	}
+
+	// Tree operations count for everything inside
+	if err := l.fs.Rename("config", "moved"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("rename of a directory holding a denied file = %v, want ErrDenied", err)
+	}
+	if err := l.fs.RemoveAll("config"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("remove of a directory holding a denied file = %v, want ErrDenied", err)
+	}
+	if err := l.fs.Rename("config/public.yml", "config/server.yml"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("rename onto a denied file = %v, want ErrDenied", err)
+	}
+	if err := l.fs.Link("config/server.yml", "hardlink.yml"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("hard link to a denied file = %v, want ErrDenied", err)
+	}
+	if err := l.fs.Symlink("config/server.yml", "newalias.yml"); err != nil {
+		t.Fatalf("symlink creation: %v", err)
+	}
+	if _, err := l.fs.ReadFile("newalias.yml"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("read through a new link = %v, want ErrDenied", err)
+	}
+
+	// Daemon metadata is never restricted
+	if err := l.fs.WriteFile(".atlas/config/server.yml", []byte("x"), 0644); err != nil {
+		t.Fatalf("metadata write: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package filesystem
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+)
+
+// PermissionStats summarise a FixPermissions run
+type PermissionStats struct {
+	Entries int `json:"entries"`
+	Failed  int `json:"failed"`
+}
+
+// Owner returns the user and group containers run as, which everything in a service
+// directory should belong to
+func Owner() (uid, gid int) {
+	return config.NodeConfig.ContainerUID, config.NodeConfig.ContainerGID
+}
+
+// ManagesOwnership reports whether the daemon can hand files to the container user. Only root
+// can give files away, so a daemon run as an ordinary user leaves ownership alone.
+func ManagesOwnership() bool {
+	return os.Geteuid() == 0
+}
+
+// own hands p to the container user without following a symlink
+func (f *Filesystem) own(p string) error {
+	if !ManagesOwnership() {
+		return nil
+	}
+	uid, gid := Owner()
+	return f.root.Lchown(native(p), uid, gid)
+}
+
+func ownFile(file *os.File) error {
+	if !ManagesOwnership() {
+		return nil
+	}
+	uid, gid := Owner()
+	return file.Chown(uid, gid)
+}
+
+// mkdirAll creates p and any missing parents, handing the directories it creates to the
+// container user
+func (f *Filesystem) mkdirAll(p string, perm os.FileMode) error {
+	var missing []string
+	for dir := Clean(p); dir != "."; dir = path.Dir(dir) {
+		if _, err := f.root.Lstat(native(dir)); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+	}
+	if err := f.root.MkdirAll(native(p), perm); err != nil {
+		return err
+	}
+	for _, dir := range missing {
+		if err := f.own(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FixPermissions walks p without following symlinks, hands everything to the container user
+// and makes sure the owner can read and write files and enter directories. Entries that cannot
+// be repaired are counted and skipped.
+func (f *Filesystem) FixPermissions(ctx context.Context, p string) (PermissionStats, error) {
+	var stats PermissionStats
+	err := fs.WalkDir(f.root.FS(), Clean(p), func(p string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// Only a missing or unreachable starting point ends the walk
+			if entry == nil {
+				return err
+			}
+			stats.Failed++
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		// The trash, revisions and pending uploads belong to the daemon, and files the
+		// service's users are kept away from stay as they are
+		if IsMetadata(p) || f.Denied(p) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		stats.Entries++
+
+		if err := f.own(p); err != nil {
+			stats.Failed++
+			return nil
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		want := os.FileMode(0600)
+		if entry.IsDir() {
+			want = 0700
+		}
+		info, err := entry.Info()
+		if err != nil {
+			stats.Failed++
+			return nil
+		}
+		if mode := info.Mode().Perm(); mode&want != want {
+			if err := f.Chmod(p, mode|want); err != nil {
+				stats.Failed++
+			}
+		}
+		return nil
+	})
+	return stats, err
+}
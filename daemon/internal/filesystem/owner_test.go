@@ -0,0 +1,67 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+)
+
+// ownerOf returns the uid and gid of p without following a symlink
+func ownerOf(t *testing.T, p string) (int, int) {
+	t.Helper()
+	info, err := os.Lstat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	return int(st.Uid), int(st.Gid)
+}
+
+func TestFixPermissionsLeavesMetadata(t *testing.T) {
+	if !ManagesOwnership() {
+		t.Skip("only root can hand files to another user")
+	}
+	l := newTestLayout(t)
+	config.NodeConfig.ContainerUID, config.NodeConfig.ContainerGID = 4321, 4321
+
+	for _, p := range []string{"world/level.dat", ".atlas/trash/1/level.dat", ".atlas/revisions/x/1", ".atlas/uploads/abc.part"} {
+		full := filepath.Join(l.root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	daemonUID, daemonGID := ownerOf(t, filepath.Join(l.root, ".atlas"))
+
+	stats, err := l.fs.FixPermissions(context.Background(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Failed != 0 {
+		t.Fatalf("FixPermissions failed on %d entries", stats.Failed)
+	}
+
+	for _, p := range []string{"world", "world/level.dat"} {
+		if uid, gid := ownerOf(t, filepath.Join(l.root, p)); uid != 4321 || gid != 4321 {
+			t.Errorf("%s is owned by %d:%d, want the container user", p, uid, gid)
+		}
+	}
+	err = filepath.Walk(filepath.Join(l.root, ".atlas"), func(p string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if uid, gid := ownerOf(t, p); uid != daemonUID || gid != daemonGID {
+			t.Errorf("%s was handed to %d:%d", p, uid, gid)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
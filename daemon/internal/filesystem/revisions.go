@@ -0,0 +1,202 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// RevisionDir keeps earlier versions of files saved from the editor, one directory per file
+	RevisionDir = MetadataPrefix + "/revisions"
+
+	// MaxRevisionSize is the largest file whose versions are kept
+	MaxRevisionSize = 8 << 20
+	// maxRevisionStore caps the compressed size of one file's history; the oldest versions go first
+	maxRevisionStore = 16 << 20
+)
+
+// ErrRevisionNotFound is returned for a revision ID a file has no record of
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is one saved version of a file
+type Revision struct {
+	ID         string    `json:"id"`
+	Size       int64     `json:"size"`
+	Compressed int64     `json:"compressed"`
+	Hash       string    `json:"hash"`
+	Author     string    `json:"author,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type revisionIndex struct {
+	Path      string     `json:"path"`
+	Revisions []Revision `json:"revisions"` // Oldest first
+}
+
+// revisionMu serialises history updates, which are read-modify-write of the index
+var revisionMu sync.Mutex
+
+// revisionPath returns the directory holding the history of p
+func revisionPath(p string) string {
+	sum := sha256.Sum256([]byte(Clean(p)))
+	return RevisionDir + "/" + hex.EncodeToString(sum[:16])
+}
+
+func (f *Filesystem) loadRevisions(p string) *revisionIndex {
+	index := &revisionIndex{Path: Clean(p)}
+	data, err := f.ReadFile(revisionPath(p) + "/index.json")
+	if err != nil {
+		return index
+	}
+	var stored revisionIndex
+	if json.Unmarshal(data, &stored) != nil || stored.Path != index.Path {
+		return index
+	}
+	return &stored
+}
+
+func (f *Filesystem) saveRevisions(index *revisionIndex) error {
+	data, _ := json.Marshal(index)
+	return f.WriteFile(revisionPath(index.Path)+"/index.json", data, 0600)
+}
+
+// addRevision stores data as the newest version of the file in index, unless it matches the
+// newest version already
+func (f *Filesystem) addRevision(index *revisionIndex, data []byte, author string) (*Revision, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if n := len(index.Revisions); n > 0 && index.Revisions[n-1].Hash == hash {
+		return &index.Revisions[n-1], nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	rev := Revision{
+		ID:         hex.EncodeToString(id),
+		Size:       int64(len(data)),
+		Compressed: int64(buf.Len()),
+		Hash:       hash,
+		Author:     author,
+		CreatedAt:  time.Now(),
+	}
+	if err := f.WriteFile(revisionPath(index.Path)+"/"+rev.ID+".gz", buf.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+	index.Revisions = append(index.Revisions, rev)
+	return &index.Revisions[len(index.Revisions)-1], nil
+}
+
+// pruneRevisions drops the oldest versions beyond keep or beyond the size cap, always keeping
+// the newest
+func (f *Filesystem) pruneRevisions(index *revisionIndex, keep int) {
+	var total int64
+	for _, rev := range index.Revisions {
+		total += rev.Compressed
+	}
+	for len(index.Revisions) > 1 && (len(index.Revisions) > keep || total > maxRevisionStore) {
+		oldest := index.Revisions[0]
+		f.Remove(revisionPath(index.Path) + "/" + oldest.ID + ".gz")
+		total -= oldest.Compressed
+		index.Revisions = index.Revisions[1:]
+	}
+}
+
+// WriteFileRevision writes data to p and keeps it as a revision, holding on to the last keep
+// versions. The first time a file is saved its previous content is kept too, so the very first
+// edit can be undone. With keep <= 0 it is a plain WriteFile.
+func (f *Filesystem) WriteFileRevision(p string, data []byte, perm os.FileMode, author string, keep int) (*Revision, error) {
+	if keep <= 0 || len(data) > MaxRevisionSize || IsMetadata(p) {
+		return nil, f.WriteFile(p, data, perm)
+	}
+
+	revisionMu.Lock()
+	defer revisionMu.Unlock()
+
+	index := f.loadRevisions(p)
+	if len(index.Revisions) == 0 {
+		if info, err := f.Lstat(p); err == nil && info.Mode().IsRegular() && info.Size() <= MaxRevisionSize {
+			if previous, err := f.ReadFile(p); err == nil {
+				f.addRevision(index, previous, "")
+			}
+		}
+	}
+
+	if err := f.WriteFile(p, data, perm); err != nil {
+		return nil, err
+	}
+
+	rev, err := f.addRevision(index, data, author)
+	if err != nil {
+		return nil, err
+	}
+	saved := *rev
+	f.pruneRevisions(index, keep)
+	if err := f.saveRevisions(index); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// ListRevisions returns the saved versions of p, newest first
+func (f *Filesystem) ListRevisions(p string) ([]Revision, error) {
+	if err := f.checkDenied(p); err != nil {
+		return nil, err
+	}
+	revisionMu.Lock()
+	index := f.loadRevisions(p)
+	revisionMu.Unlock()
+
+	list := make([]Revision, len(index.Revisions))
+	for i, rev := range index.Revisions {
+		list[len(list)-1-i] = rev
+	}
+	return list, nil
+}
+
+// ReadRevision returns the content of one version of p
+func (f *Filesystem) ReadRevision(p, id string) ([]byte, *Revision, error) {
+	if err := f.checkDenied(p); err != nil {
+		return nil, nil, err
+	}
+	revisionMu.Lock()
+	index := f.loadRevisions(p)
+	revisionMu.Unlock()
+
+	for _, rev := range index.Revisions {
+		if rev.ID != id {
+			continue
+		}
+		file, err := f.Open(revisionPath(p) + "/" + rev.ID + ".gz")
+		if err != nil {
+			return nil, nil, ErrRevisionNotFound
+		}
+		defer file.Close()
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(zr, MaxRevisionSize+1))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) > MaxRevisionSize {
+			return nil, nil, errors.New("revision is larger than expected")
+		}
+		return data, &rev, nil
+	}
+	return nil, nil, ErrRevisionNotFound
+}
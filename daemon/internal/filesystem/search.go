@@ -0,0 +1,194 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultSearchFileSize is the largest file whose contents are searched unless asked otherwise
+	DefaultSearchFileSize = 1 << 20
+	// MaxSearchFileSize caps the size a caller may ask for
+	MaxSearchFileSize = 16 << 20
+	// DefaultSearchResults stops a search that matches almost everything
+	DefaultSearchResults = 1000
+
+	// Lines longer than this are cut in results; the match is still reported
+	maxResultLine = 500
+	// binarySniff is how much of a file is checked for NUL bytes
+	binarySniff = 8000
+)
+
+// ErrSearchLimit ends a search once it has produced enough results
+var ErrSearchLimit = errors.New("search result limit reached")
+
+// SearchOptions describe what to look for. Name is a glob matched against file names, Query a
+// literal or (with Regex) a regular expression matched against lines; at least one is needed.
+type SearchOptions struct {
+	Root          string
+	Name          string
+	Query         string
+	Regex         bool
+	CaseSensitive bool
+	MaxFileSize   int64
+	MaxResults    int
+}
+
+// SearchResult is a file whose name matched, or a matching line when Line is set
+type SearchResult struct {
+	Path string `json:"path"`
+	Line int    `json:"line,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// SearchStats summarise a finished search
+type SearchStats struct {
+	FilesScanned int  `json:"files_scanned"`
+	Results      int  `json:"results"`
+	Truncated    bool `json:"truncated"`
+}
+
+// CompileSearch checks the options and returns the line matcher, nil when only names are matched
+func CompileSearch(opts *SearchOptions) (func(string) bool, error) {
+	if opts.Name == "" && opts.Query == "" {
+		return nil, errors.New("a name pattern or a query is required")
+	}
+	if opts.Name != "" {
+		if _, err := path.Match(opts.Name, ""); err != nil {
+			return nil, errors.New("invalid name pattern")
+		}
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = DefaultSearchFileSize
+	}
+	if opts.MaxFileSize > MaxSearchFileSize {
+		opts.MaxFileSize = MaxSearchFileSize
+	}
+	if opts.MaxResults <= 0 || opts.MaxResults > DefaultSearchResults {
+		opts.MaxResults = DefaultSearchResults
+	}
+
+	if opts.Query == "" {
+		return nil, nil
+	}
+	if opts.Regex {
+		expr := opts.Query
+		if !opts.CaseSensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.New("invalid regular expression")
+		}
+		return re.MatchString, nil
+	}
+	if opts.CaseSensitive {
+		return func(line string) bool { return strings.Contains(line, opts.Query) }, nil
+	}
+	query := strings.ToLower(opts.Query)
+	return func(line string) bool { return strings.Contains(strings.ToLower(line), query) }, nil
+}
+
+// Search walks Root without following symlinks and hands every match to emit as it is found.
+// Binary files, files over MaxFileSize and daemon metadata are skipped. The walk stops when ctx
+// is cancelled, emit fails or MaxResults is reached.
+func (f *Filesystem) Search(ctx context.Context, opts SearchOptions, emit func(SearchResult) error) (SearchStats, error) {
+	var stats SearchStats
+	matchLine, err := CompileSearch(&opts)
+	if err != nil {
+		return stats, err
+	}
+
+	send := func(result SearchResult) error {
+		if stats.Results >= opts.MaxResults {
+			stats.Truncated = true
+			return ErrSearchLimit
+		}
+		stats.Results++
+		return emit(result)
+	}
+
+	err = fs.WalkDir(f.root.FS(), Clean(opts.Root), func(p string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// Unreadable directories are skipped rather than ending the search
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if IsMetadata(p) || f.Denied(p) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		if opts.Name != "" {
+			if ok, _ := path.Match(opts.Name, entry.Name()); !ok {
+				return nil
+			}
+		}
+		stats.FilesScanned++
+		if matchLine == nil {
+			return send(SearchResult{Path: p})
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Size() > opts.MaxFileSize {
+			return nil
+		}
+		return f.searchFile(ctx, p, matchLine, send)
+	})
+	if errors.Is(err, ErrSearchLimit) {
+		err = nil
+	}
+	return stats, err
+}
+
+func (f *Filesystem) searchFile(ctx context.Context, p string, matchLine func(string) bool, send func(SearchResult) error) error {
+	file, err := f.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64<<10)
+	head, _ := reader.Peek(binarySniff)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64<<10), MaxSearchFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		if line%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		text := scanner.Text()
+		if !matchLine(text) {
+			continue
+		}
+		if len(text) > maxResultLine {
+			text = text[:maxResultLine]
+		}
+		if err := send(SearchResult{Path: p, Line: line, Text: text}); err != nil {
+			return err
+		}
+	}
+	// A read error or an overlong line just ends this file
+	return nil
+}
@@ -0,0 +1,216 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/luketaylor45/atlas/daemon/internal/config"
+)
+
+// TrashDir holds deleted files until they are restored or purged. Being daemon metadata it is
+// left out of listings, but it still counts towards the disk limit.
+const TrashDir = MetadataPrefix + "/trash"
+
+// ErrNotInTrash is returned for a trash ID that does not exist
+var ErrNotInTrash = errors.New("item not found in trash")
+
+var trashIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// TrashItem is a deleted file or directory
+type TrashItem struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"` // Where it was deleted from
+	IsDir     bool      `json:"is_dir"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func trashDataPath(id string) string { return TrashDir + "/" + id }
+func trashMetaPath(id string) string { return TrashDir + "/" + id + ".json" }
+
+// Trash moves p into the trash, from where it can be restored until it is purged
+func (f *Filesystem) Trash(p string) (*TrashItem, error) {
+	p = Clean(p)
+	if p == "." {
+		return nil, ErrRoot
+	}
+	if IsMetadata(p) {
+		return nil, ErrOutsideRoot
+	}
+	info, err := f.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	size, err := f.Usage(p)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	item := &TrashItem{ID: hex.EncodeToString(id), Path: p, IsDir: info.IsDir(), Size: size, DeletedAt: time.Now()}
+
+	if err := f.MkdirAll(TrashDir, 0700); err != nil {
+		return nil, err
+	}
+	meta, _ := json.Marshal(item)
+	if err := f.WriteFile(trashMetaPath(item.ID), meta, 0600); err != nil {
+		return nil, err
+	}
+	if err := f.Rename(p, trashDataPath(item.ID)); err != nil {
+		f.Remove(trashMetaPath(item.ID))
+		return nil, err
+	}
+	return item, nil
+}
+
+// ListTrash returns the items in the trash, most recently deleted first
+func (f *Filesystem) ListTrash() ([]TrashItem, error) {
+	entries, err := f.ReadDir(TrashDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []TrashItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := []TrashItem{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !trashIDPattern.MatchString(id) {
+			continue
+		}
+		if item, err := f.trashItem(id); err == nil {
+			items = append(items, *item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+func (f *Filesystem) trashItem(id string) (*TrashItem, error) {
+	if !trashIDPattern.MatchString(id) {
+		return nil, ErrNotInTrash
+	}
+	meta, err := f.ReadFile(trashMetaPath(id))
+	if err != nil {
+		return nil, ErrNotInTrash
+	}
+	var item TrashItem
+	if err := json.Unmarshal(meta, &item); err != nil {
+		return nil, fmt.Errorf("trash item %s is corrupt: %w", id, err)
+	}
+	item.ID = id
+	return &item, nil
+}
+
+// RestoreTrash moves an item out of the trash, to where it was deleted from unless to is given.
+// An existing file at the destination is never replaced.
+func (f *Filesystem) RestoreTrash(id, to string) (*TrashItem, error) {
+	item, err := f.trashItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if to == "" {
+		to = item.Path
+	}
+	to = Clean(to)
+	if to == "." {
+		return nil, ErrRoot
+	}
+	if IsMetadata(to) {
+		return nil, ErrOutsideRoot
+	}
+	if f.Exists(to) {
+		return nil, fmt.Errorf("%s: %w", to, os.ErrExist)
+	}
+
+	if err := f.MkdirAll(path.Dir(to), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.Rename(trashDataPath(id), to); err != nil {
+		return nil, err
+	}
+	f.Remove(trashMetaPath(id))
+	item.Path = to
+	return item, nil
+}
+
+// PurgeTrash deletes an item in the trash for good
+func (f *Filesystem) PurgeTrash(id string) error {
+	if _, err := f.trashItem(id); err != nil {
+		return err
+	}
+	if err := f.RemoveAll(trashDataPath(id)); err != nil {
+		return err
+	}
+	return f.Remove(trashMetaPath(id))
+}
+
+// EmptyTrash purges every item deleted more than olderThan ago, or all of them when olderThan
+// is 0. It returns how many items were purged.
+func (f *Filesystem) EmptyTrash(olderThan time.Duration) (int, error) {
+	items, err := f.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, item := range items {
+		if olderThan > 0 && time.Since(item.DeletedAt) < olderThan {
+			continue
+		}
+		if err := f.PurgeTrash(item.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartTrashPurge purges trash items older than TRASH_RETENTION_DAYS from every service once an
+// hour. A retention of 0 keeps items until they are purged by hand.
+func StartTrashPurge() {
+	days := config.NodeConfig.TrashRetentionDays
+	if days <= 0 {
+		return
+	}
+	retention := time.Duration(days) * 24 * time.Hour
+
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			purgeExpiredTrash(retention)
+		}
+	}()
+}
+
+func purgeExpiredTrash(retention time.Duration) {
+	entries, err := os.ReadDir(config.NodeConfig.DataPath)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !ValidUUID(entry.Name()) {
+			continue
+		}
+		fs, err := ForService(entry.Name())
+		if err != nil {
+			continue
+		}
+		if purged, err := fs.EmptyTrash(retention); err != nil {
+			log.Printf("[Trash] Failed to purge expired items of %s: %v", entry.Name(), err)
+		} else if purged > 0 {
+			log.Printf("[Trash] Purged %d expired item(s) of %s", purged, entry.Name())
+		}
+		fs.Close()
+	}
+}
@@ -6,14 +6,13 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
-	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
 )
 
 type Installer struct {
@@ -39,18 +38,12 @@ func (i *Installer) Install(ctx context.Context, uuid string, installImage strin
 	reader.Close()
 
 	// 2. Prepare Data Directory
-	hostDataDir := filepath.Join(config.NodeConfig.DataPath, uuid)
-	if err := os.MkdirAll(hostDataDir, 0755); err != nil {
+	fs, err := filesystem.CreateForService(uuid)
+	if err != nil {
 		return fmt.Errorf("failed to create data directory: %v", err)
 	}
-
-	// Force ownership so no permission errors when installing
-	uid := 1000
-	gid := 1000
-
-	if err := os.Chown(hostDataDir, uid, gid); err != nil {
-		return fmt.Errorf("failed to set directory ownership: %v", err)
-	}
+	defer fs.Close()
+	hostDataDir := fs.Dir()
 
 	// 3. Prepare Environment
 	// Add default required env vars for the script
@@ -131,6 +124,15 @@ func (i *Installer) Install(ctx context.Context, uuid string, installImage strin
 		}
 	}
 
+	// Install scripts run as root, so hand everything they created to the container user
+	stats, err := fs.FixPermissions(ctx, ".")
+	if err != nil {
+		return fmt.Errorf("failed to fix file ownership: %v", err)
+	}
+	if stats.Failed > 0 {
+		log.Printf("[Installer] Could not fix ownership of %d files for %s", stats.Failed, uuid)
+	}
+
 	log.Printf("[Installer] Installation completed successfully for %s", uuid)
 	return nil
 }
@@ -0,0 +1,232 @@
+package sftp
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
+	"github.com/pkg/sftp"
+)
+
+// jail serves one service directory over SFTP. Paths go through the service's filesystem, so
+// "/" is the service root and symlinks or ".." can never reach the rest of the node.
+type jail struct {
+	fs       *filesystem.Filesystem
+	readOnly bool
+}
+
+func newJail(dir string, readOnly bool, deny *filesystem.Denylist) (*jail, error) {
+	fs, err := filesystem.New(dir)
+	if err != nil {
+		return nil, err
+	}
+	fs.SetDenylist(deny)
+	return &jail{fs: fs, readOnly: readOnly}, nil
+}
+
+func (j *jail) Close() error {
+	return j.fs.Close()
+}
+
+func (j *jail) handlers() sftp.Handlers {
+	return sftp.Handlers{FileGet: j, FilePut: j, FileCmd: j, FileList: j}
+}
+
+// check hides daemon metadata and denied files, and refuses changes to read-only users
+func (j *jail) check(p string, write bool) error {
+	if filesystem.IsMetadata(p) || j.fs.Denied(p) {
+		return os.ErrNotExist
+	}
+	if write && j.readOnly {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	return nil
+}
+
+// Fileread opens a file for download
+func (j *jail) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	if err := j.check(r.Filepath, false); err != nil {
+		return nil, err
+	}
+	return j.fs.Open(r.Filepath)
+}
+
+// Filewrite opens a file for upload
+func (j *jail) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return j.OpenFile(r)
+}
+
+// OpenFile opens a file with the flags the client asked for
+func (j *jail) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	flags := r.Pflags()
+	if err := j.check(r.Filepath, flags.Write); err != nil {
+		return nil, err
+	}
+
+	// O_APPEND is left out: SFTP writes carry their own offsets and os.File refuses WriteAt with it
+	osFlags := os.O_RDONLY
+	switch {
+	case flags.Read && flags.Write:
+		osFlags = os.O_RDWR
+	case flags.Write:
+		osFlags = os.O_WRONLY
+	}
+	if flags.Creat {
+		osFlags |= os.O_CREATE
+	}
+	if flags.Trunc {
+		osFlags |= os.O_TRUNC
+	}
+	if flags.Excl {
+		osFlags |= os.O_EXCL
+	}
+
+	return j.fs.OpenFile(r.Filepath, osFlags, 0644)
+}
+
+// Filecmd handles everything that changes the tree without transferring data
+func (j *jail) Filecmd(r *sftp.Request) error {
+	if err := j.check(r.Filepath, true); err != nil {
+		return err
+	}
+
+	switch r.Method {
+	case "Setstat":
+		return j.setstat(r)
+	case "Rename", "PosixRename":
+		if err := j.check(r.Target, true); err != nil {
+			return err
+		}
+		return j.fs.Rename(r.Filepath, r.Target)
+	case "Rmdir":
+		info, err := j.fs.Lstat(r.Filepath)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return sftp.ErrSSHFxFailure
+		}
+		return j.fs.Remove(r.Filepath)
+	case "Remove":
+		return j.fs.Remove(r.Filepath)
+	case "Mkdir":
+		return j.fs.Mkdir(r.Filepath, 0755)
+	case "Link":
+		if err := j.check(r.Target, true); err != nil {
+			return err
+		}
+		return j.fs.Link(r.Filepath, r.Target)
+	case "Symlink":
+		// Filepath is the link target as sent by the client and Target is the new link
+		if err := j.check(r.Target, true); err != nil {
+			return err
+		}
+		if !filesystem.SymlinkStaysInside(r.Target, r.Filepath) || filesystem.IsMetadata(path.Join(path.Dir(r.Target), r.Filepath)) {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		return j.fs.Symlink(r.Filepath, r.Target)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (j *jail) setstat(r *sftp.Request) error {
+	name := r.Filepath
+	flags := r.AttrFlags()
+	attrs := r.Attributes()
+
+	if flags.UidGid {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	if flags.Size {
+		file, err := j.fs.OpenFile(name, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = file.Truncate(int64(attrs.Size))
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := j.fs.Chmod(name, os.FileMode(attrs.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		if err := j.fs.Chtimes(name, attrs.AccessTime(), attrs.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Filelist answers List and Stat requests
+func (j *jail) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if err := j.check(r.Filepath, false); err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case "List":
+		entries, err := j.fs.ReadDir(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		atRoot := filesystem.IsRoot(r.Filepath)
+		files := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			if atRoot && strings.HasPrefix(entry.Name(), filesystem.MetadataPrefix) {
+				continue
+			}
+			if j.fs.Denied(path.Join(r.Filepath, entry.Name())) {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				files = append(files, info)
+			}
+		}
+		return listerAt(files), nil
+	case "Stat":
+		info, err := j.fs.Stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// Lstat stats a path without following a final symlink
+func (j *jail) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	if err := j.check(r.Filepath, false); err != nil {
+		return nil, err
+	}
+	info, err := j.fs.Lstat(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	return listerAt{info}, nil
+}
+
+// Readlink returns a symlink's target as stored
+func (j *jail) Readlink(p string) (string, error) {
+	if err := j.check(p, false); err != nil {
+		return "", err
+	}
+	return j.fs.Readlink(p)
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(out []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(out, l[offset:])
+	if n < len(out) || offset+int64(n) >= int64(len(l)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
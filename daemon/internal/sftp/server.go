@@ -3,7 +3,9 @@ package sftp
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/subtle"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io"
@@ -11,9 +13,11 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/luketaylor45/atlas/daemon/internal/config"
+	"github.com/luketaylor45/atlas/daemon/internal/filesystem"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
@@ -21,9 +25,32 @@ import (
 type SFTPServer struct {
 	Port    string
 	DataDir string
+
+	// HostKeyFingerprint is the SHA256 fingerprint of the host key, available after Start
+	HostKeyFingerprint string
+}
+
+// AuthResult is Core's answer to an SFTP login attempt
+type AuthResult struct {
+	Valid        bool
+	ServiceUUID  string
+	TOTPRequired bool     // Password was accepted but the account needs a two-factor code
+	ReadOnly     bool     // Sub-users without file management can only download
+	FileDenylist []string // Egg patterns the user can't see or touch; empty for admins
+}
+
+// AuthRequest is an SFTP login attempt passed to Core for validation
+type AuthRequest struct {
+	Username string
+	Password string
+	TOTPCode string
+	ClientIP string
+
+	PublicKey   string // SHA256 fingerprint, for public key logins
+	KeyVerified bool   // The client has signed with PublicKey, so this is a real login
 }
 
-type AuthValidator func(username, password string) (bool, string) // Returns (valid, serviceUUID)
+type AuthValidator func(req AuthRequest) AuthResult
 
 var authCallback AuthValidator
 
@@ -46,6 +73,7 @@ func (s *SFTPServer) Start() error {
 	if err != nil {
 		return fmt.Errorf("failed to load host key: %v", err)
 	}
+	s.HostKeyFingerprint = ssh.FingerprintSHA256(hostKey.PublicKey())
 
 	// SSH server configuration
 	sshConfig := &ssh.ServerConfig{
@@ -55,29 +83,40 @@ func (s *SFTPServer) Start() error {
 
 			// Try user-based authentication first (via Core API)
 			if authCallback != nil {
-				if valid, uuid := authCallback(username, password); valid {
-					log.Printf("[SFTP] ✓ User Authenticated: %s (Service: %s)", username, uuid)
-
-					// Verify service directory exists
-					serviceDir := filepath.Join(s.DataDir, uuid)
-					if _, err := os.Stat(serviceDir); os.IsNotExist(err) {
-						log.Printf("[SFTP] Service directory not found: %s", uuid)
-						return nil, fmt.Errorf("service not found")
-					}
+				req := AuthRequest{Username: username, Password: password, ClientIP: remoteIP(c.RemoteAddr())}
+				result := authCallback(req)
+				if result.Valid {
+					return s.userPermissions(username, result)
+				}
 
-					return &ssh.Permissions{
-						Extensions: map[string]string{
-							"uuid":     uuid,
-							"username": username,
+				// Ask for the two-factor code as a second, keyboard-interactive step
+				if result.TOTPRequired {
+					return nil, &ssh.PartialSuccessError{
+						Next: ssh.ServerAuthCallbacks{
+							KeyboardInteractiveCallback: func(c ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+								answers, err := challenge("", "Two-factor authentication is enabled for this account.", []string{"Authentication code: "}, []bool{true})
+								if err != nil || len(answers) != 1 {
+									return nil, fmt.Errorf("invalid credentials")
+								}
+								req.TOTPCode = answers[0]
+								if result := authCallback(req); result.Valid {
+									return s.userPermissions(username, result)
+								}
+								log.Printf("[SFTP] Two-factor authentication failed for: %s", username)
+								return nil, fmt.Errorf("invalid credentials")
+							},
 						},
-					}, nil
+					}
 				}
 			}
 
 			// Fallback: Legacy format service_<UUID> with node token
-			if strings.HasPrefix(username, "service_") && password == config.NodeConfig.NodeToken {
+			if strings.HasPrefix(username, "service_") && subtle.ConstantTimeCompare(pass, []byte(config.CurrentToken())) == 1 {
 				uuid := strings.TrimPrefix(username, "service_")
-				serviceDir := filepath.Join(s.DataDir, uuid)
+				serviceDir, err := s.serviceDir(uuid)
+				if err != nil {
+					return nil, fmt.Errorf("invalid credentials")
+				}
 				if _, err := os.Stat(serviceDir); os.IsNotExist(err) {
 					log.Printf("[SFTP] Service directory not found: %s", uuid)
 					return nil, fmt.Errorf("service not found")
@@ -86,8 +125,9 @@ func (s *SFTPServer) Start() error {
 				log.Printf("[SFTP] ✓ Legacy Auth: %s", username)
 				return &ssh.Permissions{
 					Extensions: map[string]string{
-						"uuid":     uuid,
-						"username": "legacy",
+						"uuid":      uuid,
+						"username":  "legacy",
+						"read_only": "false",
 					},
 				}, nil
 			}
@@ -95,6 +135,29 @@ func (s *SFTPServer) Start() error {
 			log.Printf("[SFTP] Authentication failed for: %s", username)
 			return nil, fmt.Errorf("invalid credentials")
 		},
+
+		// Offered keys are checked with Core before the client proves it holds them
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authCallback == nil {
+				return nil, fmt.Errorf("invalid credentials")
+			}
+			result := authCallback(AuthRequest{Username: c.User(), PublicKey: ssh.FingerprintSHA256(key), ClientIP: remoteIP(c.RemoteAddr())})
+			if !result.Valid {
+				return nil, fmt.Errorf("invalid credentials")
+			}
+			return &ssh.Permissions{}, nil
+		},
+
+		// Once the signature checks out, Core records the login and picks the service
+		VerifiedPublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey, _ *ssh.Permissions, _ string) (*ssh.Permissions, error) {
+			username := c.User()
+			result := authCallback(AuthRequest{Username: username, PublicKey: ssh.FingerprintSHA256(key), KeyVerified: true, ClientIP: remoteIP(c.RemoteAddr())})
+			if !result.Valid {
+				log.Printf("[SFTP] Public key authentication failed for: %s", username)
+				return nil, fmt.Errorf("invalid credentials")
+			}
+			return s.userPermissions(username, result)
+		},
 	}
 
 	sshConfig.AddHostKey(hostKey)
@@ -106,7 +169,8 @@ func (s *SFTPServer) Start() error {
 	}
 
 	log.Printf("[SFTP] Server listening on port %s", s.Port)
-	log.Printf("[SFTP] Authentication: Username-based with per-user passwords")
+	log.Printf("[SFTP] Host key fingerprint: %s", s.HostKeyFingerprint)
+	log.Printf("[SFTP] Authentication: Username-based with per-user passwords or SSH keys")
 
 	// Accept connections
 	go func() {
@@ -124,6 +188,55 @@ func (s *SFTPServer) Start() error {
 	return nil
 }
 
+// serviceDir returns the data directory of a service, refusing identifiers that could leave DataDir
+func (s *SFTPServer) serviceDir(uuid string) (string, error) {
+	if !filesystem.ValidUUID(uuid) {
+		return "", filesystem.ErrInvalidUUID
+	}
+	return filepath.Join(s.DataDir, uuid), nil
+}
+
+// remoteIP strips the port from a connection's remote address
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// userPermissions builds the session permissions for a user Core has authenticated
+func (s *SFTPServer) userPermissions(username string, result AuthResult) (*ssh.Permissions, error) {
+	uuid := result.ServiceUUID
+	log.Printf("[SFTP] ✓ User Authenticated: %s (Service: %s, Read-only: %t)", username, uuid, result.ReadOnly)
+
+	// Verify service directory exists
+	serviceDir, err := s.serviceDir(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(serviceDir); os.IsNotExist(err) {
+		log.Printf("[SFTP] Service directory not found: %s", uuid)
+		return nil, fmt.Errorf("service not found")
+	}
+
+	// A denylist the daemon can't apply refuses the login rather than exposing the files
+	if _, err := filesystem.ParseDenylist(result.FileDenylist); err != nil {
+		log.Printf("[SFTP] Invalid file denylist for service %s: %v", uuid, err)
+		return nil, err
+	}
+	denylist, _ := json.Marshal(result.FileDenylist)
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			"uuid":          uuid,
+			"username":      username,
+			"read_only":     strconv.FormatBool(result.ReadOnly),
+			"file_denylist": string(denylist),
+		},
+	}, nil
+}
+
 func (s *SFTPServer) handleConnection(netConn net.Conn, config *ssh.ServerConfig) {
 	defer netConn.Close()
 
@@ -137,7 +250,17 @@ func (s *SFTPServer) handleConnection(netConn net.Conn, config *ssh.ServerConfig
 	// Get UUID and username from permissions
 	uuid := sshConn.Permissions.Extensions["uuid"]
 	username := sshConn.Permissions.Extensions["username"]
-	serviceRoot := filepath.Join(s.DataDir, uuid)
+	readOnly := sshConn.Permissions.Extensions["read_only"] != "false"
+	var patterns []string
+	json.Unmarshal([]byte(sshConn.Permissions.Extensions["file_denylist"]), &patterns)
+	deny, err := filesystem.ParseDenylist(patterns)
+	if err != nil {
+		return
+	}
+	serviceRoot, err := s.serviceDir(uuid)
+	if err != nil {
+		return
+	}
 
 	log.Printf("[SFTP] Connection established: User=%s, Service=%s, IP=%s", username, uuid, netConn.RemoteAddr().String())
 
@@ -171,24 +294,22 @@ func (s *SFTPServer) handleConnection(netConn net.Conn, config *ssh.ServerConfig
 			}
 		}(requests)
 
-		// Create SFTP server with chroot to service directory
-		server, err := sftp.NewServer(
-			channel,
-			sftp.WithServerWorkingDirectory(serviceRoot),
-		)
+		// Serve SFTP from a jail rooted at the service directory
+		fs, err := newJail(serviceRoot, readOnly, deny)
 		if err != nil {
-			log.Printf("[SFTP] Failed to create SFTP server: %v", err)
+			log.Printf("[SFTP] Failed to open service directory: %v", err)
 			channel.Close()
 			continue
 		}
+		server := sftp.NewRequestServer(channel, fs.handlers())
 
-		// Serve SFTP
 		if err := server.Serve(); err == io.EOF {
-			server.Close()
 			log.Printf("[SFTP] Connection closed: User=%s, Service=%s", username, uuid)
 		} else if err != nil {
 			log.Printf("[SFTP] Server error: %v", err)
 		}
+		server.Close()
+		fs.Close()
 	}
 }
 
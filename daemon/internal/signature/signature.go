@@ -0,0 +1,170 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers carried by every signed request between Core and the daemon
+const (
+	HeaderKey       = "X-Atlas-Key"
+	HeaderTimestamp = "X-Atlas-Timestamp"
+	HeaderNonce     = "X-Atlas-Nonce"
+	HeaderContent   = "X-Atlas-Content-SHA256"
+	HeaderSignature = "X-Atlas-Signature"
+
+	// HeaderDenylist carries the file denylist Core wants applied to a file request
+	HeaderDenylist = "X-Atlas-File-Denylist"
+
+	// UnsignedPayload is sent instead of a body hash for streamed uploads
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// MaxClockSkew is how far a request timestamp may drift from our clock
+	MaxClockSkew = 5 * time.Minute
+)
+
+// SignedHeaders are the request headers covered by the signature, along with the request line and body.
+// A header that is left out signs as empty.
+var SignedHeaders = []string{HeaderDenylist}
+
+// KeyLabel separates the signing key from the token hash Core stores to recognise tokens
+const KeyLabel = "atlas-request-signing"
+
+// DeriveKey turns a node token into the HMAC key used for signing
+func DeriveKey(token string) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(KeyLabel))
+	return mac.Sum(nil)
+}
+
+// KeyID returns the public part of a token that identifies it in the X-Atlas-Key header
+func KeyID(token string) string {
+	if len(token) > 10 {
+		return token[:10]
+	}
+	return token
+}
+
+// HashBody returns the hex SHA-256 of a request body
+func HashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Canonical returns the string a request's signature is computed over
+func Canonical(method, uri, timestamp, nonce, contentHash string, header http.Header) string {
+	parts := []string{method, uri, timestamp, nonce, contentHash}
+	for _, name := range SignedHeaders {
+		parts = append(parts, strings.ToLower(name)+":"+header.Get(name))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Compute returns the hex HMAC over the canonical request
+func Compute(key []byte, method, uri, timestamp, nonce, contentHash string, header http.Header) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(Canonical(method, uri, timestamp, nonce, contentHash, header)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign adds the signature headers for body to req
+func Sign(req *http.Request, token string, body []byte) {
+	signWithHash(req, token, HashBody(body))
+}
+
+// SignUnsignedPayload signs everything but the body, for requests that stream large uploads
+func SignUnsignedPayload(req *http.Request, token string) {
+	signWithHash(req, token, UnsignedPayload)
+}
+
+func signWithHash(req *http.Request, token string, contentHash string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newNonce()
+
+	req.Header.Set(HeaderKey, KeyID(token))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderContent, contentHash)
+	req.Header.Set(HeaderSignature, Compute(DeriveKey(token), req.Method, req.URL.RequestURI(), timestamp, nonce, contentHash, req.Header))
+}
+
+// Verify checks the timestamp and signature of r against key.
+// contentHash must be computed from the body actually received (or be UnsignedPayload).
+func Verify(key []byte, r *http.Request, contentHash string) error {
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("missing signature headers")
+	}
+
+	if _, err := ParseTimestamp(timestamp); err != nil {
+		return err
+	}
+
+	expected := Compute(key, r.Method, r.URL.RequestURI(), timestamp, nonce, contentHash, r.Header)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// ParseTimestamp parses a unix timestamp header and rejects it if outside the allowed skew
+func ParseTimestamp(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("invalid timestamp")
+	}
+	ts := time.Unix(seconds, 0)
+	if d := time.Since(ts); d > MaxClockSkew || d < -MaxClockSkew {
+		return time.Time{}, errors.New("request timestamp outside allowed clock skew")
+	}
+	return ts, nil
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NonceCache remembers nonces for as long as their timestamp would be accepted
+type NonceCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{seen: make(map[string]time.Time)}
+}
+
+// Use records a nonce and returns false if it has already been used
+func (c *NonceCache) Use(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		c.lastSweep = now
+		for n, expires := range c.seen {
+			if now.After(expires) {
+				delete(c.seen, n)
+			}
+		}
+	}
+
+	if expires, ok := c.seen[nonce]; ok && now.Before(expires) {
+		return false
+	}
+	c.seen[nonce] = now.Add(2 * MaxClockSkew)
+	return true
+}
@@ -6,6 +6,7 @@ import SetupPage from './pages/setup/Setup';
 import Dashboard from './pages/dashboard/Dashboard';
 import MyServices from './pages/dashboard/MyServices';
 import ServiceConsolePage from './pages/dashboard/ServiceConsole';
+import CreateServerPage from './pages/dashboard/CreateServer';
 import AdminLayout from './pages/admin/AdminLayout';
 import NodesPage from './pages/admin/Nodes';
 import CreateNodePage from './pages/admin/CreateNode';
@@ -17,6 +18,8 @@ import AdminNewsPage from './pages/admin/News';
 import SettingsPage from './pages/dashboard/Settings';
 import ImportEggPage from './pages/admin/ImportEgg';
 import AdminEggsPage from './pages/admin/Eggs';
+import AdminDatabaseHostsPage from './pages/admin/DatabaseHosts';
+import AdminLocationsPage from './pages/admin/Locations';
 import { AuthProvider } from './context/AuthContext';
 
 import RequireAuth from './components/RequireAuth';
@@ -37,6 +40,7 @@ function App() {
           }>
             <Route index element={<Dashboard />} />
             <Route path="services" element={<MyServices />} />
+            <Route path="services/create" element={<CreateServerPage />} />
             <Route path="services/:uuid" element={<ServiceConsolePage />} />
             <Route path="settings" element={<SettingsPage />} />
 
@@ -45,10 +49,12 @@ function App() {
               <Route index element={<AdminOverviewPage />} />
               <Route path="nodes" element={<NodesPage />} />
               <Route path="nodes/create" element={<CreateNodePage />} />
+              <Route path="locations" element={<AdminLocationsPage />} />
               <Route path="services" element={<AdminServicesPage />} />
               <Route path="services/create" element={<CreateServicePage />} />
               <Route path="eggs" element={<AdminEggsPage />} />
               <Route path="eggs/import" element={<ImportEggPage />} />
+              <Route path="databases" element={<AdminDatabaseHostsPage />} />
               <Route path="users" element={<AdminUsersPage />} />
               <Route path="news" element={<AdminNewsPage />} />
             </Route>
@@ -1,5 +1,5 @@
 import { Outlet, Link, useLocation } from 'react-router-dom';
-import { Home, Settings, LogOut, LayoutDashboard, Users, Layers, Activity, Package, Bell } from 'lucide-react';
+import { Home, Settings, LogOut, LayoutDashboard, Users, Layers, Activity, Package, Bell, Database, MapPin } from 'lucide-react';
 import clsx from 'clsx';
 import { useAuth } from '../context/AuthContext';
 import Logo from './Logo';
@@ -44,8 +44,10 @@ export default function Layout() {
                             <div className="text-xs font-semibold text-muted uppercase tracking-wider pl-3 mb-2 mt-6">Administration</div>
                             <SidebarItem icon={LayoutDashboard} label="Overview" to="/admin" />
                             <SidebarItem icon={Activity} label="Nodes" to="/admin/nodes" />
+                            <SidebarItem icon={MapPin} label="Locations" to="/admin/locations" />
                             <SidebarItem icon={Layers} label="Services" to="/admin/services" />
                             <SidebarItem icon={Package} label="Eggs & Nests" to="/admin/eggs" />
+                            <SidebarItem icon={Database} label="Databases" to="/admin/databases" />
                             <SidebarItem icon={Users} label="Users" to="/admin/users" />
                             <SidebarItem icon={Bell} label="Announcements" to="/admin/news" />
                         </>
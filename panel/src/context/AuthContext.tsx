@@ -1,5 +1,5 @@
 import { createContext, useContext, useState, useEffect, type ReactNode } from 'react';
-// import api from '../lib/api'; // Not strictly needed here unless we validate token with API call on load
+import api from '../lib/api';
 
 interface User {
     id: number;
@@ -11,7 +11,7 @@ interface AuthContextType {
     user: User | null;
     token: string | null;
     loading: boolean;
-    login: (token: string, user: User) => void;
+    login: (token: string, user: User, refreshToken?: string) => void;
     logout: () => void;
 }
 
@@ -34,15 +34,21 @@ export function AuthProvider({ children }: { children: ReactNode }) {
         setLoading(false);
     }, []);
 
-    const login = (newToken: string, newUser: User) => {
+    const login = (newToken: string, newUser: User, refreshToken?: string) => {
         localStorage.setItem('token', newToken);
+        if (refreshToken) {
+            localStorage.setItem('refresh_token', refreshToken);
+        }
         localStorage.setItem('user', JSON.stringify(newUser));
         setToken(newToken);
         setUser(newUser);
     };
 
     const logout = () => {
+        // End the session server-side too; the local state is cleared either way
+        api.post('/account/logout').catch(() => {});
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         localStorage.removeItem('user');
         setToken(null);
         setUser(null);
@@ -15,6 +15,8 @@ if (isProd) {
     base = 'http://localhost:8080/api/v1';
 }
 
+export const apiBase = base;
+
 const api = axios.create({
     baseURL: base,
     headers: {
@@ -31,10 +33,40 @@ api.interceptors.request.use((config) => {
     return config;
 });
 
+// Access tokens are short lived; swap the refresh token for a new pair when one expires.
+// Concurrent 401s share a single refresh request.
+let refreshing: Promise<string | null> | null = null;
+
+async function refreshAccessToken(): Promise<string | null> {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken) return null;
+
+    try {
+        const res = await axios.post(`${base}/auth/refresh`, { refresh_token: refreshToken });
+        localStorage.setItem('token', res.data.token);
+        localStorage.setItem('refresh_token', res.data.refresh_token);
+        return res.data.token;
+    } catch {
+        localStorage.removeItem('refresh_token');
+        return null;
+    }
+}
+
 // Response interceptor to handle 401s
 api.interceptors.response.use(
     (response) => response,
-    (error) => {
+    async (error) => {
+        const original = error.config;
+        if (error.response?.status === 401 && original && !original._retried && !original.url?.startsWith('/auth/')) {
+            original._retried = true;
+            refreshing = refreshing || refreshAccessToken().finally(() => { refreshing = null; });
+            const token = await refreshing;
+            if (token) {
+                original.headers.Authorization = `Bearer ${token}`;
+                return api(original);
+            }
+        }
+
         if (error.response?.status === 401) {
             localStorage.removeItem('token');
             // Optional: Redirect to login or window.location.href = '/login';
@@ -1,4 +1,4 @@
-import { useState } from 'react';
+import { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import api from '../../lib/api';
 import { Server, Cpu, MapPin, Globe } from 'lucide-react';
@@ -16,14 +16,14 @@ export default function CreateNodePage() {
         sftp_port: '2022',
         total_ram: 1024,
         total_disk: 10240,
-        location: 'Unknown'
+        location_id: 0
     });
 
-    const regions = [
-        { code: 'US', name: 'North America', icon: '🌎' },
-        { code: 'EU', name: 'Europe', icon: '🌍' },
-        { code: 'AS', name: 'Asia', icon: '🌏' },
-    ];
+    const [locations, setLocations] = useState<any[]>([]);
+
+    useEffect(() => {
+        api.get('/admin/locations').then(res => setLocations(res.data)).catch(() => setLocations([]));
+    }, []);
 
     const [successData, setSuccessData] = useState<{ name: string, token: string } | null>(null);
 
@@ -185,34 +185,29 @@ export default function CreateNodePage() {
                         </h3>
 
                         <div className="grid grid-cols-1 gap-3">
-                            {regions.map(r => (
+                            {locations.map(l => (
                                 <button
-                                    key={r.code}
+                                    key={l.id}
                                     type="button"
-                                    onClick={() => setFormData({ ...formData, location: r.name })}
+                                    onClick={() => setFormData({ ...formData, location_id: formData.location_id === l.id ? 0 : l.id })}
                                     className={clsx(
                                         "flex items-center gap-3 p-3 rounded-xl border transition-all text-left",
-                                        formData.location === r.name
+                                        formData.location_id === l.id
                                             ? "border-emerald-500 bg-emerald-500/10 text-emerald-500"
                                             : "border-border/50 bg-secondary/30 hover:bg-secondary/50 text-muted hover:text-foreground"
                                     )}
                                 >
-                                    <span className="text-xl">{r.icon}</span>
-                                    <span className="font-medium text-sm">{r.name}</span>
+                                    <Globe size={16} />
+                                    <span className="font-medium text-sm">{l.long || l.short}</span>
+                                    <span className="ml-auto text-[10px] font-mono uppercase">{l.short}</span>
                                 </button>
                             ))}
 
-                            <div className="relative mt-2">
-                                <div className="absolute inset-y-0 left-0 pl-3 flex items-center pointer-events-none">
-                                    <Globe size={14} className="text-muted" />
-                                </div>
-                                <input
-                                    className="input-field pl-9"
-                                    placeholder="Custom Location..."
-                                    value={formData.location}
-                                    onChange={e => setFormData({ ...formData, location: e.target.value })}
-                                />
-                            </div>
+                            {locations.length === 0 && (
+                                <p className="text-xs text-muted">
+                                    No locations yet. <button type="button" onClick={() => navigate('/admin/locations')} className="text-primary font-bold hover:underline">Add one</button> to group nodes by where they run.
+                                </p>
+                            )}
                         </div>
                     </div>
 
@@ -5,7 +5,7 @@ import {
     Check, ChevronRight,
     Server, Activity,
     Globe,
-    AlertTriangle
+    AlertTriangle, MapPin
 } from 'lucide-react';
 import clsx from 'clsx';
 
@@ -18,11 +18,13 @@ export default function CreateServicePage() {
     const [nodes, setNodes] = useState<any[]>([]);
     const [nests, setNests] = useState<any[]>([]);
     const [users, setUsers] = useState<any[]>([]);
+    const [locations, setLocations] = useState<any[]>([]);
 
     // Selections
     const [selectedNest, setSelectedNest] = useState<any>(null);
     const [selectedEgg, setSelectedEgg] = useState<any>(null);
     const [selectedNode, setSelectedNode] = useState<any>(null);
+    const [selectedLocation, setSelectedLocation] = useState<any>(null);
     const [selectedUser, setSelectedUser] = useState<any>(null);
     const [name, setName] = useState('');
     const [ram, setRam] = useState(1024);
@@ -34,14 +36,16 @@ export default function CreateServicePage() {
 
     useEffect(() => {
         const fetchData = async () => {
-            const [nRes, nestsRes, uRes] = await Promise.all([
+            const [nRes, nestsRes, uRes, lRes] = await Promise.all([
                 api.get('/admin/nodes'),
                 api.get('/admin/nests'),
-                api.get('/admin/users')
+                api.get('/admin/users'),
+                api.get('/admin/locations')
             ]);
             setNodes(nRes.data);
             setNests(nestsRes.data);
             setUsers(uRes.data);
+            setLocations(lRes.data);
         };
         fetchData();
     }, []);
@@ -69,7 +73,8 @@ export default function CreateServicePage() {
         try {
             await api.post('/admin/services', {
                 name,
-                node_id: selectedNode.id,
+                node_id: selectedNode?.id || 0,
+                location_id: selectedLocation?.id || 0,
                 egg_id: selectedEgg.id,
                 user_id: selectedUser.id,
                 memory: ram,
@@ -294,11 +299,32 @@ export default function CreateServicePage() {
                         {/* Node Selection */}
                         <div className="panel-card p-8 border-border/60">
                             <h3 className="text-xl font-bold mb-8 flex items-center gap-3"><Server className="text-primary" /> Hosting Node</h3>
+                            {locations.some(l => l.nodes > 0) && (
+                                <div className="mb-6 space-y-3">
+                                    <label className="text-[10px] font-bold text-muted uppercase tracking-widest">Any node in a location</label>
+                                    <div className="flex flex-wrap gap-2">
+                                        {locations.filter(l => l.nodes > 0).map(location => (
+                                            <button
+                                                key={location.id}
+                                                type="button"
+                                                onClick={() => { setSelectedLocation(location); setSelectedNode(null); }}
+                                                className={clsx(
+                                                    "flex items-center gap-2 px-4 py-2 rounded-xl border-2 text-sm font-bold transition-all",
+                                                    selectedLocation?.id === location.id ? "border-primary bg-primary/5 text-primary" : "border-border/40 hover:border-primary/20"
+                                                )}
+                                            >
+                                                <MapPin size={14} /> {location.long || location.short}
+                                            </button>
+                                        ))}
+                                    </div>
+                                    <p className="text-[11px] text-muted">Core picks the online node with the most free memory, and a free port if the port is set to 0.</p>
+                                </div>
+                            )}
                             <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
                                 {nodes.map(node => (
                                     <div
                                         key={node.id}
-                                        onClick={() => setSelectedNode(node)}
+                                        onClick={() => { setSelectedNode(node); setSelectedLocation(null); }}
                                         className={clsx(
                                             "p-4 rounded-2xl border-2 transition-all cursor-pointer flex items-center justify-between",
                                             selectedNode?.id === node.id ? "border-primary bg-primary/5" : "border-border/40 hover:border-primary/20"
@@ -310,7 +336,7 @@ export default function CreateServicePage() {
                                             </div>
                                             <div>
                                                 <div className="font-bold text-sm">{node.name}</div>
-                                                <div className="text-[10px] text-muted font-bold uppercase tracking-wider">{node.address}</div>
+                                                <div className="text-[10px] text-muted font-bold uppercase tracking-wider">{node.address}{node.location ? ` · ${node.location.short}` : ''}</div>
                                                 <div className="text-[9px] text-muted font-medium mt-1">
                                                     RAM: {node.total_ram || 0} MB | Disk: {node.total_disk || 0} MB
                                                 </div>
@@ -453,7 +479,7 @@ export default function CreateServicePage() {
                                 </div>
                                 <div className="flex flex-col gap-1">
                                     <span className="text-[10px] font-bold text-muted uppercase tracking-widest">Target Node</span>
-                                    <span className="font-bold text-lg">{selectedNode?.name || "None"}</span>
+                                    <span className="font-bold text-lg">{selectedNode?.name || (selectedLocation ? `Any in ${selectedLocation.long || selectedLocation.short}` : "None")}</span>
                                 </div>
                                 <div className="h-px bg-primary/10" />
                                 <div className="grid grid-cols-2 gap-4">
@@ -472,7 +498,7 @@ export default function CreateServicePage() {
                         <div className="space-y-3">
                             <button
                                 onClick={handleCreate}
-                                disabled={loading || !name || !selectedNode || !selectedUser}
+                                disabled={loading || !name || !(selectedNode || selectedLocation) || !selectedUser}
                                 className="w-full btn-primary !py-5 !rounded-2xl shadow-xl shadow-primary/20 flex items-center justify-center gap-3 font-bold text-lg disabled:opacity-50"
                             >
                                 {loading ? "Deploying..." : "Finalize & Launch"}
@@ -486,10 +512,10 @@ export default function CreateServicePage() {
                             </button>
                         </div>
 
-                        {!selectedNode && (
+                        {!selectedNode && !selectedLocation && (
                             <div className="p-4 rounded-xl bg-amber-500/10 border border-amber-500/20 flex gap-3">
                                 <AlertTriangle size={20} className="text-amber-500 shrink-0" />
-                                <p className="text-xs text-amber-500/80 font-medium leading-relaxed">Please select a hosting node before proceeding with deployment.</p>
+                                <p className="text-xs text-amber-500/80 font-medium leading-relaxed">Please select a hosting node or location before proceeding with deployment.</p>
                             </div>
                         )}
                     </div>
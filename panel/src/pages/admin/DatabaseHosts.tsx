@@ -0,0 +1,229 @@
+import { useState, useEffect } from 'react';
+import api from '../../lib/api';
+import { Database, Plus, Trash2, Edit3, X, PlugZap } from 'lucide-react';
+
+interface DatabaseHost {
+    id: number;
+    name: string;
+    type: string;
+    host: string;
+    port: number;
+    username: string;
+    public_host: string;
+    node_id: number | null;
+    node?: { name: string };
+    max_databases: number;
+    databases: number;
+}
+
+const emptyForm = { name: '', type: 'mysql', host: '', port: 0, username: '', password: '', public_host: '', node_id: 0, max_databases: 0 };
+
+export default function AdminDatabaseHostsPage() {
+    const [hosts, setHosts] = useState<DatabaseHost[]>([]);
+    const [nodes, setNodes] = useState<any[]>([]);
+    const [loading, setLoading] = useState(true);
+    const [showModal, setShowModal] = useState(false);
+    const [saving, setSaving] = useState(false);
+    const [editingId, setEditingId] = useState<number | null>(null);
+    const [form, setForm] = useState(emptyForm);
+
+    const fetchHosts = async () => {
+        try {
+            const res = await api.get('/admin/database-hosts');
+            setHosts(res.data);
+        } catch (err) {
+            console.error(err);
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    useEffect(() => {
+        fetchHosts();
+        api.get('/admin/nodes').then(res => setNodes(res.data)).catch(() => setNodes([]));
+    }, []);
+
+    const openCreate = () => {
+        setEditingId(null);
+        setForm(emptyForm);
+        setShowModal(true);
+    };
+
+    const openEdit = (host: DatabaseHost) => {
+        setEditingId(host.id);
+        setForm({ ...host, password: '', node_id: host.node_id || 0 });
+        setShowModal(true);
+    };
+
+    const handleSubmit = async (e: React.FormEvent) => {
+        e.preventDefault();
+        setSaving(true);
+        const payload = { ...form, port: Number(form.port) || 0, max_databases: Number(form.max_databases) || 0, node_id: form.node_id || null };
+        try {
+            if (editingId) {
+                await api.put(`/admin/database-hosts/${editingId}`, payload);
+            } else {
+                await api.post('/admin/database-hosts', payload);
+            }
+            setShowModal(false);
+            fetchHosts();
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Failed to save database host');
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    const handleTest = async (host: DatabaseHost) => {
+        try {
+            const res = await api.post(`/admin/database-hosts/${host.id}/test`);
+            alert(res.data.ok ? `Connected to ${host.name}` : `Connection failed: ${res.data.error}`);
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Connection test failed');
+        }
+    };
+
+    const handleDelete = async (host: DatabaseHost) => {
+        if (!confirm(`Remove database host ${host.name}?`)) return;
+        try {
+            await api.delete(`/admin/database-hosts/${host.id}`);
+            fetchHosts();
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Delete failed');
+        }
+    };
+
+    if (loading) return <div className="p-12 text-center animate-pulse text-muted uppercase font-bold tracking-widest mt-20">Loading Database Hosts...</div>;
+
+    const inputClass = "w-full bg-secondary/50 border border-border rounded-xl px-4 py-3 text-sm focus:outline-none focus:ring-2 focus:ring-primary/50 transition-all font-medium";
+    const labelClass = "text-[10px] font-bold uppercase tracking-widest text-muted ml-1";
+
+    return (
+        <div className="space-y-8 animation-enter">
+            <div className="flex flex-col md:flex-row md:items-center justify-between gap-6 bg-primary/5 p-8 rounded-3xl border border-primary/20">
+                <div>
+                    <h1 className="text-3xl font-bold tracking-tight flex items-center gap-3">
+                        <Database className="text-primary" size={28} /> Database Hosts
+                    </h1>
+                    <p className="text-muted text-sm font-medium mt-1 pr-10">MySQL, MariaDB and PostgreSQL servers that service owners can create databases on.</p>
+                </div>
+                <button
+                    onClick={openCreate}
+                    className="flex items-center gap-2 bg-primary text-white px-6 py-3 rounded-xl font-bold text-sm hover:scale-105 transition-all shadow-lg shadow-primary/20 shrink-0"
+                >
+                    <Plus size={18} />
+                    Add Host
+                </button>
+            </div>
+
+            <div className="grid grid-cols-1 gap-4 pb-12">
+                {hosts.length === 0 ? (
+                    <div className="py-20 text-center panel-card border-dashed border-2">
+                        <Database size={48} className="mx-auto text-muted mb-4 opacity-20" />
+                        <p className="text-muted font-bold tracking-tight">No database hosts have been added yet.</p>
+                    </div>
+                ) : (
+                    hosts.map(host => (
+                        <div key={host.id} className="panel-card flex flex-col md:flex-row md:items-center justify-between gap-6 p-6 group hover:border-primary/40 transition-all">
+                            <div className="flex items-start gap-5">
+                                <div className="p-3 rounded-2xl shrink-0 mt-1 bg-primary/10 text-primary">
+                                    <Database size={20} />
+                                </div>
+                                <div>
+                                    <div className="flex items-center gap-3 mb-1">
+                                        <h3 className="font-bold text-lg leading-tight group-hover:text-primary transition-colors">{host.name}</h3>
+                                        <span className="text-[9px] font-black uppercase tracking-widest text-muted">{host.type === 'postgres' ? 'PostgreSQL' : 'MySQL'}</span>
+                                    </div>
+                                    <p className="text-xs text-muted font-medium font-mono">{host.username}@{host.host}:{host.port}</p>
+                                    <p className="text-xs text-muted font-medium mt-1">
+                                        {host.node?.name ? `Node ${host.node.name}` : 'All nodes'} · {host.databases}{host.max_databases > 0 ? ` / ${host.max_databases}` : ''} databases
+                                    </p>
+                                </div>
+                            </div>
+                            <div className="flex items-center gap-2 opacity-0 group-hover:opacity-100 transition-opacity">
+                                <button onClick={() => handleTest(host)} className="p-2.5 hover:bg-secondary rounded-xl text-muted hover:text-foreground transition-all border border-transparent hover:border-border" title="Test connection">
+                                    <PlugZap size={16} />
+                                </button>
+                                <button onClick={() => openEdit(host)} className="p-2.5 hover:bg-secondary rounded-xl text-muted hover:text-foreground transition-all border border-transparent hover:border-border">
+                                    <Edit3 size={16} />
+                                </button>
+                                <button onClick={() => handleDelete(host)} className="p-2.5 hover:bg-red-500/10 rounded-xl text-muted hover:text-red-500 transition-all border border-transparent hover:border-red-500/20">
+                                    <Trash2 size={16} />
+                                </button>
+                            </div>
+                        </div>
+                    ))
+                )}
+            </div>
+
+            {showModal && (
+                <div className="fixed inset-0 z-[100] flex items-center justify-center p-6 bg-black/60 backdrop-blur-sm">
+                    <div className="panel-card max-w-2xl w-full p-0 shadow-2xl animation-enter overflow-hidden">
+                        <div className="px-8 py-6 border-b border-border/50 bg-secondary/20 flex items-center justify-between">
+                            <h2 className="text-xl font-bold tracking-tight">{editingId ? 'Edit Database Host' : 'Add Database Host'}</h2>
+                            <button onClick={() => setShowModal(false)} className="p-2 hover:bg-secondary rounded-lg transition-colors">
+                                <X size={20} className="text-muted" />
+                            </button>
+                        </div>
+
+                        <form onSubmit={handleSubmit} className="p-8 space-y-6">
+                            <div className="grid grid-cols-1 md:grid-cols-2 gap-6">
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Name</label>
+                                    <input required value={form.name} onChange={e => setForm({ ...form, name: e.target.value })} className={inputClass} placeholder="EU MariaDB" />
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Type</label>
+                                    <select value={form.type} onChange={e => setForm({ ...form, type: e.target.value })} className={inputClass}>
+                                        <option value="mysql">MySQL / MariaDB</option>
+                                        <option value="postgres">PostgreSQL</option>
+                                    </select>
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Host</label>
+                                    <input required value={form.host} onChange={e => setForm({ ...form, host: e.target.value })} className={inputClass} placeholder="10.0.0.5" />
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Port</label>
+                                    <input type="number" value={form.port || ''} onChange={e => setForm({ ...form, port: parseInt(e.target.value) || 0 })} className={inputClass} placeholder={form.type === 'postgres' ? '5432' : '3306'} />
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Username</label>
+                                    <input required value={form.username} onChange={e => setForm({ ...form, username: e.target.value })} className={inputClass} />
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Password</label>
+                                    <input type="password" value={form.password} onChange={e => setForm({ ...form, password: e.target.value })} className={inputClass} placeholder={editingId ? 'Unchanged' : ''} />
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Public Address</label>
+                                    <input value={form.public_host} onChange={e => setForm({ ...form, public_host: e.target.value })} className={inputClass} placeholder="Shown to users, defaults to host" />
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Linked Node</label>
+                                    <select value={form.node_id} onChange={e => setForm({ ...form, node_id: parseInt(e.target.value) })} className={inputClass}>
+                                        <option value={0}>All nodes</option>
+                                        {nodes.map(n => <option key={n.id} value={n.id}>{n.name}</option>)}
+                                    </select>
+                                </div>
+                                <div className="space-y-2">
+                                    <label className={labelClass}>Max Databases</label>
+                                    <input type="number" min={0} value={form.max_databases} onChange={e => setForm({ ...form, max_databases: parseInt(e.target.value) || 0 })} className={inputClass} placeholder="0 for no limit" />
+                                </div>
+                            </div>
+
+                            <div className="flex gap-4 pt-4">
+                                <button type="button" onClick={() => setShowModal(false)} className="flex-1 px-6 py-3 rounded-xl bg-secondary hover:bg-secondary/80 text-sm font-bold transition-all">
+                                    Cancel
+                                </button>
+                                <button type="submit" disabled={saving} className="flex-1 px-6 py-3 rounded-xl bg-primary text-white hover:opacity-90 text-sm font-bold shadow-lg shadow-primary/20 transition-all disabled:opacity-50">
+                                    {saving ? 'Connecting...' : 'Save Host'}
+                                </button>
+                            </div>
+                        </form>
+                    </div>
+                </div>
+            )}
+        </div>
+    );
+}
@@ -371,6 +371,12 @@ export default function AdminEggsPage() {
                             </div>
                         </div>
 
+                        <div className="space-y-1.5">
+                            <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">File Denylist JSON</label>
+                            <input className="input-field font-mono text-xs" value={editingEgg.file_denylist || ''} onChange={e => setEditingEgg({ ...editingEgg, file_denylist: e.target.value })} placeholder='["server.jar", "plugins/AntiCheat/*.yml"]' />
+                            <p className="text-[10px] text-muted pl-1">Files matching these patterns are hidden from SFTP and locked in the file manager for everyone but admins.</p>
+                        </div>
+
                         <div className="space-y-1.5">
                             <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">Raw Config JSON</label>
                             <textarea className="input-field font-mono text-xs min-h-[100px]" value={editingEgg.config} onChange={e => setEditingEgg({ ...editingEgg, config: e.target.value })} placeholder="{}" />
@@ -0,0 +1,173 @@
+import { useState, useEffect } from 'react';
+import api from '../../lib/api';
+import { MapPin, Plus, Trash2, Edit3, X } from 'lucide-react';
+
+interface Location {
+    id: number;
+    short: string;
+    long: string;
+    region: string;
+    nodes: number;
+}
+
+const emptyForm = { short: '', long: '', region: '' };
+
+export default function AdminLocationsPage() {
+    const [locations, setLocations] = useState<Location[]>([]);
+    const [loading, setLoading] = useState(true);
+    const [showModal, setShowModal] = useState(false);
+    const [saving, setSaving] = useState(false);
+    const [editingId, setEditingId] = useState<number | null>(null);
+    const [form, setForm] = useState(emptyForm);
+
+    const fetchLocations = async () => {
+        try {
+            const res = await api.get('/admin/locations');
+            setLocations(res.data);
+        } catch (err) {
+            console.error(err);
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    useEffect(() => {
+        fetchLocations();
+    }, []);
+
+    const openCreate = () => {
+        setEditingId(null);
+        setForm(emptyForm);
+        setShowModal(true);
+    };
+
+    const openEdit = (location: Location) => {
+        setEditingId(location.id);
+        setForm({ short: location.short, long: location.long, region: location.region });
+        setShowModal(true);
+    };
+
+    const handleSubmit = async (e: React.FormEvent) => {
+        e.preventDefault();
+        setSaving(true);
+        try {
+            if (editingId) {
+                await api.put(`/admin/locations/${editingId}`, form);
+            } else {
+                await api.post('/admin/locations', form);
+            }
+            setShowModal(false);
+            fetchLocations();
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Failed to save location');
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    const handleDelete = async (location: Location) => {
+        if (!confirm(`Remove location ${location.short}?`)) return;
+        try {
+            await api.delete(`/admin/locations/${location.id}`);
+            fetchLocations();
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Delete failed');
+        }
+    };
+
+    if (loading) return <div className="p-12 text-center animate-pulse text-muted uppercase font-bold tracking-widest mt-20">Loading Locations...</div>;
+
+    const inputClass = "w-full bg-secondary/50 border border-border rounded-xl px-4 py-3 text-sm focus:outline-none focus:ring-2 focus:ring-primary/50 transition-all font-medium";
+    const labelClass = "text-[10px] font-bold uppercase tracking-widest text-muted ml-1";
+
+    return (
+        <div className="space-y-8 animation-enter">
+            <div className="flex flex-col md:flex-row md:items-center justify-between gap-6 bg-primary/5 p-8 rounded-3xl border border-primary/20">
+                <div>
+                    <h1 className="text-3xl font-bold tracking-tight flex items-center gap-3">
+                        <MapPin className="text-primary" size={28} /> Locations
+                    </h1>
+                    <p className="text-muted text-sm font-medium mt-1 pr-10">Group nodes by where they run, so services can be deployed to a location instead of a node.</p>
+                </div>
+                <button
+                    onClick={openCreate}
+                    className="flex items-center gap-2 bg-primary text-white px-6 py-3 rounded-xl font-bold text-sm hover:scale-105 transition-all shadow-lg shadow-primary/20 shrink-0"
+                >
+                    <Plus size={18} />
+                    Add Location
+                </button>
+            </div>
+
+            <div className="grid grid-cols-1 gap-4 pb-12">
+                {locations.length === 0 ? (
+                    <div className="py-20 text-center panel-card border-dashed border-2">
+                        <MapPin size={48} className="mx-auto text-muted mb-4 opacity-20" />
+                        <p className="text-muted font-bold tracking-tight">No locations have been added yet.</p>
+                    </div>
+                ) : (
+                    locations.map(location => (
+                        <div key={location.id} className="panel-card flex flex-col md:flex-row md:items-center justify-between gap-6 p-6 group hover:border-primary/40 transition-all">
+                            <div className="flex items-start gap-5">
+                                <div className="p-3 rounded-2xl shrink-0 mt-1 bg-primary/10 text-primary">
+                                    <MapPin size={20} />
+                                </div>
+                                <div>
+                                    <div className="flex items-center gap-3 mb-1">
+                                        <h3 className="font-bold text-lg leading-tight font-mono group-hover:text-primary transition-colors">{location.short}</h3>
+                                        {location.region && <span className="text-[9px] font-black uppercase tracking-widest text-muted">{location.region}</span>}
+                                    </div>
+                                    <p className="text-xs text-muted font-medium">{location.long || 'No description'} · {location.nodes} node(s)</p>
+                                </div>
+                            </div>
+                            <div className="flex items-center gap-2 opacity-0 group-hover:opacity-100 transition-opacity">
+                                <button onClick={() => openEdit(location)} className="p-2.5 hover:bg-secondary rounded-xl text-muted hover:text-foreground transition-all border border-transparent hover:border-border">
+                                    <Edit3 size={16} />
+                                </button>
+                                <button onClick={() => handleDelete(location)} className="p-2.5 hover:bg-red-500/10 rounded-xl text-muted hover:text-red-500 transition-all border border-transparent hover:border-red-500/20">
+                                    <Trash2 size={16} />
+                                </button>
+                            </div>
+                        </div>
+                    ))
+                )}
+            </div>
+
+            {showModal && (
+                <div className="fixed inset-0 z-[100] flex items-center justify-center p-6 bg-black/60 backdrop-blur-sm">
+                    <div className="panel-card max-w-lg w-full p-0 shadow-2xl animation-enter overflow-hidden">
+                        <div className="px-8 py-6 border-b border-border/50 bg-secondary/20 flex items-center justify-between">
+                            <h2 className="text-xl font-bold tracking-tight">{editingId ? 'Edit Location' : 'Add Location'}</h2>
+                            <button onClick={() => setShowModal(false)} className="p-2 hover:bg-secondary rounded-lg transition-colors">
+                                <X size={20} className="text-muted" />
+                            </button>
+                        </div>
+
+                        <form onSubmit={handleSubmit} className="p-8 space-y-6">
+                            <div className="space-y-2">
+                                <label className={labelClass}>Short Code</label>
+                                <input required value={form.short} onChange={e => setForm({ ...form, short: e.target.value })} className={`${inputClass} font-mono`} placeholder="eu.fra" />
+                            </div>
+                            <div className="space-y-2">
+                                <label className={labelClass}>Name</label>
+                                <input value={form.long} onChange={e => setForm({ ...form, long: e.target.value })} className={inputClass} placeholder="Frankfurt, Germany" />
+                            </div>
+                            <div className="space-y-2">
+                                <label className={labelClass}>Region</label>
+                                <input value={form.region} onChange={e => setForm({ ...form, region: e.target.value })} className={inputClass} placeholder="Europe" />
+                            </div>
+
+                            <div className="flex gap-4 pt-4">
+                                <button type="button" onClick={() => setShowModal(false)} className="flex-1 px-6 py-3 rounded-xl bg-secondary hover:bg-secondary/80 text-sm font-bold transition-all">
+                                    Cancel
+                                </button>
+                                <button type="submit" disabled={saving} className="flex-1 px-6 py-3 rounded-xl bg-primary text-white hover:opacity-90 text-sm font-bold shadow-lg shadow-primary/20 transition-all disabled:opacity-50">
+                                    {saving ? 'Saving...' : 'Save Location'}
+                                </button>
+                            </div>
+                        </form>
+                    </div>
+                </div>
+            )}
+        </div>
+    );
+}
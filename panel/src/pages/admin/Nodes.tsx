@@ -1,7 +1,7 @@
 import { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import api from '../../lib/api';
-import { Server, HardDrive, Plus, Globe, CheckCircle, XCircle, Trash2, Settings, X, AlertTriangle } from 'lucide-react';
+import { Server, HardDrive, Plus, Globe, CheckCircle, XCircle, Trash2, Settings, X, AlertTriangle, MapPin } from 'lucide-react';
 import clsx from 'clsx';
 import { formatDistanceToNow } from 'date-fns';
 
@@ -11,9 +11,11 @@ interface Node {
     address: string;
     port: string;
     is_online: boolean;
-    location?: string;
+    location_id?: number | null;
+    location?: { id: number; short: string; long: string };
     total_ram?: number;
     total_disk?: number;
+    pull_allowlist?: string;
     last_heartbeat?: string;
 }
 
@@ -22,9 +24,11 @@ export default function NodesPage() {
     const [nodes, setNodes] = useState<Node[]>([]);
     const [loading, setLoading] = useState(true);
     const [editingNode, setEditingNode] = useState<Node | null>(null);
+    const [locations, setLocations] = useState<any[]>([]);
+    const [locationFilter, setLocationFilter] = useState('');
 
     const fetchNodes = () => {
-        api.get<Node[]>('/admin/nodes')
+        api.get<Node[]>('/admin/nodes', { params: locationFilter ? { location: locationFilter } : {} })
             .then(res => setNodes(res.data))
             .catch(err => console.error(err))
             .finally(() => setLoading(false));
@@ -32,6 +36,10 @@ export default function NodesPage() {
 
     useEffect(() => {
         fetchNodes();
+    }, [locationFilter]);
+
+    useEffect(() => {
+        api.get('/admin/locations').then(res => setLocations(res.data)).catch(() => setLocations([]));
     }, []);
 
     const handleDelete = async (id: number) => {
@@ -51,7 +59,7 @@ export default function NodesPage() {
     const saveEdit = async () => {
         if (!editingNode) return;
         try {
-            await api.put(`/admin/nodes/${editingNode.id}`, editingNode);
+            await api.put(`/admin/nodes/${editingNode.id}`, { ...editingNode, location: undefined, location_id: editingNode.location_id || 0 });
             setEditingNode(null);
             fetchNodes();
         } catch (err) {
@@ -68,13 +76,23 @@ export default function NodesPage() {
                     <h2 className="text-2xl font-bold tracking-tight">Active Infrastructure</h2>
                     <p className="text-muted text-sm font-medium">Monitoring {nodes.length} compute nodes across your network.</p>
                 </div>
-                <button
-                    onClick={() => navigate('/admin/nodes/create')}
-                    className="flex items-center gap-2 bg-primary text-white px-5 py-2.5 rounded-xl font-bold text-sm hover:bg-primary/90 transition-all shadow-lg shadow-primary/20"
-                >
-                    <Plus size={18} />
-                    Add Node
-                </button>
+                <div className="flex items-center gap-3">
+                    <select
+                        value={locationFilter}
+                        onChange={e => setLocationFilter(e.target.value)}
+                        className="input-field w-48"
+                    >
+                        <option value="">All locations</option>
+                        {locations.map(l => <option key={l.id} value={l.id}>{l.short} ({l.long})</option>)}
+                    </select>
+                    <button
+                        onClick={() => navigate('/admin/nodes/create')}
+                        className="flex items-center gap-2 bg-primary text-white px-5 py-2.5 rounded-xl font-bold text-sm hover:bg-primary/90 transition-all shadow-lg shadow-primary/20"
+                    >
+                        <Plus size={18} />
+                        Add Node
+                    </button>
+                </div>
             </div>
 
             <div className="grid grid-cols-1 md:grid-cols-2 lg:grid-cols-3 gap-6">
@@ -93,6 +111,9 @@ export default function NodesPage() {
                                     <div className="flex items-center gap-1.5 text-xs text-muted font-medium mt-1">
                                         <Globe size={12} /> {node.address}:{node.port}
                                     </div>
+                                    <div className="flex items-center gap-1.5 text-xs text-muted font-medium mt-0.5">
+                                        <MapPin size={12} /> {node.location ? `${node.location.long || node.location.short} (${node.location.short})` : 'No location'}
+                                    </div>
                                 </div>
                             </div>
                             <div className={clsx(
@@ -190,12 +211,14 @@ export default function NodesPage() {
                                 </div>
                                 <div className="space-y-2">
                                     <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">Location</label>
-                                    <input
+                                    <select
                                         className="input-field"
-                                        value={editingNode.location || ''}
-                                        onChange={e => setEditingNode({ ...editingNode, location: e.target.value })}
-                                        placeholder="e.g. London, UK"
-                                    />
+                                        value={editingNode.location_id || 0}
+                                        onChange={e => setEditingNode({ ...editingNode, location_id: parseInt(e.target.value) || null })}
+                                    >
+                                        <option value={0}>No location</option>
+                                        {locations.map(l => <option key={l.id} value={l.id}>{l.short} ({l.long})</option>)}
+                                    </select>
                                 </div>
                             </div>
                             <div className="grid grid-cols-2 gap-6">
@@ -236,6 +259,16 @@ export default function NodesPage() {
                                     />
                                 </div>
                             </div>
+                            <div className="space-y-2">
+                                <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">URL Download Allowlist</label>
+                                <input
+                                    className="input-field"
+                                    value={editingNode.pull_allowlist || ''}
+                                    onChange={e => setEditingNode({ ...editingNode, pull_allowlist: e.target.value })}
+                                    placeholder="e.g. 10.0.5.20, 192.168.10.0/24"
+                                />
+                                <p className="text-[10px] text-muted pl-1">Private addresses services may download files from. Everything non-public is blocked otherwise.</p>
+                            </div>
                             <div className="p-4 rounded-xl bg-amber-500/5 border border-amber-500/20 flex gap-3">
                                 <AlertTriangle className="text-amber-500 shrink-0 mt-0.5" size={16} />
                                 <div className="text-[10px] text-amber-500/80 font-medium leading-relaxed">
@@ -10,10 +10,12 @@ export default function AdminServicesPage() {
     const [loading, setLoading] = useState(true);
     const [searchTerm, setSearchTerm] = useState('');
     const [editingService, setEditingService] = useState<any>(null);
+    const [locations, setLocations] = useState<any[]>([]);
+    const [locationFilter, setLocationFilter] = useState('');
 
     const fetchServices = async () => {
         try {
-            const res = await api.get('/admin/services');
+            const res = await api.get('/admin/services', { params: locationFilter ? { location: locationFilter } : {} });
             setServices(res.data);
         } catch (err) {
             console.error("Failed to fetch services", err);
@@ -24,6 +26,10 @@ export default function AdminServicesPage() {
 
     useEffect(() => {
         fetchServices();
+    }, [locationFilter]);
+
+    useEffect(() => {
+        api.get('/admin/locations').then(res => setLocations(res.data)).catch(() => setLocations([]));
     }, []);
 
     const filteredServices = services.filter(service =>
@@ -71,6 +77,16 @@ export default function AdminServicesPage() {
                 </div>
 
                 <div className="flex items-center gap-4">
+                    {locations.length > 0 && (
+                        <select
+                            value={locationFilter}
+                            onChange={e => setLocationFilter(e.target.value)}
+                            className="bg-background border border-border/50 px-4 py-2.5 rounded-xl text-sm focus:outline-none focus:ring-2 focus:ring-primary/20 focus:border-primary transition-all font-medium"
+                        >
+                            <option value="">All locations</option>
+                            {locations.map(l => <option key={l.id} value={l.id}>{l.short}</option>)}
+                        </select>
+                    )}
                     <div className="relative group">
                         <Search className="absolute left-4 top-1/2 -translate-y-1/2 text-muted group-focus-within:text-primary transition-colors" size={18} />
                         <input
@@ -255,6 +271,17 @@ export default function AdminServicesPage() {
                                 </div>
                             </div>
 
+                            <div className="space-y-2">
+                                <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">Database Limit</label>
+                                <input
+                                    type="number"
+                                    min={0}
+                                    className="input-field"
+                                    value={editingService.database_limit ?? 0}
+                                    onChange={e => setEditingService({ ...editingService, database_limit: parseInt(e.target.value) || 0 })}
+                                />
+                            </div>
+
                             <div className="space-y-2">
                                 <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">Container Image</label>
                                 <select
@@ -2,13 +2,41 @@ import { useState, useEffect } from 'react';
 import api from '../../lib/api';
 import { Users, Shield, Trash2, UserPlus, Search, User as UserIcon, Edit3, X } from 'lucide-react';
 
+interface UserQuota {
+    services: number;
+    memory: number;
+    disk: number;
+    cpu: number;
+    database_limit: number;
+    allowed_nests: string;
+    allowed_eggs: string;
+    allowed_nodes: string;
+    allowed_locations: string;
+}
+
 interface UserData {
     id: number;
     username: string;
     is_admin: boolean;
+    quota?: UserQuota;
     created_at: string;
 }
 
+const emptyQuota: UserQuota = { services: 0, memory: 0, disk: 0, cpu: 0, database_limit: 0, allowed_nests: '', allowed_eggs: '', allowed_nodes: '', allowed_locations: '' };
+
+// Quota ID lists are stored as JSON but edited as comma separated IDs
+const idsToText = (list: string) => {
+    try {
+        return (JSON.parse(list || '[]') as number[]).join(', ');
+    } catch {
+        return '';
+    }
+};
+const textToIds = (text: string) => {
+    const ids = text.split(',').map(id => parseInt(id.trim())).filter(id => id > 0);
+    return ids.length > 0 ? JSON.stringify(ids) : '';
+};
+
 export default function AdminUsersPage() {
     const [users, setUsers] = useState<UserData[]>([]);
     const [loading, setLoading] = useState(true);
@@ -26,6 +54,7 @@ export default function AdminUsersPage() {
     const [editUsername, setEditUsername] = useState('');
     const [editPassword, setEditPassword] = useState('');
     const [editIsAdmin, setEditIsAdmin] = useState(false);
+    const [editQuota, setEditQuota] = useState<UserQuota>(emptyQuota);
     const [editLoading, setEditLoading] = useState(false);
 
     const fetchUsers = async () => {
@@ -76,7 +105,14 @@ export default function AdminUsersPage() {
             const res = await api.put(`/admin/users/${editingUser.id}`, {
                 username: editUsername,
                 password: editPassword || undefined,
-                is_admin: editIsAdmin
+                is_admin: editIsAdmin,
+                quota: {
+                    ...editQuota,
+                    allowed_nests: textToIds(editQuota.allowed_nests),
+                    allowed_eggs: textToIds(editQuota.allowed_eggs),
+                    allowed_nodes: textToIds(editQuota.allowed_nodes),
+                    allowed_locations: textToIds(editQuota.allowed_locations)
+                }
             });
             setUsers(users.map(u => u.id === editingUser.id ? res.data : u));
             setEditingUser(null);
@@ -92,6 +128,14 @@ export default function AdminUsersPage() {
         setEditUsername(user.username);
         setEditPassword('');
         setEditIsAdmin(user.is_admin);
+        const quota = user.quota || emptyQuota;
+        setEditQuota({
+            ...quota,
+            allowed_nests: idsToText(quota.allowed_nests),
+            allowed_eggs: idsToText(quota.allowed_eggs),
+            allowed_nodes: idsToText(quota.allowed_nodes),
+            allowed_locations: idsToText(quota.allowed_locations)
+        });
     };
 
     const deleteUser = async (id: number) => {
@@ -269,7 +313,7 @@ export default function AdminUsersPage() {
             {/* Edit User Modal */}
             {editingUser && (
                 <div className="fixed inset-0 z-[100] flex items-center justify-center p-6 bg-black/60 backdrop-blur-sm">
-                    <div className="panel-card max-w-md w-full p-8 shadow-2xl animation-enter">
+                    <div className="panel-card max-w-md w-full p-8 shadow-2xl animation-enter max-h-[90vh] overflow-y-auto">
                         <div className="flex items-center justify-between mb-8">
                             <div className="flex items-center gap-4">
                                 <div className="p-3 rounded-2xl bg-primary/10 text-primary">
@@ -320,6 +364,49 @@ export default function AdminUsersPage() {
                                 </div>
                             </label>
 
+                            <div className="space-y-3 pt-2">
+                                <div>
+                                    <span className="block text-sm font-bold">Self-Service Quota</span>
+                                    <span className="block text-[10px] text-muted font-medium">Servers the user may create themselves. 0 servers disables self-service.</span>
+                                </div>
+                                <div className="grid grid-cols-2 gap-3">
+                                    {([
+                                        ['services', 'Servers'],
+                                        ['database_limit', 'Databases / Server'],
+                                        ['memory', 'Memory (MB)'],
+                                        ['disk', 'Disk (MB)'],
+                                        ['cpu', 'CPU (%)'],
+                                    ] as [keyof UserQuota, string][]).map(([key, label]) => (
+                                        <div key={key} className="space-y-1">
+                                            <label className="text-[10px] font-bold uppercase tracking-widest text-muted ml-1">{label}</label>
+                                            <input
+                                                type="number"
+                                                min={0}
+                                                value={editQuota[key] as number}
+                                                onChange={e => setEditQuota({ ...editQuota, [key]: parseInt(e.target.value) || 0 })}
+                                                className="w-full bg-secondary/50 border border-border rounded-xl px-3 py-2 text-sm focus:outline-none focus:ring-2 focus:ring-primary/50 transition-all font-medium"
+                                            />
+                                        </div>
+                                    ))}
+                                </div>
+                                {([
+                                    ['allowed_nests', 'Allowed Nest IDs'],
+                                    ['allowed_eggs', 'Allowed Egg IDs'],
+                                    ['allowed_nodes', 'Allowed Node IDs'],
+                                    ['allowed_locations', 'Allowed Location IDs'],
+                                ] as [keyof UserQuota, string][]).map(([key, label]) => (
+                                    <div key={key} className="space-y-1">
+                                        <label className="text-[10px] font-bold uppercase tracking-widest text-muted ml-1">{label}</label>
+                                        <input
+                                            value={editQuota[key] as string}
+                                            onChange={e => setEditQuota({ ...editQuota, [key]: e.target.value })}
+                                            className="w-full bg-secondary/50 border border-border rounded-xl px-3 py-2 text-sm focus:outline-none focus:ring-2 focus:ring-primary/50 transition-all font-mono"
+                                            placeholder="e.g. 1, 3 (empty allows all)"
+                                        />
+                                    </div>
+                                ))}
+                            </div>
+
                             <div className="flex gap-4 pt-4">
                                 <button
                                     type="button"
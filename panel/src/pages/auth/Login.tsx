@@ -1,7 +1,7 @@
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
 import Logo from '../../components/Logo';
-import api from '../../lib/api';
+import api, { apiBase } from '../../lib/api';
 import { useAuth } from '../../context/AuthContext';
 
 export default function LoginPage() {
@@ -9,8 +9,38 @@ export default function LoginPage() {
     const { login } = useAuth();
     const [username, setUsername] = useState('');
     const [password, setPassword] = useState('');
+    const [challengeToken, setChallengeToken] = useState('');
+    const [code, setCode] = useState('');
     const [error, setError] = useState('');
     const [loading, setLoading] = useState(false);
+    const [providers, setProviders] = useState<{ local_login: boolean; oidc: { enabled: boolean; name: string } } | null>(null);
+
+    useEffect(() => {
+        api.get('/auth/providers').then((res) => setProviders(res.data)).catch(() => {});
+
+        // Single sign-on comes back with a one-time ticket (or an error) in the URL fragment
+        const params = new URLSearchParams(window.location.hash.slice(1));
+        const ticket = params.get('sso_ticket');
+        const ssoError = params.get('sso_error');
+        if (!ticket && !ssoError) return;
+        window.history.replaceState(null, '', window.location.pathname);
+
+        if (ssoError) {
+            setError(ssoError);
+            return;
+        }
+        setLoading(true);
+        api.post('/auth/oidc/exchange', { ticket })
+            .then((res) => {
+                login(res.data.token, res.data.user, res.data.refresh_token);
+                navigate('/');
+            })
+            .catch((err) => setError(err.response?.data?.error || 'Single sign-on failed'))
+            .finally(() => setLoading(false));
+    }, []);
+
+    // Admins can still use their password when local login is disabled, so only registration is hidden
+    const localLogin = providers?.local_login ?? true;
 
     const handleLogin = async (e: React.FormEvent) => {
         e.preventDefault();
@@ -18,8 +48,17 @@ export default function LoginPage() {
         setLoading(true);
 
         try {
-            const res = await api.post('/auth/login', { username, password });
-            login(res.data.token, res.data.user);
+            const res = challengeToken
+                ? await api.post('/auth/login/2fa', { challenge_token: challengeToken, code })
+                : await api.post('/auth/login', { username, password });
+
+            // Accounts with 2FA get a challenge token first and must enter a code
+            if (res.data.two_factor_required) {
+                setChallengeToken(res.data.challenge_token);
+                return;
+            }
+
+            login(res.data.token, res.data.user, res.data.refresh_token);
             navigate('/');
         } catch (err: any) {
             setError(err.response?.data?.error || 'Failed to login');
@@ -45,7 +84,32 @@ export default function LoginPage() {
                     </div>
                 )}
 
+                {providers?.oidc.enabled && !challengeToken && (
+                    <a
+                        href={`${apiBase}/auth/oidc/login`}
+                        className="block w-full text-center bg-primary text-white font-semibold py-3 rounded-lg hover:bg-primary/90 transition-colors mb-5"
+                    >
+                        Sign in with {providers.oidc.name}
+                    </a>
+                )}
+
                 <form onSubmit={handleLogin} className="flex flex-col gap-5">
+                    {challengeToken ? (
+                    <div className="space-y-2">
+                        <label className="text-xs font-medium uppercase tracking-wide text-muted">Authentication Code</label>
+                        <input
+                            type="text"
+                            inputMode="numeric"
+                            autoComplete="one-time-code"
+                            autoFocus
+                            className="w-full bg-secondary/50 border border-border rounded-lg px-4 py-3 text-sm focus:outline-none focus:ring-2 focus:ring-primary/50 transition-all placeholder:text-muted/50"
+                            placeholder="123456 or a recovery code"
+                            value={code}
+                            onChange={(e) => setCode(e.target.value)}
+                        />
+                    </div>
+                    ) : (
+                    <>
                     <div className="space-y-2">
                         <label className="text-xs font-medium uppercase tracking-wide text-muted">Username</label>
                         <input
@@ -70,20 +134,24 @@ export default function LoginPage() {
                             onChange={(e) => setPassword(e.target.value)}
                         />
                     </div>
+                    </>
+                    )}
 
                     <button
                         type="submit"
                         disabled={loading}
                         className="w-full bg-white text-black font-semibold py-3 rounded-lg hover:bg-gray-200 transition-colors mt-2 disabled:opacity-50"
                     >
-                        {loading ? 'Signing in...' : 'Sign In'}
+                        {loading ? 'Signing in...' : challengeToken ? 'Verify' : 'Sign In'}
                     </button>
                 </form>
 
                 <div className="text-center mt-8 space-y-4">
+                    {localLogin && (
                     <p className="text-xs text-muted">
                         Don't have an account? <Link to="/register" className="text-primary hover:text-primary/80 font-bold">Sign Up</Link>
                     </p>
+                    )}
                     <p className="text-xs text-muted">
                         By signing in, you agree to our <a href="#" className="underline hover:text-white">Terms of Service</a>
                     </p>
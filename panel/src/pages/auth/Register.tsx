@@ -31,7 +31,7 @@ export default function RegisterPage() {
 
         try {
             const res = await api.post('/auth/register', { username, password });
-            login(res.data.token, res.data.user);
+            login(res.data.token, res.data.user, res.data.refresh_token);
             navigate('/');
         } catch (err: any) {
             setError(err.response?.data?.error || 'Failed to register');
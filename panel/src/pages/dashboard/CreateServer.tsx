@@ -0,0 +1,209 @@
+import { useState, useEffect } from 'react';
+import { useNavigate } from 'react-router-dom';
+import api from '../../lib/api';
+import { Server, Rocket, Lock, Layers, MapPin } from 'lucide-react';
+import clsx from 'clsx';
+
+interface Variable {
+    id: number;
+    name: string;
+    description: string;
+    environment_variable: string;
+    default_value: string;
+    user_editable: boolean;
+    rules: string;
+}
+
+interface SelfServiceEgg {
+    id: number;
+    name: string;
+    description: string;
+    nest_name: string;
+    docker_images: string[] | null;
+    variables: Variable[];
+}
+
+export default function CreateServerPage() {
+    const navigate = useNavigate();
+    const [options, setOptions] = useState<any>(null);
+    const [loading, setLoading] = useState(true);
+    const [creating, setCreating] = useState(false);
+
+    const [egg, setEgg] = useState<SelfServiceEgg | null>(null);
+    const [name, setName] = useState('');
+    const [memory, setMemory] = useState(1024);
+    const [disk, setDisk] = useState(5120);
+    const [cpu, setCpu] = useState(100);
+    const [image, setImage] = useState('');
+    const [vars, setVars] = useState<Record<string, string>>({});
+    const [locationId, setLocationId] = useState(0);
+
+    useEffect(() => {
+        api.get('/services/create-options')
+            .then(res => setOptions(res.data))
+            .catch(err => console.error('Failed to fetch create options', err))
+            .finally(() => setLoading(false));
+    }, []);
+
+    const selectEgg = (selected: SelfServiceEgg) => {
+        setEgg(selected);
+        setImage(selected.docker_images?.[0] || '');
+        const defaults: Record<string, string> = {};
+        selected.variables.filter(v => v.user_editable).forEach(v => {
+            defaults[v.environment_variable] = v.default_value;
+        });
+        setVars(defaults);
+    };
+
+    const handleCreate = async (e: React.FormEvent) => {
+        e.preventDefault();
+        if (!egg) return;
+        setCreating(true);
+        try {
+            const res = await api.post('/services', {
+                name,
+                egg_id: egg.id,
+                memory,
+                disk,
+                cpu,
+                docker_image: image,
+                environment: vars,
+                location_id: locationId
+            });
+            navigate(`/services/${res.data.uuid}`);
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Failed to create server');
+        } finally {
+            setCreating(false);
+        }
+    };
+
+    if (loading) return <div className="p-12 text-center text-muted animate-pulse font-bold tracking-widest uppercase">Loading...</div>;
+
+    if (!options?.enabled) {
+        return (
+            <div className="max-w-xl mx-auto py-32 text-center panel-card bg-secondary/10 border-dashed">
+                <Lock size={48} className="mx-auto text-muted mb-6 opacity-20" />
+                <h3 className="text-xl font-bold mb-2">Self-Service Unavailable</h3>
+                <p className="text-muted text-sm max-w-xs mx-auto">Your account can't create servers yet. Contact an administrator to get a quota.</p>
+            </div>
+        );
+    }
+
+    const { quota, used } = options;
+    const left = {
+        services: quota.services - used.services,
+        memory: Math.max(0, quota.memory - used.memory),
+        disk: Math.max(0, quota.disk - used.disk),
+        cpu: Math.max(0, quota.cpu - used.cpu),
+    };
+    const inputClass = "w-full bg-secondary/50 border border-border rounded-xl px-4 py-3 text-sm focus:outline-none focus:ring-2 focus:ring-primary/50 transition-all font-medium";
+    const labelClass = "text-[10px] font-bold uppercase tracking-widest text-muted ml-1";
+
+    return (
+        <div className="max-w-5xl mx-auto space-y-10 pb-20 animation-enter">
+            <div>
+                <h1 className="text-3xl font-bold tracking-tight mb-2">New Server</h1>
+                <p className="text-muted">
+                    {left.services} server(s), {left.memory}MB memory, {left.disk}MB disk and {left.cpu}% CPU left in your quota.
+                </p>
+            </div>
+
+            <div className="grid grid-cols-1 md:grid-cols-3 gap-4">
+                {options.eggs.length === 0 ? (
+                    <div className="col-span-full py-16 text-center panel-card border-dashed border-2">
+                        <Layers size={40} className="mx-auto text-muted mb-4 opacity-20" />
+                        <p className="text-muted font-bold">No service types are available to you.</p>
+                    </div>
+                ) : options.eggs.map((e: SelfServiceEgg) => (
+                    <button
+                        key={e.id}
+                        type="button"
+                        onClick={() => selectEgg(e)}
+                        className={clsx(
+                            "panel-card p-5 text-left border-2 transition-all",
+                            egg?.id === e.id ? "border-primary bg-primary/5" : "border-border/40 hover:border-primary/40"
+                        )}
+                    >
+                        <span className="block text-[10px] font-bold text-muted uppercase tracking-widest">{e.nest_name}</span>
+                        <span className="block font-bold mt-1">{e.name}</span>
+                        {e.description && <span className="block text-xs text-muted mt-2 line-clamp-2">{e.description}</span>}
+                    </button>
+                ))}
+            </div>
+
+            {egg && (
+                <form onSubmit={handleCreate} className="panel-card p-8 space-y-6">
+                    <div className="flex items-center gap-3">
+                        <Server className="text-primary" size={22} />
+                        <h2 className="text-lg font-bold tracking-tight">{egg.name}</h2>
+                    </div>
+
+                    <div className="grid grid-cols-1 md:grid-cols-2 gap-6">
+                        <div className="space-y-2">
+                            <label className={labelClass}>Server Name</label>
+                            <input required value={name} onChange={e => setName(e.target.value)} className={inputClass} placeholder="My Server" />
+                        </div>
+                        {(egg.docker_images?.length || 0) > 1 && (
+                            <div className="space-y-2">
+                                <label className={labelClass}>Image</label>
+                                <select value={image} onChange={e => setImage(e.target.value)} className={inputClass}>
+                                    {egg.docker_images!.map(img => <option key={img} value={img}>{img}</option>)}
+                                </select>
+                            </div>
+                        )}
+                        {options.locations?.length > 0 && (
+                            <div className="space-y-2">
+                                <label className={labelClass}>Location</label>
+                                <div className="relative">
+                                    <MapPin size={14} className="absolute left-4 top-1/2 -translate-y-1/2 text-muted" />
+                                    <select value={locationId} onChange={e => setLocationId(parseInt(e.target.value))} className={clsx(inputClass, "pl-10")}>
+                                        <option value={0}>Any location</option>
+                                        {options.locations.map((l: any) => <option key={l.id} value={l.id}>{l.long || l.short}{l.region ? ` (${l.region})` : ''}</option>)}
+                                    </select>
+                                </div>
+                            </div>
+                        )}
+                        <div className="space-y-2">
+                            <label className={labelClass}>Memory (MB)</label>
+                            <input type="number" min={1} max={left.memory} value={memory} onChange={e => setMemory(parseInt(e.target.value) || 0)} className={inputClass} />
+                        </div>
+                        <div className="space-y-2">
+                            <label className={labelClass}>Disk (MB)</label>
+                            <input type="number" min={1} max={left.disk} value={disk} onChange={e => setDisk(parseInt(e.target.value) || 0)} className={inputClass} />
+                        </div>
+                        <div className="space-y-2">
+                            <label className={labelClass}>CPU (%)</label>
+                            <input type="number" min={1} max={left.cpu} value={cpu} onChange={e => setCpu(parseInt(e.target.value) || 0)} className={inputClass} />
+                        </div>
+                    </div>
+
+                    {egg.variables.length > 0 && (
+                        <div className="grid grid-cols-1 md:grid-cols-2 gap-6 pt-6 border-t border-border/50">
+                            {egg.variables.map(v => (
+                                <div key={v.id} className="space-y-2">
+                                    <label className={labelClass}>{v.name}</label>
+                                    <input
+                                        value={v.user_editable ? (vars[v.environment_variable] ?? '') : v.default_value}
+                                        disabled={!v.user_editable}
+                                        onChange={e => setVars({ ...vars, [v.environment_variable]: e.target.value })}
+                                        className={clsx(inputClass, !v.user_editable && "opacity-50")}
+                                    />
+                                    {v.description && <p className="text-[11px] text-muted ml-1">{v.description}</p>}
+                                </div>
+                            ))}
+                        </div>
+                    )}
+
+                    <button
+                        type="submit"
+                        disabled={creating || !name}
+                        className="w-full flex items-center justify-center gap-2 px-6 py-3 rounded-xl bg-primary text-white hover:opacity-90 text-sm font-bold shadow-lg shadow-primary/20 transition-all disabled:opacity-50"
+                    >
+                        <Rocket size={16} /> {creating ? 'Deploying...' : 'Create Server'}
+                    </button>
+                </form>
+            )}
+        </div>
+    );
+}
@@ -5,7 +5,7 @@ import clsx from 'clsx';
 import {
     Layers, ShieldCheck,
     ArrowRight, Zap, Bell, Clock,
-    CheckCircle, AlertTriangle
+    CheckCircle, AlertTriangle, Gauge, Plus
 } from 'lucide-react';
 import { useAuth } from '../../context/AuthContext';
 
@@ -100,6 +100,47 @@ export default function UserDashboard() {
                 </div>
             </div>
 
+            {/* Self-Service Quota */}
+            {overview.quota && (
+                <div className="panel-card bg-card border-border shadow-sm p-6">
+                    <div className="flex items-center justify-between mb-6">
+                        <h2 className="text-lg font-bold flex items-center gap-2">
+                            <Gauge size={20} className="text-primary" />
+                            Your Quota
+                        </h2>
+                        {overview.quota.used.services < overview.quota.limits.services && (
+                            <button
+                                onClick={() => navigate('/services/create')}
+                                className="flex items-center gap-2 px-4 py-2 bg-primary text-white rounded-xl font-bold text-xs hover:bg-primary/90 transition-all"
+                            >
+                                <Plus size={14} /> New Server
+                            </button>
+                        )}
+                    </div>
+                    <div className="grid grid-cols-2 md:grid-cols-4 gap-6">
+                        {[
+                            { label: 'Servers', used: overview.quota.used.services, limit: overview.quota.limits.services, unit: '' },
+                            { label: 'Memory', used: overview.quota.used.memory, limit: overview.quota.limits.memory, unit: 'MB' },
+                            { label: 'Disk', used: overview.quota.used.disk, limit: overview.quota.limits.disk, unit: 'MB' },
+                            { label: 'CPU', used: overview.quota.used.cpu, limit: overview.quota.limits.cpu, unit: '%' },
+                        ].map(item => (
+                            <div key={item.label} className="space-y-2">
+                                <div className="flex items-center justify-between text-xs">
+                                    <span className="font-bold text-muted uppercase tracking-widest">{item.label}</span>
+                                    <span className="font-mono">{item.used}{item.unit} / {item.limit}{item.unit}</span>
+                                </div>
+                                <div className="h-1.5 rounded-full bg-secondary overflow-hidden">
+                                    <div
+                                        className={clsx("h-full rounded-full", item.used >= item.limit ? "bg-amber-500" : "bg-primary")}
+                                        style={{ width: `${item.limit > 0 ? Math.min(100, (item.used / item.limit) * 100) : 100}%` }}
+                                    />
+                                </div>
+                            </div>
+                        ))}
+                    </div>
+                </div>
+            )}
+
             <div className="grid grid-cols-1 lg:grid-cols-3 gap-8">
                 {/* Recent Services */}
                 <div className="lg:col-span-2 space-y-6">
@@ -1,10 +1,10 @@
-import { useState, useEffect } from 'react';
+import { useState, useEffect, useRef } from 'react';
 import { useParams } from 'react-router-dom';
-import api from '../../lib/api';
+import api, { apiBase } from '../../lib/api';
 import {
     Folder, ChevronRight, Home, Upload,
     Plus, Trash2, Save, X, MoreVertical,
-    FileText, Code, Settings, CornerUpLeft, RefreshCw, Key
+    FileText, Code, Settings, CornerUpLeft, RefreshCw, Key, Pencil, Copy, Archive, PackageOpen, Link, Download, Search, Lock, Wrench, RotateCcw, History, ShieldOff
 } from 'lucide-react';
 import clsx from 'clsx';
 import { useAuth } from '../../context/AuthContext';
@@ -13,6 +13,43 @@ interface FileInfo {
     name: string;
     size: number;
     is_dir: boolean;
+    mode: string;
+    denied?: boolean; // Matches the egg's file denylist, so it can't be opened or changed
+}
+
+// Uploads are sent in chunks so a dropped connection only costs the current chunk
+const UPLOAD_CHUNK_SIZE = 8 * 1024 * 1024;
+const UPLOAD_RETRIES = 5;
+
+interface SearchResult {
+    path: string;
+    line?: number;
+    text?: string;
+}
+
+interface Pull {
+    id: string;
+    url: string;
+    path: string;
+    total: number;
+    written: number;
+    status: 'running' | 'completed' | 'failed' | 'cancelled';
+    error?: string;
+}
+
+interface TrashItem {
+    id: string;
+    path: string;
+    is_dir: boolean;
+    size: number;
+    deleted_at: string;
+}
+
+interface Revision {
+    id: string;
+    size: number;
+    author?: string;
+    created_at: string;
 }
 
 export default function FileManager({ service }: { service?: any }) {
@@ -25,6 +62,15 @@ export default function FileManager({ service }: { service?: any }) {
     const [showNewFolderModal, setShowNewFolderModal] = useState(false);
     const [showSFTPModal, setShowSFTPModal] = useState(false);
     const [newFolderName, setNewFolderName] = useState('');
+    const [pulls, setPulls] = useState<Pull[]>([]);
+    const [searchQuery, setSearchQuery] = useState('');
+    const [searchResults, setSearchResults] = useState<SearchResult[] | null>(null);
+    const [searching, setSearching] = useState(false);
+    const searchAbort = useRef<AbortController | null>(null);
+    const [upload, setUpload] = useState<{ name: string, sent: number, total: number } | null>(null);
+    const [trash, setTrash] = useState<TrashItem[] | null>(null);
+    const [revisions, setRevisions] = useState<Revision[] | null>(null);
+    const [revisionDiff, setRevisionDiff] = useState<string | null>(null);
 
     const fetchFiles = async () => {
         setLoading(true);
@@ -42,6 +88,30 @@ export default function FileManager({ service }: { service?: any }) {
         fetchFiles();
     }, [path]);
 
+    const fetchPulls = async () => {
+        try {
+            const res = await api.get(`/services/${uuid}/files/pull`);
+            setPulls(res.data);
+        } catch (err) {
+            console.error(err);
+        }
+    };
+
+    useEffect(() => {
+        fetchPulls();
+    }, []);
+
+    // Poll while a download is running and refresh the listing once it finishes
+    const pullsRunning = pulls.some(p => p.status === 'running');
+    useEffect(() => {
+        if (!pullsRunning) return;
+        const interval = setInterval(fetchPulls, 2000);
+        return () => {
+            clearInterval(interval);
+            fetchFiles();
+        };
+    }, [pullsRunning]);
+
     const navigateTo = (folderName: string) => {
         const newPath = path === '' ? folderName : `${path}/${folderName}`;
         setPath(newPath);
@@ -69,13 +139,53 @@ export default function FileManager({ service }: { service?: any }) {
         return <FileText className="text-muted" size={20} />;
     };
 
-    const openFile = async (name: string) => {
+    const openFile = (name: string) => openPath(path === '' ? name : `${path}/${name}`);
+
+    const openPath = async (fullPath: string) => {
         try {
-            const fullPath = path === '' ? name : `${path}/${name}`;
             const res = await api.get(`/services/${uuid}/files/content?path=${fullPath}`);
             setEditingFile({ name: fullPath, content: res.data });
-        } catch (err) {
-            alert("Failed to read file.");
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to read file.");
+        }
+    };
+
+    const closeEditor = () => {
+        setEditingFile(null);
+        setRevisions(null);
+        setRevisionDiff(null);
+    };
+
+    const fetchRevisions = async () => {
+        if (!editingFile) return;
+        try {
+            const res = await api.get(`/services/${uuid}/files/revisions?path=${encodeURIComponent(editingFile.name)}`);
+            setRevisions(res.data.revisions);
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to load history.");
+        }
+    };
+
+    const diffRevision = async (id: string) => {
+        if (!editingFile) return;
+        try {
+            const res = await api.get(`/services/${uuid}/files/revisions/diff?path=${encodeURIComponent(editingFile.name)}&from=${id}`);
+            setRevisionDiff(res.data.diff || 'No differences from the current file.');
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to compare.");
+        }
+    };
+
+    const restoreRevision = async (id: string) => {
+        if (!editingFile || !confirm("Replace the file with this version? The current content stays in the history.")) return;
+        try {
+            await api.post(`/services/${uuid}/files/revisions/restore`, { path: editingFile.name, id });
+            const res = await api.get(`/services/${uuid}/files/content?path=${encodeURIComponent(editingFile.name)}`);
+            setEditingFile({ name: editingFile.name, content: res.data });
+            setRevisionDiff(null);
+            fetchRevisions();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to restore.");
         }
     };
 
@@ -86,21 +196,159 @@ export default function FileManager({ service }: { service?: any }) {
                 path: editingFile.name,
                 content: editingFile.content
             });
-            setEditingFile(null);
+            closeEditor();
             fetchFiles();
         } catch (err) {
             alert("Failed to save file.");
         }
     };
 
-    const deleteItem = async (name: string) => {
-        if (!confirm(`Are you sure you want to delete ${name}?`)) return;
+    // Deletes go to the trash; shift-click deletes for good after the name is typed back
+    const deleteItem = async (name: string, permanent: boolean) => {
+        const fullPath = path === '' ? name : `${path}/${name}`;
+        if (permanent) {
+            if (prompt(`Permanently delete ${name}? This cannot be undone. Type the name to confirm:`) !== name) return;
+        } else if (!confirm(`Move ${name} to the trash?`)) {
+            return;
+        }
+        try {
+            const query = permanent ? `&permanent=true&confirm=${encodeURIComponent(fullPath)}` : '';
+            await api.delete(`/services/${uuid}/files?path=${encodeURIComponent(fullPath)}${query}`);
+            fetchFiles();
+            if (trash !== null) fetchTrash();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to delete.");
+        }
+    };
+
+    const fetchTrash = async () => {
+        try {
+            const res = await api.get(`/services/${uuid}/files/trash`);
+            setTrash(res.data.items);
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to load the trash.");
+        }
+    };
+
+    const restoreTrash = async (item: TrashItem) => {
+        try {
+            await api.post(`/services/${uuid}/files/trash/restore`, { id: item.id });
+        } catch (err: any) {
+            if (err.response?.status !== 409) {
+                alert(err.response?.data?.error || "Failed to restore.");
+                return;
+            }
+            // Something new took its place; ask where else to put it
+            const to = prompt(`${item.path} already exists. Restore to:`, `${item.path}.restored`);
+            if (!to) return;
+            try {
+                await api.post(`/services/${uuid}/files/trash/restore`, { id: item.id, to });
+            } catch (err: any) {
+                alert(err.response?.data?.error || "Failed to restore.");
+                return;
+            }
+        }
+        fetchTrash();
+        fetchFiles();
+    };
+
+    const purgeTrash = async (item?: TrashItem) => {
+        const what = item ? item.path : 'everything in the trash';
+        if (!confirm(`Permanently delete ${what}? This cannot be undone.`)) return;
+        try {
+            await api.delete(item ? `/services/${uuid}/files/trash/${item.id}` : `/services/${uuid}/files/trash`);
+            fetchTrash();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to purge.");
+        }
+    };
+
+    const renameItem = async (name: string) => {
+        const fullPath = path === '' ? name : `${path}/${name}`;
+        // A path with folders in it moves the item, e.g. "backups/world"
+        const target = prompt(`Rename or move ${name} to:`, fullPath);
+        if (!target || target === fullPath) return;
+        try {
+            await api.post(`/services/${uuid}/files/rename`, { files: [{ from: fullPath, to: target }] });
+            fetchFiles();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to rename.");
+        }
+    };
+
+    const copyItem = async (name: string) => {
         try {
             const fullPath = path === '' ? name : `${path}/${name}`;
-            await api.delete(`/services/${uuid}/files?path=${fullPath}`);
+            await api.post(`/services/${uuid}/files/copy`, { files: [{ from: fullPath }] });
+            fetchFiles();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to copy.");
+        }
+    };
+
+    const chmodItem = async (file: FileInfo) => {
+        const fullPath = path === '' ? file.name : `${path}/${file.name}`;
+        const mode = prompt(`Permissions for ${file.name} (octal, e.g. 644 or 755):`, file.mode);
+        if (!mode || mode === file.mode) return;
+        try {
+            await api.post(`/services/${uuid}/files/chmod`, { files: [{ path: fullPath, mode }] });
+            fetchFiles();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to change permissions.");
+        }
+    };
+
+    const fixPermissions = async () => {
+        if (!confirm("Reset ownership and permissions of every file in this folder so the server can write to them?")) return;
+        try {
+            const res = await api.post(`/services/${uuid}/files/fix-permissions`, { path });
+            if (res.data.failed > 0) {
+                alert(`Fixed ${res.data.entries - res.data.failed} of ${res.data.entries} files.`);
+            }
             fetchFiles();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to fix permissions.");
+        }
+    };
+
+    const pullFromUrl = async () => {
+        const url = prompt("Download a file from URL into this folder:");
+        if (!url) return;
+        try {
+            await api.post(`/services/${uuid}/files/pull`, { url, root: path });
+            fetchPulls();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to start download.");
+        }
+    };
+
+    const cancelPull = async (id: string) => {
+        try {
+            await api.delete(`/services/${uuid}/files/pull/${id}`);
+            fetchPulls();
         } catch (err) {
-            alert("Failed to delete.");
+            alert("Failed to cancel download.");
+        }
+    };
+
+    const isArchive = (name: string) => /\.(zip|tar|tar\.gz|tgz|tar\.xz|txz)$/i.test(name);
+
+    const compressItem = async (name: string) => {
+        try {
+            await api.post(`/services/${uuid}/files/compress`, { root: path, files: [name], format: 'zip' });
+            fetchFiles();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to compress.");
+        }
+    };
+
+    const decompressItem = async (name: string) => {
+        try {
+            const fullPath = path === '' ? name : `${path}/${name}`;
+            await api.post(`/services/${uuid}/files/decompress`, { file: fullPath, root: path });
+            fetchFiles();
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to decompress.");
         }
     };
 
@@ -116,23 +364,102 @@ export default function FileManager({ service }: { service?: any }) {
         }
     };
 
+    // Results are streamed as JSON lines, so they show up while the node is still searching
+    const runSearch = async () => {
+        searchAbort.current?.abort();
+        if (!searchQuery.trim()) {
+            setSearchResults(null);
+            return;
+        }
+        const controller = new AbortController();
+        searchAbort.current = controller;
+        setSearchResults([]);
+        setSearching(true);
+        try {
+            const params = new URLSearchParams({ root: path, query: searchQuery });
+            const res = await fetch(`${apiBase}/services/${uuid}/files/search?${params}`, {
+                headers: { Authorization: `Bearer ${localStorage.getItem('token')}` },
+                signal: controller.signal,
+            });
+            if (!res.ok || !res.body) {
+                const data = await res.json().catch(() => ({}));
+                throw new Error(data.error || 'Search failed');
+            }
+            const reader = res.body.getReader();
+            const decoder = new TextDecoder();
+            let buffered = '';
+            for (; ;) {
+                const { done, value } = await reader.read();
+                if (done) break;
+                buffered += decoder.decode(value, { stream: true });
+                const lines = buffered.split('\n');
+                buffered = lines.pop() || '';
+                const found = lines.filter(l => l.trim()).map(l => JSON.parse(l)).filter(r => !r.done);
+                if (found.length) setSearchResults(prev => [...(prev || []), ...found]);
+            }
+        } catch (err: any) {
+            if (err.name !== 'AbortError') alert(err.message);
+        } finally {
+            if (searchAbort.current === controller) setSearching(false);
+        }
+    };
+
+    const clearSearch = () => {
+        searchAbort.current?.abort();
+        setSearching(false);
+        setSearchQuery('');
+        setSearchResults(null);
+    };
+
     const handleUpload = async (e: React.ChangeEvent<HTMLInputElement>) => {
         const file = e.target.files?.[0];
+        e.target.value = '';
         if (!file) return;
 
-        const formData = new FormData();
-        formData.append('file', file);
-
-        setLoading(true);
+        const fullPath = path === '' ? file.name : `${path}/${file.name}`;
+        setUpload({ name: file.name, sent: 0, total: file.size });
         try {
-            await api.post(`/services/${uuid}/files/upload?path=${path}`, formData, {
-                headers: { 'Content-Type': 'multipart/form-data' }
-            });
+            const res = await api.post(`/services/${uuid}/files/uploads`, { path: fullPath, size: file.size });
+            const id = res.data.id;
+            let offset = 0;
+            let failures = 0;
+            while (offset < file.size) {
+                const chunk = file.slice(offset, offset + UPLOAD_CHUNK_SIZE);
+                try {
+                    const chunkRes = await api.patch(`/services/${uuid}/files/uploads/${id}`, chunk, {
+                        headers: { 'Content-Type': 'application/offset+octet-stream', 'Upload-Offset': String(offset) }
+                    });
+                    offset = chunkRes.data.offset;
+                    failures = 0;
+                } catch (err: any) {
+                    if (err.response?.status === 507 || ++failures > UPLOAD_RETRIES) throw err;
+                    // Ask the node how much arrived and carry on from there
+                    await new Promise(resolve => setTimeout(resolve, 1000 * failures));
+                    const status = await api.get(`/services/${uuid}/files/uploads/${id}`);
+                    offset = status.data.offset;
+                }
+                setUpload({ name: file.name, sent: offset, total: file.size });
+            }
             fetchFiles();
-        } catch (err) {
-            alert("Failed to upload file.");
+        } catch (err: any) {
+            alert(err.response?.data?.error || "Failed to upload file.");
         } finally {
-            setLoading(false);
+            setUpload(null);
+        }
+    };
+
+    const downloadItem = async (name: string) => {
+        try {
+            const fullPath = path === '' ? name : `${path}/${name}`;
+            const res = await api.get(`/services/${uuid}/files/download?path=${encodeURIComponent(fullPath)}`, { responseType: 'blob' });
+            const url = URL.createObjectURL(res.data);
+            const link = document.createElement('a');
+            link.href = url;
+            link.download = name;
+            link.click();
+            URL.revokeObjectURL(url);
+        } catch (err) {
+            alert("Failed to download file.");
         }
     };
 
@@ -174,13 +501,144 @@ export default function FileManager({ service }: { service?: any }) {
                     >
                         <Plus size={18} /> New Folder
                     </button>
+                    <button
+                        onClick={() => trash === null ? fetchTrash() : setTrash(null)}
+                        className="bg-secondary text-foreground border border-border/50 px-4 py-2 rounded-xl text-sm font-bold flex items-center gap-2 hover:bg-secondary/80 transition-all"
+                    >
+                        <Trash2 size={18} /> Trash
+                    </button>
+                    <button
+                        onClick={fixPermissions}
+                        className="bg-secondary text-foreground border border-border/50 px-4 py-2 rounded-xl text-sm font-bold flex items-center gap-2 hover:bg-secondary/80 transition-all"
+                        title="Fix Permissions"
+                    >
+                        <Wrench size={18} />
+                    </button>
+                    <button
+                        onClick={pullFromUrl}
+                        className="bg-secondary text-foreground border border-border/50 px-4 py-2 rounded-xl text-sm font-bold flex items-center gap-2 hover:bg-secondary/80 transition-all"
+                    >
+                        <Link size={18} /> From URL
+                    </button>
                     <label className="bg-primary text-white shadow-lg shadow-primary/20 px-4 py-2 rounded-xl text-sm font-bold flex items-center gap-2 hover:brightness-110 transition-all cursor-pointer">
                         <Upload size={18} /> Upload
-                        <input type="file" className="hidden" onChange={handleUpload} />
+                        <input type="file" className="hidden" onChange={handleUpload} disabled={!!upload} />
                     </label>
                 </div>
             </div>
 
+            <div className="flex items-center gap-3">
+                <div className="relative flex-1">
+                    <Search size={16} className="absolute left-3 top-1/2 -translate-y-1/2 text-muted" />
+                    <input
+                        className="input-field !pl-10"
+                        placeholder="Search file contents in this folder..."
+                        value={searchQuery}
+                        onChange={e => setSearchQuery(e.target.value)}
+                        onKeyDown={e => e.key === 'Enter' && runSearch()}
+                    />
+                </div>
+                {searchResults !== null && (
+                    <button onClick={clearSearch} className="p-2 hover:bg-secondary rounded-xl text-muted transition-colors">
+                        <X size={18} />
+                    </button>
+                )}
+            </div>
+
+            {searchResults !== null && (
+                <div className="panel-card space-y-1 max-h-80 overflow-y-auto">
+                    <span className="text-[10px] font-bold text-muted uppercase tracking-[0.2em]">
+                        {searching ? 'Searching...' : `${searchResults.length} matches`}
+                    </span>
+                    {searchResults.map((result, i) => (
+                        <button
+                            key={i}
+                            onClick={() => openPath(result.path)}
+                            className="w-full text-left px-3 py-2 rounded-lg hover:bg-secondary/50 transition-colors"
+                        >
+                            <span className="text-xs font-bold">{result.path}{result.line ? `:${result.line}` : ''}</span>
+                            {result.text && <p className="text-xs text-muted font-mono truncate">{result.text}</p>}
+                        </button>
+                    ))}
+                </div>
+            )}
+
+            {trash !== null && (
+                <div className="panel-card space-y-1 max-h-80 overflow-y-auto">
+                    <div className="flex items-center justify-between">
+                        <span className="text-[10px] font-bold text-muted uppercase tracking-[0.2em]">
+                            Trash: {trash.length} items, {formatSize(trash.reduce((sum, item) => sum + item.size, 0))}
+                        </span>
+                        {trash.length > 0 && (
+                            <button onClick={() => purgeTrash()} className="text-[10px] font-bold uppercase tracking-widest text-red-500 hover:underline">
+                                Empty Trash
+                            </button>
+                        )}
+                    </div>
+                    {trash.map(item => (
+                        <div key={item.id} className="flex items-center justify-between gap-4 px-3 py-2 rounded-lg hover:bg-secondary/50 transition-colors">
+                            <div className="min-w-0">
+                                <span className="text-xs font-bold truncate block">{item.path}{item.is_dir ? '/' : ''}</span>
+                                <span className="text-[10px] text-muted">{formatSize(item.size)} · deleted {new Date(item.deleted_at).toLocaleString()}</span>
+                            </div>
+                            <div className="flex items-center gap-1 shrink-0">
+                                <button onClick={() => restoreTrash(item)} className="p-1.5 hover:bg-secondary rounded-lg text-muted transition-colors" title="Restore">
+                                    <RotateCcw size={14} />
+                                </button>
+                                <button onClick={() => purgeTrash(item)} className="p-1.5 hover:bg-red-500/10 hover:text-red-500 rounded-lg text-muted transition-colors" title="Delete permanently">
+                                    <X size={14} />
+                                </button>
+                            </div>
+                        </div>
+                    ))}
+                </div>
+            )}
+
+            {upload && (
+                <div className="panel-card space-y-1.5">
+                    <div className="flex items-center justify-between gap-4 text-xs">
+                        <span className="font-bold truncate">Uploading {upload.name}</span>
+                        <span className="font-bold uppercase tracking-widest text-[10px] text-muted">
+                            {formatSize(upload.sent)} / {formatSize(upload.total)}
+                        </span>
+                    </div>
+                    <div className="h-1 bg-secondary rounded-full overflow-hidden">
+                        <div className="h-full bg-primary transition-all" style={{ width: `${upload.total > 0 ? (upload.sent / upload.total) * 100 : 100}%` }} />
+                    </div>
+                </div>
+            )}
+
+            {pulls.length > 0 && (
+                <div className="panel-card space-y-3">
+                    {pulls.map(pull => (
+                        <div key={pull.id} className="space-y-1.5">
+                            <div className="flex items-center justify-between gap-4 text-xs">
+                                <span className="font-bold truncate">{pull.path}</span>
+                                <div className="flex items-center gap-3 shrink-0">
+                                    <span className={clsx(
+                                        "font-bold uppercase tracking-widest text-[10px]",
+                                        pull.status === 'failed' ? "text-red-500" : pull.status === 'completed' ? "text-emerald-500" : "text-muted"
+                                    )}>
+                                        {pull.status === 'running' ? formatSize(pull.written) + (pull.total > 0 ? ` / ${formatSize(pull.total)}` : '') : pull.status}
+                                    </span>
+                                    {pull.status === 'running' && (
+                                        <button onClick={() => cancelPull(pull.id)} className="p-1 hover:bg-red-500/10 hover:text-red-500 rounded-lg text-muted transition-colors">
+                                            <X size={14} />
+                                        </button>
+                                    )}
+                                </div>
+                            </div>
+                            {pull.status === 'running' && pull.total > 0 && (
+                                <div className="h-1 bg-secondary rounded-full overflow-hidden">
+                                    <div className="h-full bg-primary transition-all" style={{ width: `${Math.min(100, (pull.written / pull.total) * 100)}%` }} />
+                                </div>
+                            )}
+                            {pull.error && <p className="text-[10px] text-red-500/80">{pull.error}</p>}
+                        </div>
+                    ))}
+                </div>
+            )}
+
             <div className="panel-card !p-0 border-border/40 overflow-hidden min-h-[500px] flex flex-col">
                 <div className="bg-secondary/30 border-b border-border/50 px-6 py-4 flex items-center justify-between">
                     <span className="text-[10px] font-bold text-muted uppercase tracking-[0.2em]">Listing {files.length} items</span>
@@ -223,8 +681,8 @@ export default function FileManager({ service }: { service?: any }) {
                                 {files.map(file => (
                                     <tr
                                         key={file.name}
-                                        onClick={() => file.is_dir ? navigateTo(file.name) : openFile(file.name)}
-                                        className="hover:bg-primary/[0.02] cursor-pointer group transition-colors"
+                                        onClick={() => file.denied ? undefined : file.is_dir ? navigateTo(file.name) : openFile(file.name)}
+                                        className={`group transition-colors ${file.denied ? 'opacity-60 cursor-not-allowed' : 'hover:bg-primary/[0.02] cursor-pointer'}`}
                                     >
                                         <td className="px-6 py-4">
                                             <div className="flex items-center gap-4">
@@ -236,10 +694,63 @@ export default function FileManager({ service }: { service?: any }) {
                                             <span className="text-xs font-medium text-muted">{file.is_dir ? '--' : formatSize(file.size)}</span>
                                         </td>
                                         <td className="px-6 py-4 text-right">
+                                            {file.denied ? (
+                                                <span className="inline-flex items-center gap-1.5 text-[10px] font-bold uppercase tracking-widest text-muted" title="This file is managed by your host">
+                                                    <ShieldOff size={14} /> Restricted
+                                                </span>
+                                            ) : (
                                             <div className="flex items-center justify-end gap-2 opacity-0 group-hover:opacity-100 transition-all">
+                                                {!file.is_dir && (
+                                                    <button
+                                                        onClick={(e) => { e.stopPropagation(); downloadItem(file.name); }}
+                                                        className="p-2 hover:bg-secondary rounded-lg text-muted transition-colors"
+                                                        title="Download"
+                                                    >
+                                                        <Download size={16} />
+                                                    </button>
+                                                )}
+                                                <button
+                                                    onClick={(e) => { e.stopPropagation(); renameItem(file.name); }}
+                                                    className="p-2 hover:bg-secondary rounded-lg text-muted transition-colors"
+                                                    title="Rename / Move"
+                                                >
+                                                    <Pencil size={16} />
+                                                </button>
+                                                <button
+                                                    onClick={(e) => { e.stopPropagation(); copyItem(file.name); }}
+                                                    className="p-2 hover:bg-secondary rounded-lg text-muted transition-colors"
+                                                    title="Copy"
+                                                >
+                                                    <Copy size={16} />
+                                                </button>
+                                                <button
+                                                    onClick={(e) => { e.stopPropagation(); chmodItem(file); }}
+                                                    className="p-2 hover:bg-secondary rounded-lg text-muted transition-colors"
+                                                    title={`Permissions (${file.mode})`}
+                                                >
+                                                    <Lock size={16} />
+                                                </button>
+                                                {!file.is_dir && isArchive(file.name) ? (
+                                                    <button
+                                                        onClick={(e) => { e.stopPropagation(); decompressItem(file.name); }}
+                                                        className="p-2 hover:bg-secondary rounded-lg text-muted transition-colors"
+                                                        title="Extract"
+                                                    >
+                                                        <PackageOpen size={16} />
+                                                    </button>
+                                                ) : (
+                                                    <button
+                                                        onClick={(e) => { e.stopPropagation(); compressItem(file.name); }}
+                                                        className="p-2 hover:bg-secondary rounded-lg text-muted transition-colors"
+                                                        title="Compress"
+                                                    >
+                                                        <Archive size={16} />
+                                                    </button>
+                                                )}
                                                 <button
-                                                    onClick={(e) => { e.stopPropagation(); deleteItem(file.name); }}
+                                                    onClick={(e) => { e.stopPropagation(); deleteItem(file.name, e.shiftKey); }}
                                                     className="p-2 hover:bg-red-500/10 hover:text-red-500 rounded-lg text-muted transition-colors"
+                                                    title="Move to trash (shift-click to delete permanently)"
                                                 >
                                                     <Trash2 size={16} />
                                                 </button>
@@ -247,6 +758,7 @@ export default function FileManager({ service }: { service?: any }) {
                                                     <MoreVertical size={16} />
                                                 </button>
                                             </div>
+                                            )}
                                         </td>
                                     </tr>
                                 ))}
@@ -278,7 +790,17 @@ export default function FileManager({ service }: { service?: any }) {
                             </div>
                             <div className="flex items-center gap-3">
                                 <button
-                                    onClick={() => setEditingFile(null)}
+                                    onClick={() => {
+                                        if (revisions === null) return fetchRevisions();
+                                        setRevisions(null);
+                                        setRevisionDiff(null);
+                                    }}
+                                    className="px-4 py-2 rounded-xl text-sm font-bold text-muted hover:bg-secondary transition-all flex items-center gap-2"
+                                >
+                                    <History size={18} /> History
+                                </button>
+                                <button
+                                    onClick={closeEditor}
                                     className="px-4 py-2 rounded-xl text-sm font-bold text-muted hover:bg-secondary transition-all"
                                 >
                                     Cancel
@@ -291,13 +813,47 @@ export default function FileManager({ service }: { service?: any }) {
                                 </button>
                             </div>
                         </div>
-                        <div className="flex-1 p-0 bg-[#0d1117]">
-                            <textarea
-                                className="w-full h-full bg-transparent text-slate-300 font-mono text-sm p-8 outline-none resize-none selection:bg-primary/30"
-                                value={editingFile.content}
-                                onChange={(e) => setEditingFile({ ...editingFile, content: e.target.value })}
-                                spellCheck={false}
-                            />
+                        <div className="flex-1 flex min-h-0">
+                            <div className="flex-1 p-0 bg-[#0d1117]">
+                                {revisionDiff !== null ? (
+                                    <pre className="w-full h-full overflow-auto text-slate-300 font-mono text-sm p-8">
+                                        {revisionDiff.split('\n').map((line, i) => (
+                                            <div key={i} className={clsx(
+                                                line.startsWith('+') && !line.startsWith('+++') && "text-emerald-400",
+                                                line.startsWith('-') && !line.startsWith('---') && "text-red-400",
+                                                line.startsWith('@@') && "text-blue-400"
+                                            )}>{line || ' '}</div>
+                                        ))}
+                                    </pre>
+                                ) : (
+                                    <textarea
+                                        className="w-full h-full bg-transparent text-slate-300 font-mono text-sm p-8 outline-none resize-none selection:bg-primary/30"
+                                        value={editingFile.content}
+                                        onChange={(e) => setEditingFile({ ...editingFile, content: e.target.value })}
+                                        spellCheck={false}
+                                    />
+                                )}
+                            </div>
+                            {revisions !== null && (
+                                <div className="w-72 border-l border-border/50 overflow-y-auto p-3 space-y-1">
+                                    {revisions.length === 0 && <p className="text-xs text-muted p-3">No saved versions yet.</p>}
+                                    {revisionDiff !== null && (
+                                        <button onClick={() => setRevisionDiff(null)} className="w-full text-left px-3 py-2 rounded-lg text-xs font-bold text-primary hover:bg-secondary/50">
+                                            Back to editor
+                                        </button>
+                                    )}
+                                    {revisions.map(rev => (
+                                        <div key={rev.id} className="px-3 py-2 rounded-lg hover:bg-secondary/50 transition-colors">
+                                            <span className="text-xs font-bold block">{new Date(rev.created_at).toLocaleString()}</span>
+                                            <span className="text-[10px] text-muted">{rev.author || 'original'} · {formatSize(rev.size)}</span>
+                                            <div className="flex gap-3 mt-1">
+                                                <button onClick={() => diffRevision(rev.id)} className="text-[10px] font-bold uppercase tracking-widest text-muted hover:text-foreground">Diff</button>
+                                                <button onClick={() => restoreRevision(rev.id)} className="text-[10px] font-bold uppercase tracking-widest text-primary hover:underline">Restore</button>
+                                            </div>
+                                        </div>
+                                    ))}
+                                </div>
+                            )}
                         </div>
                     </div>
                 </div>
@@ -364,6 +920,13 @@ export default function FileManager({ service }: { service?: any }) {
                                         {service.node?.sftp_port || '2022'}
                                     </div>
                                 </div>
+                                <div className="space-y-1.5">
+                                    <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">Host Key Fingerprint</label>
+                                    <div className="p-3 bg-secondary/50 border border-border rounded-xl font-mono text-xs break-all">
+                                        {service.node?.sftp_fingerprint || 'Not reported yet'}
+                                    </div>
+                                    <p className="text-[10px] text-muted pl-1">Check this matches what your client shows the first time you connect.</p>
+                                </div>
                                 <div className="space-y-1.5">
                                     <label className="text-[10px] font-bold text-muted uppercase tracking-widest pl-1">Username</label>
                                     <div className="p-3 bg-secondary/50 border border-border rounded-xl font-mono text-xs flex justify-between items-center group">
@@ -1,13 +1,14 @@
 import { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import api from '../../lib/api';
-import { Layers, Activity, Globe, HardDrive, Cpu, ExternalLink } from 'lucide-react';
+import { Layers, Activity, Globe, HardDrive, Cpu, ExternalLink, Plus } from 'lucide-react';
 import clsx from 'clsx';
 
 export default function MyServices() {
     const navigate = useNavigate();
     const [services, setServices] = useState<any[]>([]);
     const [loading, setLoading] = useState(true);
+    const [canCreate, setCanCreate] = useState(false);
 
     useEffect(() => {
         const fetchServices = async () => {
@@ -21,6 +22,9 @@ export default function MyServices() {
             }
         };
         fetchServices();
+        api.get('/services/create-options')
+            .then(res => setCanCreate(res.data.enabled && res.data.used.services < res.data.quota.services))
+            .catch(() => setCanCreate(false));
         const interval = setInterval(fetchServices, 10000);
         return () => clearInterval(interval);
     }, []);
@@ -32,6 +36,14 @@ export default function MyServices() {
                     <h1 className="text-3xl font-bold tracking-tight mb-2">My Services</h1>
                     <p className="text-muted">Monitoring {services.length} active service instances across the Atlas cloud.</p>
                 </div>
+                {canCreate && (
+                    <button
+                        onClick={() => navigate('/services/create')}
+                        className="flex items-center gap-2 bg-primary text-white px-6 py-3 rounded-xl font-bold text-sm hover:scale-105 transition-all shadow-lg shadow-primary/20"
+                    >
+                        <Plus size={18} /> New Server
+                    </button>
+                )}
             </div>
 
             <div className="grid grid-cols-1 md:grid-cols-2 lg:grid-cols-3 gap-8 pb-10">
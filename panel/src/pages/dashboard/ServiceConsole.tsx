@@ -1,18 +1,19 @@
 import { useState, useEffect, useRef } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
-import api from '../../lib/api';
+import api, { apiBase } from '../../lib/api';
 import {
     Play, Square, RefreshCcw, Skull,
     Terminal, Activity,
     ChevronRight, ArrowLeft, Settings, FolderClosed, Rocket,
-    Globe, AlertTriangle, Layers, Users, Clock, ArrowDown, ArrowUp
+    Globe, AlertTriangle, Layers, Users, Clock, ArrowDown, ArrowUp, Database
 } from 'lucide-react';
 import clsx from 'clsx';
 import FileManager from './FileManager';
 import ServiceUsersTab from './ServiceUsersTab';
 import ServiceActivityTab from './ServiceActivityTab';
+import ServiceDatabasesTab from './ServiceDatabasesTab';
 
-type Tab = 'console' | 'files' | 'startup' | 'settings' | 'users' | 'activity';
+type Tab = 'console' | 'files' | 'startup' | 'settings' | 'users' | 'databases' | 'activity';
 
 interface LogLine {
     time: string;
@@ -71,22 +72,13 @@ export default function ServiceConsolePage() {
         const connect = () => {
             if (isStopped) return;
 
-            const isLocal = ['localhost', '127.0.0.1', 'atlas_daemon'].includes(service.node.address);
-            const useProxy = window.location.protocol === 'https:';
-
-            let wsUrl = '';
-            if (useProxy && (isLocal || service.node.address === window.location.hostname)) {
-                // Remove the port to use the Nginx proxy on port 443
-                wsUrl = `wss://${window.location.hostname}/api/servers/${uuid}/console`;
-            } else {
-                const nodeAddr = isLocal
-                    ? `${window.location.hostname}:${service.node.port || '8081'}`
-                    : `${service.node.address}:${service.node.port || '8081'}`;
-                const wsProtocol = window.location.protocol === 'https:' ? 'wss' : 'ws';
-                wsUrl = `${wsProtocol}://${nodeAddr}/api/servers/${uuid}/console`;
-            }
+            // The console is proxied through Core, which signs the request to the node
+            const consoleUrl = new URL(`${apiBase}/services/${uuid}/console`, window.location.href);
+            consoleUrl.protocol = consoleUrl.protocol === 'https:' ? 'wss:' : 'ws:';
+            consoleUrl.searchParams.set('token', localStorage.getItem('token') || '');
+            const wsUrl = consoleUrl.toString();
 
-            console.log(`[Atlas] Connecting to console: ${wsUrl}`);
+            console.log(`[Atlas] Connecting to console for ${uuid}`);
             const ws = new WebSocket(wsUrl);
             wsRef.current = ws;
 
@@ -124,7 +116,7 @@ export default function ServiceConsolePage() {
             };
 
             ws.onerror = (err) => {
-                console.error("[Atlas] Console WebSocket Error. Check if the Node address is reachable and if SSL matches the Panel protocol.", err);
+                console.error("[Atlas] Console WebSocket Error. Check that Core can reach the node.", err);
                 ws.close();
             };
         };
@@ -149,25 +141,10 @@ export default function ServiceConsolePage() {
         }
 
         const fetchStats = async () => {
-            const isLocal = ['localhost', '127.0.0.1', 'atlas_daemon'].includes(service.node?.address);
-            const useProxy = window.location.protocol === 'https:';
-
-            let statsUrl = '';
-            if (useProxy && (isLocal || service.node?.address === window.location.hostname)) {
-                // Use the relative path to hit the Nginx proxy
-                statsUrl = `/api/servers/${uuid}/stats`;
-            } else {
-                const httpProtocol = window.location.protocol === 'https:' ? 'https' : 'http';
-                const nodeAddr = isLocal
-                    ? `${httpProtocol}://${window.location.hostname}:${service.node?.port || '8081'}`
-                    : `${httpProtocol}://${service.node?.address}:${service.node?.port || '8081'}`;
-                statsUrl = `${nodeAddr}/api/servers/${uuid}/stats`;
-            }
-
             try {
-                const res = await fetch(statsUrl);
-                if (res.ok) {
-                    const data = await res.json();
+                const res = await api.get(`/services/${uuid}/stats`);
+                if (res.status === 200) {
+                    const data = res.data;
                     setStats({
                         cpu: data.cpu,
                         memory: data.memory,
@@ -454,6 +431,7 @@ export default function ServiceConsolePage() {
                     { id: 'files', label: 'File Manager', icon: FolderClosed, show: isOwner || permissions?.can_manage_files },
                     { id: 'startup', label: 'Startup', icon: Rocket, show: isOwner || permissions?.can_edit_startup },
                     { id: 'users', label: 'Sub-Users', icon: Users, show: isOwner },
+                    { id: 'databases', label: 'Databases', icon: Database, show: isOwner && service.database_limit > 0 },
                     { id: 'activity', label: 'Activity', icon: Clock, show: isOwner },
                     { id: 'settings', label: 'Settings', icon: Settings, show: isOwner },
                 ].filter(tab => tab.show).map(tab => (
@@ -576,6 +554,10 @@ export default function ServiceConsolePage() {
                         <ServiceUsersTab />
                     )}
 
+                    {activeTab === 'databases' && (
+                        <ServiceDatabasesTab />
+                    )}
+
                     {activeTab === 'activity' && (
                         <ServiceActivityTab />
                     )}
@@ -648,6 +630,12 @@ export default function ServiceConsolePage() {
                                 <span className="text-[10px] text-muted font-bold uppercase">Node</span>
                                 <span className="text-xs font-bold uppercase">NODE-{service.node?.id}</span>
                             </div>
+                            {service.node?.location && (
+                                <div className="flex justify-between">
+                                    <span className="text-[10px] text-muted font-bold uppercase">Location</span>
+                                    <span className="text-xs font-bold">{service.node.location.long || service.node.location.short}</span>
+                                </div>
+                            )}
                             <div className="flex justify-between">
                                 <span className="text-[10px] text-muted font-bold uppercase">Public IP</span>
                                 <span className="text-xs font-bold">{service.node?.address || 'N/A'}</span>
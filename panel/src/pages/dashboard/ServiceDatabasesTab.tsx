@@ -0,0 +1,155 @@
+import { useState, useEffect } from 'react';
+import { useParams } from 'react-router-dom';
+import api from '../../lib/api';
+import { Database, Plus, Trash2, RefreshCw, Copy, Eye, EyeOff } from 'lucide-react';
+
+interface ServiceDatabase {
+    id: number;
+    name: string;
+    username: string;
+    password: string;
+    remote: string;
+    type: string;
+    host: string;
+    port: number;
+    created_at: string;
+}
+
+export default function ServiceDatabasesTab() {
+    const { uuid } = useParams();
+    const [databases, setDatabases] = useState<ServiceDatabase[]>([]);
+    const [limit, setLimit] = useState(0);
+    const [loading, setLoading] = useState(true);
+    const [name, setName] = useState('');
+    const [remote, setRemote] = useState('%');
+    const [creating, setCreating] = useState(false);
+    const [shown, setShown] = useState<number | null>(null);
+
+    const fetchDatabases = async () => {
+        try {
+            const res = await api.get(`/services/${uuid}/databases`);
+            setDatabases(res.data.databases);
+            setLimit(res.data.limit);
+        } catch (err) {
+            console.error('Failed to fetch databases', err);
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    useEffect(() => {
+        fetchDatabases();
+    }, [uuid]);
+
+    const handleCreate = async () => {
+        if (!name) return;
+        setCreating(true);
+        try {
+            await api.post(`/services/${uuid}/databases`, { name, remote });
+            setName('');
+            setRemote('%');
+            fetchDatabases();
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Failed to create database');
+        } finally {
+            setCreating(false);
+        }
+    };
+
+    const handleRotate = async (db: ServiceDatabase) => {
+        if (!confirm(`Generate a new password for ${db.username}? Anything using the old one will stop working.`)) return;
+        try {
+            await api.post(`/services/${uuid}/databases/${db.id}/rotate-password`);
+            setShown(db.id);
+            fetchDatabases();
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Failed to rotate password');
+        }
+    };
+
+    const handleDelete = async (db: ServiceDatabase) => {
+        if (prompt(`This permanently drops ${db.name} and everything in it. Type the database name to confirm:`) !== db.name) return;
+        try {
+            await api.delete(`/services/${uuid}/databases/${db.id}`);
+            fetchDatabases();
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Failed to delete database');
+        }
+    };
+
+    const connectionString = (db: ServiceDatabase) =>
+        `${db.type === 'postgres' ? 'postgresql' : 'mysql'}://${db.username}:${db.password}@${db.host}:${db.port}/${db.name}`;
+
+    if (loading) return <div className="p-12 text-center text-muted animate-pulse">Loading databases...</div>;
+
+    return (
+        <div className="space-y-8">
+            <div className="panel-card p-6">
+                <div className="flex items-center justify-between mb-6">
+                    <div className="flex items-center gap-3">
+                        <Database className="text-primary" size={22} />
+                        <h2 className="text-lg font-bold tracking-tight">Databases</h2>
+                    </div>
+                    <span className="text-xs font-bold text-muted uppercase tracking-widest">{databases.length} / {limit} used</span>
+                </div>
+
+                {limit === 0 ? (
+                    <p className="text-sm text-muted">Databases are not enabled for this service. Ask an administrator to raise its database limit.</p>
+                ) : databases.length < limit && (
+                    <div className="flex flex-col md:flex-row gap-3">
+                        <input value={name} onChange={e => setName(e.target.value)} className="input-field flex-1" placeholder="Database name, e.g. luckperms" />
+                        <input value={remote} onChange={e => setRemote(e.target.value)} className="input-field md:w-48 font-mono" placeholder="Connections from (%)" title="Hosts allowed to connect, % for any (MySQL only)" />
+                        <button
+                            onClick={handleCreate}
+                            disabled={creating || !name}
+                            className="flex items-center justify-center gap-2 px-5 py-2 bg-primary text-white rounded-xl font-bold text-sm hover:bg-primary/90 transition-all disabled:opacity-50"
+                        >
+                            <Plus size={16} /> {creating ? 'Creating...' : 'Create'}
+                        </button>
+                    </div>
+                )}
+            </div>
+
+            {databases.map(db => (
+                <div key={db.id} className="panel-card p-6 space-y-4">
+                    <div className="flex items-center justify-between">
+                        <div>
+                            <h3 className="font-bold font-mono">{db.name}</h3>
+                            <p className="text-xs text-muted">{db.type === 'postgres' ? 'PostgreSQL' : 'MySQL'} · connections from {db.remote}</p>
+                        </div>
+                        <div className="flex items-center gap-2">
+                            <button onClick={() => handleRotate(db)} className="p-2 hover:bg-secondary rounded-lg text-muted transition-colors" title="Rotate password">
+                                <RefreshCw size={16} />
+                            </button>
+                            <button onClick={() => handleDelete(db)} className="p-2 hover:bg-red-500/10 hover:text-red-500 rounded-lg text-muted transition-colors" title="Delete database">
+                                <Trash2 size={16} />
+                            </button>
+                        </div>
+                    </div>
+                    <div className="grid grid-cols-1 md:grid-cols-3 gap-4 text-xs">
+                        <div>
+                            <span className="block text-[10px] font-bold text-muted uppercase tracking-widest mb-1">Endpoint</span>
+                            <span className="font-mono">{db.host}:{db.port}</span>
+                        </div>
+                        <div>
+                            <span className="block text-[10px] font-bold text-muted uppercase tracking-widest mb-1">Username</span>
+                            <span className="font-mono">{db.username}</span>
+                        </div>
+                        <div>
+                            <span className="block text-[10px] font-bold text-muted uppercase tracking-widest mb-1">Password</span>
+                            <span className="flex items-center gap-2 font-mono">
+                                {shown === db.id ? db.password : '••••••••••••'}
+                                <button onClick={() => setShown(shown === db.id ? null : db.id)} className="text-muted hover:text-foreground">
+                                    {shown === db.id ? <EyeOff size={14} /> : <Eye size={14} />}
+                                </button>
+                                <button onClick={() => navigator.clipboard.writeText(connectionString(db))} className="text-muted hover:text-foreground" title="Copy connection URL">
+                                    <Copy size={14} />
+                                </button>
+                            </span>
+                        </div>
+                    </div>
+                </div>
+            ))}
+        </div>
+    );
+}
@@ -41,6 +41,7 @@ export default function SetupPage() {
             // Auto login if token provided
             if (res.data.token) {
                 localStorage.setItem('token', res.data.token);
+                localStorage.setItem('refresh_token', res.data.refresh_token);
                 // Refreshing context is handled by AuthContext if we redirect to /
                 window.location.href = '/';
             } else {